@@ -0,0 +1,108 @@
+package sfu
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// number of black frames sent after the video is muted or paused, after that the video packets are dropped
+	blankFrameBurst = 5
+	blankFrameMTU   = 1200
+)
+
+// blankFrames replaces the first frames of a muted or paused video with black keyframes,
+// so the receiver shows a black picture instead of freezing on the last frame.
+// The black frames use the timestamps of the live frames they replace to keep the timing of the stream.
+type blankFrames struct {
+	mu        sync.Mutex
+	mimeType  string
+	payloader rtp.Payloader
+	active    bool
+	sent      int
+	lastTS    uint32
+}
+
+func newBlankFrames(codec webrtc.RTPCodecCapability) *blankFrames {
+	payloader, _ := payloaderForCodec(codec)
+
+	return &blankFrames{
+		mu:        sync.Mutex{},
+		mimeType:  codec.MimeType,
+		payloader: payloader,
+	}
+}
+
+// Next returns the black frame packets that replace the live packet, the sequence numbers must be set by the caller.
+// Returns nil if the live packet belongs to a frame that is already replaced or the burst is already sent,
+// in that case the live packet must be dropped.
+func (b *blankFrames) Next(p *rtp.Packet) []*rtp.Packet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.active && b.lastTS == p.Timestamp {
+		return nil
+	}
+
+	b.active = true
+	b.lastTS = p.Timestamp
+
+	if b.sent >= blankFrameBurst {
+		return nil
+	}
+
+	payloads := getBlankFramePayloads(b.mimeType, b.payloader)
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	b.sent++
+
+	packets := make([]*rtp.Packet, 0, len(payloads))
+
+	for i, payload := range payloads {
+		packets = append(packets, &rtp.Packet{
+			Header: rtp.Header{
+				Version:     2,
+				Marker:      i == len(payloads)-1,
+				PayloadType: p.PayloadType,
+				Timestamp:   p.Timestamp,
+				SSRC:        p.SSRC,
+			},
+			Payload: payload,
+		})
+	}
+
+	return packets
+}
+
+// Reset is called when the live video is resumed.
+// Returns true if the live packets were replaced, so a keyframe is required to resume the video.
+func (b *blankFrames) Reset() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	active := b.active
+	b.active = false
+	b.sent = 0
+
+	return active
+}
+
+// getBlankFramePayloads returns the RTP payloads of a black keyframe for the codec.
+func getBlankFramePayloads(mimeType string, payloader rtp.Payloader) [][]byte {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		// already packetized as a single STAP-A payload
+		return [][]byte{getH264BlankFrame()}
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return payloader.Payload(blankFrameMTU, VP8KeyFrame8x8)
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return payloader.Payload(blankFrameMTU, VP9KeyFrame8x8)
+	default:
+		return nil
+	}
+}
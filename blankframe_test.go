@@ -0,0 +1,301 @@
+package sfu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs/vp9"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlankFrames(t *testing.T) {
+	for _, mimeType := range []string{webrtc.MimeTypeVP8, webrtc.MimeTypeVP9, webrtc.MimeTypeH264} {
+		blank := newBlankFrames(getCodecCapability(mimeType))
+
+		live := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: 100,
+				Timestamp:      3000,
+				SSRC:           1234,
+			},
+		}
+
+		packets := blank.Next(live)
+		require.Len(t, packets, 1, mimeType)
+		require.True(t, IsKeyframe(mimeType, packets[0]), mimeType)
+		require.True(t, packets[0].Marker, mimeType)
+		require.Equal(t, live.Timestamp, packets[0].Timestamp, mimeType)
+
+		// the next packet of the same frame is dropped
+		live.SequenceNumber++
+		require.Nil(t, blank.Next(live), mimeType)
+
+		for i := 1; i < blankFrameBurst; i++ {
+			live.SequenceNumber++
+			live.Timestamp += 3000
+			require.Len(t, blank.Next(live), 1, mimeType)
+		}
+
+		// the burst is sent, the next frames are dropped
+		live.SequenceNumber++
+		live.Timestamp += 3000
+		require.Nil(t, blank.Next(live), mimeType)
+
+		require.True(t, blank.Reset(), mimeType)
+		require.False(t, blank.Reset(), mimeType)
+	}
+}
+
+// vp9BoolDecoder is the boolean decoder of the VP9 compressed header and tile data.
+type vp9BoolDecoder struct {
+	data  []byte
+	pos   int
+	value int
+	rng   int
+}
+
+func newVP9BoolDecoder(data []byte) *vp9BoolDecoder {
+	d := &vp9BoolDecoder{data: data, rng: 255}
+	for i := 0; i < 8; i++ {
+		d.value = d.value<<1 | d.bit()
+	}
+
+	return d
+}
+
+func (d *vp9BoolDecoder) bit() int {
+	b := 0
+	if d.pos < len(d.data)*8 {
+		b = int(d.data[d.pos/8]>>(7-d.pos%8)) & 1
+	}
+	d.pos++
+
+	return b
+}
+
+func (d *vp9BoolDecoder) read(prob int) int {
+	split := 1 + ((d.rng-1)*prob)>>8
+	b := 0
+	if d.value < split {
+		d.rng = split
+	} else {
+		d.rng -= split
+		d.value -= split
+		b = 1
+	}
+
+	for d.rng < 128 {
+		d.value = d.value<<1 | d.bit()
+		d.rng <<= 1
+	}
+
+	return b
+}
+
+func (d *vp9BoolDecoder) literal(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | d.read(128)
+	}
+
+	return v
+}
+
+func (d *vp9BoolDecoder) termSubexp() int {
+	if d.literal(1) == 0 {
+		return d.literal(4)
+	}
+
+	if d.literal(1) == 0 {
+		return d.literal(4) + 16
+	}
+
+	if d.literal(1) == 0 {
+		return d.literal(5) + 32
+	}
+
+	v := d.literal(7)
+	if v < 65 {
+		return v + 64
+	}
+
+	return v<<1 - 1 + d.literal(1)
+}
+
+// invRemapProb only supports the first deltas of the inverse map table, which are spaced by 13.
+func invRemapProb(t *testing.T, delta, prob int) int {
+	require.Less(t, delta, 20)
+	v := 7 + 13*delta
+
+	recenter := func(v, m int) int {
+		switch {
+		case v > 2*m:
+			return v
+		case v&1 == 1:
+			return m - (v+1)>>1
+		default:
+			return m + v>>1
+		}
+	}
+
+	prob--
+	if prob<<1 <= 255 {
+		return 1 + recenter(v, prob)
+	}
+
+	return 255 - recenter(v, 254-prob)
+}
+
+func TestVP9KeyFrame8x8(t *testing.T) {
+	var header vp9.Header
+	require.NoError(t, header.Unmarshal(VP9KeyFrame8x8))
+	require.False(t, header.NonKeyFrame)
+	require.True(t, header.ShowFrame)
+	require.Equal(t, uint16(8), header.Width())
+	require.Equal(t, uint16(8), header.Height())
+
+	// the rest of the uncompressed header, after the frame size
+	pos := 8 + 24 + 4 + 2*16 + 1
+	bits := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | int(VP9KeyFrame8x8[pos/8]>>(7-pos%8))&1
+			pos++
+		}
+
+		return v
+	}
+
+	bits(1 + 1 + 2)              // refresh_frame_context, frame_parallel_decoding_mode, frame_context_idx
+	require.Equal(t, 0, bits(6)) // filter_level
+	bits(3)                      // sharpness
+	require.Equal(t, 0, bits(1)) // mode_ref_delta_enabled
+	baseQIdx := bits(8)          // base_q_idx
+	require.Equal(t, 0, bits(3)) // no delta_q
+	require.Equal(t, 0, bits(1)) // segmentation disabled
+	require.Equal(t, 0, bits(1)) // one tile row, an 8x8 frame has a single tile column
+	headerSize := bits(16)       // header_size_in_bytes
+	pos = (pos + 7) / 8 * 8
+	require.Equal(t, 255, baseQIdx)
+
+	// compressed header
+	compressed := newVP9BoolDecoder(VP9KeyFrame8x8[pos/8 : pos/8+headerSize])
+	require.Equal(t, 0, compressed.read(128))  // marker
+	require.Equal(t, 0, compressed.literal(2)) // ONLY_4X4
+	require.Equal(t, 1, compressed.literal(1)) // 4x4 coefficient probabilities update
+
+	// default probabilities of the first band of intra luma 4x4 blocks without coded neighbours
+	dcProbs := []int{195, 29, 183}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			for k := 0; k < 6; k++ {
+				maxL := 6
+				if k == 0 {
+					maxL = 3
+				}
+
+				for l := 0; l < maxL; l++ {
+					for m := 0; m < 3; m++ {
+						if compressed.read(252) == 0 {
+							continue
+						}
+
+						require.Equal(t, []int{0, 0, 0, 0, 2}, []int{i, j, k, l, m})
+						dcProbs[m] = invRemapProb(t, compressed.termSubexp(), dcProbs[m])
+					}
+				}
+			}
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, 0, compressed.read(252)) // skip probabilities
+	}
+
+	// the pivot probability of 1 selects the first row of the pareto table
+	require.Equal(t, 1, dcProbs[2])
+	pareto := []int{3, 86, 128}
+
+	tile := newVP9BoolDecoder(VP9KeyFrame8x8[pos/8+headerSize:])
+	require.Equal(t, 0, tile.read(128)) // marker
+	require.Equal(t, 0, tile.read(158)) // PARTITION_NONE for the 8x8 block
+	require.Equal(t, 0, tile.read(192)) // not skipped
+	require.Equal(t, 0, tile.read(137)) // DC_PRED luma
+	require.Equal(t, 0, tile.read(120)) // DC_PRED chroma
+
+	// DC coefficient of the first luma 4x4 block
+	require.Equal(t, 1, tile.read(dcProbs[0])) // more coefficients
+	require.Equal(t, 1, tile.read(dcProbs[1])) // not ZERO_TOKEN
+	require.Equal(t, 1, tile.read(dcProbs[2])) // not ONE_TOKEN
+	require.Equal(t, 0, tile.read(pareto[0]))  // TWO_TOKEN to FOUR_TOKEN
+	require.Equal(t, 1, tile.read(pareto[1]))  // not TWO_TOKEN
+	require.Equal(t, 0, tile.read(pareto[2]))  // THREE_TOKEN
+	dc := 3
+	if tile.read(128) == 1 {
+		dc = -dc
+	}
+
+	// no other coefficient, neither in the other luma blocks nor in the chroma blocks
+	for _, prob := range []int{8, 84, 84, 195, 214, 214} {
+		require.Equal(t, 0, tile.read(prob))
+	}
+
+	// 4x4 inverse DCT of a DC only block, dc_qlookup[255] is 1336
+	roundShift := func(v int) int { return (v + 1<<13) >> 14 }
+	out := roundShift(roundShift(dc*1336*11585) * 11585)
+	luma := 128 + (out+8)>>4
+
+	// the other luma blocks are DC predicted from the first one, without coefficients
+	require.LessOrEqual(t, luma, 16)
+	require.GreaterOrEqual(t, luma, 0)
+}
+
+func TestClientTrackPausedOnEmptyViewport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	roomOpts := DefaultRoomOptions()
+	roomOpts.Codecs = &[]string{webrtc.MimeTypeH264, webrtc.MimeTypeOpus}
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, roomOpts)
+	require.NoError(t, err)
+
+	defer testRoom.Close()
+
+	pc1, _, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "publisher", true, false)
+	defer pc1.PeerConnection.Close()
+
+	pc2, subscriber, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "subscriber", true, false)
+	defer pc2.PeerConnection.Close()
+
+	var video iClientTrack
+
+	require.Eventually(t, func() bool {
+		for _, track := range subscriber.ClientTracks() {
+			if track.Kind() == webrtc.RTPCodecTypeVideo {
+				video = track
+				return true
+			}
+		}
+
+		return false
+	}, 30*time.Second, 100*time.Millisecond)
+
+	// a plain video track is paused when the remote viewport is 0x0
+	_, ok := video.(*clientTrack)
+	require.True(t, ok)
+	require.Equal(t, QualityLevel(QualityHigh), video.MaxQuality())
+
+	subscriber.bitrateController.onRemoteViewedSizeChanged(videoSize{TrackID: video.ID()})
+	require.Equal(t, QualityLevel(QualityNone), video.MaxQuality())
+
+	subscriber.bitrateController.onRemoteViewedSizeChanged(videoSize{TrackID: video.ID(), Width: 640, Height: 360})
+	require.Equal(t, QualityLevel(QualityHigh), video.MaxQuality())
+}
@@ -0,0 +1,415 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	bridgeNegotiationRetry   = 100 * time.Millisecond
+	bridgeNegotiationTimeout = 10 * time.Second
+)
+
+var (
+	ErrBridgingDisabled       = errors.New("bridge: bridging is not enabled in the manager options")
+	ErrBridgeExists           = errors.New("bridge: room already has a downbridge")
+	ErrBridgeConnected        = errors.New("bridge: bridge is already connected")
+	ErrBridgeNotConnected     = errors.New("bridge: bridge is not connected")
+	ErrBridgeInvalidSignaling = errors.New("bridge: invalid session description")
+)
+
+type bridgeNegotiationState int
+
+const (
+	bridgeNegotiationIdle bridgeNegotiationState = iota
+	// asking the other node for the negotiation turn
+	bridgeNegotiationLocking
+	// the bridge is sending an offer to the other node
+	bridgeNegotiationLocal
+	// the other node is sending an offer to the bridge
+	bridgeNegotiationRemote
+)
+
+// BridgeSignaler passes the signaling of a bridge to the bridge on the other node, like an HTTP client of the other node.
+// The Bridge implements it for the requests that are received from the other node.
+type BridgeSignaler interface {
+	// Lock asks the bridge on the other node for the negotiation turn, false means the other node is negotiating
+	Lock(ctx context.Context) (bool, error)
+	// Unlock ends the negotiation turn after the answer is applied
+	Unlock(ctx context.Context) error
+	// Negotiate passes the offer to the bridge on the other node and returns its answer, the session descriptions
+	// contain the ICE candidates so there is no trickle ICE between the nodes.
+	Negotiate(ctx context.Context, offer webrtc.SessionDescription) (webrtc.SessionDescription, error)
+}
+
+// Bridge connects a room to a room on another node with a peer connection between two SFU clients. The upbridge client
+// is in the origin room and the downbridge client is in the edge room, each client subscribes the tracks of its room
+// and publishes the tracks that are received from the other node, so both rooms see the tracks of each other.
+// The messages of the data channels that exist in both rooms are forwarded both ways.
+//
+// A room has at most one downbridge, so the bridged rooms are a tree with the origin room as the root and a track
+// is never sent back to the node it comes from. A track with the ID of a track that is already in the room is not
+// published, so a misconfigured loop of bridges doesn't duplicate the tracks.
+type Bridge struct {
+	mu          sync.Mutex
+	id          string
+	room        *Room
+	client      *Client
+	remote      BridgeSignaler
+	negotiation bridgeNegotiationState
+}
+
+// AddUpBridge adds the upbridge client of a bridge to the origin room, call Connect after the downbridge is added on the edge node
+func (m *Manager) AddUpBridge(roomID, id string) (*Bridge, error) {
+	return m.addBridge(roomID, id, ClientTypeUpBridge)
+}
+
+// AddDownBridge adds the downbridge client of a bridge to the edge room, a room can only be bridged to one origin room
+func (m *Manager) AddDownBridge(roomID, id string) (*Bridge, error) {
+	return m.addBridge(roomID, id, ClientTypeDownBridge)
+}
+
+func (m *Manager) addBridge(roomID, id, clientType string) (*Bridge, error) {
+	if !m.options.EnableBridging {
+		return nil, ErrBridgingDisabled
+	}
+
+	room, err := m.GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientType == ClientTypeDownBridge {
+		for _, client := range room.sfu.clients.GetClients() {
+			if client.Type() == ClientTypeDownBridge {
+				return nil, ErrBridgeExists
+			}
+		}
+	}
+
+	opts := DefaultClientOptions()
+	opts.Type = clientType
+
+	client, err := room.AddClient(id, clientType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bridge := &Bridge{
+		mu:     sync.Mutex{},
+		id:     id,
+		room:   room,
+		client: client,
+	}
+
+	client.OnBeforeRenegotiation(bridge.lock)
+	client.OnRenegotiationFailed(bridge.renegotiationFailed)
+	client.OnRenegotiation(bridge.renegotiate)
+	client.OnTracksAdded(bridge.publishTracks)
+	client.OnTracksAvailable(bridge.subscribeTracks)
+	client.PeerConnection().PC().OnDataChannel(bridge.onDataChannel)
+
+	return bridge, nil
+}
+
+func (b *Bridge) ID() string {
+	return b.id
+}
+
+// Client returns the upbridge or the downbridge client of the bridge
+func (b *Bridge) Client() *Client {
+	return b.client
+}
+
+// Context is canceled when the bridge client is stopped
+func (b *Bridge) Context() context.Context {
+	return b.client.Context()
+}
+
+// Connect connects the bridge with the bridge on the other node. The downbridge only keeps the signaler and waits for
+// the offer of the upbridge, so Connect is called on the downbridge first. Connect on the upbridge returns after the
+// first negotiation, the bridge is ready when the connection state of the client is connected.
+func (b *Bridge) Connect(ctx context.Context, remote BridgeSignaler) error {
+	b.mu.Lock()
+	if b.remote != nil {
+		b.mu.Unlock()
+		return ErrBridgeConnected
+	}
+
+	b.remote = remote
+	b.mu.Unlock()
+
+	if b.client.Type() == ClientTypeDownBridge {
+		return nil
+	}
+
+	for !b.lock(ctx) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bridgeNegotiationRetry):
+		}
+	}
+
+	defer b.unlock(ctx)
+
+	pc := b.client.PeerConnection().PC()
+
+	// the offer has the data channels of the room so they don't need another negotiation
+	b.client.initDataChannel()
+	b.client.dataChannelsInitiated = true
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+
+	b.client.canAddCandidate.Store(true)
+
+	localDescription, err := b.gatheredLocalDescription(ctx)
+	if err != nil {
+		return err
+	}
+
+	answer, err := remote.Negotiate(ctx, localDescription)
+	if err != nil {
+		return err
+	}
+
+	if answer.Type != webrtc.SDPTypeAnswer {
+		return ErrBridgeInvalidSignaling
+	}
+
+	return pc.SetRemoteDescription(answer)
+}
+
+// Close stops the bridge client, the tracks of the other node are removed from the room
+func (b *Bridge) Close() error {
+	return b.client.stop()
+}
+
+// Lock is called by the bridge on the other node to get the negotiation turn. When both nodes ask at the same time
+// the downbridge gives the turn to the upbridge.
+func (b *Bridge) Lock(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client.Context().Err() != nil {
+		return false, ErrClientStoped
+	}
+
+	switch b.negotiation {
+	case bridgeNegotiationIdle:
+		b.negotiation = bridgeNegotiationRemote
+		return true, nil
+	case bridgeNegotiationLocking:
+		if b.client.Type() == ClientTypeDownBridge {
+			b.negotiation = bridgeNegotiationRemote
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Unlock is called by the bridge on the other node when its negotiation is done
+func (b *Bridge) Unlock(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.negotiation == bridgeNegotiationRemote {
+		b.negotiation = bridgeNegotiationIdle
+	}
+
+	return nil
+}
+
+// Negotiate is called by the bridge on the other node with its offer, the answer contains the gathered ICE candidates
+func (b *Bridge) Negotiate(ctx context.Context, offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	if offer.Type != webrtc.SDPTypeOffer {
+		return webrtc.SessionDescription{}, ErrBridgeInvalidSignaling
+	}
+
+	if _, err := b.client.Negotiate(offer); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+
+	return b.gatheredLocalDescription(ctx)
+}
+
+// gatheredLocalDescription waits for the ICE candidates of the local description
+func (b *Bridge) gatheredLocalDescription(ctx context.Context) (webrtc.SessionDescription, error) {
+	pc := b.client.PeerConnection().PC()
+
+	select {
+	case <-webrtc.GatheringCompletePromise(pc):
+	case <-ctx.Done():
+		return webrtc.SessionDescription{}, ctx.Err()
+	}
+
+	return b.client.setOpusSDP(*pc.LocalDescription()), nil
+}
+
+// lock gets the negotiation turn from the other node before the client creates an offer
+func (b *Bridge) lock(ctx context.Context) bool {
+	b.mu.Lock()
+	if b.remote == nil || b.negotiation != bridgeNegotiationIdle {
+		b.mu.Unlock()
+		return false
+	}
+
+	b.negotiation = bridgeNegotiationLocking
+	remote := b.remote
+	b.mu.Unlock()
+
+	ok, err := remote.Lock(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil || !ok {
+		if b.negotiation == bridgeNegotiationLocking {
+			b.negotiation = bridgeNegotiationIdle
+		}
+
+		return false
+	}
+
+	b.negotiation = bridgeNegotiationLocal
+
+	return true
+}
+
+func (b *Bridge) unlock(ctx context.Context) {
+	b.mu.Lock()
+	if b.negotiation != bridgeNegotiationLocal {
+		b.mu.Unlock()
+		return
+	}
+
+	b.negotiation = bridgeNegotiationIdle
+	remote := b.remote
+	b.mu.Unlock()
+
+	if err := remote.Unlock(ctx); err != nil {
+		b.client.log.Errorf("bridge: failed to unlock the negotiation of bridge %s: %s", b.id, err.Error())
+	}
+}
+
+// renegotiationFailed releases the negotiation turn when the client fails to create the offer after getting it
+func (b *Bridge) renegotiationFailed(ctx context.Context, _ error) {
+	b.unlock(context.WithoutCancel(ctx))
+}
+
+// renegotiate passes the offer of the client to the other node, the turn is released once the answer is applied
+func (b *Bridge) renegotiate(ctx context.Context, offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	b.mu.Lock()
+	remote := b.remote
+	b.mu.Unlock()
+
+	if remote == nil {
+		return webrtc.SessionDescription{}, ErrBridgeNotConnected
+	}
+
+	negotiateCtx, cancel := context.WithTimeout(ctx, bridgeNegotiationTimeout)
+	defer cancel()
+
+	answer, err := remote.Negotiate(negotiateCtx, offer)
+
+	go b.unlockWhenStable(ctx)
+
+	return answer, err
+}
+
+// unlockWhenStable releases the negotiation turn when the client has applied the answer or is stopped
+func (b *Bridge) unlockWhenStable(ctx context.Context) {
+	timeout, cancel := context.WithTimeout(ctx, bridgeNegotiationTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for b.client.PeerConnection().PC().SignalingState() != webrtc.SignalingStateStable {
+		select {
+		case <-timeout.Done():
+			b.unlock(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+		}
+	}
+
+	b.unlock(ctx)
+}
+
+// publishTracks publishes the tracks that are received from the other node, except the tracks that are already in the room
+func (b *Bridge) publishTracks(tracks []ITrack) {
+	trackTypes := make(map[string]TrackType)
+
+	for _, track := range tracks {
+		if b.isTrackInRoom(track.ID()) {
+			b.client.log.Warnf("bridge: track %s is already in room %s, the bridges are in a loop", track.ID(), b.room.ID())
+			continue
+		}
+
+		trackTypes[track.ID()] = TrackTypeMedia
+	}
+
+	if len(trackTypes) > 0 {
+		b.client.SetTracksSourceType(trackTypes)
+	}
+}
+
+func (b *Bridge) isTrackInRoom(trackID string) bool {
+	for _, client := range b.client.SFU().clients.GetClients() {
+		if client.ID() == b.client.ID() {
+			continue
+		}
+
+		if _, err := client.tracks.Get(trackID); err == nil {
+			return true
+		}
+	}
+
+	for _, track := range b.client.SFU().getRelayTracks() {
+		if track.ID() == trackID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subscribeTracks sends the tracks of the room to the other node
+func (b *Bridge) subscribeTracks(tracks []ITrack) {
+	requests := make([]SubscribeTrackRequest, 0, len(tracks))
+	for _, track := range tracks {
+		requests = append(requests, SubscribeTrackRequest{
+			ClientID: track.ClientID(),
+			TrackID:  track.ID(),
+		})
+	}
+
+	if err := b.client.SubscribeTracks(requests); err != nil {
+		b.client.log.Errorf("bridge: failed to subscribe tracks of room %s: %s", b.room.ID(), err.Error())
+	}
+}
+
+// onDataChannel forwards the messages of the data channels that are created by the other node to the clients of the room,
+// the messages of the room are sent to the other node on the data channels that are created by the client.
+func (b *Bridge) onDataChannel(dc *webrtc.DataChannel) {
+	s := b.client.SFU()
+
+	if s.dataChannels.Get(dc.Label()) == nil {
+		return
+	}
+
+	s.setupMessageForwarder(b.client.ID(), dc)
+}
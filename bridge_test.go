@@ -0,0 +1,197 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridgeRoom(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := NewManager(ctx, "disabled", sfuOpts).AddUpBridge("room", "bridge")
+	require.ErrorIs(t, err, ErrBridgingDisabled)
+
+	bridgeOpts := sfuOpts
+	bridgeOpts.EnableBridging = true
+
+	// the origin and the edge node in one process
+	origin := NewManager(ctx, "origin", bridgeOpts)
+	defer origin.Close()
+
+	edge := NewManager(ctx, "edge", bridgeOpts)
+	defer edge.Close()
+
+	roomID := origin.CreateRoomID()
+
+	originRoom, err := origin.NewRoom(roomID, "bridged", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	edgeRoom, err := edge.NewRoom(roomID, "bridged", RoomTypeRemote, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	require.NoError(t, originRoom.CreateDataChannel("chat", DefaultDataChannelOptions()))
+	require.NoError(t, edgeRoom.CreateDataChannel("chat", DefaultDataChannelOptions()))
+
+	speaker, err := originRoom.AddVirtualPublisher("speaker", VirtualPublisherOptions{Name: "keynote"})
+	require.NoError(t, err)
+
+	audio, err := speaker.NewTrack("speaker-audio", "speaker", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	pc, listener, _, _ := CreatePeerPair(ctx, TestLogger, edgeRoom, DefaultTestIceServers(), "listener", true, false)
+	defer pc.PeerConnection.Close()
+
+	require.Eventually(t, func() bool {
+		return listener.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	down, err := edge.AddDownBridge(roomID, "origin-bridge")
+	require.NoError(t, err)
+	require.True(t, down.Client().IsBridge())
+
+	_, err = edge.AddDownBridge(roomID, "second-origin-bridge")
+	require.ErrorIs(t, err, ErrBridgeExists)
+
+	up, err := origin.AddUpBridge(roomID, "edge-bridge")
+	require.NoError(t, err)
+
+	require.NoError(t, down.Connect(ctx, up))
+	require.NoError(t, up.Connect(ctx, down))
+	require.ErrorIs(t, up.Connect(ctx, down), ErrBridgeConnected)
+
+	require.Eventually(t, func() bool {
+		return up.Client().PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected &&
+			down.Client().PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	go func() {
+		for i := 0; i < 100 && ctx.Err() == nil; i++ {
+			_ = audio.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	// the track of the origin is published by the downbridge and the listener on the edge subscribes it
+	require.Eventually(t, func() bool {
+		_, ok := listener.ClientTracks()["speaker-audio"]
+		return ok
+	}, 30*time.Second, 100*time.Millisecond)
+
+	track, err := edgeRoom.SFU().getTrack("speaker-audio")
+	require.NoError(t, err)
+	require.Equal(t, down.Client().ID(), track.ClientID())
+
+	// the tracks of the listener are published in the origin room by the upbridge
+	require.Eventually(t, func() bool {
+		for _, track := range listener.Tracks() {
+			if _, err := up.Client().tracks.Get(track.ID()); err != nil {
+				return false
+			}
+		}
+
+		return len(listener.Tracks()) == 2
+	}, 30*time.Second, 100*time.Millisecond)
+
+	// the tracks don't go back to the node they come from
+	_, err = up.Client().tracks.Get("speaker-audio")
+	require.ErrorIs(t, err, ErrTrackIsNotExists)
+
+	for _, track := range listener.Tracks() {
+		_, err := down.Client().tracks.Get(track.ID())
+		require.ErrorIs(t, err, ErrTrackIsNotExists)
+	}
+
+	// the data channel messages are forwarded both ways
+	edgeMessages := make(chan string, 1)
+	edgeRoom.SFU().OnDataChannelMessage(func(clientID string, label string, msg webrtc.DataChannelMessage) {
+		if clientID == down.Client().ID() && label == "chat" {
+			edgeMessages <- string(msg.Data)
+		}
+	})
+
+	originMessages := make(chan string, 1)
+	originRoom.SFU().OnDataChannelMessage(func(clientID string, label string, msg webrtc.DataChannelMessage) {
+		if clientID == up.Client().ID() && label == "chat" {
+			originMessages <- string(msg.Data)
+		}
+	})
+
+	for _, bridge := range []*Bridge{up, down} {
+		dc := bridge.Client().dataChannels.Get("chat")
+		require.NotNil(t, dc)
+
+		require.Eventually(t, func() bool {
+			return dc.ReadyState() == webrtc.DataChannelStateOpen
+		}, 10*time.Second, 50*time.Millisecond)
+
+		require.NoError(t, dc.SendText(bridge.ID()))
+	}
+
+	require.Equal(t, up.ID(), <-edgeMessages)
+	require.Equal(t, down.ID(), <-originMessages)
+
+	// the tracks of the edge are removed from the origin when the bridge is closed
+	require.NoError(t, up.Close())
+
+	require.Eventually(t, func() bool {
+		_, err := originRoom.SFU().GetClient(up.ID())
+		return err == ErrClientNotFound
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+type countingSignaler struct {
+	unlocks atomic.Int32
+}
+
+func (s *countingSignaler) Lock(context.Context) (bool, error) {
+	return true, nil
+}
+
+func (s *countingSignaler) Unlock(context.Context) error {
+	s.unlocks.Add(1)
+	return nil
+}
+
+func (s *countingSignaler) Negotiate(context.Context, webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	return webrtc.SessionDescription{}, errors.New("not implemented")
+}
+
+func TestBridgeRenegotiationFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bridgeOpts := sfuOpts
+	bridgeOpts.EnableBridging = true
+
+	manager := NewManager(ctx, "origin", bridgeOpts)
+	defer manager.Close()
+
+	_, err := manager.NewRoom("room", "bridged", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	bridge, err := manager.AddUpBridge("room", "bridge")
+	require.NoError(t, err)
+
+	signaler := &countingSignaler{}
+	bridge.remote = signaler
+
+	// the client got the turn but failed to create the offer
+	require.True(t, bridge.lock(ctx))
+	bridge.Client().renegotiationFailed(errors.New("create offer failed"))
+
+	bridge.mu.Lock()
+	require.Equal(t, bridgeNegotiationIdle, bridge.negotiation)
+	bridge.mu.Unlock()
+	require.Equal(t, int32(1), signaler.unlocks.Load())
+
+	// the turn can be taken again
+	require.True(t, bridge.lock(ctx))
+}
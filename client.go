@@ -40,6 +40,8 @@ const (
 	ClientTypePeer       = "peer"
 	ClientTypeUpBridge   = "upbridge"
 	ClientTypeDownBridge = "downbridge"
+	// a client without a peer connection that publishes the tracks of a VirtualPublisher
+	ClientTypeVirtual = "virtual"
 
 	QualityAudioRed = 5
 	QualityAudio    = 4
@@ -52,14 +54,19 @@ const (
 	messageTypeStats      = "stats"
 	messageTypeVADStarted = "vad_started"
 	messageTypeVADEnded   = "vad_ended"
+	messageTypeRecording  = "recording"
 )
 
 type QualityLevel uint32
 
 var (
-	ErrNegotiationIsNotRequested = errors.New("client: error negotiation is called before requested")
-	ErrRenegotiationCallback     = errors.New("client: error renegotiation callback is not set")
-	ErrClientStoped              = errors.New("client: error client already stopped")
+	ErrNegotiationIsNotRequested  = errors.New("client: error negotiation is called before requested")
+	ErrRenegotiationCallback      = errors.New("client: error renegotiation callback is not set")
+	ErrClientStoped               = errors.New("client: error client already stopped")
+	ErrPlayoutDelayDisabled       = errors.New("client: error playout delay is not enabled")
+	ErrPlayoutDelayInvalid        = errors.New("client: error playout delay min is larger than max")
+	ErrInvalidJitterBufferLatency = errors.New("client: error jitter buffer min wait is larger than max wait")
+	ErrJitterBufferDisabled       = errors.New("client: error jitter buffer is not enabled, set ReorderPackets option to enable it")
 )
 
 type ClientOptions struct {
@@ -83,13 +90,24 @@ type ClientOptions struct {
 	MaxPlayoutDelay     uint16        `json:"max_playout_delay"`
 	JitterBufferMinWait time.Duration `json:"jitter_buffer_min_wait"`
 	JitterBufferMaxWait time.Duration `json:"jitter_buffer_max_wait"`
+	// The jitter buffer wait for audio tracks, audio is more sensitive to the latency than video so it's using a shorter wait
+	AudioJitterBufferMinWait time.Duration `json:"audio_jitter_buffer_min_wait"`
+	AudioJitterBufferMaxWait time.Duration `json:"audio_jitter_buffer_max_wait"`
 	// On unstable network, the packets can be arrived unordered which may affected the nack and packet loss counts, set this to true to allow the SFU to handle reordered packet
 	ReorderPackets bool `json:"reorder_packets"`
 	Log            logging.LeveledLogger
 	settingEngine  webrtc.SettingEngine
 	QuicConnection quic.Connection `json:"-"`
 	RecorderConfig *recorder.RecorderConfig
-	Channel        recorder.Channel
+	// Configure the recording to the local disk, the recording doesn't need a recorder service when this is set
+	LocalRecorderConfig *recorder.FileConfig
+	// The channel of the client in the stereo layout of the room recording
+	Channel recorder.Channel
+	// The role of the client in the role layout of the room recording, the clients with the same role share a channel
+	RecordingRole string `json:"recording_role"`
+	// A hidden client like a recorder bot or a transcription agent is not seen by the other clients, its tracks are not
+	// announced and it's not counted as a participant of the room or to keep the room from being closed when it's empty
+	Hidden bool `json:"hidden"`
 }
 
 type internalDataMessage struct {
@@ -128,7 +146,7 @@ type remoteClientStats struct {
 type Client struct {
 	id                    string
 	name                  string
-	roomId                string
+	roomId                atomic.Value
 	bitrateController     *bitrateController
 	context               context.Context
 	cancel                context.CancelFunc
@@ -147,7 +165,8 @@ type Client struct {
 	idleTimeoutCancel     context.CancelFunc
 	mu                    sync.RWMutex
 	peerConnection        *PeerConnection
-	quicClient            quic.Connection
+	recordingSession      *recorder.Session
+	recordingState        *RecordingState
 	isMuted               *atomic.Bool
 	// pending received tracks are the remote tracks from other clients that waiting to add when the client is connected
 	pendingReceivedTracks []SubscribeTrackRequest
@@ -159,23 +178,27 @@ type Client struct {
 	pendingRemoteRenegotiation        *atomic.Bool
 	receiveRED                        bool
 	state                             *atomic.Value
-	sfu                               *SFU
+	sfu                               atomic.Pointer[SFU]
 	muCallback                        sync.Mutex
 	onConnectionStateChangedCallbacks []func(webrtc.PeerConnectionState)
 	onJoinedCallbacks                 []func()
 	onLeftCallbacks                   []func()
 	onVoiceDetectedCallbacks          []func(voiceactivedetector.VoiceActivity)
+	onDTMFCallbacks                   []func(digit rune, duration time.Duration)
 	onTrackRemovedCallbacks           []func(sourceType string, track *webrtc.TrackLocalStaticRTP)
 	onIceCandidate                    func(context.Context, *webrtc.ICECandidate)
 	onBeforeRenegotiation             func(context.Context) bool
+	onRenegotiationFailed             func(context.Context, error)
 	onRenegotiation                   func(context.Context, webrtc.SessionDescription) (webrtc.SessionDescription, error)
 	onAllowedRemoteRenegotiation      func()
 	onTracksAvailableCallbacks        []func([]ITrack)
 	onNetworkConditionChangedFunc     func(networkmonitor.NetworkConditionType)
+	onRecordingHealthChangedCallbacks []func(recorder.SessionHealth)
 	// onTrack is used by SFU to take action when a new track is added to the client
 	onTrack                        func(ITrack)
 	onTracksAdded                  func([]ITrack)
 	options                        ClientOptions
+	jitterBufferMu                 sync.RWMutex
 	statsGetter                    stats.Getter
 	stats                          *ClientStats
 	tracks                         *trackList
@@ -189,24 +212,33 @@ type Client struct {
 	ingressQualityLimitationReason *atomic.Value
 	isDebug                        bool
 	vadInterceptor                 *voiceactivedetector.Interceptor
+	playoutDelayInterceptor        *playoutdelay.Interceptor
 	log                            logging.LeveledLogger
 	isRecording                    atomic.Bool
 	isRecordingPaused              atomic.Bool
+	// the tracks of a hidden client are not announced to the other clients
+	hidden atomic.Bool
+	// the local tracks of the subscribed audio tracks in the subscribe order, used to send DTMF
+	dtmfTracks []*dtmfTrackLocal
+	// stops canceling the client when the context of the SFU is done
+	stopSFUContext func() bool
 }
 
 func DefaultClientOptions() ClientOptions {
 	return ClientOptions{
-		IdleTimeout:          5 * time.Minute,
-		Type:                 ClientTypePeer,
-		EnableVoiceDetection: true,
-		EnablePlayoutDelay:   true,
-		EnableOpusDTX:        true,
-		EnableOpusInbandFEC:  true,
-		MinPlayoutDelay:      100,
-		MaxPlayoutDelay:      200,
-		JitterBufferMinWait:  20 * time.Millisecond,
-		JitterBufferMaxWait:  150 * time.Millisecond,
-		ReorderPackets:       false,
+		IdleTimeout:              5 * time.Minute,
+		Type:                     ClientTypePeer,
+		EnableVoiceDetection:     true,
+		EnablePlayoutDelay:       true,
+		EnableOpusDTX:            true,
+		EnableOpusInbandFEC:      true,
+		MinPlayoutDelay:          100,
+		MaxPlayoutDelay:          200,
+		JitterBufferMinWait:      20 * time.Millisecond,
+		JitterBufferMaxWait:      150 * time.Millisecond,
+		AudioJitterBufferMinWait: 10 * time.Millisecond,
+		AudioJitterBufferMaxWait: 60 * time.Millisecond,
+		ReorderPackets:           false,
 	}
 }
 
@@ -214,8 +246,10 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 
 	var client *Client
 	var vadInterceptor *voiceactivedetector.Interceptor
+	var playoutDelayInterceptor *playoutdelay.Interceptor
 
-	localCtx, cancel := context.WithCancel(s.context)
+	// the client is canceled with the SFU through stopSFUContext, so it can be moved to the SFU of another room
+	localCtx, cancel := context.WithCancel(context.WithoutCancel(s.context))
 	m := &webrtc.MediaEngine{}
 
 	if err := RegisterCodecs(m, s.codecs); err != nil {
@@ -300,9 +334,13 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 
 	if opts.EnablePlayoutDelay {
 		playoutdelay.RegisterPlayoutDelayHeaderExtension(m)
-		playoutDelayInterceptor := playoutdelay.NewInterceptor(opts.Log, opts.MinPlayoutDelay, opts.MaxPlayoutDelay)
+		playoutDelayInterceptorFactory := playoutdelay.NewInterceptor(opts.Log, opts.MinPlayoutDelay, opts.MaxPlayoutDelay)
 
-		i.Add(playoutDelayInterceptor)
+		playoutDelayInterceptorFactory.OnNew(func(i *playoutdelay.Interceptor) {
+			playoutDelayInterceptor = i
+		})
+
+		i.Add(playoutDelayInterceptorFactory)
 	}
 
 	// Use the default set of Interceptors
@@ -342,7 +380,6 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 		pendingPublishedTracks:         newTrackList(opts.Log),
 		pendingRemoteRenegotiation:     &atomic.Bool{},
 		publishedTracks:                newTrackList(opts.Log),
-		sfu:                            s,
 		statsGetter:                    statsGetter,
 		quality:                        &quality,
 		receivingBandwidth:             &atomic.Uint32{},
@@ -351,9 +388,15 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 		ingressQualityLimitationReason: &atomic.Value{},
 		onTracksAvailableCallbacks:     make([]func([]ITrack), 0),
 		vadInterceptor:                 vadInterceptor,
+		playoutDelayInterceptor:        playoutDelayInterceptor,
 		log:                            opts.Log,
 	}
 
+	client.hidden.Store(opts.Hidden)
+	client.sfu.Store(s)
+
+	client.stopSFUContext = context.AfterFunc(s.context, cancel)
+
 	client.onTrack = func(track ITrack) {
 
 		if err := client.pendingPublishedTracks.Add(track); err == ErrTrackExists {
@@ -400,36 +443,10 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 				client.onJoined()
 
 				// trigger available tracks from other clients
-
-				availableTracks := make([]ITrack, 0)
-
-				for _, c := range s.clients.GetClients() {
-					for _, track := range c.tracks.GetTracks() {
-						_, err := client.publishedTracks.Get(track.ID())
-						if track.ClientID() != client.ID() {
-							if err == ErrTrackIsNotExists {
-								availableTracks = append(availableTracks, track)
-							} else {
-								c.log.Errorf("client: track already exists")
-							}
-						}
-					}
-				}
-
-				// add relay tracks
-				for _, track := range s.relayTracks {
-					availableTracks = append(availableTracks, track)
-				}
-
-				if len(availableTracks) > 0 {
-					client.log.Infof("client: ", client.ID(), " available tracks ", len(availableTracks))
-					client.onTracksAvailable(availableTracks)
-				}
+				client.announceAvailableTracks()
 			}
 
-			if len(client.pendingReceivedTracks) > 0 {
-				client.processPendingTracks()
-			}
+			client.processPendingTracks()
 
 		case webrtc.PeerConnectionStateClosed:
 			client.afterClosed()
@@ -507,10 +524,9 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 		if remoteTrack.RID() == "" {
 			// not simulcast
 
-			minWait := opts.JitterBufferMinWait
-			maxWait := opts.JitterBufferMaxWait
+			minWait, maxWait := client.jitterBufferWait(remoteTrack.Kind())
 
-			track, _ = newTrack(client.context, client, remoteTrack, minWait, maxWait, s.pliInterval, onPLI, client.statsGetter, onStatsUpdated)
+			track, _ = newTrack(client.context, client, remoteTrack, minWait, maxWait, client.SFU().PLIInterval(), onPLI, client.statsGetter, onStatsUpdated)
 
 			track.OnEnded(func() {
 				client.stats.removeReceiverStats(remoteTrack.ID() + remoteTrack.RID())
@@ -521,8 +537,14 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 				client.log.Errorf("client: error add track ", err)
 			}
 
+			if remoteTrack.Kind() == webrtc.RTPCodecTypeAudio {
+				track.(*Track).setDTMFCodec(receiver.GetParameters().Codecs)
+			}
+
 			client.onTrack(track)
 			track.SetAsProcessed()
+
+			go readSenderReports(receiver, remoteTrack, track.(*Track).onSenderReport)
 		} else {
 			// simulcast
 			var simulcast *SimulcastTrack
@@ -534,7 +556,8 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 
 			if err != nil {
 				// if track not found, add it
-				track = newSimulcastTrack(client, remoteTrack, opts.JitterBufferMinWait, opts.JitterBufferMaxWait, s.pliInterval, onPLI, client.statsGetter, onStatsUpdated)
+				minWait, maxWait := client.jitterBufferWait(remoteTrack.Kind())
+				track = newSimulcastTrack(client, remoteTrack, minWait, maxWait, client.SFU().PLIInterval(), onPLI, client.statsGetter, onStatsUpdated)
 				if err := client.tracks.Add(track); err != nil {
 					client.log.Errorf("client: error add track ", err)
 				}
@@ -559,7 +582,15 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 				})
 
 			} else if simulcast, ok = track.(*SimulcastTrack); ok {
-				simulcast.AddRemoteTrack(remoteTrack, opts.JitterBufferMinWait, opts.JitterBufferMaxWait, client.statsGetter, onStatsUpdated, onPLI)
+				minWait, maxWait := client.jitterBufferWait(remoteTrack.Kind())
+				simulcast.AddRemoteTrack(remoteTrack, minWait, maxWait, client.statsGetter, onStatsUpdated, onPLI)
+			}
+
+			if simulcast, ok := track.(*SimulcastTrack); ok {
+				quality := RIDToQuality(remoteTrack.RID())
+				go readSenderReports(receiver, remoteTrack, func(sr *rtcp.SenderReport) {
+					simulcast.onSenderReport(sr, quality)
+				})
 			}
 
 			if !track.IsProcessed() {
@@ -591,6 +622,30 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 	return client
 }
 
+// readSenderReports reads the RTCP packets of the receiver until it's stopped, and passes the sender reports of the remote track to the callback
+func readSenderReports(receiver *webrtc.RTPReceiver, remoteTrack *webrtc.TrackRemote, onSenderReport func(*rtcp.SenderReport)) {
+	for {
+		var packets []rtcp.Packet
+		var err error
+
+		if remoteTrack.RID() == "" {
+			packets, _, err = receiver.ReadRTCP()
+		} else {
+			packets, _, err = receiver.ReadSimulcastRTCP(remoteTrack.RID())
+		}
+
+		if err != nil {
+			return
+		}
+
+		for _, packet := range packets {
+			if sr, ok := packet.(*rtcp.SenderReport); ok && sr.SSRC == uint32(remoteTrack.SSRC()) {
+				onSenderReport(sr)
+			}
+		}
+	}
+}
+
 func (c *Client) IsMuted() bool {
 	return c.isMuted.Load()
 }
@@ -620,32 +675,52 @@ func (c *Client) StartClientRecording(bucketName, filename string) error {
 		return fmt.Errorf("recording is already started")
 	}
 
-	var quicClient quic.Connection = c.quicClient
-	var err error
+	if c.options.LocalRecorderConfig != nil {
+		newRecorder, err := localTrackRecorder(*c.options.LocalRecorderConfig, bucketName, filename)
+		if err != nil {
+			c.isRecording.Store(false)
+			return err
+		}
 
-	if quicClient == nil {
-		quicClient, err = recorder.NewQuicClient(
-			context.Background(),
-			recorder.ClientConfig{
-				ClientId:   c.ID(),
-				BucketName: bucketName,
-				FileName:   filename,
-			},
-			c.options.RecorderConfig,
-		)
-		c.quicClient = quicClient
+		for _, track := range c.tracks.GetTracks() {
+			if err := track.StartRecording(newRecorder); err != nil {
+				c.log.Errorf("client: error start recording track %s: %s", track.ID(), err.Error())
+			}
+		}
+
+		return nil
 	}
 
+	session, err := recorder.NewSession(
+		recorder.ClientConfig{
+			ClientId:      c.ID(),
+			BucketName:    bucketName,
+			FileName:      filename,
+			TimelineStart: time.Now(),
+		},
+		c.options.RecorderConfig,
+		recorder.SessionOptions{
+			Log: c.log,
+		},
+	)
 	if err != nil {
+		c.isRecording.Store(false)
 		return err
 	}
 
+	session.OnHealthChanged(c.onRecordingHealth)
+
+	c.mu.Lock()
+	c.recordingSession = session
+	c.mu.Unlock()
+
+	newRecorder := session.NewTrackRecorder
 	for _, track := range c.tracks.GetTracks() {
-		stream, err := quicClient.OpenUniStream()
-		if err != nil {
+		if err := track.StartRecording(newRecorder); err != nil {
+			// stop the tracks that are already recorded and close the session
+			c.StopClientRecording(recorder.StopConfig{})
 			return err
 		}
-		track.StartRecording(stream)
 	}
 
 	return nil
@@ -659,17 +734,64 @@ func (c *Client) StopClientRecording(stopConfig recorder.StopConfig) {
 	for _, track := range c.tracks.GetTracks() {
 		track.StopRecording()
 	}
-	if c.quicClient != nil {
-		c.quicClient.SendDatagram(serializeCloseDatagram(stopConfig))
-		c.quicClient = nil
+	c.isRecordingPaused.Store(false)
+
+	c.mu.Lock()
+	session := c.recordingSession
+	c.recordingSession = nil
+	c.mu.Unlock()
+
+	if session != nil {
+		// the stop config is sent after the queued packets
+		session.Close(stopConfig)
+	}
+}
+
+// RecordingHealth returns the state of the connection to the recorder service of the client recording,
+// false if the client is not recorded with StartClientRecording.
+func (c *Client) RecordingHealth() (recorder.SessionHealth, bool) {
+	c.mu.RLock()
+	session := c.recordingSession
+	c.mu.RUnlock()
+
+	if session == nil {
+		return recorder.SessionHealth{}, false
+	}
+
+	return session.Health(), true
+}
+
+// OnRecordingHealthChanged is called when the connection of the client recording to the recorder service is connected, lost or closed.
+func (c *Client) OnRecordingHealthChanged(callback func(recorder.SessionHealth)) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onRecordingHealthChangedCallbacks = append(c.onRecordingHealthChangedCallbacks, callback)
+}
+
+func (c *Client) onRecordingHealth(health recorder.SessionHealth) {
+	if !health.Connected && health.State != recorder.SessionStateClosed {
+		c.log.Warnf("client: recording connection is %s: %s", health.State, health.LastError)
+	}
+
+	c.muCallback.Lock()
+	callbacks := c.onRecordingHealthChangedCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback(health)
 	}
 }
 
 func (c *Client) PauseClientRecording() {
-	swp := c.isRecording.CompareAndSwap(true, false)
-	if !swp {
+	if !c.isRecording.Load() {
 		return // not recording
 	}
+
+	swp := c.isRecordingPaused.CompareAndSwap(false, true)
+	if !swp {
+		return // already paused
+	}
 	for _, track := range c.tracks.GetTracks() {
 		track.PauseRecording()
 	}
@@ -688,23 +810,41 @@ func (c *Client) ContinueClientRecording() {
 /*
 startRoomRecording is called by the room to record the whole room
 */
-func (c *Client) startRoomRecording(conn quic.Connection) error {
+func (c *Client) startRoomRecording(newRecorder recorder.NewTrackRecorderFunc) error {
 	c.log.Infof("client: start recording")
 	swp := c.isRecording.CompareAndSwap(false, true)
 	if !swp {
 		return nil // already recording
 	}
 	for _, track := range c.tracks.GetTracks() {
-		stream, err := conn.OpenUniStream()
-		if err != nil {
+		if err := track.StartRecording(newRecorder); err != nil {
 			return err
 		}
-		track.StartRecording(stream)
 	}
 
 	return nil
 }
 
+// localTrackRecorder records the tracks to {directory}/{bucket name}/{file name}_{client id}_{track id},
+// the file name of the track config is used when it's set by a rotation
+func localTrackRecorder(conf recorder.FileConfig, bucketName, filename string) (recorder.NewTrackRecorderFunc, error) {
+	directory, err := recorder.BucketDirectory(conf.Directory, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.Directory = directory
+
+	return func(trackConf *recorder.TrackConfig) (recorder.TrackRecorder, error) {
+		fileTrackConf := *trackConf
+		if fileTrackConf.FileName == "" {
+			fileTrackConf.FileName = filename
+		}
+
+		return recorder.NewFileTrackRecorder(&fileTrackConf, conf)
+	}, nil
+}
+
 func (c *Client) stopRoomRecording() {
 	swp := c.isRecording.CompareAndSwap(true, false)
 	if !swp {
@@ -713,6 +853,7 @@ func (c *Client) stopRoomRecording() {
 	for _, track := range c.tracks.GetTracks() {
 		track.StopRecording()
 	}
+	c.isRecordingPaused.Store(false)
 }
 
 func (c *Client) pauseRoomRecording() {
@@ -746,7 +887,42 @@ func (c *Client) initDataChannel() {
 		c.log.Errorf("client: error create internal data channel %s", err.Error())
 	}
 
+	if internalDataChannel != nil {
+		// the recording state that changed before the data channel is opened
+		internalDataChannel.OnOpen(c.sendPendingRecordingState)
+	}
+
+	c.mu.Lock()
 	c.internalDataChannel = internalDataChannel
+	c.mu.Unlock()
+}
+
+// announceAvailableTracks triggers OnTracksAvailable with the tracks of the other clients and the relay tracks of the room
+func (c *Client) announceAvailableTracks() {
+	availableTracks := make([]ITrack, 0)
+
+	for _, client := range c.SFU().clients.GetClients() {
+		for _, track := range client.tracks.GetTracks() {
+			_, err := c.publishedTracks.Get(track.ID())
+			if track.ClientID() != c.ID() {
+				if err == ErrTrackIsNotExists {
+					availableTracks = append(availableTracks, track)
+				} else {
+					client.log.Errorf("client: track already exists")
+				}
+			}
+		}
+	}
+
+	// add relay tracks
+	for _, track := range c.SFU().getRelayTracks() {
+		availableTracks = append(availableTracks, track)
+	}
+
+	if len(availableTracks) > 0 {
+		c.log.Infof("client: ", c.ID(), " available tracks ", len(availableTracks))
+		c.onTracksAvailable(availableTracks)
+	}
 }
 
 func (c *Client) ID() string {
@@ -971,7 +1147,7 @@ func (c *Client) setOpusSDP(sdp webrtc.SessionDescription) webrtc.SessionDescrip
 
 // OnBeforeRenegotiation event is called before the SFU is trying to renegotiate with the client.
 // The client must be listen for this event and set the callback to return true if the client is ready to renegotiate
-// and no current negotiation is in progress from the client.
+// and no current negotiation is in progress from the client. Returning false delays the renegotiation, it's retried until the callback returns true.
 func (c *Client) OnBeforeRenegotiation(callback func(context.Context) bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -979,6 +1155,15 @@ func (c *Client) OnBeforeRenegotiation(callback func(context.Context) bool) {
 	c.onBeforeRenegotiation = callback
 }
 
+// OnRenegotiationFailed event is called when the SFU fails to create or set the offer after OnBeforeRenegotiation returned true.
+// Use it to release anything acquired in OnBeforeRenegotiation.
+func (c *Client) OnRenegotiationFailed(callback func(context.Context, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onRenegotiationFailed = callback
+}
+
 // OnRenegotiation event is called when the SFU is trying to renegotiate with the client.
 // The callback will receive the SDP offer from the SFU that must be use to create the SDP answer from the client.
 // The SDP answer then can be passed back to the SFU using `client.CompleteNegotiation()` method.
@@ -1043,9 +1228,17 @@ func (c *Client) renegotiate() {
 					return
 				}
 
+				// the remote peer is not ready, try again on the next loop
+				if c.onBeforeRenegotiation != nil && !c.onBeforeRenegotiation(c.context) {
+					c.negotiationNeeded.Store(c.context.Err() == nil)
+					continue
+				}
+
 				offer, err := c.peerConnection.PC().CreateOffer(nil)
 				if err != nil {
 					c.log.Errorf("sfu: error create offer on renegotiation ", err)
+					c.renegotiationFailed(err)
+
 					return
 				}
 
@@ -1053,6 +1246,7 @@ func (c *Client) renegotiate() {
 				err = c.peerConnection.PC().SetLocalDescription(offer)
 				if err != nil {
 					c.log.Errorf("sfu: error set local description on renegotiation ", err)
+					c.renegotiationFailed(err)
 					_ = c.stop()
 
 					return
@@ -1088,6 +1282,17 @@ func (c *Client) renegotiate() {
 
 }
 
+// renegotiationFailed informs the callback that the renegotiation failed after OnBeforeRenegotiation returned true
+func (c *Client) renegotiationFailed(err error) {
+	c.mu.RLock()
+	callback := c.onRenegotiationFailed
+	c.mu.RUnlock()
+
+	if callback != nil {
+		callback(c.context, err)
+	}
+}
+
 // OnAllowedRemoteRenegotiation event is called when the SFU is done with the renegotiation
 // and ready to receive the renegotiation from the client.
 // Use this event to trigger the client to do renegotiation if needed.
@@ -1125,7 +1330,15 @@ func (c *Client) setClientTrack(t ITrack) iClientTrack {
 
 	localTrack := outputTrack.LocalTrack()
 
-	senderTcv, err := c.peerConnection.PC().AddTransceiverFromTrack(localTrack, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+	var trackLocal webrtc.TrackLocal = localTrack
+
+	var dtmfTrack *dtmfTrackLocal
+	if t.Kind() == webrtc.RTPCodecTypeAudio {
+		dtmfTrack = newDTMFTrackLocal(localTrack)
+		trackLocal = dtmfTrack
+	}
+
+	senderTcv, err := c.peerConnection.PC().AddTransceiverFromTrack(trackLocal, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
 	if err != nil {
 		c.log.Errorf("client: error on adding track ", err)
 		return nil
@@ -1150,6 +1363,13 @@ func (c *Client) setClientTrack(t ITrack) iClientTrack {
 			c.muTracks.Lock()
 			delete(c.clientTracks, outputTrack.ID())
 			c.publishedTracks.remove([]string{outputTrack.ID()})
+
+			for i, track := range c.dtmfTracks {
+				if track == dtmfTrack {
+					c.dtmfTracks = append(c.dtmfTracks[:i], c.dtmfTracks[i+1:]...)
+					break
+				}
+			}
 			c.muTracks.Unlock()
 		}()
 
@@ -1167,6 +1387,9 @@ func (c *Client) setClientTrack(t ITrack) iClientTrack {
 
 	c.muTracks.Lock()
 	c.clientTracks[outputTrack.ID()] = outputTrack
+	if dtmfTrack != nil {
+		c.dtmfTracks = append(c.dtmfTracks, dtmfTrack)
+	}
 	c.muTracks.Unlock()
 
 	return outputTrack
@@ -1208,6 +1431,8 @@ func (c *Client) enableReportAndStats(rtpSender *webrtc.RTPSender, track iClient
 						track.RequestPLI()
 					case *rtcp.FullIntraRequest:
 						track.RequestPLI()
+					case *rtcp.ReceiverReport:
+						track.onReceiverReport()
 					}
 				}
 			}
@@ -1232,13 +1457,16 @@ func (c *Client) enableReportAndStats(rtpSender *webrtc.RTPSender, track iClient
 }
 
 func (c *Client) processPendingTracks() {
-	if len(c.pendingReceivedTracks) > 0 {
-		err := c.SubscribeTracks(c.pendingReceivedTracks)
+	c.mu.Lock()
+	pendingTracks := c.pendingReceivedTracks
+	c.pendingReceivedTracks = make([]SubscribeTrackRequest, 0)
+	c.mu.Unlock()
+
+	if len(pendingTracks) > 0 {
+		err := c.SubscribeTracks(pendingTracks)
 		if err != nil {
 			c.log.Errorf("client: error subscribe tracks %s ", err.Error())
 		}
-
-		c.pendingReceivedTracks = make([]SubscribeTrackRequest, 0)
 	}
 }
 
@@ -1261,8 +1489,9 @@ func (c *Client) afterClosed() {
 
 	c.onLeft()
 
-	c.sfu.onAfterClientStopped(c)
+	c.SFU().onAfterClientStopped(c)
 
+	c.stopSFUContext()
 	c.cancel()
 }
 
@@ -1289,7 +1518,7 @@ func (c *Client) End() {
 
 	removed := make(chan bool)
 
-	c.sfu.OnClientRemoved(func(removedClient *Client) {
+	c.SFU().OnClientRemoved(func(removedClient *Client) {
 		if removedClient.ID() == c.ID() {
 			removed <- true
 		}
@@ -1358,9 +1587,11 @@ func (c *Client) onConnectionStateChanged(state webrtc.PeerConnectionState) {
 
 func (c *Client) onJoined() {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	callbacks := c.onJoinedCallbacks
+	c.mu.RUnlock()
 
-	for _, callback := range c.onJoinedCallbacks {
+	// the callbacks are called without the lock, the room sends the recording state to the joined client
+	for _, callback := range callbacks {
 		callback()
 	}
 }
@@ -1494,13 +1725,15 @@ func (c *Client) SetTracksSourceType(trackTypes map[string]TrackType) {
 	if len(availableTracks) > 0 {
 		// broadcast to other clients available tracks from this client
 		c.log.Debugf("client: %s set source tracks %d", c.ID(), len(availableTracks))
-		c.sfu.onTracksAvailable(c.ID(), availableTracks)
+		c.SFU().onTracksAvailable(c.ID(), availableTracks)
 	}
 }
 
 // SubscribeTracks subscribe tracks from other clients that are published to this client
 // The client must listen for `client.OnTracksAvailable` to know if a new track is available to subscribe.
 // Calling subscribe tracks will trigger the SFU renegotiation with the client.
+// The requests are processed in order, when a track is not found or not allowed the error is returned and
+// the tracks of the requests before it are still subscribed, the tracks of the requests after it are not.
 func (c *Client) SubscribeTracks(req []SubscribeTrackRequest) error {
 	if c.peerConnection.PC().ConnectionState() != webrtc.PeerConnectionStateConnected {
 		c.mu.Lock()
@@ -1510,7 +1743,7 @@ func (c *Client) SubscribeTracks(req []SubscribeTrackRequest) error {
 		return nil
 	}
 
-	clientTracks := make([]iClientTrack, 0)
+	tracks := make([]ITrack, 0)
 
 	for _, r := range req {
 		trackFound := false
@@ -1520,17 +1753,21 @@ func (c *Client) SubscribeTracks(req []SubscribeTrackRequest) error {
 			continue
 		}
 
-		client, err := c.sfu.clients.GetClient(r.ClientID)
+		client, err := c.SFU().clients.GetClient(r.ClientID)
 		if err != nil {
 			return err
 		}
 
 		for _, track := range client.tracks.GetTracks() {
 			if track.ID() == r.TrackID {
-				if clientTrack := c.setClientTrack(track); clientTrack != nil {
-					clientTracks = append(clientTracks, clientTrack)
+				if !c.canSubscribe(track) {
+					c.subscribeTracks(tracks)
+
+					return ErrTrackNotAllowed
 				}
 
+				tracks = append(tracks, track)
+
 				c.log.Debugf("client: subscribe track %s from %s to %s", r.TrackID, r.ClientID, c.ID())
 
 				trackFound = true
@@ -1539,21 +1776,43 @@ func (c *Client) SubscribeTracks(req []SubscribeTrackRequest) error {
 		}
 
 		// look on relay tracks
-		for _, track := range c.SFU().relayTracks {
+		for _, track := range c.SFU().getRelayTracks() {
 			if track.ID() == r.TrackID {
-				if clientTrack := c.setClientTrack(track); clientTrack != nil {
-					clientTracks = append(clientTracks, clientTrack)
+				if !c.canSubscribe(track) {
+					c.subscribeTracks(tracks)
+
+					return ErrTrackNotAllowed
 				}
 
+				tracks = append(tracks, track)
+
 				trackFound = true
 			}
 		}
 
 		if !trackFound {
+			// the tracks before the missing track are still subscribed
+			c.subscribeTracks(tracks)
+
 			return fmt.Errorf("client: track %s not found", r.TrackID)
 		}
 	}
 
+	c.subscribeTracks(tracks)
+
+	return nil
+}
+
+// subscribeTracks adds the tracks to the connected client, the tracks don't need to be published in the room
+func (c *Client) subscribeTracks(tracks []ITrack) {
+	clientTracks := make([]iClientTrack, 0)
+
+	for _, track := range tracks {
+		if clientTrack := c.setClientTrack(track); clientTrack != nil {
+			clientTracks = append(clientTracks, clientTrack)
+		}
+	}
+
 	if len(clientTracks) > 0 {
 		// claim bitrates
 		if err := c.bitrateController.addClaims(clientTracks); err != nil {
@@ -1565,8 +1824,6 @@ func (c *Client) SubscribeTracks(req []SubscribeTrackRequest) error {
 			track.RequestPLI()
 		}
 	}
-
-	return nil
 }
 
 // SetQuality method is to set the maximum quality of the video that will be sent to the client.
@@ -1623,7 +1880,7 @@ func (c *Client) createDataChannel(label string, initOpts *webrtc.DataChannelIni
 	}
 
 	c.log.Infof("client: data channel created ", label, " ", c.ID())
-	c.sfu.setupMessageForwarder(c.ID(), newDc)
+	c.SFU().setupMessageForwarder(c.ID(), newDc)
 	c.dataChannels.Add(newDc)
 
 	return nil
@@ -1686,6 +1943,132 @@ func (c *Client) SetReceivingBandwidthLimit(bandwidth uint32) {
 	c.receivingBandwidth.Store(bandwidth)
 }
 
+// SetPlayoutDelay sets the playout delay in milliseconds of a track that the client receives.
+// The delay is applied on the next packet, so it can be changed without renegotiation, for example when the client
+// switch between interactive mode (0-100 ms) and viewing mode (400 ms or more).
+func (c *Client) SetPlayoutDelay(trackID string, min, max uint16) error {
+	if c.playoutDelayInterceptor == nil {
+		return ErrPlayoutDelayDisabled
+	}
+
+	if min > max {
+		return ErrPlayoutDelayInvalid
+	}
+
+	ssrc, err := c.getSenderSSRC(trackID)
+	if err != nil {
+		return err
+	}
+
+	return c.playoutDelayInterceptor.SetDelay(uint32(ssrc), min, max)
+}
+
+// ResetPlayoutDelay removes the playout delay of a track that set with SetPlayoutDelay,
+// the track will use the default playout delay of the client.
+func (c *Client) ResetPlayoutDelay(trackID string) error {
+	if c.playoutDelayInterceptor == nil {
+		return ErrPlayoutDelayDisabled
+	}
+
+	ssrc, err := c.getSenderSSRC(trackID)
+	if err != nil {
+		return err
+	}
+
+	c.playoutDelayInterceptor.ResetDelay(uint32(ssrc))
+
+	return nil
+}
+
+// SetDefaultPlayoutDelay sets the playout delay in milliseconds of all tracks that the client receives,
+// except the tracks that have their own playout delay set with SetPlayoutDelay.
+func (c *Client) SetDefaultPlayoutDelay(min, max uint16) error {
+	if c.playoutDelayInterceptor == nil {
+		return ErrPlayoutDelayDisabled
+	}
+
+	if min > max {
+		return ErrPlayoutDelayInvalid
+	}
+
+	return c.playoutDelayInterceptor.SetDefaultDelay(min, max)
+}
+
+// SetJitterBufferLatency changes the min and max wait of the jitter buffer for the published tracks with the kind,
+// including the tracks that will be published later. Only works if ReorderPackets option is enabled.
+func (c *Client) SetJitterBufferLatency(kind webrtc.RTPCodecType, minWait, maxWait time.Duration) error {
+	if !c.options.ReorderPackets {
+		return ErrJitterBufferDisabled
+	}
+
+	if minWait > maxWait {
+		return ErrInvalidJitterBufferLatency
+	}
+
+	c.jitterBufferMu.Lock()
+	if kind == webrtc.RTPCodecTypeAudio {
+		c.options.AudioJitterBufferMinWait = minWait
+		c.options.AudioJitterBufferMaxWait = maxWait
+	} else {
+		c.options.JitterBufferMinWait = minWait
+		c.options.JitterBufferMaxWait = maxWait
+	}
+	c.jitterBufferMu.Unlock()
+
+	for _, track := range c.tracks.GetTracks() {
+		if track.Kind() != kind {
+			continue
+		}
+
+		remoteTracks := make([]*remoteTrack, 0, 3)
+
+		if track.IsSimulcast() {
+			simulcastTrack := track.(*SimulcastTrack)
+			simulcastTrack.mu.Lock()
+			remoteTracks = append(remoteTracks, simulcastTrack.remoteTrackHigh, simulcastTrack.remoteTrackMid, simulcastTrack.remoteTrackLow)
+			simulcastTrack.mu.Unlock()
+		} else {
+			remoteTracks = append(remoteTracks, track.(*Track).RemoteTrack())
+		}
+
+		for _, remoteTrack := range remoteTracks {
+			if remoteTrack != nil && remoteTrack.Buffered() {
+				remoteTrack.Buffer().SetLatency(minWait, maxWait)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) jitterBufferWait(kind webrtc.RTPCodecType) (time.Duration, time.Duration) {
+	c.jitterBufferMu.RLock()
+	defer c.jitterBufferMu.RUnlock()
+
+	if kind == webrtc.RTPCodecTypeAudio {
+		return c.options.AudioJitterBufferMinWait, c.options.AudioJitterBufferMaxWait
+	}
+
+	return c.options.JitterBufferMinWait, c.options.JitterBufferMaxWait
+}
+
+func (c *Client) getSenderSSRC(trackID string) (webrtc.SSRC, error) {
+	for _, sender := range c.peerConnection.PC().GetSenders() {
+		if sender.Track() == nil || sender.Track().ID() != trackID {
+			continue
+		}
+
+		encodings := sender.GetParameters().Encodings
+		if len(encodings) == 0 {
+			break
+		}
+
+		return encodings[0].SSRC, nil
+	}
+
+	return 0, ErrTrackIsNotExists
+}
+
 // SetName update the name of the client, that previously set on create client
 // The name then later can use by call client.Name() method
 func (c *Client) SetName(name string) {
@@ -1719,7 +2102,7 @@ func (c *Client) Stats() ClientTrackStats {
 			if simulcastClientTrack.remoteTrackHigh != nil {
 				stats, err := c.stats.GetReceiver(simulcastClientTrack.remoteTrackHigh.Track().ID(), simulcastClientTrack.remoteTrackHigh.Track().RID())
 				if err == nil {
-					receivedStats, err := generateClientReceiverStats(c, simulcastClientTrack.remoteTrackHigh.Track(), stats)
+					receivedStats, err := generateClientReceiverStats(c, simulcastClientTrack.remoteTrackHigh, stats)
 					if err == nil {
 						clientStats.Receives = append(clientStats.Receives, receivedStats)
 					}
@@ -1730,7 +2113,7 @@ func (c *Client) Stats() ClientTrackStats {
 			if simulcastClientTrack.remoteTrackMid != nil {
 				stats, err := c.stats.GetReceiver(simulcastClientTrack.remoteTrackMid.Track().ID(), simulcastClientTrack.remoteTrackMid.Track().RID())
 				if err == nil {
-					receivedStats, err := generateClientReceiverStats(c, simulcastClientTrack.remoteTrackMid.Track(), stats)
+					receivedStats, err := generateClientReceiverStats(c, simulcastClientTrack.remoteTrackMid, stats)
 					if err == nil {
 						clientStats.Receives = append(clientStats.Receives, receivedStats)
 					}
@@ -1741,7 +2124,7 @@ func (c *Client) Stats() ClientTrackStats {
 			if simulcastClientTrack.remoteTrackLow != nil {
 				stats, err := c.stats.GetReceiver(simulcastClientTrack.remoteTrackLow.Track().ID(), simulcastClientTrack.remoteTrackLow.Track().RID())
 				if err == nil {
-					receivedStats, err := generateClientReceiverStats(c, simulcastClientTrack.remoteTrackLow.Track(), stats)
+					receivedStats, err := generateClientReceiverStats(c, simulcastClientTrack.remoteTrackLow, stats)
 					if err == nil {
 						clientStats.Receives = append(clientStats.Receives, receivedStats)
 					}
@@ -1756,7 +2139,7 @@ func (c *Client) Stats() ClientTrackStats {
 				continue
 			}
 
-			receivedStats, err := generateClientReceiverStats(c, track.(*Track).RemoteTrack().Track(), stat)
+			receivedStats, err := generateClientReceiverStats(c, t.RemoteTrack(), stat)
 			if err != nil {
 				continue
 			}
@@ -1811,7 +2194,14 @@ func (c *Client) IsDebugEnabled() bool {
 }
 
 func (c *Client) SFU() *SFU {
-	return c.sfu
+	return c.sfu.Load()
+}
+
+// RoomID returns the ID of the room of the client, it changes when the client is moved to another room
+func (c *Client) RoomID() string {
+	roomID, _ := c.roomId.Load().(string)
+
+	return roomID
 }
 
 // OnTracksAvailable event is called when the SFU is trying to publish new tracks to the client.
@@ -1823,9 +2213,36 @@ func (c *Client) OnTracksAvailable(callback func([]ITrack)) {
 }
 
 func (c *Client) onTracksAvailable(tracks []ITrack) {
+	visibleTracks := make([]ITrack, 0, len(tracks))
+	for _, track := range tracks {
+		if c.canSubscribe(track) {
+			visibleTracks = append(visibleTracks, track)
+		}
+	}
+
+	if len(visibleTracks) == 0 {
+		return
+	}
+
 	for _, callback := range c.onTracksAvailableCallbacks {
-		callback(tracks)
+		callback(visibleTracks)
+	}
+}
+
+// canSubscribe returns false when the track is from a hidden client or the client is not allowed to subscribe the track
+func (c *Client) canSubscribe(track ITrack) bool {
+	if !track.IsSubscriberAllowed(c.ID()) {
+		return false
 	}
+
+	owner, err := c.SFU().clients.GetClient(track.ClientID())
+
+	return err != nil || !owner.IsHidden()
+}
+
+// IsHidden returns true when the tracks of the client are not announced to the other clients
+func (c *Client) IsHidden() bool {
+	return c.hidden.Load()
 }
 
 // OnVoiceDetected event is called when the SFU is detecting voice activity in the room.
@@ -1948,7 +2365,8 @@ func registerInterceptors(m *webrtc.MediaEngine, interceptorRegistry *intercepto
 	return webrtc.ConfigureTWCCSender(m, interceptorRegistry)
 }
 
-func generateClientReceiverStats(c *Client, track IRemoteTrack, stat stats.Stats) (TrackReceivedStats, error) {
+func generateClientReceiverStats(c *Client, remoteTrack *remoteTrack, stat stats.Stats) (TrackReceivedStats, error) {
+	track := remoteTrack.Track()
 	bitrate, _ := c.stats.GetReceiverBitrate(track.ID(), track.RID())
 
 	receivedStats := TrackReceivedStats{
@@ -1963,6 +2381,14 @@ func generateClientReceiverStats(c *Client, track IRemoteTrack, stat stats.Stats
 		PacketsReceived: stat.InboundRTPStreamStats.PacketsReceived,
 	}
 
+	if remoteTrack.Buffered() {
+		bufferStats := remoteTrack.Buffer().Stats()
+		receivedStats.JitterBufferLatency = uint32(bufferStats.Latency.Milliseconds())
+		receivedStats.PacketsReordered = bufferStats.PacketsReordered
+		receivedStats.PacketsLate = bufferStats.PacketsLate
+		receivedStats.PacketsDuplicate = bufferStats.PacketsDuplicate
+	}
+
 	return receivedStats, nil
 }
 
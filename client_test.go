@@ -269,3 +269,132 @@ func TestClientDataChannel(t *testing.T) {
 		require.Equal(t, "internal", dc.Label())
 	}
 }
+
+func TestClientSetPlayoutDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	defer testRoom.Close()
+
+	// the invalid delay is not stored for the clients that join later
+	require.ErrorIs(t, testRoom.SetPlayoutDelay(400, 200), ErrPlayoutDelayInvalid)
+	require.Nil(t, testRoom.Options().MinPlayoutDelay)
+	require.Nil(t, testRoom.Options().MaxPlayoutDelay)
+
+	pc, client, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "peer", true, false)
+	defer pc.PeerConnection.Close()
+
+	require.Eventually(t, func() bool {
+		return client.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	playback, err := testRoom.PlayMedia(writeWav(t, wavFormatMuLaw, 8, make([]byte, 800)), PlayMediaOptions{ClientID: client.ID(), Loop: true})
+	require.NoError(t, err)
+
+	defer playback.Stop()
+
+	require.NoError(t, client.SetPlayoutDelay(playback.ID(), 200, 400))
+	require.ErrorIs(t, client.SetPlayoutDelay(playback.ID(), 400, 200), ErrPlayoutDelayInvalid)
+	require.ErrorIs(t, client.SetPlayoutDelay("unknown", 200, 400), ErrTrackIsNotExists)
+	require.NoError(t, client.ResetPlayoutDelay(playback.ID()))
+
+	require.NoError(t, client.SetDefaultPlayoutDelay(0, 100))
+	require.ErrorIs(t, client.SetDefaultPlayoutDelay(100, 0), ErrPlayoutDelayInvalid)
+
+	// the virtual publisher doesn't receive tracks
+	publisher, err := testRoom.SFU().GetClient(playback.ID())
+	require.NoError(t, err)
+	require.ErrorIs(t, publisher.SetPlayoutDelay(playback.ID(), 200, 400), ErrPlayoutDelayDisabled)
+
+	require.NoError(t, testRoom.SetPlayoutDelay(200, 400))
+	require.Equal(t, uint16(200), *testRoom.Options().MinPlayoutDelay)
+	require.Equal(t, uint16(400), *testRoom.Options().MaxPlayoutDelay)
+}
+
+func TestClientSetJitterBufferLatency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	defer testRoom.Close()
+
+	pc1, unbuffered, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "unbuffered", true, false)
+	defer pc1.PeerConnection.Close()
+
+	require.ErrorIs(t, unbuffered.SetJitterBufferLatency(webrtc.RTPCodecTypeAudio, 0, 100*time.Millisecond), ErrJitterBufferDisabled)
+
+	// a publisher with the jitter buffer enabled, CreatePeerPair uses the default client options
+	opts := DefaultClientOptions()
+	opts.ReorderPackets = true
+
+	client, err := testRoom.AddClient("buffered", "buffered", opts)
+	require.NoError(t, err)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: DefaultTestIceServers()})
+	require.NoError(t, err)
+
+	defer pc.Close()
+
+	iceConnectedCtx, iceConnectedCancel := context.WithCancel(ctx)
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			iceConnectedCancel()
+		}
+	})
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			_ = client.PeerConnection().PC().AddICECandidate(candidate.ToJSON())
+		}
+	})
+
+	client.OnIceCandidate(func(_ context.Context, candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			_ = pc.AddICECandidate(candidate.ToJSON())
+		}
+	})
+
+	client.OnTracksAdded(func(addedTracks []ITrack) {
+		setTracks := make(map[string]TrackType)
+		for _, track := range addedTracks {
+			setTracks[track.ID()] = TrackTypeMedia
+		}
+
+		client.SetTracksSourceType(setTracks)
+	})
+
+	tracks, _ := GetStaticTracks(ctx, iceConnectedCtx, "buffered", true)
+	SetPeerConnectionTracks(ctx, pc, tracks)
+
+	negotiate(pc, client, TestLogger)
+
+	require.Eventually(t, func() bool {
+		return len(client.Tracks()) == 2
+	}, 30*time.Second, 100*time.Millisecond)
+
+	require.ErrorIs(t, client.SetJitterBufferLatency(webrtc.RTPCodecTypeAudio, 100*time.Millisecond, 0), ErrInvalidJitterBufferLatency)
+	require.NoError(t, client.SetJitterBufferLatency(webrtc.RTPCodecTypeAudio, 30*time.Millisecond, 300*time.Millisecond))
+
+	// the latency only reaches the buffers of the tracks with the kind
+	for _, track := range client.Tracks() {
+		remoteTrack := track.(*Track).RemoteTrack()
+		require.True(t, remoteTrack.Buffered())
+
+		if track.Kind() == webrtc.RTPCodecTypeAudio {
+			require.Equal(t, 300*time.Millisecond, remoteTrack.Buffer().MaxLatency())
+		} else {
+			require.Equal(t, opts.JitterBufferMaxWait, remoteTrack.Buffer().MaxLatency())
+		}
+	}
+}
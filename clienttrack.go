@@ -3,6 +3,7 @@ package sfu
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
@@ -28,6 +29,8 @@ type iClientTrack interface {
 	SendBitrate() uint32
 	Quality() QualityLevel
 	OnEnded(func())
+	onReceiverReport()
+	end()
 }
 
 type clientTrack struct {
@@ -44,6 +47,12 @@ type clientTrack struct {
 	isScreen              bool
 	ssrc                  webrtc.SSRC
 	onTrackEndedCallbacks []func()
+	gopCache              *gopCache
+	gopReplay             *gopReplay
+	blankFrames           *blankFrames
+	isPaused              *atomic.Bool
+	cancel                context.CancelFunc
+	endOnce               sync.Once
 }
 
 func newClientTrack(c *Client, t *Track, isScreen bool, localTrack webrtc.TrackLocal) *clientTrack {
@@ -66,12 +75,14 @@ func newClientTrack(c *Client, t *Track, isScreen bool, localTrack webrtc.TrackL
 		isScreen:              isScreen,
 		ssrc:                  t.remoteTrack.track.SSRC(),
 		onTrackEndedCallbacks: make([]func(), 0),
+		gopCache:              t.gopCache,
+		gopReplay:             newGOPReplay(),
+		blankFrames:           newBlankFrames(t.base.codec.RTPCodecCapability),
+		isPaused:              &atomic.Bool{},
+		cancel:                cancel,
 	}
 
-	t.OnEnded(func() {
-		ct.onEnded()
-		cancel()
-	})
+	t.OnEnded(ct.end)
 
 	return ct
 }
@@ -131,11 +142,82 @@ func (t *clientTrack) push(p *rtp.Packet, _ QualityLevel) {
 		// do something here with audio level
 	}
 
+	if t.Kind() == webrtc.RTPCodecTypeVideo {
+		if t.baseTrack.isMuted.Load() || t.isPaused.Load() {
+			t.pushBlankFrames(p)
+			return
+		}
+
+		if t.blankFrames.Reset() && !IsKeyframe(t.baseTrack.codec.MimeType, p) {
+			// the frames after the black frames can't be decoded without a keyframe
+			t.remoteTrack.sendPLI()
+		}
+
+		t.pushWithGOPReplay(p)
+
+		return
+	}
+
+	if err := t.localTrack.WriteRTP(p); err != nil {
+		t.client.log.Errorf("clienttrack: error on write rtp", err)
+	}
+}
+
+// pushWithGOPReplay sends the cached keyframe before the live packet if a replay is requested,
+// then rewrites the live packet to continue the sequence numbers and timestamps of the replayed packets.
+func (t *clientTrack) pushWithGOPReplay(p *rtp.Packet) {
+	if t.gopReplay.Consume() {
+		cached := t.gopCache.Packets()
+		if len(cached) == 0 {
+			t.remoteTrack.sendPLI()
+		} else {
+			for _, replayPacket := range t.gopReplay.Replay(cached, p) {
+				if err := t.localTrack.WriteRTP(replayPacket); err != nil {
+					t.client.log.Errorf("clienttrack: error on write replay rtp", err)
+				}
+			}
+
+			t.gopReplay.KeyframeSent()
+		}
+	}
+
+	t.gopReplay.Rewrite(p)
+
+	if t.gopCache != nil && IsKeyframe(t.baseTrack.codec.MimeType, p) {
+		t.gopReplay.KeyframeSent()
+	}
+
 	if err := t.localTrack.WriteRTP(p); err != nil {
 		t.client.log.Errorf("clienttrack: error on write rtp", err)
 	}
 }
 
+// pushBlankFrames replaces the live packet with black frames while the track is muted or paused
+func (t *clientTrack) pushBlankFrames(p *rtp.Packet) {
+	packets := t.blankFrames.Next(p)
+
+	t.gopReplay.Substitute(packets, p)
+
+	for _, blankPacket := range packets {
+		if err := t.localTrack.WriteRTP(blankPacket); err != nil {
+			t.client.log.Errorf("clienttrack: error on write blank rtp", err)
+		}
+	}
+}
+
+// requestGOPReplay returns true if the cached keyframe will be replayed on the next packet
+func (t *clientTrack) requestGOPReplay() bool {
+	if t.gopCache == nil || !t.gopCache.HasKeyframe() {
+		return false
+	}
+
+	return t.gopReplay.Request()
+}
+
+func (t *clientTrack) onReceiverReport() {
+	t.gopReplay.SetReceiving()
+}
+
 func (t *clientTrack) LocalTrack() *webrtc.TrackLocalStaticRTP {
 	return t.localTrack
 }
@@ -160,14 +242,29 @@ func (t *clientTrack) IsScaleable() bool {
 }
 
 func (t *clientTrack) RequestPLI() {
+	if t.requestGOPReplay() {
+		return
+	}
+
 	t.remoteTrack.sendPLI()
 }
 
-func (t *clientTrack) SetMaxQuality(_ QualityLevel) {
-	// do nothing
+// SetMaxQuality with quality none will pause the video, the client will receive black frames until it's resumed
+// with any other quality. The bitrate controller sets quality none when the remote viewport of the track is 0x0,
+// so a plain video that is not displayed by the client is paused until the viewport has a size again.
+func (t *clientTrack) SetMaxQuality(quality QualityLevel) {
+	if t.Kind() != webrtc.RTPCodecTypeVideo {
+		return
+	}
+
+	t.isPaused.Store(quality == QualityNone)
 }
 
 func (t *clientTrack) MaxQuality() QualityLevel {
+	if t.isPaused.Load() {
+		return QualityNone
+	}
+
 	return QualityHigh
 }
 
@@ -190,6 +287,14 @@ func (t *clientTrack) OnEnded(f func()) {
 	t.onTrackEndedCallbacks = append(t.onTrackEndedCallbacks, f)
 }
 
+// end stops sending the track to the client when the source track is ended or the client unsubscribes it
+func (t *clientTrack) end() {
+	t.endOnce.Do(func() {
+		t.onEnded()
+		t.cancel()
+	})
+}
+
 func (t *clientTrack) onEnded() {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -20,7 +20,7 @@ type clientTrackRed struct {
 
 func newClientTrackRed(c *Client, t *Track) *clientTrackRed {
 	var localTrack *webrtc.TrackLocalStaticRTP
-	mimeType := t.remoteTrack.track.Codec().MimeType
+	mimeType := t.base.codec.MimeType
 
 	if !c.receiveRED {
 		mimeType = webrtc.MimeTypeOpus
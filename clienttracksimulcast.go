@@ -33,6 +33,11 @@ type simulcastClientTrack struct {
 	packetmapMid            *packetmap.Map
 	packetmapLow            *packetmap.Map
 	onTrackEndedCallbacks   []func()
+	gopReplay               *gopReplay
+	blankFrames             *blankFrames
+	cancel                  context.CancelFunc
+	endOnce                 sync.Once
+	replayed                *atomic.Bool
 }
 
 func newSimulcastClientTrack(c *Client, t *SimulcastTrack) *simulcastClientTrack {
@@ -75,16 +80,17 @@ func newSimulcastClientTrack(c *Client, t *SimulcastTrack) *simulcastClientTrack
 		packetmapHigh:           &packetmap.Map{},
 		packetmapMid:            &packetmap.Map{},
 		packetmapLow:            &packetmap.Map{},
+		gopReplay:               newGOPReplay(),
+		blankFrames:             newBlankFrames(t.base.codec.RTPCodecCapability),
+		cancel:                  cancel,
+		replayed:                &atomic.Bool{},
 	}
 
 	ct.SetMaxQuality(QualityHigh)
 
 	ct.remoteTrack.sendPLI()
 
-	t.OnEnded(func() {
-		ct.onEnded()
-		cancel()
-	})
+	t.OnEnded(ct.end)
 
 	return ct
 }
@@ -128,17 +134,20 @@ func (t *simulcastClientTrack) push(p *rtp.Packet, quality QualityLevel) {
 
 	targetQuality := t.getQuality()
 
-	if targetQuality == QualityNone {
-		// TODO: figure out what to do if the target quality is none
-		// probably we should send a blank frame
-		targetQuality = QualityLow
-	}
-
 	if !t.client.bitrateController.exists(t.ID()) {
 		// do nothing if the bitrate claim is not exist
 		return
 	}
 
+	if targetQuality == QualityNone || t.baseTrack.isMuted.Load() {
+		// the subscription is paused or the track is muted, replace the frames of the current quality with black frames
+		if currentQuality != QualityNone && quality == currentQuality {
+			t.sendBlankFrames(p, quality)
+		}
+
+		return
+	}
+
 	var canSwitch bool
 
 	if isKeyframe && quality == targetQuality && t.lastQuality.Load() != uint32(targetQuality) {
@@ -177,16 +186,28 @@ func (t *simulcastClientTrack) push(p *rtp.Packet, quality QualityLevel) {
 		// we try to send the low quality first	if the track is active and fallback to upper quality if not
 		if t.remoteTrack.getRemoteTrack(QualityLow) != nil && quality == QualityLow {
 			t.lastQuality.Store(uint32(QualityLow))
-			// send PLI to make sure the client will receive the first frame
-			t.remoteTrack.sendPLI()
+			// replay the cached keyframe or send PLI to make sure the client will receive the first frame
+			if t.replayGOP(quality) {
+				currentQuality = quality
+			} else {
+				t.remoteTrack.sendPLI()
+			}
 		} else if t.remoteTrack.getRemoteTrack(QualityMid) != nil && quality == QualityMid {
 			t.lastQuality.Store(uint32(QualityMid))
-			// send PLI to make sure the client will receive the first frame
-			t.remoteTrack.sendPLI()
+			// replay the cached keyframe or send PLI to make sure the client will receive the first frame
+			if t.replayGOP(quality) {
+				currentQuality = quality
+			} else {
+				t.remoteTrack.sendPLI()
+			}
 		} else if t.remoteTrack.getRemoteTrack(QualityHigh) != nil && quality == QualityHigh {
 			t.lastQuality.Store(uint32(QualityHigh))
-			// send PLI to make sure the client will receive the first frame
-			t.remoteTrack.sendPLI()
+			// replay the cached keyframe or send PLI to make sure the client will receive the first frame
+			if t.replayGOP(quality) {
+				currentQuality = quality
+			} else {
+				t.remoteTrack.sendPLI()
+			}
 		}
 
 		t.remoteTrack.onRemoteTrackAdded(func(remote *remoteTrack) {
@@ -202,13 +223,75 @@ func (t *simulcastClientTrack) push(p *rtp.Packet, quality QualityLevel) {
 		// request PLI to allow us switch quality to target quality
 		t.client.log.Infof("track: ", t.id, " keyframe ", isKeyframe, " send keyframe and sequence number ", p.SequenceNumber)
 		t.remoteTrack.sendPLI()
+
+		// the current quality is stalled, send black frames instead of freezing the last frame until the target quality keyframe is received
+		if currentQuality != QualityNone && !t.remoteTrack.isTrackActive(currentQuality) {
+			t.sendBlankFrames(p, quality)
+		}
 	}
 
 	if currentQuality == quality {
+		if t.gopReplay.Consume() && !t.replayGOP(quality) {
+			t.remoteTrack.sendPLI()
+		}
+
+		if isKeyframe {
+			t.gopReplay.KeyframeSent()
+		}
+
+		if t.blankFrames.Reset() && !isKeyframe {
+			// the frames after the black frames can't be decoded without a keyframe
+			t.remoteTrack.sendPLI()
+		}
+
 		t.send(p, quality)
 	}
 }
 
+// replayGOP sends the cached keyframe of the quality layer with rewritten sequence numbers and timestamps.
+// Returns false if there is no cached keyframe to replay.
+func (t *simulcastClientTrack) replayGOP(quality QualityLevel) bool {
+	cache := t.remoteTrack.getGOPCache(quality)
+	if cache == nil {
+		return false
+	}
+
+	cached := cache.Packets()
+	if len(cached) == 0 {
+		return false
+	}
+
+	for _, p := range cached {
+		copyPacket := p.Clone()
+		t.rewriteTimestamp(copyPacket, quality)
+		copyPacket.SequenceNumber = uint16(t.sequenceNumber.Add(1))
+		t.writeRTP(copyPacket)
+	}
+
+	// the next live packet continues after the replayed packets
+	t.replayed.Store(true)
+
+	t.gopReplay.KeyframeSent()
+
+	// clear the replay that requested before the first packet
+	_ = t.gopReplay.Consume()
+
+	return true
+}
+
+// sendBlankFrames sends black frames in place of the live packet with the rewritten timestamp of the live packet
+func (t *simulcastClientTrack) sendBlankFrames(p *rtp.Packet, quality QualityLevel) {
+	for _, blankPacket := range t.blankFrames.Next(p) {
+		t.rewriteTimestamp(blankPacket, quality)
+		blankPacket.SequenceNumber = uint16(t.sequenceNumber.Add(1))
+		t.writeRTP(blankPacket)
+	}
+}
+
+func (t *simulcastClientTrack) onReceiverReport() {
+	t.gopReplay.SetReceiving()
+}
+
 func (t *simulcastClientTrack) GetRemoteTrack() *remoteTrack {
 	lastQuality := Uint32ToQualityLevel(t.lastQuality.Load())
 	// lastQuality := t.lastQuality
@@ -276,16 +359,26 @@ func (t *simulcastClientTrack) onEnded() {
 		return
 	}
 
-	t.mu.Lock()
-	defer t.mu.Unlock()
+	// the callbacks are called without the lock because they can read the client of the track
+	t.mu.RLock()
+	callbacks := t.onTrackEndedCallbacks
+	t.mu.RUnlock()
 
-	for _, callback := range t.onTrackEndedCallbacks {
+	for _, callback := range callbacks {
 		callback()
 	}
 
 	t.isEnded.Store(true)
 }
 
+// end stops sending the track to the client when the source track is ended or the client unsubscribes it
+func (t *simulcastClientTrack) end() {
+	t.endOnce.Do(func() {
+		t.onEnded()
+		t.cancel()
+	})
+}
+
 func (t *simulcastClientTrack) SetMaxQuality(quality QualityLevel) {
 	t.maxQuality.Store(uint32(quality))
 	t.remoteTrack.sendPLI()
@@ -304,28 +397,51 @@ func (t *simulcastClientTrack) IsScaleable() bool {
 }
 
 func (t *simulcastClientTrack) rewritePacket(p *rtp.Packet, quality QualityLevel) {
+	t.rewriteTimestamp(p, quality)
+
 	t.remoteTrack.mu.RLock()
 	defer t.remoteTrack.mu.RUnlock()
 	// make sure the timestamp and sequence number is consistent from the previous packet even it is not the same track
 	sequenceDelta := uint16(0)
-	// credit to https://github.com/k0nserv for helping me with this on Pion Slack channel
 	switch quality {
 	case QualityHigh:
-		p.Timestamp = t.remoteTrack.baseTS + ((p.Timestamp - t.remoteTrack.remoteTrackHighBaseTS) - t.remoteTrack.remoteTrackHighBaseTS)
 		sequenceDelta = t.remoteTrack.highSequence - t.remoteTrack.lastHighSequence
 	case QualityMid:
-		p.Timestamp = t.remoteTrack.baseTS + ((p.Timestamp - t.remoteTrack.remoteTrackMidBaseTS) - t.remoteTrack.remoteTrackMidBaseTS)
 		sequenceDelta = t.remoteTrack.midSequence - t.remoteTrack.lastMidSequence
 	case QualityLow:
-		p.Timestamp = t.remoteTrack.baseTS + ((p.Timestamp - t.remoteTrack.remoteTrackLowBaseTS) - t.remoteTrack.remoteTrackLowBaseTS)
 		sequenceDelta = t.remoteTrack.lowSequence - t.remoteTrack.lastLowSequence
 	}
 
+	// the delta from the previous live packet doesn't account for the replayed packets,
+	// a late packet would reuse the sequence number of a replayed packet
+	if t.replayed.Swap(false) {
+		sequenceDelta = 1
+	}
+
 	t.sequenceNumber.Add(uint32(sequenceDelta))
 	p.SequenceNumber = uint16(t.sequenceNumber.Load())
 }
 
+func (t *simulcastClientTrack) rewriteTimestamp(p *rtp.Packet, quality QualityLevel) {
+	t.remoteTrack.mu.RLock()
+	defer t.remoteTrack.mu.RUnlock()
+	// credit to https://github.com/k0nserv for helping me with this on Pion Slack channel
+	switch quality {
+	case QualityHigh:
+		p.Timestamp = t.remoteTrack.baseTS + ((p.Timestamp - t.remoteTrack.remoteTrackHighBaseTS) - t.remoteTrack.remoteTrackHighBaseTS)
+	case QualityMid:
+		p.Timestamp = t.remoteTrack.baseTS + ((p.Timestamp - t.remoteTrack.remoteTrackMidBaseTS) - t.remoteTrack.remoteTrackMidBaseTS)
+	case QualityLow:
+		p.Timestamp = t.remoteTrack.baseTS + ((p.Timestamp - t.remoteTrack.remoteTrackLowBaseTS) - t.remoteTrack.remoteTrackLowBaseTS)
+	}
+}
+
 func (t *simulcastClientTrack) RequestPLI() {
+	// replay the cached keyframe of the current layer until the subscriber has received a keyframe
+	if cache := t.remoteTrack.getGOPCache(t.LastQuality()); cache != nil && cache.HasKeyframe() && t.gopReplay.Request() {
+		return
+	}
+
 	t.remoteTrack.sendPLI()
 }
 
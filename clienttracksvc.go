@@ -119,6 +119,16 @@ func (t *scaleableClientTrack) push(p *rtp.Packet, _ QualityLevel) {
 		// return
 	}
 
+	if t.baseTrack.isMuted.Load() || t.MaxQuality() == QualityNone {
+		t.pushBlankFrame(p, vp9Packet)
+		return
+	}
+
+	if t.blankFrames.Reset() && !t.isKeyframe(vp9Packet) {
+		// the frames after the black frames can't be decoded without a keyframe
+		t.RequestPLI()
+	}
+
 	switch quality {
 	case QualityHigh:
 		qualityPreset = t.qualityPresets.High
@@ -202,6 +212,25 @@ func (t *scaleableClientTrack) push(p *rtp.Packet, _ QualityLevel) {
 	t.send(p)
 }
 
+// pushBlankFrame replaces the first packet of a frame with a black frame and drops the other packets while the track is muted or paused.
+// The black frame fits in a single packet, so the packet map keeps the sequence numbers continuous.
+func (t *scaleableClientTrack) pushBlankFrame(p *rtp.Packet, vp9Packet *codecs.VP9Packet) {
+	packets := t.blankFrames.Next(p)
+	if len(packets) != 1 {
+		_ = t.packetmap.Drop(p.SequenceNumber, vp9Packet.PictureID)
+		return
+	}
+
+	ok, newseqno, _ := t.packetmap.Map(p.SequenceNumber, vp9Packet.PictureID)
+	if !ok {
+		return
+	}
+
+	packets[0].SequenceNumber = newseqno
+
+	t.send(packets[0])
+}
+
 func (t *scaleableClientTrack) send(p *rtp.Packet) {
 	t.mu.Lock()
 	t.lastTimestamp = p.Timestamp
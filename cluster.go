@@ -0,0 +1,419 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	clusterDefaultVirtualNodes = 64
+	clusterRegistryTimeout     = 5 * time.Second
+)
+
+var (
+	ErrClusterNoNodes         = errors.New("cluster: no nodes in the cluster")
+	ErrClusterRoomIsRemote    = errors.New("cluster: room is placed on another node")
+	ErrClusterRoomNotFound    = errors.New("cluster: room has no owner")
+	ErrClusterMissingNodeID   = errors.New("cluster: missing node id")
+	ErrClusterMissingRegistry = errors.New("cluster: missing registry")
+)
+
+// ClusterNode is a member of the cluster
+type ClusterNode struct {
+	ID string `json:"id"`
+	// The address of the signaling of the node, the clients of a remote room are redirected to this address
+	Address string `json:"address"`
+	// The data of the node that is needed to bridge or relay a room, like the address of the relay
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// ClusterRegistry keeps the members of the cluster and the owner node of each room, it's shared by all nodes like
+// a key value store. The owner of a room is claimed atomically so only one node owns a room.
+type ClusterRegistry interface {
+	Join(ctx context.Context, node ClusterNode) error
+	Leave(ctx context.Context, nodeID string) error
+	Nodes(ctx context.Context) ([]ClusterNode, error)
+	// ClaimRoom sets the node as the owner of the room if the room has no owner, and returns the owner of the room
+	ClaimRoom(ctx context.Context, roomID, nodeID string) (string, error)
+	// ReleaseRoom removes the owner of the room if the node is the owner
+	ReleaseRoom(ctx context.Context, roomID, nodeID string) error
+	// RoomOwner returns the owner of the room or ErrClusterRoomNotFound
+	RoomOwner(ctx context.Context, roomID string) (string, error)
+}
+
+// MemoryClusterRegistry is a registry for the nodes in one process, like the tests or a single node deployment
+type MemoryClusterRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]ClusterNode
+	rooms map[string]string
+}
+
+func NewMemoryClusterRegistry() *MemoryClusterRegistry {
+	return &MemoryClusterRegistry{
+		mu:    sync.Mutex{},
+		nodes: make(map[string]ClusterNode),
+		rooms: make(map[string]string),
+	}
+}
+
+func (r *MemoryClusterRegistry) Join(ctx context.Context, node ClusterNode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nodes[node.ID] = node
+
+	return nil
+}
+
+// Leave removes the node and releases its rooms
+func (r *MemoryClusterRegistry) Leave(ctx context.Context, nodeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.nodes, nodeID)
+
+	for roomID, owner := range r.rooms {
+		if owner == nodeID {
+			delete(r.rooms, roomID)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryClusterRegistry) Nodes(ctx context.Context) ([]ClusterNode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := make([]ClusterNode, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func (r *MemoryClusterRegistry) ClaimRoom(ctx context.Context, roomID, nodeID string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if owner, ok := r.rooms[roomID]; ok {
+		return owner, nil
+	}
+
+	r.rooms[roomID] = nodeID
+
+	return nodeID, nil
+}
+
+func (r *MemoryClusterRegistry) ReleaseRoom(ctx context.Context, roomID, nodeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rooms[roomID] == nodeID {
+		delete(r.rooms, roomID)
+	}
+
+	return nil
+}
+
+func (r *MemoryClusterRegistry) RoomOwner(ctx context.Context, roomID string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owner, ok := r.rooms[roomID]
+	if !ok {
+		return "", ErrClusterRoomNotFound
+	}
+
+	return owner, nil
+}
+
+type ClusterOptions struct {
+	// The node of the manager
+	Node ClusterNode
+	// The registry that is shared by the nodes
+	Registry ClusterRegistry
+	// The number of the points of each node on the hash ring, more points spread the rooms more evenly. Default is 64
+	VirtualNodes int
+	// The options of the local rooms that are created as the proxies of the remote rooms, default is DefaultRoomOptions()
+	ProxyRoomOptions *RoomOptions
+}
+
+// ClusterExtension is a manager extension that places the rooms on the nodes of a cluster with consistent hashing.
+// A new room is only created on the node that the room ID is placed on, and the node records itself as the owner of
+// the room in the registry. GetRoom of a room that is owned by another node returns a local proxy room with the
+// RoomTypeRemote type, the signaling can redirect the client to the owner with RemoteNode or add a downbridge
+// to the proxy room and bridge it to the room on the owner node.
+type ClusterExtension struct {
+	mu           sync.Mutex
+	context      context.Context
+	node         ClusterNode
+	registry     ClusterRegistry
+	virtualNodes int
+	proxyOptions RoomOptions
+	// the owner nodes of the proxy rooms
+	proxies map[string]ClusterNode
+}
+
+// NewClusterExtension joins the node to the cluster, add the extension to the manager with AddExtension
+func NewClusterExtension(ctx context.Context, opts ClusterOptions) (*ClusterExtension, error) {
+	if opts.Node.ID == "" {
+		return nil, ErrClusterMissingNodeID
+	}
+
+	if opts.Registry == nil {
+		return nil, ErrClusterMissingRegistry
+	}
+
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = clusterDefaultVirtualNodes
+	}
+
+	if opts.ProxyRoomOptions == nil {
+		proxyOptions := DefaultRoomOptions()
+		opts.ProxyRoomOptions = &proxyOptions
+	}
+
+	e := &ClusterExtension{
+		mu:           sync.Mutex{},
+		context:      ctx,
+		node:         opts.Node,
+		registry:     opts.Registry,
+		virtualNodes: opts.VirtualNodes,
+		proxyOptions: *opts.ProxyRoomOptions,
+		proxies:      make(map[string]ClusterNode),
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, clusterRegistryTimeout)
+	defer cancel()
+
+	if err := e.registry.Join(timeout, e.node); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Node returns the node of the extension
+func (e *ClusterExtension) Node() ClusterNode {
+	return e.node
+}
+
+// Leave removes the node from the cluster, the rooms of the node are placed on the other nodes
+func (e *ClusterExtension) Leave() error {
+	timeout, cancel := context.WithTimeout(context.WithoutCancel(e.context), clusterRegistryTimeout)
+	defer cancel()
+
+	return e.registry.Leave(timeout, e.node.ID)
+}
+
+// Placement returns the node that the room is placed on, the owner of the room or the node of the room ID on the hash ring
+func (e *ClusterExtension) Placement(roomID string) (ClusterNode, error) {
+	timeout, cancel := context.WithTimeout(e.context, clusterRegistryTimeout)
+	defer cancel()
+
+	nodes, err := e.registry.Nodes(timeout)
+	if err != nil {
+		return ClusterNode{}, err
+	}
+
+	owner, err := e.registry.RoomOwner(timeout, roomID)
+	if err == nil {
+		for _, node := range nodes {
+			if node.ID == owner {
+				return node, nil
+			}
+		}
+	} else if !errors.Is(err, ErrClusterRoomNotFound) {
+		return ClusterNode{}, err
+	}
+
+	return newClusterRing(nodes, e.virtualNodes).locate(roomID)
+}
+
+// RemoteNode returns the owner node of a proxy room
+func (e *ClusterExtension) RemoteNode(roomID string) (ClusterNode, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	node, ok := e.proxies[roomID]
+
+	return node, ok
+}
+
+func (e *ClusterExtension) OnGetRoom(manager *Manager, roomID string) (*Room, error) {
+	timeout, cancel := context.WithTimeout(e.context, clusterRegistryTimeout)
+	defer cancel()
+
+	// only a room that exists on another node has a proxy
+	owner, err := e.registry.RoomOwner(timeout, roomID)
+	if errors.Is(err, ErrClusterRoomNotFound) || owner == e.node.ID {
+		return nil, ErrRoomNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := e.registry.Nodes(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	index := slices.IndexFunc(nodes, func(node ClusterNode) bool {
+		return node.ID == owner
+	})
+
+	if index < 0 {
+		return nil, ErrRoomNotFound
+	}
+
+	node := nodes[index]
+
+	e.mu.Lock()
+	e.proxies[roomID] = node
+	e.mu.Unlock()
+
+	room, err := manager.NewRoom(roomID, roomID, RoomTypeRemote, e.proxyOptions)
+	if errors.Is(err, ErrRoomAlreadyExists) {
+		manager.mutex.RLock()
+		defer manager.mutex.RUnlock()
+
+		return manager.getRoom(roomID)
+	}
+
+	if err != nil {
+		e.removeProxy(roomID)
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// OnBeforeNewRoom claims the room for the node when the room is placed on the node, the proxy rooms are not claimed.
+// The claim is released in OnNewRoomCanceled when another extension rejects the room.
+func (e *ClusterExtension) OnBeforeNewRoom(id, name, roomType string) error {
+	if roomType == RoomTypeRemote {
+		return nil
+	}
+
+	node, err := e.Placement(id)
+	if err != nil {
+		return err
+	}
+
+	if node.ID != e.node.ID {
+		return fmt.Errorf("%w: %s", ErrClusterRoomIsRemote, node.ID)
+	}
+
+	timeout, cancel := context.WithTimeout(e.context, clusterRegistryTimeout)
+	defer cancel()
+
+	owner, err := e.registry.ClaimRoom(timeout, id, e.node.ID)
+	if err != nil {
+		return err
+	}
+
+	if owner != e.node.ID {
+		return fmt.Errorf("%w: %s", ErrClusterRoomIsRemote, owner)
+	}
+
+	return nil
+}
+
+func (e *ClusterExtension) OnNewRoom(manager *Manager, room *Room) {}
+
+// OnNewRoomCanceled releases the room that is claimed in OnBeforeNewRoom when another extension rejects the room
+func (e *ClusterExtension) OnNewRoomCanceled(id, name, roomType string) {
+	if roomType == RoomTypeRemote {
+		return
+	}
+
+	timeout, cancel := context.WithTimeout(context.WithoutCancel(e.context), clusterRegistryTimeout)
+	defer cancel()
+
+	// the room stays claimed by the node if the release fails, the node can still claim it again
+	_ = e.registry.ReleaseRoom(timeout, id, e.node.ID)
+}
+
+// OnRoomClosed releases the room so it can be placed again, or removes the proxy of a remote room
+func (e *ClusterExtension) OnRoomClosed(manager *Manager, room *Room) {
+	if room.Kind() == RoomTypeRemote {
+		e.removeProxy(room.ID())
+		return
+	}
+
+	timeout, cancel := context.WithTimeout(context.WithoutCancel(e.context), clusterRegistryTimeout)
+	defer cancel()
+
+	if err := e.registry.ReleaseRoom(timeout, room.ID(), e.node.ID); err != nil {
+		manager.log.Errorf("cluster: failed to release room %s: %s", room.ID(), err.Error())
+	}
+}
+
+func (e *ClusterExtension) removeProxy(roomID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.proxies, roomID)
+}
+
+type clusterRingPoint struct {
+	hash uint32
+	node ClusterNode
+}
+
+// clusterRing is a consistent hash ring, a room is placed on the first point after the hash of the room ID so only
+// the rooms of a joined or left node are placed again
+type clusterRing struct {
+	points []clusterRingPoint
+}
+
+func newClusterRing(nodes []ClusterNode, virtualNodes int) *clusterRing {
+	points := make([]clusterRingPoint, 0, len(nodes)*virtualNodes)
+
+	for _, node := range nodes {
+		for i := 0; i < virtualNodes; i++ {
+			points = append(points, clusterRingPoint{
+				hash: crc32.ChecksumIEEE([]byte(node.ID + "#" + strconv.Itoa(i))),
+				node: node,
+			})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash == points[j].hash {
+			return points[i].node.ID < points[j].node.ID
+		}
+
+		return points[i].hash < points[j].hash
+	})
+
+	return &clusterRing{points: points}
+}
+
+func (r *clusterRing) locate(key string) (ClusterNode, error) {
+	if len(r.points) == 0 {
+		return ClusterNode{}, ErrClusterNoNodes
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.points[i].node, nil
+}
@@ -0,0 +1,184 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterExtension(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewMemoryClusterRegistry()
+
+	_, err := NewClusterExtension(ctx, ClusterOptions{Registry: registry})
+	require.ErrorIs(t, err, ErrClusterMissingNodeID)
+
+	managerA := NewManager(ctx, "node-a", sfuOpts)
+	defer managerA.Close()
+
+	extA, err := NewClusterExtension(ctx, ClusterOptions{Node: ClusterNode{ID: "node-a", Address: "a.example.com"}, Registry: registry})
+	require.NoError(t, err)
+	managerA.AddExtension(extA)
+
+	managerB := NewManager(ctx, "node-b", sfuOpts)
+	defer managerB.Close()
+
+	extB, err := NewClusterExtension(ctx, ClusterOptions{Node: ClusterNode{ID: "node-b", Address: "b.example.com"}, Registry: registry})
+	require.NoError(t, err)
+	managerB.AddExtension(extB)
+
+	// find a room ID that is placed on node A
+	roomID := ""
+	for i := 0; roomID == ""; i++ {
+		node, err := extA.Placement("room-" + strconv.Itoa(i))
+		require.NoError(t, err)
+
+		if node.ID == "node-a" {
+			roomID = "room-" + strconv.Itoa(i)
+		}
+	}
+
+	// both nodes agree on the placement
+	node, err := extB.Placement(roomID)
+	require.NoError(t, err)
+	require.Equal(t, "node-a", node.ID)
+
+	_, err = managerB.NewRoom(roomID, "placed", RoomTypeLocal, DefaultRoomOptions())
+	require.ErrorIs(t, err, ErrClusterRoomIsRemote)
+
+	// the room doesn't exist yet on any node
+	_, err = managerB.GetRoom(roomID)
+	require.ErrorIs(t, err, ErrRoomNotFound)
+
+	room, err := managerA.NewRoom(roomID, "placed", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	owner, err := registry.RoomOwner(ctx, roomID)
+	require.NoError(t, err)
+	require.Equal(t, "node-a", owner)
+
+	// node B returns a proxy room of the room on node A
+	proxy, err := managerB.GetRoom(roomID)
+	require.NoError(t, err)
+	require.Equal(t, RoomTypeRemote, proxy.Kind())
+
+	remote, ok := extB.RemoteNode(roomID)
+	require.True(t, ok)
+	require.Equal(t, "a.example.com", remote.Address)
+
+	sameProxy, err := managerB.GetRoom(roomID)
+	require.NoError(t, err)
+	require.Equal(t, proxy, sameProxy)
+
+	// the local room is not a proxy
+	local, err := managerA.GetRoom(roomID)
+	require.NoError(t, err)
+	require.Equal(t, room, local)
+
+	_, ok = extA.RemoteNode(roomID)
+	require.False(t, ok)
+
+	// the room is released when it's closed
+	require.NoError(t, managerA.CloseRoom(roomID))
+
+	_, err = registry.RoomOwner(ctx, roomID)
+	require.ErrorIs(t, err, ErrClusterRoomNotFound)
+
+	require.NoError(t, managerB.CloseRoom(roomID))
+
+	_, ok = extB.RemoteNode(roomID)
+	require.False(t, ok)
+
+	// the rooms of a node that left are placed on the other nodes
+	require.NoError(t, extA.Leave())
+
+	node, err = extB.Placement(roomID)
+	require.NoError(t, err)
+	require.Equal(t, "node-b", node.ID)
+}
+
+// rejectingManagerExtension rejects the new rooms after it checks that the manager is not locked
+type rejectingManagerExtension struct {
+	manager *Manager
+}
+
+func (e *rejectingManagerExtension) OnGetRoom(manager *Manager, roomID string) (*Room, error) {
+	return nil, nil
+}
+
+func (e *rejectingManagerExtension) OnBeforeNewRoom(id, name, roomType string) error {
+	// blocks if the manager is locked while the extensions are called
+	_ = e.manager.RoomsCount()
+
+	return errors.New("rejected")
+}
+
+func (e *rejectingManagerExtension) OnNewRoom(manager *Manager, room *Room) {}
+
+func (e *rejectingManagerExtension) OnRoomClosed(manager *Manager, room *Room) {}
+
+func TestClusterExtensionCanceledRoom(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewMemoryClusterRegistry()
+
+	manager := NewManager(ctx, "node-a", sfuOpts)
+	defer manager.Close()
+
+	ext, err := NewClusterExtension(ctx, ClusterOptions{Node: ClusterNode{ID: "node-a"}, Registry: registry})
+	require.NoError(t, err)
+
+	manager.AddExtension(ext)
+	manager.AddExtension(&rejectingManagerExtension{manager: manager})
+
+	// the claim of the cluster extension is released when a later extension rejects the room
+	_, err = manager.NewRoom("room", "rejected", RoomTypeLocal, DefaultRoomOptions())
+	require.EqualError(t, err, "rejected")
+
+	_, err = registry.RoomOwner(ctx, "room")
+	require.ErrorIs(t, err, ErrClusterRoomNotFound)
+
+	require.Zero(t, manager.RoomsCount())
+}
+
+func TestClusterRing(t *testing.T) {
+	_, err := newClusterRing(nil, clusterDefaultVirtualNodes).locate("room")
+	require.ErrorIs(t, err, ErrClusterNoNodes)
+
+	nodes := []ClusterNode{{ID: "node-a"}, {ID: "node-b"}, {ID: "node-c"}}
+
+	before := newClusterRing(nodes, clusterDefaultVirtualNodes)
+	after := newClusterRing(append(nodes, ClusterNode{ID: "node-d"}), clusterDefaultVirtualNodes)
+
+	placed := make(map[string]int)
+	moved := 0
+
+	for i := 0; i < 1000; i++ {
+		key := "room-" + strconv.Itoa(i)
+
+		nodeBefore, err := before.locate(key)
+		require.NoError(t, err)
+
+		nodeAfter, err := after.locate(key)
+		require.NoError(t, err)
+
+		placed[nodeBefore.ID]++
+
+		if nodeBefore.ID != nodeAfter.ID {
+			// a room only moves to the new node
+			require.Equal(t, "node-d", nodeAfter.ID)
+			moved++
+		}
+	}
+
+	// the rooms are spread on all nodes and about a quarter of the rooms move to the new node
+	require.Len(t, placed, 3)
+	require.Greater(t, moved, 100)
+	require.Less(t, moved, 400)
+}
@@ -0,0 +1,56 @@
+// recorder-server is a reference implementation of the recorder service that receives the recordings of the SFU
+// over QUIC and writes them to the local disk.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/samespace/sfu/recorder"
+)
+
+func main() {
+	addr := flag.String("addr", "0.0.0.0:9000", "UDP address to listen")
+	cert := flag.String("cert", "server.cert", "TLS certificate file")
+	key := flag.String("key", "server.key", "TLS key file")
+	dir := flag.String("dir", "recordings", "directory to write the recordings")
+	videoFormat := flag.String("video-format", string(recorder.VideoFormatIVF), "container of VP8 and VP9 tracks, ivf or webm")
+
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	server, err := recorder.NewServer(recorder.ServerConfig{
+		Address:     *addr,
+		CertFile:    *cert,
+		KeyFile:     *key,
+		Directory:   *dir,
+		VideoFormat: recorder.VideoFormat(*videoFormat),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.OnSessionEnded(func(result recorder.SessionResult) {
+		for _, file := range result.Files {
+			log.Printf("session %s: %s", result.Config.ClientId, file)
+		}
+	})
+
+	if err := server.Listen(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("recorder server listening on %s", server.Addr())
+
+	if err := server.Serve(ctx); err != nil && err != recorder.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	_ = server.Close()
+}
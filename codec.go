@@ -115,6 +115,18 @@ var (
 		},
 	}
 
+	// RFC 4733 telephone events for the clock rates of the audio codecs, the payload types are the same as in Chrome
+	dtmfCodecs = []webrtc.RTPCodecParameters{
+		{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeTelephoneEvent, ClockRate: 48000, Channels: 1, SDPFmtpLine: "0-15"},
+			PayloadType:        126,
+		},
+		{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeTelephoneEvent, ClockRate: 8000, Channels: 1, SDPFmtpLine: "0-15"},
+			PayloadType:        110,
+		},
+	}
+
 	H264KeyFrame2x2SPS = []byte{
 		0x67, 0x42, 0xc0, 0x1f, 0x0f, 0xd9, 0x1f, 0x88,
 		0x88, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00,
@@ -129,6 +141,24 @@ var (
 	}
 	H264KeyFrame2x2 = [][]byte{H264KeyFrame2x2SPS, H264KeyFrame2x2PPS, H264KeyFrame2x2IDR}
 
+	// credit to Livekit code, black 8x8 VP8 keyframe
+	VP8KeyFrame8x8 = []byte{
+		0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x08, 0x00,
+		0x08, 0x00, 0x00, 0x47, 0x08, 0x85, 0x85, 0x88,
+		0x85, 0x84, 0x88, 0x02, 0x02, 0x00, 0x0c, 0x0d,
+		0x60, 0x00, 0xfe, 0xff, 0xab, 0x50, 0x80,
+	}
+
+	// black 8x8 VP9 profile 0 keyframe with the highest quantizer and 4x4 transforms. The compressed header only
+	// updates the luma DC pivot probability. The first luma block has a -3 DC coefficient, which brings its luma
+	// down to 3, the other luma blocks are DC predicted from it and the chroma planes stay at 128.
+	VP9KeyFrame8x8 = []byte{
+		0x82, 0x49, 0x83, 0x42, 0x20, 0x00, 0x70, 0x00,
+		0x72, 0x00, 0x1f, 0xe0, 0x00, 0x07, 0x1f, 0x63,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x0b, 0xb2, 0x0c,
+		0x00, 0x00, 0x00,
+	}
+
 	OpusSilenceFrame = []byte{
 		0xf8, 0xff, 0xfe, 0x00, 0x00, 0x00, 0x00, 0x00,
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
@@ -146,11 +176,24 @@ var (
 func RegisterCodecs(m *webrtc.MediaEngine, codecs []string) error {
 	errors := []error{}
 
+	clockRates := make([]uint32, 0)
+
 	for _, codec := range audioCodecs {
 		if slices.Contains(codecs, codec.MimeType) {
 			if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeAudio); err != nil {
 				errors = append(errors, err)
 			}
+
+			clockRates = append(clockRates, codec.ClockRate)
+		}
+	}
+
+	// DTMF is sent with the clock rate of the audio codec
+	for _, codec := range dtmfCodecs {
+		if slices.Contains(clockRates, codec.ClockRate) {
+			if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeAudio); err != nil {
+				errors = append(errors, err)
+			}
 		}
 	}
 
@@ -188,6 +231,12 @@ func RegisterDefaultCodecs(m *webrtc.MediaEngine) error {
 		}
 	}
 
+	for _, codec := range dtmfCodecs {
+		if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeAudio); err != nil {
+			return err
+		}
+	}
+
 	for _, codec := range videoCodecs {
 		if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
 			return err
@@ -0,0 +1,385 @@
+package sfu
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	MimeTypeTelephoneEvent = "audio/telephone-event"
+
+	dtmfToneDuration   = 100 * time.Millisecond
+	dtmfPacketInterval = 20 * time.Millisecond
+	// the pause between the digits, the audio is forwarded again during the pause
+	dtmfDigitInterval = 70 * time.Millisecond
+	// the end packet is sent 3 times like RFC 4733 recommends, a lost end packet would make the digit longer
+	dtmfEndPackets = 3
+	dtmfVolume     = 10
+)
+
+var (
+	ErrDTMFInvalidDigit  = errors.New("dtmf: digit is not a DTMF digit")
+	ErrDTMFNotNegotiated = errors.New("dtmf: client has no audio track with telephone events")
+)
+
+// dtmfEvents are the RFC 4733 events of the DTMF digits, the event is the index of the digit
+const dtmfEvents = "0123456789*#ABCD"
+
+// dtmfReceiver detects the digits of the telephone events of a remote audio track
+type dtmfReceiver struct {
+	payloadType   uint8
+	clockRate     uint32
+	started       bool
+	ended         bool
+	lastTimestamp uint32
+}
+
+// detect returns the digit and its duration when the first end packet of the event is received,
+// the packets of an event have the same timestamp.
+func (d *dtmfReceiver) detect(p *rtp.Packet) (rune, time.Duration, bool) {
+	if len(p.Payload) < 4 || int(p.Payload[0]) >= len(dtmfEvents) {
+		return 0, 0, false
+	}
+
+	if !d.started || p.Timestamp != d.lastTimestamp {
+		d.started = true
+		d.ended = false
+		d.lastTimestamp = p.Timestamp
+	}
+
+	end := p.Payload[1]&0x80 != 0
+	if !end || d.ended {
+		return 0, 0, false
+	}
+
+	d.ended = true
+
+	duration := time.Duration(binary.BigEndian.Uint16(p.Payload[2:])) * time.Second / time.Duration(d.clockRate)
+
+	return rune(dtmfEvents[p.Payload[0]]), duration, true
+}
+
+// dtmfTrackLocal is the local track of a subscribed audio track that can send telephone events between the audio packets.
+// The audio packets are written through the dtmfWriter of each binding, it drops the audio while a digit is sent and
+// continues the sequence numbers after the telephone event packets.
+type dtmfTrackLocal struct {
+	*webrtc.TrackLocalStaticRTP
+	mu      sync.Mutex
+	sendMu  sync.Mutex
+	writers map[string]*dtmfWriter
+}
+
+func newDTMFTrackLocal(track *webrtc.TrackLocalStaticRTP) *dtmfTrackLocal {
+	return &dtmfTrackLocal{
+		TrackLocalStaticRTP: track,
+		mu:                  sync.Mutex{},
+		writers:             make(map[string]*dtmfWriter),
+	}
+}
+
+// dtmfTrackLocalContext replaces the write stream of the binding with the dtmfWriter
+type dtmfTrackLocalContext struct {
+	webrtc.TrackLocalContext
+	writer *dtmfWriter
+}
+
+func (c *dtmfTrackLocalContext) WriteStream() webrtc.TrackLocalWriter {
+	return c.writer
+}
+
+func (t *dtmfTrackLocal) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	writer := &dtmfWriter{
+		writer: ctx.WriteStream(),
+		ssrc:   uint32(ctx.SSRC()),
+	}
+
+	codec, err := t.TrackLocalStaticRTP.Bind(&dtmfTrackLocalContext{TrackLocalContext: ctx, writer: writer})
+	if err != nil {
+		return codec, err
+	}
+
+	writer.clockRate = codec.ClockRate
+
+	for _, negotiated := range ctx.CodecParameters() {
+		if strings.EqualFold(negotiated.MimeType, MimeTypeTelephoneEvent) && negotiated.ClockRate == codec.ClockRate {
+			writer.payloadType = uint8(negotiated.PayloadType)
+			writer.negotiated = true
+		}
+	}
+
+	t.mu.Lock()
+	t.writers[ctx.ID()] = writer
+	t.mu.Unlock()
+
+	return codec, nil
+}
+
+func (t *dtmfTrackLocal) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	delete(t.writers, ctx.ID())
+	t.mu.Unlock()
+
+	return t.TrackLocalStaticRTP.Unbind(ctx)
+}
+
+// canSendDTMF returns true when the telephone events are negotiated with the subscriber
+func (t *dtmfTrackLocal) canSendDTMF() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, writer := range t.writers {
+		if writer.negotiated {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sendDTMF sends the digits one after another, it returns when the last digit is sent
+func (t *dtmfTrackLocal) sendDTMF(ctx context.Context, events []byte) error {
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+
+	for i, event := range events {
+		if i > 0 {
+			if err := sleepContext(ctx, dtmfDigitInterval); err != nil {
+				return err
+			}
+		}
+
+		t.mu.Lock()
+		writers := make([]*dtmfWriter, 0, len(t.writers))
+		for _, writer := range t.writers {
+			if writer.negotiated {
+				writers = append(writers, writer)
+			}
+		}
+		t.mu.Unlock()
+
+		if len(writers) == 0 {
+			return ErrDTMFNotNegotiated
+		}
+
+		var wg sync.WaitGroup
+		var errMu sync.Mutex
+		errs := []error{}
+
+		for _, writer := range writers {
+			wg.Add(1)
+
+			go func(writer *dtmfWriter) {
+				defer wg.Done()
+
+				if err := writer.sendEvent(ctx, event); err != nil {
+					errMu.Lock()
+					errs = append(errs, err)
+					errMu.Unlock()
+				}
+			}(writer)
+		}
+
+		wg.Wait()
+
+		if err := FlattenErrors(errs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dtmfWriter writes the audio packets and the telephone event packets of a binding with continuous sequence numbers
+type dtmfWriter struct {
+	mu             sync.Mutex
+	writer         webrtc.TrackLocalWriter
+	ssrc           uint32
+	payloadType    uint8
+	clockRate      uint32
+	negotiated     bool
+	sending        bool
+	resync         bool
+	started        bool
+	sequenceOffset uint16
+	lastSequence   uint16
+	lastTimestamp  uint32
+	lastWritten    time.Time
+}
+
+func (w *dtmfWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// the audio is muted while a digit is sent
+	if w.sending {
+		return 0, nil
+	}
+
+	if w.resync {
+		w.sequenceOffset = w.lastSequence + 1 - header.SequenceNumber
+		w.resync = false
+	}
+
+	header.SequenceNumber += w.sequenceOffset
+
+	w.started = true
+	w.lastSequence = header.SequenceNumber
+	w.lastTimestamp = header.Timestamp
+	w.lastWritten = time.Now()
+
+	return w.writer.WriteRTP(header, payload)
+}
+
+func (w *dtmfWriter) Write(b []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+
+	return w.WriteRTP(&packet.Header, packet.Payload)
+}
+
+// sendEvent sends the telephone event packets of a digit in the timeline of the audio packets
+func (w *dtmfWriter) sendEvent(ctx context.Context, event byte) error {
+	w.mu.Lock()
+	w.sending = true
+
+	sequence := w.lastSequence
+	timestamp := rand.Uint32()
+
+	if w.started {
+		timestamp = w.lastTimestamp + uint32(time.Since(w.lastWritten).Seconds()*float64(w.clockRate))
+	}
+	w.mu.Unlock()
+
+	samplesPerPacket := uint32(dtmfPacketInterval.Seconds() * float64(w.clockRate))
+	packets := int(dtmfToneDuration / dtmfPacketInterval)
+	duration := uint32(0)
+
+	defer func() {
+		w.mu.Lock()
+		w.sending = false
+		w.resync = true
+		w.started = true
+		w.lastSequence = sequence
+		w.lastTimestamp = timestamp + duration
+		w.lastWritten = time.Now()
+		w.mu.Unlock()
+	}()
+
+	for i := 0; i < packets+dtmfEndPackets; i++ {
+		end := i >= packets
+		if !end {
+			duration += samplesPerPacket
+		}
+
+		sequence++
+
+		payload := []byte{event, dtmfVolume, 0, 0}
+		if end {
+			payload[1] |= 0x80
+		}
+
+		binary.BigEndian.PutUint16(payload[2:], uint16(duration))
+
+		header := &rtp.Header{
+			Version:        2,
+			Marker:         i == 0,
+			PayloadType:    w.payloadType,
+			SequenceNumber: sequence,
+			Timestamp:      timestamp,
+			SSRC:           w.ssrc,
+		}
+
+		if _, err := w.writer.WriteRTP(header, payload); err != nil {
+			return err
+		}
+
+		if !end {
+			if err := sleepContext(ctx, dtmfPacketInterval); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// dtmfEventsFromDigits converts the digits to the RFC 4733 events, the letters are case insensitive
+func dtmfEventsFromDigits(digits string) ([]byte, error) {
+	events := make([]byte, 0, len(digits))
+
+	for _, digit := range strings.ToUpper(digits) {
+		event := strings.IndexRune(dtmfEvents, digit)
+		if event < 0 {
+			return nil, ErrDTMFInvalidDigit
+		}
+
+		events = append(events, byte(event))
+	}
+
+	return events, nil
+}
+
+// OnDTMF is called when a DTMF digit is received on an audio track of the client, the duration is the length of the tone
+func (c *Client) OnDTMF(callback func(digit rune, duration time.Duration)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onDTMFCallbacks = append(c.onDTMFCallbacks, callback)
+}
+
+func (c *Client) onDTMF(digit rune, duration time.Duration) {
+	c.mu.RLock()
+	callbacks := c.onDTMFCallbacks
+	c.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(digit, duration)
+	}
+}
+
+// SendDTMF sends the digits 0-9, *, #, and A-D to the client as RFC 4733 telephone events on the first subscribed
+// audio track. The audio of the track is muted while a digit is sent, it returns when the last digit is sent.
+func (c *Client) SendDTMF(digits string) error {
+	events, err := dtmfEventsFromDigits(digits)
+	if err != nil {
+		return err
+	}
+
+	c.muTracks.Lock()
+	var sender *dtmfTrackLocal
+	for _, track := range c.dtmfTracks {
+		if track.canSendDTMF() {
+			sender = track
+			break
+		}
+	}
+	c.muTracks.Unlock()
+
+	if sender == nil {
+		return ErrDTMFNotNegotiated
+	}
+
+	return sender.sendDTMF(c.context, events)
+}
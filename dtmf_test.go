@@ -0,0 +1,147 @@
+package sfu
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// testTrackLocalWriter keeps the written packets of a binding
+type testTrackLocalWriter struct {
+	mu      sync.Mutex
+	packets []*rtp.Packet
+}
+
+func (w *testTrackLocalWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.packets = append(w.packets, &rtp.Packet{Header: header.Clone(), Payload: append([]byte(nil), payload...)})
+
+	return len(payload), nil
+}
+
+func (w *testTrackLocalWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *testTrackLocalWriter) Packets() []*rtp.Packet {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]*rtp.Packet(nil), w.packets...)
+}
+
+type testTrackLocalContext struct {
+	codecs []webrtc.RTPCodecParameters
+	writer *testTrackLocalWriter
+}
+
+func (c *testTrackLocalContext) CodecParameters() []webrtc.RTPCodecParameters {
+	return c.codecs
+}
+
+func (c *testTrackLocalContext) HeaderExtensions() []webrtc.RTPHeaderExtensionParameter {
+	return nil
+}
+
+func (c *testTrackLocalContext) SSRC() webrtc.SSRC {
+	return 1234
+}
+
+func (c *testTrackLocalContext) WriteStream() webrtc.TrackLocalWriter {
+	return c.writer
+}
+
+func (c *testTrackLocalContext) ID() string {
+	return "binding"
+}
+
+func (c *testTrackLocalContext) RTCPReader() interceptor.RTCPReader {
+	return nil
+}
+
+func TestDTMFDigits(t *testing.T) {
+	t.Parallel()
+
+	events, err := dtmfEventsFromDigits("09*#ad")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 9, 10, 11, 12, 15}, events)
+
+	_, err = dtmfEventsFromDigits("1x")
+	require.ErrorIs(t, err, ErrDTMFInvalidDigit)
+}
+
+func TestDTMFSendAndDetect(t *testing.T) {
+	t.Parallel()
+
+	localTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000, Channels: 1}, "audio", "stream")
+	require.NoError(t, err)
+
+	writer := &testTrackLocalWriter{}
+	trackLocal := newDTMFTrackLocal(localTrack)
+
+	// the telephone events are not negotiated
+	_, err = trackLocal.Bind(&testTrackLocalContext{codecs: audioCodecs, writer: writer})
+	require.NoError(t, err)
+	require.False(t, trackLocal.canSendDTMF())
+	require.NoError(t, trackLocal.Unbind(&testTrackLocalContext{}))
+
+	_, err = trackLocal.Bind(&testTrackLocalContext{codecs: append(append([]webrtc.RTPCodecParameters{}, audioCodecs...), dtmfCodecs...), writer: writer})
+	require.NoError(t, err)
+	require.True(t, trackLocal.canSendDTMF())
+
+	writeAudio := func(sequence uint16) {
+		require.NoError(t, localTrack.WriteRTP(&rtp.Packet{
+			Header:  rtp.Header{Version: 2, SequenceNumber: sequence, Timestamp: uint32(sequence) * 160},
+			Payload: make([]byte, 160),
+		}))
+	}
+
+	writeAudio(100)
+	writeAudio(101)
+
+	sent := make(chan error)
+	go func() {
+		sent <- trackLocal.sendDTMF(context.Background(), []byte{5})
+	}()
+
+	// the audio is dropped while the digit is sent
+	time.Sleep(30 * time.Millisecond)
+	writeAudio(102)
+
+	require.NoError(t, <-sent)
+
+	writeAudio(103)
+
+	packets := writer.Packets()
+	require.Len(t, packets, 2+int(dtmfToneDuration/dtmfPacketInterval)+dtmfEndPackets+1)
+
+	receiver := &dtmfReceiver{payloadType: 110, clockRate: 8000}
+	digits := []rune{}
+
+	for i, p := range packets {
+		require.Equal(t, uint32(1234), p.SSRC)
+		require.Equal(t, uint16(100+i), p.SequenceNumber)
+
+		if p.PayloadType != receiver.payloadType {
+			require.Equal(t, uint8(0), p.PayloadType)
+			continue
+		}
+
+		require.Equal(t, i == 2, p.Marker)
+
+		if digit, duration, ok := receiver.detect(p); ok {
+			require.Equal(t, dtmfToneDuration, duration)
+			digits = append(digits, digit)
+		}
+	}
+
+	require.Equal(t, []rune{'5'}, digits)
+}
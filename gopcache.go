@@ -0,0 +1,231 @@
+package sfu
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// default RTP timestamp gap between frames on a 90kHz video clock at 30fps
+	gopReplayFrameDuration = uint32(3000)
+)
+
+// gopCache keeps the packets of the latest group of pictures, the last keyframe and the frames that follow it,
+// so a new subscriber can start rendering the video without waiting for the publisher to send a new keyframe.
+type gopCache struct {
+	mu          sync.RWMutex
+	mimeType    string
+	maxPackets  int
+	packets     []*rtp.Packet
+	hasKeyframe bool
+}
+
+func newGOPCache(mimeType string, maxPackets int) *gopCache {
+	return &gopCache{
+		mu:         sync.RWMutex{},
+		mimeType:   mimeType,
+		maxPackets: maxPackets,
+		packets:    make([]*rtp.Packet, 0),
+	}
+}
+
+// Add stores a copy of the packet if it belongs to the current group of pictures.
+// A keyframe will reset the cache and start a new group of pictures.
+func (c *gopCache) Add(p *rtp.Packet) {
+	isKeyframe := IsKeyframe(c.mimeType, p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if isKeyframe {
+		c.packets = c.packets[:0]
+		c.hasKeyframe = true
+	}
+
+	if !c.hasKeyframe {
+		// wait until the next keyframe
+		return
+	}
+
+	if len(c.packets) >= c.maxPackets {
+		// the group of pictures is too long to replay, drop it and wait for the next keyframe
+		c.packets = c.packets[:0]
+		c.hasKeyframe = false
+
+		return
+	}
+
+	c.packets = append(c.packets, p.Clone())
+}
+
+// Packets returns the cached packets started with the keyframe.
+// The returned packets are shared, make sure to copy a packet before modifying it.
+func (c *gopCache) Packets() []*rtp.Packet {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.hasKeyframe {
+		return nil
+	}
+
+	packets := make([]*rtp.Packet, len(c.packets))
+	copy(packets, c.packets)
+
+	return packets
+}
+
+func (c *gopCache) HasKeyframe() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.hasKeyframe && len(c.packets) > 0
+}
+
+func (c *gopCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.packets = c.packets[:0]
+	c.hasKeyframe = false
+}
+
+// gopReplay tracks the cached keyframe replay of a client track.
+// A replay is only used until the subscriber is receiving the track and a keyframe is delivered,
+// after that the keyframe requests are forwarded to the publisher.
+// It also keeps the sequence numbers continuous when the live packets are dropped or replaced.
+type gopReplay struct {
+	mu        sync.Mutex
+	pending   bool
+	receiving bool
+	delivered bool
+	init      bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+}
+
+func newGOPReplay() *gopReplay {
+	return &gopReplay{
+		mu: sync.Mutex{},
+	}
+}
+
+// Request marks the replay as pending and returns false if the replay is not allowed anymore,
+// in that case the keyframe must be requested from the publisher.
+func (r *gopReplay) Request() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.delivered {
+		return false
+	}
+
+	r.pending = true
+
+	return true
+}
+
+// Consume returns true once if there is a pending replay.
+func (r *gopReplay) Consume() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := r.pending
+	r.pending = false
+
+	return pending
+}
+
+// SetReceiving is called when the subscriber reports that it's receiving the track.
+func (r *gopReplay) SetReceiving() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.receiving = true
+}
+
+// KeyframeSent marks the keyframe as delivered if the subscriber is already receiving the track.
+func (r *gopReplay) KeyframeSent() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.receiving {
+		r.delivered = true
+	}
+}
+
+// Replay returns rewritten copies of the cached packets that must be sent before the live packet.
+// The sequence numbers of the replayed packets are continuous and the next live packets will be
+// shifted to continue after the last replayed packet.
+func (r *gopReplay) Replay(cached []*rtp.Packet, live *rtp.Packet) []*rtp.Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(cached) == 0 {
+		return nil
+	}
+
+	startSeq := cached[0].SequenceNumber
+	replayTSOffset := uint32(0)
+
+	if r.init {
+		// continue after the last sent packet
+		startSeq = r.lastSeq + 1
+		replayTSOffset = r.lastTS + gopReplayFrameDuration - cached[0].Timestamp
+	}
+
+	packets := make([]*rtp.Packet, 0, len(cached))
+
+	for i, p := range cached {
+		copyPacket := p.Clone()
+		copyPacket.SequenceNumber = startSeq + uint16(i)
+		copyPacket.Timestamp = p.Timestamp + replayTSOffset
+		packets = append(packets, copyPacket)
+	}
+
+	last := packets[len(packets)-1]
+
+	r.init = true
+	r.lastSeq = last.SequenceNumber
+	r.lastTS = last.Timestamp
+	r.seqOffset = last.SequenceNumber + 1 - live.SequenceNumber
+	r.tsOffset = replayTSOffset
+
+	return packets
+}
+
+// Rewrite applies the sequence number and timestamp offsets from the previous replays to the live packet.
+func (r *gopReplay) Rewrite(p *rtp.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.SequenceNumber += r.seqOffset
+	p.Timestamp += r.tsOffset
+
+	r.init = true
+	r.lastSeq = p.SequenceNumber
+	r.lastTS = p.Timestamp
+}
+
+// Substitute replaces the live packet with the given packets, or drops the live packet if there are no packets.
+// The given packets use the timestamp of the live packet and the next live packets continue after them.
+func (r *gopReplay) Substitute(packets []*rtp.Packet, live *rtp.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.init {
+		r.init = true
+		r.lastSeq = live.SequenceNumber + r.seqOffset - 1
+	}
+
+	for _, p := range packets {
+		r.lastSeq++
+		p.SequenceNumber = r.lastSeq
+		p.Timestamp = live.Timestamp + r.tsOffset
+		r.lastTS = p.Timestamp
+	}
+
+	r.seqOffset = r.lastSeq - live.SequenceNumber
+}
@@ -0,0 +1,181 @@
+package sfu
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func newVP8TestPacket(seq uint16, ts uint32, keyframe bool) *rtp.Packet {
+	payload := []byte{0x10, 0x01, 0x00, 0x00}
+	if keyframe {
+		payload[1] = 0x00
+	}
+
+	return &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: seq,
+			Timestamp:      ts,
+		},
+		Payload: payload,
+	}
+}
+
+func TestGOPCache(t *testing.T) {
+	cache := newGOPCache(webrtc.MimeTypeVP8, 5)
+
+	// packets before the first keyframe are ignored
+	cache.Add(newVP8TestPacket(1, 3000, false))
+	require.False(t, cache.HasKeyframe())
+	require.Nil(t, cache.Packets())
+
+	cache.Add(newVP8TestPacket(2, 6000, true))
+	cache.Add(newVP8TestPacket(3, 9000, false))
+	require.True(t, cache.HasKeyframe())
+	require.Len(t, cache.Packets(), 2)
+	require.Equal(t, uint16(2), cache.Packets()[0].SequenceNumber)
+
+	// a new keyframe starts a new group of pictures
+	cache.Add(newVP8TestPacket(4, 12000, true))
+	require.Len(t, cache.Packets(), 1)
+	require.Equal(t, uint16(4), cache.Packets()[0].SequenceNumber)
+
+	// exceeding the max packets drops the group of pictures
+	for i := uint16(5); i < 10; i++ {
+		cache.Add(newVP8TestPacket(i, uint32(i)*3000, false))
+	}
+
+	require.False(t, cache.HasKeyframe())
+
+	cache.Add(newVP8TestPacket(10, 30000, true))
+	require.True(t, cache.HasKeyframe())
+
+	cache.Reset()
+	require.False(t, cache.HasKeyframe())
+}
+
+func TestGOPReplay(t *testing.T) {
+	replay := newGOPReplay()
+
+	cached := []*rtp.Packet{
+		newVP8TestPacket(10, 3000, true),
+		newVP8TestPacket(12, 6000, false),
+	}
+
+	require.True(t, replay.Request())
+	require.True(t, replay.Consume())
+	require.False(t, replay.Consume())
+
+	// first replay keeps the original sequence and timestamp of the keyframe
+	live := newVP8TestPacket(13, 9000, false)
+	packets := replay.Replay(cached, live)
+	require.Len(t, packets, 2)
+	require.Equal(t, uint16(10), packets[0].SequenceNumber)
+	require.Equal(t, uint16(11), packets[1].SequenceNumber)
+	require.Equal(t, uint32(6000), packets[1].Timestamp)
+
+	// the cached packets must not be modified
+	require.Equal(t, uint16(12), cached[1].SequenceNumber)
+
+	// live packet continues after the replayed packets
+	replay.Rewrite(live)
+	require.Equal(t, uint16(12), live.SequenceNumber)
+	require.Equal(t, uint32(9000), live.Timestamp)
+
+	// second replay continues after the last sent packet
+	live = newVP8TestPacket(14, 12000, false)
+	packets = replay.Replay(cached, live)
+	require.Equal(t, uint16(13), packets[0].SequenceNumber)
+	require.Equal(t, uint32(9000+gopReplayFrameDuration), packets[0].Timestamp)
+
+	replay.Rewrite(live)
+	require.Equal(t, uint16(15), live.SequenceNumber)
+	require.Equal(t, packets[1].Timestamp+(12000-6000), live.Timestamp)
+
+	// keyframe is not delivered until the subscriber is receiving
+	replay.KeyframeSent()
+	require.True(t, replay.Request())
+
+	replay.SetReceiving()
+	replay.KeyframeSent()
+	require.False(t, replay.Request())
+}
+
+func TestGOPReplaySubstitute(t *testing.T) {
+	replay := newGOPReplay()
+
+	live := newVP8TestPacket(100, 3000, false)
+	replay.Rewrite(live)
+
+	// replace the live packet with two packets
+	live = newVP8TestPacket(101, 6000, false)
+	packets := []*rtp.Packet{newVP8TestPacket(0, 0, true), newVP8TestPacket(0, 0, true)}
+	replay.Substitute(packets, live)
+	require.Equal(t, uint16(101), packets[0].SequenceNumber)
+	require.Equal(t, uint16(102), packets[1].SequenceNumber)
+	require.Equal(t, uint32(6000), packets[1].Timestamp)
+
+	// drop the live packets
+	replay.Substitute(nil, newVP8TestPacket(102, 6000, false))
+	replay.Substitute(nil, newVP8TestPacket(103, 9000, false))
+
+	// live packet continues after the substituted packets
+	live = newVP8TestPacket(104, 12000, false)
+	replay.Rewrite(live)
+	require.Equal(t, uint16(103), live.SequenceNumber)
+	require.Equal(t, uint32(12000), live.Timestamp)
+}
+
+func TestSimulcastClientTrackGOPReplay(t *testing.T) {
+	codec := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}
+	localTrack, err := webrtc.NewTrackLocalStaticRTP(codec, "video", "stream")
+	require.NoError(t, err)
+
+	writer := &testTrackLocalWriter{}
+	_, err = localTrack.Bind(&testTrackLocalContext{codecs: videoCodecs, writer: writer})
+	require.NoError(t, err)
+
+	remoteTrack := &SimulcastTrack{
+		base:         &baseTrack{codec: webrtc.RTPCodecParameters{RTPCodecCapability: codec}},
+		gopCacheHigh: newGOPCache(webrtc.MimeTypeVP8, 10),
+	}
+
+	track := &simulcastClientTrack{
+		mimeType:       webrtc.MimeTypeVP8,
+		localTrack:     localTrack,
+		remoteTrack:    remoteTrack,
+		sequenceNumber: &atomic.Uint32{},
+		lastTimestamp:  &atomic.Uint32{},
+		gopReplay:      newGOPReplay(),
+		replayed:       &atomic.Bool{},
+	}
+
+	// mimic the read loop of the simulcast track
+	receive := func(p *rtp.Packet) {
+		remoteTrack.lastHighSequence = remoteTrack.highSequence
+		remoteTrack.highSequence = p.SequenceNumber
+		track.send(p, QualityHigh)
+		remoteTrack.gopCacheHigh.Add(newVP8TestPacket(p.SequenceNumber, p.Timestamp, IsKeyframe(webrtc.MimeTypeVP8, p)))
+	}
+
+	receive(newVP8TestPacket(100, 3000, true))
+	receive(newVP8TestPacket(102, 6000, false))
+	require.True(t, track.replayGOP(QualityHigh))
+
+	// a late packet after the replay must not reuse the sequence number of a replayed packet
+	receive(newVP8TestPacket(101, 6000, false))
+	receive(newVP8TestPacket(103, 9000, false))
+
+	sequences := make([]uint16, 0)
+	for _, p := range writer.Packets() {
+		sequences = append(sequences, p.SequenceNumber)
+	}
+
+	// the replayed packets follow the last live packet, the late packet follows the replayed packets
+	// and the next live packet keeps its distance to the late packet
+	require.Equal(t, []uint16{100, 102, 103, 104, 105, 107}, sequences)
+}
@@ -9,6 +9,12 @@ type IManagerExtension interface {
 	OnRoomClosed(manager *Manager, room *Room)
 }
 
+// INewRoomCanceler is an optional interface of a manager extension to release what it acquired in OnBeforeNewRoom
+type INewRoomCanceler interface {
+	// called when the room is not created because a later extension returned an error from OnBeforeNewRoom
+	OnNewRoomCanceled(id, name, roomType string)
+}
+
 type IExtension interface {
 	// This can be use for authentication before a client add to a room
 	OnBeforeClientAdded(room *Room, clientID string) error
@@ -29,6 +29,8 @@ type Manager struct {
 	options    Options
 	extension  []IManagerExtension
 	log        logging.LeveledLogger
+	// the IDs of the rooms that are waiting for OnBeforeNewRoom of the extensions
+	pendingRooms map[string]struct{}
 }
 
 func NewManager(ctx context.Context, name string, options Options) *Manager {
@@ -37,15 +39,16 @@ func NewManager(ctx context.Context, name string, options Options) *Manager {
 	logger := logging.NewDefaultLoggerFactory().NewLogger("sfu")
 
 	m := &Manager{
-		rooms:      make(map[string]*Room),
-		context:    localCtx,
-		cancel:     cancel,
-		iceServers: options.IceServers,
-		name:       name,
-		mutex:      sync.RWMutex{},
-		options:    options,
-		extension:  make([]IManagerExtension, 0),
-		log:        logger,
+		rooms:        make(map[string]*Room),
+		context:      localCtx,
+		cancel:       cancel,
+		iceServers:   options.IceServers,
+		name:         name,
+		mutex:        sync.RWMutex{},
+		options:      options,
+		extension:    make([]IManagerExtension, 0),
+		log:          logger,
+		pendingRooms: make(map[string]struct{}),
 	}
 
 	return m
@@ -69,13 +72,27 @@ func (m *Manager) Name() string {
 
 func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, error) {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
 	if _, ok := m.rooms[id]; ok {
+		m.mutex.Unlock()
+		return nil, ErrRoomAlreadyExists
+	}
+
+	if _, ok := m.pendingRooms[id]; ok {
+		m.mutex.Unlock()
 		return nil, ErrRoomAlreadyExists
 	}
 
+	// the extensions are called without the lock because they can call a remote service
+	m.pendingRooms[id] = struct{}{}
+	m.mutex.Unlock()
+
 	err := m.onBeforeNewRoom(id, name, roomType)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.pendingRooms, id)
+
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +105,7 @@ func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, e
 		QualityPresets: *opts.QualityPresets,
 		Log:            m.log,
 		SettingEngine:  m.options.SettingEngine,
+		GOPCacheSize:   opts.GOPCacheSize,
 	}
 
 	newSFU := New(m.context, sfuOpts)
@@ -117,7 +135,8 @@ func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, e
 		idleMutex.Lock()
 		defer idleMutex.Unlock()
 
-		if room.SFU().clients.Length() == 0 && !idle {
+		// the hidden clients don't keep the room from being closed
+		if room.SFU().clients.VisibleLength() == 0 && !idle {
 			idle = true
 			_, emptyRoomCancel = startRoomTimeout(m, room)
 		}
@@ -127,6 +146,10 @@ func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, e
 		idleMutex.Lock()
 		defer idleMutex.Unlock()
 
+		if client.IsHidden() {
+			return
+		}
+
 		if idle {
 			emptyRoomCancel()
 		}
@@ -139,10 +162,17 @@ func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, e
 	return room, nil
 }
 
+// onBeforeNewRoom cancels the room on the extensions that already accepted it when an extension returns an error
 func (m *Manager) onBeforeNewRoom(id, name, roomType string) error {
-	for _, ext := range m.extension {
+	for i, ext := range m.extension {
 		err := ext.OnBeforeNewRoom(id, name, roomType)
 		if err != nil {
+			for _, accepted := range m.extension[:i] {
+				if canceler, ok := accepted.(INewRoomCanceler); ok {
+					canceler.OnNewRoomCanceled(id, name, roomType)
+				}
+			}
+
 			return err
 		}
 
@@ -152,6 +182,9 @@ func (m *Manager) onBeforeNewRoom(id, name, roomType string) error {
 }
 
 func (m *Manager) RoomsCount() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	return len(m.rooms)
 }
 
@@ -161,7 +194,11 @@ func (m *Manager) GetRoom(id string) (*Room, error) {
 		err  error
 	)
 
+	// the extensions can create a room, the lock is not held while they're called
+	m.mutex.RLock()
 	room, err = m.getRoom(id)
+	m.mutex.RUnlock()
+
 	if err == ErrRoomNotFound {
 		for _, ext := range m.extension {
 			room, err = ext.OnGetRoom(m, id)
@@ -176,6 +213,7 @@ func (m *Manager) GetRoom(id string) (*Room, error) {
 	return room, nil
 }
 
+// getRoom returns the room, the caller must hold the lock of the manager
 func (m *Manager) getRoom(id string) (*Room, error) {
 	var (
 		room *Room
@@ -210,7 +248,14 @@ func (m *Manager) CloseRoom(id string) error {
 func (m *Manager) Close() {
 	defer m.cancel()
 
+	m.mutex.RLock()
+	rooms := make([]*Room, 0, len(m.rooms))
 	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+	m.mutex.RUnlock()
+
+	for _, room := range rooms {
 		room.Close()
 	}
 }
@@ -0,0 +1,295 @@
+package sfu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/samespace/sfu/recorder"
+)
+
+const (
+	wavFormatPCM   = 1
+	wavFormatALaw  = 6
+	wavFormatMuLaw = 7
+
+	// G.711 samples of a 20ms frame
+	g711FrameSamples = 160
+	g711SampleRate   = 8000
+)
+
+// mediaReader reads the frames of a media file that are sent as the samples of a track
+type mediaReader interface {
+	MimeType() string
+	// ReadFrame returns the next frame with its duration, or io.EOF at the end of the file
+	ReadFrame() ([]byte, time.Duration, error)
+}
+
+// openMediaFile opens an Ogg/Opus file or a G.711 WAV file, a 16 bit PCM WAV file is encoded to PCMU
+func openMediaFile(filePath string) (mediaReader, io.Closer, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reader mediaReader
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ogg", ".opus":
+		reader, err = newOggOpusReader(f)
+	case ".wav":
+		reader, err = newWavReader(f)
+	default:
+		err = ErrMediaFormat
+	}
+
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	return reader, f, nil
+}
+
+// oggOpusReader reads the Opus packets of an Ogg file, unlike the Ogg reader of pion a page can have several packets
+// and a packet can continue on the next page.
+type oggOpusReader struct {
+	reader  *bufio.Reader
+	packets [][]byte
+	partial []byte
+}
+
+func newOggOpusReader(r io.Reader) (*oggOpusReader, error) {
+	o := &oggOpusReader{
+		reader: bufio.NewReader(r),
+	}
+
+	head, err := o.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, ErrMediaFormat
+	}
+
+	// skip the OpusTags packet
+	if _, err := o.readPacket(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func (o *oggOpusReader) MimeType() string {
+	return webrtc.MimeTypeOpus
+}
+
+func (o *oggOpusReader) ReadFrame() ([]byte, time.Duration, error) {
+	packet, err := o.readPacket()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	samples, err := recorder.OpusPacketSamples(packet)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return packet, time.Duration(samples) * time.Second / 48000, nil
+}
+
+func (o *oggOpusReader) readPacket() ([]byte, error) {
+	for len(o.packets) == 0 {
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+
+	packet := o.packets[0]
+	o.packets = o.packets[1:]
+
+	return packet, nil
+}
+
+// readPage reads the packets of the next page, a segment shorter than 255 bytes ends a packet
+func (o *oggOpusReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.reader, header); err != nil {
+		return err
+	}
+
+	if string(header[:4]) != "OggS" {
+		return ErrMediaFormat
+	}
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.reader, segments); err != nil {
+		return err
+	}
+
+	for _, size := range segments {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(o.reader, data); err != nil {
+			return err
+		}
+
+		o.partial = append(o.partial, data...)
+
+		if size < 255 {
+			if len(o.partial) > 0 {
+				o.packets = append(o.packets, o.partial)
+			}
+
+			o.partial = nil
+		}
+	}
+
+	return nil
+}
+
+// wavReader reads 20ms frames of a mono 8kHz WAV file
+type wavReader struct {
+	reader   io.Reader
+	mimeType string
+	// 16 bit samples that are encoded to PCMU
+	linear bool
+}
+
+func newWavReader(r io.Reader) (*wavReader, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return nil, ErrMediaFormat
+	}
+
+	w := &wavReader{}
+
+	for {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrMediaFormat
+			}
+
+			format := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return nil, err
+			}
+
+			audioFormat := binary.LittleEndian.Uint16(format[0:])
+			channels := binary.LittleEndian.Uint16(format[2:])
+			sampleRate := binary.LittleEndian.Uint32(format[4:])
+			bitsPerSample := binary.LittleEndian.Uint16(format[14:])
+
+			if channels != 1 || sampleRate != g711SampleRate {
+				return nil, ErrMediaFormat
+			}
+
+			switch {
+			case audioFormat == wavFormatMuLaw && bitsPerSample == 8:
+				w.mimeType = webrtc.MimeTypePCMU
+			case audioFormat == wavFormatALaw && bitsPerSample == 8:
+				w.mimeType = webrtc.MimeTypePCMA
+			case audioFormat == wavFormatPCM && bitsPerSample == 16:
+				w.mimeType = webrtc.MimeTypePCMU
+				w.linear = true
+			default:
+				return nil, ErrMediaFormat
+			}
+		case "data":
+			if w.mimeType == "" {
+				return nil, ErrMediaFormat
+			}
+
+			w.reader = io.LimitReader(r, size)
+
+			return w, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (w *wavReader) MimeType() string {
+	return w.mimeType
+}
+
+func (w *wavReader) ReadFrame() ([]byte, time.Duration, error) {
+	sampleSize := 1
+	if w.linear {
+		sampleSize = 2
+	}
+
+	buf := make([]byte, g711FrameSamples*sampleSize)
+
+	n, err := io.ReadFull(w.reader, buf)
+	if err == io.ErrUnexpectedEOF {
+		// the last frame is shorter
+		err = nil
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	samples := n / sampleSize
+	frame := buf[:samples]
+
+	if w.linear {
+		for i := 0; i < samples; i++ {
+			frame[i] = linearToMuLaw(int16(binary.LittleEndian.Uint16(buf[i*2:])))
+		}
+	}
+
+	return frame, time.Duration(samples) * time.Second / g711SampleRate, nil
+}
+
+// linearToMuLaw encodes a 16 bit sample to G.711 μ-law
+func linearToMuLaw(sample int16) byte {
+	const (
+		bias = 0x84
+		clip = 32635
+	)
+
+	s := int(sample)
+	sign := 0
+
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+
+	if s > clip {
+		s = clip
+	}
+
+	s += bias
+
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+
+	mantissa := (s >> (exponent + 3)) & 0x0f
+
+	return ^byte(sign | exponent<<4 | mantissa)
+}
@@ -0,0 +1,220 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+var (
+	ErrMediaFormat             = errors.New("mediaplayer: media format is not supported")
+	ErrMediaClientNotConnected = errors.New("mediaplayer: client is not connected")
+)
+
+type PlayMediaOptions struct {
+	// The client that hears the media, the media is played to all clients of the room when it's empty
+	ClientID string
+	// Play the media again from the start when it ends, until the playback is stopped
+	Loop bool
+	// Called when the playback ends, the error is nil when the media is played to the end or stopped
+	OnEnded func(err error)
+}
+
+// MediaPlayback is a media file that is played into a room, like a call recording notice, hold music or an IVR message.
+// The media is sent from a virtual publisher that leaves the room when the playback ends.
+type MediaPlayback struct {
+	mu        sync.Mutex
+	context   context.Context
+	cancel    context.CancelFunc
+	filePath  string
+	publisher *VirtualPublisher
+	track     *VirtualTrack
+	loop      atomic.Bool
+	done      chan struct{}
+	err       error
+	onEnded   func(error)
+}
+
+// PlayMedia plays an Ogg/Opus file, or a mono 8kHz WAV file with PCMU, PCMA or 16 bit PCM samples to the room or to one client.
+// The media played to the room is published as a track of a virtual publisher and subscribed by the connected clients,
+// the clients that connect later receive it through OnTracksAvailable. The media played to one client is only sent to
+// the client, it's not seen by the other clients and the room recording.
+func (r *Room) PlayMedia(filePath string, opts PlayMediaOptions) (*MediaPlayback, error) {
+	reader, closer, err := openMediaFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *Client
+
+	if opts.ClientID != "" {
+		if target, err = r.sfu.GetClient(opts.ClientID); err != nil {
+			_ = closer.Close()
+			return nil, err
+		}
+
+		if target.PeerConnection().PC().ConnectionState() != webrtc.PeerConnectionStateConnected {
+			_ = closer.Close()
+			return nil, ErrMediaClientNotConnected
+		}
+	}
+
+	id := "playback-" + GenerateID(16)
+
+	publisher, err := r.AddVirtualPublisher(id, VirtualPublisherOptions{Name: "playback", Hidden: target != nil})
+	if err != nil {
+		_ = closer.Close()
+		return nil, err
+	}
+
+	track, err := publisher.newTrack(id, "", reader.MimeType(), target == nil)
+	if err != nil {
+		_ = closer.Close()
+		_ = publisher.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(publisher.Client().Context())
+
+	playback := &MediaPlayback{
+		mu:        sync.Mutex{},
+		context:   ctx,
+		cancel:    cancel,
+		filePath:  filePath,
+		publisher: publisher,
+		track:     track,
+		done:      make(chan struct{}),
+		onEnded:   opts.OnEnded,
+	}
+
+	playback.loop.Store(opts.Loop)
+
+	if target != nil {
+		target.subscribeTracks([]ITrack{track.Track()})
+
+		// stop playing when the client left
+		go func() {
+			select {
+			case <-target.Context().Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	} else {
+		for _, client := range r.sfu.clients.GetClients() {
+			if client.Type() == ClientTypeVirtual {
+				continue
+			}
+
+			if err := client.SubscribeTracks([]SubscribeTrackRequest{{ClientID: id, TrackID: id}}); err != nil {
+				r.sfu.log.Errorf("room: failed to subscribe client %s to the playback: %s", client.ID(), err.Error())
+			}
+		}
+	}
+
+	go playback.play(reader, closer)
+
+	return playback, nil
+}
+
+// ID returns the ID of the virtual publisher and the track of the playback
+func (p *MediaPlayback) ID() string {
+	return p.publisher.ID()
+}
+
+// SetLoop changes whether the media is played again when it ends
+func (p *MediaPlayback) SetLoop(loop bool) {
+	p.loop.Store(loop)
+}
+
+// Stop stops the playback and waits until the virtual publisher left the room
+func (p *MediaPlayback) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Done is closed when the playback ended
+func (p *MediaPlayback) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the error that ended the playback
+func (p *MediaPlayback) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+func (p *MediaPlayback) play(reader mediaReader, closer io.Closer) {
+	err := p.playFile(reader)
+	_ = closer.Close()
+
+	for err == nil && p.loop.Load() && p.context.Err() == nil {
+		if reader, closer, err = openMediaFile(p.filePath); err != nil {
+			break
+		}
+
+		err = p.playFile(reader)
+		_ = closer.Close()
+	}
+
+	p.cancel()
+
+	if closeErr := p.publisher.Close(); closeErr != nil {
+		p.publisher.Client().log.Errorf("mediaplayer: failed to close the publisher: %s", closeErr.Error())
+	}
+
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+
+	close(p.done)
+
+	if p.onEnded != nil {
+		p.onEnded(err)
+	}
+}
+
+// playFile writes the frames to the track at the pace of their duration
+func (p *MediaPlayback) playFile(reader mediaReader) error {
+	start := time.Now()
+	elapsed := time.Duration(0)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.context.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		frame, duration, err := reader.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := p.track.WriteSample(media.Sample{Data: frame, Duration: duration}); err != nil {
+			if p.context.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		elapsed += duration
+		timer.Reset(time.Until(start.Add(elapsed)))
+	}
+}
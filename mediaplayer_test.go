@@ -0,0 +1,190 @@
+package sfu
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// writeWav writes a mono 8kHz WAV file with the samples
+func writeWav(t *testing.T, format, bitsPerSample uint16, data []byte) string {
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], format)
+	binary.LittleEndian.PutUint16(header[22:], 1)
+	binary.LittleEndian.PutUint32(header[24:], 8000)
+	binary.LittleEndian.PutUint32(header[28:], uint32(8000*bitsPerSample/8))
+	binary.LittleEndian.PutUint16(header[32:], bitsPerSample/8)
+	binary.LittleEndian.PutUint16(header[34:], bitsPerSample)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+
+	filePath := filepath.Join(t.TempDir(), "prompt.wav")
+	require.NoError(t, os.WriteFile(filePath, append(header, data...), 0o644))
+
+	return filePath
+}
+
+func TestMediaFile(t *testing.T) {
+	t.Parallel()
+
+	reader, closer, err := openMediaFile(audioFileName)
+	require.NoError(t, err)
+	defer closer.Close()
+
+	require.Equal(t, webrtc.MimeTypeOpus, reader.MimeType())
+
+	frames := 0
+	duration := time.Duration(0)
+	for {
+		frame, frameDuration, err := reader.ReadFrame()
+		if err != nil {
+			break
+		}
+
+		require.NotEmpty(t, frame)
+		frames++
+		duration += frameDuration
+	}
+
+	require.Greater(t, frames, 0)
+	require.Equal(t, time.Duration(frames)*20*time.Millisecond, duration)
+
+	// 330 linear samples are encoded to PCMU in 20ms frames
+	samples := make([]byte, 330*2)
+	binary.LittleEndian.PutUint16(samples[2:], 32767)
+	reader, closer, err = openMediaFile(writeWav(t, wavFormatPCM, 16, samples))
+	require.NoError(t, err)
+	defer closer.Close()
+
+	require.Equal(t, webrtc.MimeTypePCMU, reader.MimeType())
+
+	frame, frameDuration, err := reader.ReadFrame()
+	require.NoError(t, err)
+	require.Len(t, frame, 160)
+	require.Equal(t, 20*time.Millisecond, frameDuration)
+	require.Equal(t, []byte{0xff, 0x80}, frame[:2])
+
+	_, _, err = reader.ReadFrame()
+	require.NoError(t, err)
+
+	frame, frameDuration, err = reader.ReadFrame()
+	require.NoError(t, err)
+	require.Len(t, frame, 10)
+	require.Equal(t, 1250*time.Microsecond, frameDuration)
+
+	_, _, err = openMediaFile(writeWav(t, wavFormatPCM, 8, samples))
+	require.ErrorIs(t, err, ErrMediaFormat)
+
+	_, _, err = openMediaFile("prompt.mp3")
+	require.Error(t, err)
+}
+
+func TestRoomPlayMedia(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	// 100ms of PCMU silence
+	filePath := writeWav(t, wavFormatMuLaw, 8, make([]byte, 800))
+
+	_, err = testRoom.PlayMedia(filePath, PlayMediaOptions{ClientID: "unknown"})
+	require.ErrorIs(t, err, ErrClientNotFound)
+
+	ended := make(chan error, 1)
+	start := time.Now()
+	playback, err := testRoom.PlayMedia(filePath, PlayMediaOptions{
+		OnEnded: func(err error) {
+			ended <- err
+		},
+	})
+	require.NoError(t, err)
+
+	client, err := testRoom.SFU().GetClient(playback.ID())
+	require.NoError(t, err)
+	require.Equal(t, webrtc.MimeTypePCMU, client.Tracks()[0].MimeType())
+
+	select {
+	case err := <-ended:
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the playback to end")
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := testRoom.SFU().GetClient(playback.ID())
+		return err == ErrClientNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a looped playback is played until it's stopped
+	playback, err = testRoom.PlayMedia(filePath, PlayMediaOptions{Loop: true})
+	require.NoError(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+
+	select {
+	case <-playback.Done():
+		t.Fatal("looped playback ended")
+	default:
+	}
+
+	playback.Stop()
+	require.NoError(t, playback.Err())
+}
+
+func TestClientPlayMedia(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	defer testRoom.Close()
+
+	pc1, client1, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "peer1", true, false)
+	defer pc1.PeerConnection.Close()
+
+	pc2, client2, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "peer2", true, false)
+	defer pc2.PeerConnection.Close()
+
+	require.Eventually(t, func() bool {
+		return client1.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected &&
+			client2.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	playback, err := testRoom.PlayMedia(writeWav(t, wavFormatMuLaw, 8, make([]byte, 800)), PlayMediaOptions{ClientID: client1.ID(), Loop: true})
+	require.NoError(t, err)
+
+	require.Contains(t, client1.ClientTracks(), playback.ID())
+	require.NotContains(t, client2.ClientTracks(), playback.ID())
+
+	publisher, err := testRoom.SFU().GetClient(playback.ID())
+	require.NoError(t, err)
+	require.Empty(t, publisher.Tracks())
+	require.True(t, publisher.IsHidden())
+
+	playback.Stop()
+
+	require.Eventually(t, func() bool {
+		_, ok := client1.ClientTracks()[playback.ID()]
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,171 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrMoveClientSameRoom  = errors.New("manager: client is already in the room")
+	ErrMoveClientNotJoined = errors.New("manager: only a joined peer client can be moved")
+	ErrMoveClientCodecs    = errors.New("manager: room doesn't support the codecs of the client tracks")
+)
+
+// MoveClient moves a joined client to another room on the same peer connection, like a call transfer or a breakout room.
+// The tracks of the client are removed from the subscribers of the old room and announced to the clients of the new room,
+// the subscribed tracks are removed and the client gets the tracks of the new room in OnTracksAvailable.
+// The data channels of the old room are closed and the data channels of the new room are created,
+// the old room sees the client leave and the new room sees it join.
+func (m *Manager) MoveClient(clientID, fromRoomID, toRoomID string) error {
+	if fromRoomID == toRoomID {
+		return ErrMoveClientSameRoom
+	}
+
+	m.mutex.RLock()
+	from, fromErr := m.getRoom(fromRoomID)
+	to, toErr := m.getRoom(toRoomID)
+	m.mutex.RUnlock()
+
+	if fromErr != nil {
+		return fromErr
+	}
+
+	if toErr != nil {
+		return toErr
+	}
+
+	to.mu.RLock()
+	state := to.state
+	exts := to.extensions
+	to.mu.RUnlock()
+
+	if state == StateRoomClosed {
+		return ErrRoomIsClosed
+	}
+
+	client, err := from.sfu.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	if client.Type() != ClientTypePeer || client.state.Load() != ClientStateActive {
+		return ErrMoveClientNotJoined
+	}
+
+	if _, err := to.sfu.GetClient(clientID); err == nil {
+		return ErrClientExists
+	}
+
+	// the peer connection is negotiated with the codecs of the old room
+	for _, track := range client.tracks.GetTracks() {
+		if !to.sfu.supportsCodec(track.MimeType()) {
+			return ErrMoveClientCodecs
+		}
+	}
+
+	for _, ext := range exts {
+		if err := ext.OnBeforeClientAdded(to, clientID); err != nil {
+			return err
+		}
+	}
+
+	// leave the old room
+	if from.isRecording.Load() {
+		client.stopRoomRecording()
+	}
+
+	client.unpublishTracks(from.sfu)
+	client.unsubscribeTracks()
+	client.dataChannels.Clear()
+
+	if err := from.sfu.removeClient(client); err != nil {
+		return err
+	}
+
+	// join the new room
+	client.moveToSFU(to.sfu, to.id)
+	to.sfu.addClient(client)
+	to.sfu.createExistingDataChannels(client)
+
+	to.onClientJoined(client)
+
+	if from.isRecording.Load() && !to.isRecording.Load() {
+		client.sendRecordingState(to.RecordingState())
+	}
+
+	if tracks := client.announcedTracks(); len(tracks) > 0 {
+		to.sfu.onTracksAvailable(clientID, tracks)
+	}
+
+	client.announceAvailableTracks()
+
+	return nil
+}
+
+// supportsCodec returns true when the codec is registered on the clients of the SFU
+func (s *SFU) supportsCodec(mimeType string) bool {
+	for _, codec := range s.codecs {
+		if strings.EqualFold(codec, mimeType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unpublishTracks stops sending the tracks of the client to the subscribers in the SFU, the tracks keep running
+func (c *Client) unpublishTracks(s *SFU) {
+	for _, track := range c.tracks.GetTracks() {
+		var clientTracks []iClientTrack
+
+		switch t := track.(type) {
+		case *Track:
+			clientTracks = t.base.clientTracks.GetTracks()
+		case *SimulcastTrack:
+			clientTracks = t.base.clientTracks.GetTracks()
+		}
+
+		for _, clientTrack := range clientTracks {
+			if clientTrack.Client().SFU() == s {
+				clientTrack.end()
+			}
+		}
+	}
+}
+
+// unsubscribeTracks removes all subscribed tracks from the client
+func (c *Client) unsubscribeTracks() {
+	c.mu.Lock()
+	c.pendingReceivedTracks = make([]SubscribeTrackRequest, 0)
+	c.mu.Unlock()
+
+	for _, clientTrack := range c.ClientTracks() {
+		clientTrack.end()
+	}
+}
+
+// announcedTracks returns the tracks of the client that are already announced to the other clients
+func (c *Client) announcedTracks() []ITrack {
+	tracks := make([]ITrack, 0)
+
+	for _, track := range c.tracks.GetTracks() {
+		if _, err := c.pendingPublishedTracks.Get(track.ID()); err == ErrTrackIsNotExists {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks
+}
+
+// moveToSFU makes the client a client of the SFU of another room, the client is canceled with the new SFU
+func (c *Client) moveToSFU(s *SFU, roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stopSFUContext()
+
+	c.sfu.Store(s)
+	c.roomId.Store(roomID)
+	c.stopSFUContext = context.AfterFunc(s.context, c.cancel)
+}
@@ -0,0 +1,100 @@
+package sfu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerMoveClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	roomA, err := roomManager.NewRoom(roomManager.CreateRoomID(), "room-a", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	roomB, err := roomManager.NewRoom(roomManager.CreateRoomID(), "room-b", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	defer roomB.Close()
+
+	require.NoError(t, roomA.SFU().CreateDataChannel("room-a", DefaultDataChannelOptions()))
+	require.NoError(t, roomB.SFU().CreateDataChannel("room-b", DefaultDataChannelOptions()))
+
+	pcA, peerA, _, _ := CreatePeerPair(ctx, TestLogger, roomA, DefaultTestIceServers(), "peer-a", true, false)
+	defer pcA.PeerConnection.Close()
+
+	pcB, peerB, _, _ := CreatePeerPair(ctx, TestLogger, roomB, DefaultTestIceServers(), "peer-b", true, false)
+	defer pcB.PeerConnection.Close()
+
+	pcMover, mover, _, _ := CreatePeerPair(ctx, TestLogger, roomA, DefaultTestIceServers(), "mover", true, false)
+	defer pcMover.PeerConnection.Close()
+
+	subscribedTo := func(subscriber, publisher *Client) int {
+		count := 0
+
+		for _, track := range publisher.Tracks() {
+			if _, ok := subscriber.ClientTracks()[track.ID()]; ok {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	// the mover and the peer in room A see each other
+	require.Eventually(t, func() bool {
+		return subscribedTo(peerA, mover) == 2 && subscribedTo(mover, peerA) == 2 &&
+			peerB.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	left := make(chan *Client, 1)
+	roomA.OnClientLeft(func(client *Client) {
+		left <- client
+	})
+
+	joined := make(chan *Client, 1)
+	roomB.OnClientJoined(func(client *Client) {
+		joined <- client
+	})
+
+	require.ErrorIs(t, roomManager.MoveClient(mover.ID(), roomA.ID(), roomA.ID()), ErrMoveClientSameRoom)
+	require.ErrorIs(t, roomManager.MoveClient(mover.ID(), roomA.ID(), "unknown"), ErrRoomNotFound)
+	require.ErrorIs(t, roomManager.MoveClient("unknown", roomA.ID(), roomB.ID()), ErrClientNotFound)
+
+	require.NoError(t, roomManager.MoveClient(mover.ID(), roomA.ID(), roomB.ID()))
+
+	require.Equal(t, mover, <-left)
+	require.Equal(t, mover, <-joined)
+
+	_, err = roomA.SFU().GetClient(mover.ID())
+	require.ErrorIs(t, err, ErrClientNotFound)
+
+	_, err = roomB.SFU().GetClient(mover.ID())
+	require.NoError(t, err)
+	require.Equal(t, roomB.SFU(), mover.SFU())
+
+	// the subscriptions are replaced on the same peer connection
+	require.Eventually(t, func() bool {
+		return subscribedTo(peerA, mover) == 0 && subscribedTo(mover, peerA) == 0 &&
+			subscribedTo(peerB, mover) == 2 && subscribedTo(mover, peerB) == 2
+	}, 30*time.Second, 100*time.Millisecond)
+
+	require.Nil(t, mover.dataChannels.Get("room-a"))
+	require.NotNil(t, mover.dataChannels.Get("room-b"))
+
+	// the moved client is not stopped with the old room
+	require.NoError(t, roomA.Close())
+
+	time.Sleep(500 * time.Millisecond)
+
+	require.NoError(t, mover.Context().Err())
+	require.Equal(t, webrtc.PeerConnectionStateConnected, mover.PeerConnection().PC().ConnectionState())
+	require.Equal(t, webrtc.PeerConnectionStateConnected, pcMover.PeerConnection.ConnectionState())
+}
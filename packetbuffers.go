@@ -46,6 +46,9 @@ type packetBuffers struct {
 	packetAvailableWait  *sync.Cond
 	enableDynamicLatency bool
 	ended                bool
+	packetsLate          uint64
+	packetsDuplicate     uint64
+	packetsReordered     uint64
 	log                  logging.LeveledLogger
 }
 
@@ -77,6 +80,15 @@ func newPacketBuffers(ctx context.Context, minLatency, maxLatency time.Duration,
 	return p
 }
 
+// packetBuffersStats is the snapshot of the jitter buffer counters
+type packetBuffersStats struct {
+	// current min latency, adjusted by the dynamic latency
+	Latency          time.Duration
+	PacketsLate      uint64
+	PacketsDuplicate uint64
+	PacketsReordered uint64
+}
+
 func (p *packetBuffers) MaxLatency() time.Duration {
 	p.latencyMu.RLock()
 	defer p.latencyMu.RUnlock()
@@ -88,6 +100,29 @@ func (p *packetBuffers) MinLatency() time.Duration {
 	defer p.latencyMu.RUnlock()
 	return p.minLatency
 }
+
+// SetLatency changes the min and max duration to wait before sending the packets.
+// The min latency will be adjusted again by the dynamic latency if it's enabled.
+func (p *packetBuffers) SetLatency(minLatency, maxLatency time.Duration) {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+
+	p.minLatency = minLatency
+	p.maxLatency = maxLatency
+}
+
+func (p *packetBuffers) Stats() packetBuffersStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return packetBuffersStats{
+		Latency:          p.MinLatency(),
+		PacketsLate:      p.packetsLate,
+		PacketsDuplicate: p.packetsDuplicate,
+		PacketsReordered: p.packetsReordered,
+	}
+}
+
 func (p *packetBuffers) Initiated() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -109,11 +144,10 @@ func (p *packetBuffers) Add(pkt *rtppool.RetainablePacket) error {
 		(p.lastSequenceNumber == pkt.Header().SequenceNumber || IsRTPPacketLate(pkt.Header().SequenceNumber, p.lastSequenceNumber)) {
 		p.log.Warnf("packet cache: packet sequence ", pkt.Header().SequenceNumber, " is too late, last sent was ", p.lastSequenceNumber, ", will not adding the packet")
 
-		// add to to front of the list to make sure pop take it first
-		p.buffers.PushFront(&packet{
-			packet:    pkt,
-			addedTime: time.Now(),
-		})
+		// the packets after it are already sent, sending it now will be out of order
+		pkt.Release()
+
+		p.packetsLate++
 
 		return ErrPacketTooLate
 	}
@@ -126,8 +160,11 @@ func (p *packetBuffers) Add(pkt *rtppool.RetainablePacket) error {
 
 		return nil
 	}
-	// add packet in order
-Loop:
+
+	// add packet in order, reordered means the packet is inserted before the packets that arrived earlier
+	inserted := false
+	reordered := false
+
 	for e := p.buffers.Back(); e != nil; e = e.Prev() {
 		currentPkt := e.Value.(*packet)
 
@@ -139,37 +176,43 @@ Loop:
 		if currentPkt.packet.Header().SequenceNumber == pkt.Header().SequenceNumber {
 			// p.log.Warnf("packet cache: packet sequence ", pkt.SequenceNumber, " already exists in the cache, will not adding the packet")
 			currentPkt.packet.Release()
+			pkt.Release()
+			p.packetsDuplicate++
 			return ErrPacketDuplicate
 		}
 
-		if currentPkt.packet.Header().SequenceNumber < pkt.Header().SequenceNumber && pkt.Header().SequenceNumber-currentPkt.packet.Header().SequenceNumber < uint16SizeHalf {
+		if (currentPkt.packet.Header().SequenceNumber < pkt.Header().SequenceNumber && pkt.Header().SequenceNumber-currentPkt.packet.Header().SequenceNumber < uint16SizeHalf) ||
+			currentPkt.packet.Header().SequenceNumber-pkt.Header().SequenceNumber > uint16SizeHalf {
 			p.buffers.InsertAfter(&packet{
 				packet:    pkt,
 				addedTime: time.Now(),
 			}, e)
 			currentPkt.packet.Release()
-			break Loop
+			inserted = true
+
+			break
 		}
 
-		if currentPkt.packet.Header().SequenceNumber-pkt.Header().SequenceNumber > uint16SizeHalf {
-			p.buffers.InsertAfter(&packet{
-				packet:    pkt,
-				addedTime: time.Now(),
-			}, e)
-			currentPkt.packet.Release()
-			break Loop
+		currentPkt.packet.Release()
+		reordered = true
+	}
+
+	if !inserted {
+		newPacket := &packet{
+			packet:    pkt,
+			addedTime: time.Now(),
 		}
 
-		if e.Prev() == nil {
-			p.buffers.PushFront(&packet{
-				packet:    pkt,
-				addedTime: time.Now(),
-			})
-			currentPkt.packet.Release()
-			break Loop
+		// the packet is older than all packets in the list, or the list only has released packets
+		if reordered {
+			p.buffers.PushFront(newPacket)
+		} else {
+			p.buffers.PushBack(newPacket)
 		}
+	}
 
-		currentPkt.packet.Release()
+	if reordered {
+		p.packetsReordered++
 	}
 
 	return nil
@@ -226,7 +269,7 @@ func (p *packetBuffers) pop(el *list.Element) *packet {
 func (p *packetBuffers) flush() []*packet {
 	packets := make([]*packet, 0)
 
-	if p.oldestPacket != nil && time.Since(p.oldestPacket.addedTime) > p.maxLatency {
+	if p.oldestPacket != nil && time.Since(p.oldestPacket.addedTime) > p.MaxLatency() {
 		// we have waited too long, we should send the packets
 
 		packets = append(packets, p.sendOldestPacket())
@@ -267,7 +310,7 @@ func (p *packetBuffers) fetch(e *list.Element) *packet {
 
 	latency := time.Since(currentPacket.addedTime)
 
-	if !p.Initiated() && latency > minLatency && e.Next() != nil && !IsRTPPacketLate(e.Next().Value.(*rtppool.RetainablePacket).Header().SequenceNumber, currentSeq) {
+	if !p.Initiated() && latency > minLatency && e.Next() != nil && !IsRTPPacketLate(e.Next().Value.(*packet).packet.Header().SequenceNumber, currentSeq) {
 		// first packet to send, but make sure we have the packet in order
 		p.mu.Lock()
 		p.initSequence = currentSeq
@@ -298,12 +341,31 @@ func (p *packetBuffers) fetch(e *list.Element) *packet {
 		return p.pop(e)
 	}
 
+	if p.hasExpiredPacket(e.Next(), maxLatency) {
+		// a later packet reached the max latency, the packets before it are sent first to keep the order
+		return p.pop(e)
+	}
+
 	return nil
 }
 
+// hasExpiredPacket checks if a packet from the element to the back of the list has waited more than the max latency
+func (p *packetBuffers) hasExpiredPacket(e *list.Element, maxLatency time.Duration) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for ; e != nil; e = e.Next() {
+		if time.Since(e.Value.(*packet).addedTime) > maxLatency {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (p *packetBuffers) Pop() *packet {
 	p.mu.RLock()
-	if p.oldestPacket != nil && time.Since(p.oldestPacket.addedTime) > p.maxLatency {
+	if p.oldestPacket != nil && time.Since(p.oldestPacket.addedTime) > p.MaxLatency() {
 		p.mu.RUnlock()
 		// we have waited too long, we should send the packets
 		return p.sendOldestPacket()
@@ -316,7 +378,7 @@ func (p *packetBuffers) Pop() *packet {
 		return nil
 	}
 
-	item := frontElement.Value.(*rtppool.RetainablePacket)
+	item := frontElement.Value.(*packet).packet
 	if err := item.Retain(); err != nil {
 		return nil
 	}
@@ -360,9 +422,8 @@ func (p *packetBuffers) Clear() {
 	defer p.mu.Unlock()
 
 	for e := p.buffers.Front(); e != nil; e = e.Next() {
-		packet := e.Value.(*rtppool.RetainablePacket)
-		packet.Release()
-		p.buffers.Remove(e)
+		pkt := e.Value.(*packet)
+		pkt.packet.Release()
 	}
 
 	p.buffers.Init()
@@ -400,6 +461,9 @@ func (p *packetBuffers) WaitAvailablePacket() {
 }
 
 func (p *packetBuffers) checkOrderedPacketAndRecordTimes() {
+	minLatency := p.MinLatency()
+	maxLatency := p.MaxLatency()
+
 	for e := p.buffers.Front(); e != nil; e = e.Next() {
 		pkt := e.Value.(*packet)
 
@@ -412,18 +476,18 @@ func (p *packetBuffers) checkOrderedPacketAndRecordTimes() {
 		currentSeq := pkt.packet.Header().SequenceNumber
 		latency := time.Since(pkt.addedTime)
 
-		if !p.init && latency > p.minLatency && e.Next() != nil && !IsRTPPacketLate(e.Next().Value.(*rtppool.RetainablePacket).Header().SequenceNumber, currentSeq) {
+		if !p.init && latency > minLatency && e.Next() != nil && !IsRTPPacketLate(e.Next().Value.(*packet).packet.Header().SequenceNumber, currentSeq) {
 			// signal first packet to send
 			p.packetAvailableWait.Signal()
 		} else if (p.lastSequenceNumber < currentSeq || p.lastSequenceNumber-currentSeq > uint16SizeHalf) && currentSeq-p.lastSequenceNumber == 1 {
 			// the current packet is in sequence with the last packet we popped
 			p.recordWaitTime(e)
 
-			if time.Since(pkt.addedTime) > p.minLatency {
+			if time.Since(pkt.addedTime) > minLatency {
 				// passed the min latency
 				p.packetAvailableWait.Signal()
 			}
-		} else if latency > p.maxLatency {
+		} else if latency > maxLatency {
 			// passed the max latency
 			p.packetAvailableWait.Signal()
 		}
@@ -485,15 +549,17 @@ func (p *packetBuffers) checkWaitTimeAdjuster() {
 
 		percentile := sortedWaitTimes[percentileIndex]
 
-		if percentile > p.minLatency && percentile < p.maxLatency {
+		minLatency := p.MinLatency()
+
+		if percentile > minLatency && percentile < p.MaxLatency() {
 			// increase the min latency
-			p.log.Infof("packet cache: set min latency ", percentile, ", increasing min latency from ", p.minLatency)
+			p.log.Infof("packet cache: set min latency ", percentile, ", increasing min latency from ", minLatency)
 			p.latencyMu.Lock()
 			p.minLatency = percentile
 			p.latencyMu.Unlock()
-		} else if percentile < p.minLatency && percentile > 0 {
+		} else if percentile < minLatency && percentile > 0 {
 			// decrease the min latency
-			p.log.Infof("packet cache: set min latency ", percentile, ", decreasing min latency from ", p.minLatency)
+			p.log.Infof("packet cache: set min latency ", percentile, ", decreasing min latency from ", minLatency)
 			p.latencyMu.Lock()
 			p.minLatency = percentile
 			p.latencyMu.Unlock()
@@ -51,10 +51,9 @@ func TestAdd(t *testing.T) {
 
 	i := 0
 	for e := caches.buffers.Front(); e != nil; e = e.Next() {
-		packet := e.Value.(*rtppool.RetainablePacket)
+		packet := e.Value.(*packet).packet
 		require.Equal(t, packet.Header().SequenceNumber, sortedNumbers[i], fmt.Sprintf("packet sequence number %d should be equal to sortedNumbers sequence number %d", packet.Header().SequenceNumber, sortedNumbers[i]))
 		i++
-		packet.Release()
 	}
 }
 
@@ -96,14 +95,13 @@ func TestAddLost(t *testing.T) {
 
 	i := 0
 	for e := caches.buffers.Front(); e != nil; e = e.Next() {
-		packet := e.Value.(*rtppool.RetainablePacket)
+		packet := e.Value.(*packet).packet
 		if sortedNumbers[i] == 65533 {
 			i++
 		}
 
 		require.Equal(t, packet.Header().SequenceNumber, sortedNumbers[i], fmt.Sprintf("packet sequence number %d should be equal to sortedNumbers sequence number %d", packet.Header().SequenceNumber, sortedNumbers[i]))
 		i++
-		packet.Release()
 	}
 }
 
@@ -377,3 +375,55 @@ func BenchmarkPopPool(b *testing.B) {
 	}
 
 }
+
+func TestPacketBuffersStats(t *testing.T) {
+	t.Parallel()
+
+	minLatency := 10 * time.Millisecond
+	maxLatency := 100 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	caches := newPacketBuffers(ctx, minLatency, maxLatency, false, logging.NewDefaultLoggerFactory().NewLogger("sfu"))
+
+	for _, seq := range unsortedNumbers {
+		rp := pool.NewPacket(&rtp.Header{SequenceNumber: seq}, nil)
+		_ = caches.Add(rp)
+	}
+
+	stats := caches.Stats()
+	require.Equal(t, uint64(2), stats.PacketsDuplicate)
+	require.Equal(t, uint64(5), stats.PacketsReordered)
+	require.Equal(t, uint64(0), stats.PacketsLate)
+	require.Equal(t, minLatency, stats.Latency)
+
+	time.Sleep(5 * minLatency)
+
+	sorted := caches.Flush()
+	require.Equal(t, len(sortedNumbers), len(sorted))
+
+	// add a packet that already sent
+	err := caches.Add(pool.NewPacket(&rtp.Header{SequenceNumber: 5}, nil))
+	require.ErrorIs(t, err, ErrPacketTooLate)
+	require.Equal(t, uint64(1), caches.Stats().PacketsLate)
+
+	// the late packet is dropped, not sent out of order
+	require.Zero(t, caches.Len())
+
+	time.Sleep(2 * maxLatency)
+	require.Empty(t, caches.Flush())
+
+	// a packet is not counted as reordered when the packets it is compared with are already released
+	released := rtppool.New().NewPacket(&rtp.Header{SequenceNumber: 12}, nil)
+	require.NoError(t, caches.Add(released))
+	released.Release()
+
+	require.NoError(t, caches.Add(pool.NewPacket(&rtp.Header{SequenceNumber: 11}, nil)))
+	require.Equal(t, uint64(5), caches.Stats().PacketsReordered)
+	require.Equal(t, 2, caches.Len())
+
+	caches.SetLatency(20*time.Millisecond, 200*time.Millisecond)
+	require.Equal(t, 20*time.Millisecond, caches.Stats().Latency)
+	require.Equal(t, 200*time.Millisecond, caches.MaxLatency())
+}
@@ -1,6 +1,8 @@
 package playoutdelay
 
 import (
+	"sync"
+
 	"github.com/pion/interceptor"
 	"github.com/pion/logging"
 	"github.com/pion/rtp"
@@ -9,6 +11,7 @@ import (
 
 type InterceptorFactory struct {
 	minDelay, maxDelay uint16
+	onNew              func(i *Interceptor)
 	log                logging.LeveledLogger
 }
 
@@ -24,45 +27,115 @@ func NewInterceptor(log logging.LeveledLogger, minDelay, maxDelay uint16) *Inter
 func (g *InterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
 	i := new(g.log, g.minDelay, g.maxDelay)
 
+	if g.onNew != nil {
+		g.onNew(i)
+	}
+
 	return i, nil
 }
 
+func (g *InterceptorFactory) OnNew(callback func(i *Interceptor)) {
+	g.onNew = callback
+}
+
 type Interceptor struct {
-	minDelay uint16
-	maxDelay uint16
+	mu             sync.RWMutex
+	defaultPayload []byte
+	// playout delay payloads per SSRC that override the default playout delay
+	payloads map[uint32][]byte
 	log      logging.LeveledLogger
 }
 
 func new(log logging.LeveledLogger, min, max uint16) *Interceptor {
-	return &Interceptor{
-		minDelay: min,
-		maxDelay: max,
+	i := &Interceptor{
+		mu:       sync.RWMutex{},
+		payloads: make(map[uint32][]byte),
 		log:      log,
 	}
+
+	payload, err := PlayoutDelayFromValue(min, max).Marshal()
+	if err != nil {
+		log.Errorf("error on marshal playout delay payload", err)
+	}
+
+	i.defaultPayload = payload
+
+	return i
 }
 
-// BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
-// will be called once per rtp packet.
-func (v *Interceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
-	extID := v.getHeaderExtensionID(info, PlayoutDelayURI)
+// SetDefaultDelay sets the playout delay in milliseconds of the streams that don't have their own playout delay.
+// The new delay is used on the next packet.
+func (v *Interceptor) SetDefaultDelay(min, max uint16) error {
+	payload, err := marshalDelay(min, max)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
-	playOutDelay := PlayoutDelayFromValue(v.minDelay, v.maxDelay)
+	v.defaultPayload = payload
 
-	payloadDelay, err := playOutDelay.Marshal()
+	return nil
+}
+
+// SetDelay sets the playout delay in milliseconds of the stream with the SSRC.
+// The new delay is used on the next packet.
+func (v *Interceptor) SetDelay(ssrc uint32, min, max uint16) error {
+	payload, err := marshalDelay(min, max)
 	if err != nil {
-		v.log.Errorf("error on marshal playout delay payload", err)
-		return writer
+		return err
 	}
 
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.payloads[ssrc] = payload
+
+	return nil
+}
+
+// ResetDelay removes the playout delay of the stream with the SSRC, the stream will use the default playout delay.
+func (v *Interceptor) ResetDelay(ssrc uint32) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.payloads, ssrc)
+}
+
+func (v *Interceptor) getPayload(ssrc uint32) []byte {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if payload, ok := v.payloads[ssrc]; ok {
+		return payload
+	}
+
+	return v.defaultPayload
+}
+
+func marshalDelay(min, max uint16) ([]byte, error) {
+	if min > max {
+		return nil, errPlayoutDelayInvalid
+	}
+
+	return PlayoutDelayFromValue(min, max).Marshal()
+}
+
+// BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
+// will be called once per rtp packet.
+func (v *Interceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	extID := v.getHeaderExtensionID(info, PlayoutDelayURI)
+
 	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
-		newHeader := v.addPlayoutDelay(info, header, extID, payloadDelay)
+		newHeader := v.addPlayoutDelay(info, header, extID, v.getPayload(info.SSRC))
 		return writer.Write(newHeader, payload, attributes)
 	})
 }
 
 // UnbindLocalStream is called when the Stream is removed. It can be used to clean up any data related to that track.
 func (v *Interceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
-
+	v.ResetDelay(info.SSRC)
 }
 
 // BindRemoteStream lets you modify any incoming RTP packets. It is called once for per RemoteStream. The returned method
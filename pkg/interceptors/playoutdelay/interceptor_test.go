@@ -0,0 +1,71 @@
+package playoutdelay
+
+import (
+	"testing"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptorDelayPerSSRC(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("playoutdelay")
+
+	factory := NewInterceptor(log, 100, 200)
+
+	var playoutDelay *Interceptor
+	factory.OnNew(func(i *Interceptor) {
+		playoutDelay = i
+	})
+
+	i, err := factory.NewInterceptor("")
+	require.NoError(t, err)
+	require.NotNil(t, playoutDelay)
+
+	var lastHeader *rtp.Header
+
+	writer := interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		lastHeader = header
+		return len(payload), nil
+	})
+
+	bindStream := func(ssrc uint32) interceptor.RTPWriter {
+		return i.BindLocalStream(&interceptor.StreamInfo{
+			SSRC: ssrc,
+			RTPHeaderExtensions: []interceptor.RTPHeaderExtension{
+				{URI: PlayoutDelayURI, ID: 5},
+			},
+		}, writer)
+	}
+
+	readDelay := func(w interceptor.RTPWriter) PlayOutDelay {
+		_, err := w.Write(&rtp.Header{Version: 2}, []byte{0x00}, nil)
+		require.NoError(t, err)
+
+		delay := PlayOutDelay{}
+		require.NoError(t, delay.Unmarshal(lastHeader.GetExtension(5)))
+
+		return delay
+	}
+
+	stream1 := bindStream(1)
+	stream2 := bindStream(2)
+
+	require.Equal(t, PlayOutDelay{Min: 100, Max: 200}, readDelay(stream1))
+
+	// change the delay of a stream at runtime
+	require.NoError(t, playoutDelay.SetDelay(1, 400, 1000))
+	require.Equal(t, PlayOutDelay{Min: 400, Max: 1000}, readDelay(stream1))
+	require.Equal(t, PlayOutDelay{Min: 100, Max: 200}, readDelay(stream2))
+
+	// change the default delay doesn't affect the stream with its own delay
+	require.NoError(t, playoutDelay.SetDefaultDelay(0, 100))
+	require.Equal(t, PlayOutDelay{Min: 400, Max: 1000}, readDelay(stream1))
+	require.Equal(t, PlayOutDelay{Min: 0, Max: 100}, readDelay(stream2))
+
+	playoutDelay.ResetDelay(1)
+	require.Equal(t, PlayOutDelay{Min: 0, Max: 100}, readDelay(stream1))
+
+	require.ErrorIs(t, playoutDelay.SetDelay(1, 200, 100), errPlayoutDelayInvalid)
+}
@@ -17,6 +17,7 @@ const (
 
 var (
 	errPlayoutDelayOverflow = errors.New("playout delay overflow")
+	errPlayoutDelayInvalid  = errors.New("playout delay min is larger than max")
 	errTooSmall             = errors.New("buffer too small")
 )
 
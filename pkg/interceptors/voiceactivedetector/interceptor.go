@@ -225,7 +225,11 @@ func RegisterAudioLevelHeaderExtension(m *webrtc.MediaEngine) {
 func (v *Interceptor) getAudioLevelExtensionID(ssrc uint32) uint8 {
 	vad := v.getVadBySSRC(ssrc)
 	if vad != nil {
-		for _, extension := range vad.streamInfo.RTPHeaderExtensions {
+		vad.mu.RLock()
+		streamInfo := vad.streamInfo
+		vad.mu.RUnlock()
+
+		for _, extension := range streamInfo.RTPHeaderExtensions {
 			if extension.URI == sdp.AudioLevelURI {
 				return uint8(extension.ID)
 			}
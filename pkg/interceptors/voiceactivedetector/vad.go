@@ -43,8 +43,11 @@ type VoiceDetector struct {
 }
 
 func newVAD(ctx context.Context, config Config, streamInfo *interceptor.StreamInfo) *VoiceDetector {
+	ctx, cancel := context.WithCancel(ctx)
+
 	v := &VoiceDetector{
 		context:      ctx,
+		cancel:       cancel,
 		config:       config,
 		streamInfo:   streamInfo,
 		channel:      make(chan VoicePacketData, 1024),
@@ -68,12 +71,10 @@ func newVAD(ctx context.Context, config Config, streamInfo *interceptor.StreamIn
 func (v *VoiceDetector) run() {
 	go func() {
 		ticker := time.NewTicker(v.config.TailMargin)
-		ctx, cancel := context.WithCancel(v.context)
-		v.cancel = cancel
 
 		defer func() {
 			ticker.Stop()
-			cancel()
+			v.cancel()
 		}()
 
 		active := false
@@ -81,33 +82,19 @@ func (v *VoiceDetector) run() {
 
 		for {
 			select {
-			case <-ctx.Done():
+			case <-v.context.Done():
 				return
 			case voicePacket := <-v.channel:
 				if voicePacket.AudioLevel < v.config.Threshold {
 					// send all packets to callback
-					activity := VoiceActivity{
-						TrackID:     v.trackID,
-						StreamID:    v.streamID,
-						SSRC:        v.streamInfo.SSRC,
-						ClockRate:   v.streamInfo.ClockRate,
-						AudioLevels: []VoicePacketData{voicePacket},
-					}
-
-					v.onVoiceDetected(activity)
+					v.onVoiceDetected(v.newActivity([]VoicePacketData{voicePacket}))
 					lastSent = time.Now()
 					active = true
 				}
 			case <-ticker.C:
 				if active && time.Since(lastSent) > v.config.TailMargin {
 					// we need to notify that the voice is stopped
-					v.onVoiceDetected(VoiceActivity{
-						TrackID:     v.trackID,
-						StreamID:    v.streamID,
-						SSRC:        v.streamInfo.SSRC,
-						ClockRate:   v.streamInfo.ClockRate,
-						AudioLevels: nil,
-					})
+					v.onVoiceDetected(v.newActivity(nil))
 					active = false
 				}
 			}
@@ -115,6 +102,20 @@ func (v *VoiceDetector) run() {
 	}()
 }
 
+// newActivity returns the voice activity of the track with the audio levels
+func (v *VoiceDetector) newActivity(audioLevels []VoicePacketData) VoiceActivity {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return VoiceActivity{
+		TrackID:     v.trackID,
+		StreamID:    v.streamID,
+		SSRC:        v.streamInfo.SSRC,
+		ClockRate:   v.streamInfo.ClockRate,
+		AudioLevels: audioLevels,
+	}
+}
+
 // TODO: this function is use together with isDetected function
 // need to fix isDetected function first before we can use this function
 func (v *VoiceDetector) dropExpiredPackets() {
@@ -152,15 +153,7 @@ func (v *VoiceDetector) sendPacketsToCallback() int {
 	length := len(packets)
 
 	if length > 0 {
-		activity := VoiceActivity{
-			TrackID:     v.trackID,
-			StreamID:    v.streamID,
-			SSRC:        v.streamInfo.SSRC,
-			ClockRate:   v.streamInfo.ClockRate,
-			AudioLevels: packets,
-		}
-
-		v.onVoiceDetected(activity)
+		v.onVoiceDetected(v.newActivity(packets))
 	}
 
 	// clear packets
@@ -279,8 +272,8 @@ func (v *VoiceDetector) addPacket(header *rtp.Header, audioLevel uint8, isVoice
 }
 
 func (v *VoiceDetector) UpdateTrack(trackID, streamID string) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
 	v.trackID = trackID
 	v.streamID = streamID
@@ -291,8 +284,8 @@ func (v *VoiceDetector) Stop() {
 }
 
 func (v *VoiceDetector) updateStreamInfo(streamInfo *interceptor.StreamInfo) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
 	v.streamInfo = streamInfo
 }
@@ -22,6 +22,12 @@ type ClientConfig struct {
 	BucketName string
 	FileName   string
 	Channel    int // 1 to left channel, 2 to right channel
+	// SessionID identifies the recording session of a Session across reconnections
+	SessionID string
+	// Resume is set when the connection is made again to continue the session
+	Resume bool
+	// TimelineStart is the start of the room timeline, the markers and the splits are relative to it
+	TimelineStart time.Time
 }
 
 type SplitConfig struct {
@@ -37,51 +43,110 @@ const (
 	RightChannel Channel = 2
 )
 
+// ChannelLayout is how the clients are placed in the channels of the mixed recording
+type ChannelLayout string
+
+const (
+	// the clients are in the left or right channel of their Channel option
+	ChannelLayoutStereo ChannelLayout = "stereo"
+	// a channel per client in the order they're recorded
+	ChannelLayoutParticipant ChannelLayout = "participant"
+	// a channel per role, the clients with the same role share the channel
+	ChannelLayoutRole ChannelLayout = "role"
+	// all clients in a single channel
+	ChannelLayoutMono ChannelLayout = "mono"
+)
+
+// ChannelLayoutConfig configures the channels of the mixed recording of a room
+type ChannelLayoutConfig struct {
+	// Default is ChannelLayoutStereo
+	Layout ChannelLayout `json:"layout,omitempty" enums:"stereo,participant,role,mono" default:"stereo"`
+	// The channel of each role with the role layout, starting from 1. The roles that are not in the map get
+	// the next channels in the order they're recorded.
+	RoleChannels map[string]int `json:"role_channels,omitempty"`
+}
+
+// ChannelClient is the metadata of a client in the mixed recording
+type ChannelClient struct {
+	ClientID string
+	Name     string
+	Role     string
+	Channel  int
+	TrackIDs []string
+}
+
+// ChannelConfig is the channel of each track ID, starting from 1
 type ChannelConfig map[string]int
 type StopConfig struct {
 	Splits        []SplitConfig
 	ChannelConfig ChannelConfig
+	// The layout and the number of channels of the mixed recording, a stop config without them is a stereo recording
+	ChannelLayout ChannelLayout   `json:",omitempty"`
+	Channels      int             `json:",omitempty"`
+	Clients       []ChannelClient `json:",omitempty"`
 }
 
-func readCertAndKey(config *RecorderConfig) *tls.Config {
+// channelCount returns the number of channels of the mixed recording
+func (s StopConfig) channelCount() int {
+	if s.Channels > 0 {
+		return s.Channels
+	}
+
+	if s.ChannelLayout == "" || s.ChannelLayout == ChannelLayoutStereo {
+		return 2
+	}
+
+	channels := 0
+	for _, channel := range s.ChannelConfig {
+		channels = max(channels, channel)
+	}
+
+	return channels
+}
+
+func loadTLSConfig(config *RecorderConfig) (*tls.Config, error) {
 	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("recorder: failed to load the certificate: %w", err)
 	}
+
 	return &tls.Config{
 		Certificates:       []tls.Certificate{cert},
-		NextProtos:         []string{"samespace-recorder"},
+		NextProtos:         recorderProtocols,
 		InsecureSkipVerify: true,
-	}
+	}, nil
 }
 
+// NewQuicClient connects to the recorder service and sends the client config. It makes a single attempt,
+// use NewSession for a connection that is restored in the background when it's lost.
 func NewQuicClient(ctx context.Context, clientConfig ClientConfig, config *RecorderConfig) (quic.Connection, error) {
-	var conn quic.Connection
-	var err error
+	tlsConfig, err := loadTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	tlsConfig := readCertAndKey(config)
 	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
 
-	for retries := 0; retries < 5; retries++ {
-		fmt.Printf("Attempting connection (attempt %d)...\n", retries+1)
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
-
-		conn, err = quic.DialAddr(ctx, address, tlsConfig, &quic.Config{
-			EnableDatagrams: true,
-		})
-		if err == nil {
-			j, _ := json.Marshal(clientConfig)
-			err := conn.SendDatagram(j)
-			if err != nil {
-				return nil, err
-			}
-			return conn, nil
-		}
-
-		fmt.Printf("Connection failed (attempt %d): %v\n", retries+1, err)
-		time.Sleep(time.Duration(2<<retries) * time.Second) // backoff exponentially
+	conn, err := quic.DialAddr(ctx, address, tlsConfig, &quic.Config{
+		EnableDatagrams: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recorder: failed to connect to %s: %w", address, err)
+	}
+
+	j, err := json.Marshal(clientConfig)
+	if err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	if err := conn.SendDatagram(j); err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("failed to establish QUIC connection after retries: %w", err)
+	return conn, nil
 }
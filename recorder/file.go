@@ -0,0 +1,323 @@
+package recorder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+)
+
+type VideoFormat string
+
+const (
+	VideoFormatIVF  VideoFormat = "ivf"
+	VideoFormatWebM VideoFormat = "webm"
+)
+
+var (
+	ErrUnsupportedMimeType = errors.New("recorder: unsupported mime type for file recording")
+	ErrRecorderClosed      = errors.New("recorder: recorder is closed")
+	ErrSameFile            = errors.New("recorder: the track is already written to the file")
+	ErrInvalidFileName     = errors.New("recorder: invalid file name")
+	ErrInvalidBucketName   = errors.New("recorder: invalid bucket name")
+)
+
+// FileConfig configures the recording to the local disk without a recorder service.
+// Opus is written to Ogg, VP8 and VP9 to IVF or WebM, and H264 to Annex-B.
+type FileConfig struct {
+	// The directory where the recording files are written, it will be created if not exists
+	Directory string `json:"directory"`
+	// The container of VP8 and VP9 tracks, default is IVF
+	VideoFormat VideoFormat `json:"video_format,omitempty" enums:"ivf,webm"`
+}
+
+// rtpFileWriter is implemented by the container writers
+type rtpFileWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// FileTrack is a TrackRecorder that writes the track to a file on the local disk.
+// A rotate marker closes the file and continues the track in a new file named with the label of the marker.
+type FileTrack struct {
+	TrackID  string
+	ClientID string
+	RoomID   string
+	FilePath string
+	mu       sync.Mutex
+	config   TrackConfig
+	fileConf FileConfig
+	writer   rtpFileWriter
+	closed   bool
+}
+
+// NewFileTrackRecorder creates the recording file of the track in the directory of the config.
+// The file is named {FileName}_{ClientID}_{TrackID} with the extension of the container,
+// or {ClientID}_{TrackID} if the file name of the track config is empty.
+func NewFileTrackRecorder(conf *TrackConfig, fileConf FileConfig) (TrackRecorder, error) {
+	if err := validateTrackConfig(conf); err != nil {
+		return nil, err
+	}
+
+	filePath, writer, err := createTrackFile(conf, fileConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTrack{
+		TrackID:  conf.TrackID,
+		ClientID: conf.ClientID,
+		RoomID:   conf.RoomID,
+		FilePath: filePath,
+		mu:       sync.Mutex{},
+		config:   *conf,
+		fileConf: fileConf,
+		writer:   writer,
+	}, nil
+}
+
+func createTrackFile(conf *TrackConfig, fileConf FileConfig) (string, rtpFileWriter, error) {
+	ext, err := fileExtension(conf.MimeType, fileConf.VideoFormat)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := os.MkdirAll(fileConf.Directory, 0o755); err != nil {
+		return "", nil, err
+	}
+
+	filePath, err := trackFilePath(conf, fileConf, ext)
+	if err != nil {
+		return "", nil, err
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	out := newBufferedFile(f)
+
+	var writer rtpFileWriter
+
+	switch ext {
+	case ".ogg":
+		writer, err = newOggOpusWriter(out)
+	case ".ivf":
+		writer, err = newIVFWriter(out, conf.MimeType, conf.Width, conf.Height)
+	case ".webm":
+		writer, err = newWebMWriter(out, conf.MimeType, conf.Width, conf.Height)
+	case ".h264":
+		writer = h264writer.NewWith(out)
+	}
+
+	if err != nil {
+		_ = out.Close()
+		return "", nil, err
+	}
+
+	return filePath, writer, nil
+}
+
+func trackFilePath(conf *TrackConfig, fileConf FileConfig, ext string) (string, error) {
+	name := fmt.Sprintf("%s_%s", conf.ClientID, conf.TrackID)
+	if conf.FileName != "" {
+		name = fmt.Sprintf("%s_%s", conf.FileName, name)
+	}
+
+	return joinFileName(fileConf.Directory, name, ext)
+}
+
+// FileTrackRecorder returns a NewTrackRecorderFunc that records the tracks to the local disk
+func FileTrackRecorder(fileConf FileConfig) NewTrackRecorderFunc {
+	return func(conf *TrackConfig) (TrackRecorder, error) {
+		return NewFileTrackRecorder(conf, fileConf)
+	}
+}
+
+// Write writes a marshaled RTP packet
+func (f *FileTrack) Write(data []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(data); err != nil {
+		return 0, err
+	}
+
+	if _, err := f.WritePacket(packet); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (f *FileTrack) WritePacket(packet *rtp.Packet) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrRecorderClosed
+	}
+
+	if err := f.writer.WriteRTP(packet); err != nil {
+		return 0, err
+	}
+
+	return len(packet.Payload), nil
+}
+
+// Rotate closes the current file and writes the following packets to a new file named with the file name,
+// the path of the new file is set to FilePath. A video track should be rotated before a keyframe.
+func (f *FileTrack) Rotate(fileName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrRecorderClosed
+	}
+
+	conf := f.config
+	conf.FileName = fileName
+
+	filePath, err := trackFilePath(&conf, f.fileConf, filepath.Ext(f.FilePath))
+	if err != nil {
+		return err
+	}
+
+	if filePath == f.FilePath {
+		return ErrSameFile
+	}
+
+	filePath, writer, err := createTrackFile(&conf, f.fileConf)
+	if err != nil {
+		return err
+	}
+
+	closeErr := f.writer.Close()
+
+	f.config = conf
+	f.FilePath = filePath
+	f.writer = writer
+
+	return closeErr
+}
+
+// WriteSenderReport is a no-op, the file doesn't have a timeline
+func (f *FileTrack) WriteSenderReport(SenderReport) error {
+	return nil
+}
+
+// WriteMarker rotates the file on a rotate marker, the other markers are not recorded to the file
+func (f *FileTrack) WriteMarker(marker Marker) error {
+	if marker.Type != MarkerRotate {
+		return nil
+	}
+
+	return f.Rotate(marker.Label)
+}
+
+func (f *FileTrack) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	return f.writer.Close()
+}
+
+func fileExtension(mimeType string, videoFormat VideoFormat) (string, error) {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return ".ogg", nil
+	case strings.ToLower(webrtc.MimeTypeVP8), strings.ToLower(webrtc.MimeTypeVP9):
+		if videoFormat == VideoFormatWebM {
+			return ".webm", nil
+		}
+		return ".ivf", nil
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return ".h264", nil
+	default:
+		return "", ErrUnsupportedMimeType
+	}
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// joinFileName joins the sanitized name to the directory, the empty names and the names that escape the directory are rejected
+func joinFileName(directory, name, ext string) (string, error) {
+	name = sanitizeFileName(name)
+	if name == "" || name == "." || name == ".." {
+		return "", ErrInvalidFileName
+	}
+
+	filePath := filepath.Join(directory, name+ext)
+
+	rel, err := filepath.Rel(directory, filePath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidFileName
+	}
+
+	return filePath, nil
+}
+
+// BucketDirectory returns the directory of the bucket in the recordings directory. The empty and absolute bucket names,
+// and the names with a path separator or .. are rejected, so the files are never written outside the directory.
+func BucketDirectory(directory, bucketName string) (string, error) {
+	if bucketName == "" || filepath.IsAbs(bucketName) || strings.Contains(bucketName, "..") || strings.ContainsAny(bucketName, `/\`) {
+		return "", ErrInvalidBucketName
+	}
+
+	bucketPath, err := joinFileName(directory, bucketName, "")
+	if err != nil {
+		return "", ErrInvalidBucketName
+	}
+
+	return bucketPath, nil
+}
+
+// bufferedFile buffers the small writes of the container writers, the buffer is flushed before seeking and closing
+type bufferedFile struct {
+	file *os.File
+	*bufio.Writer
+}
+
+func newBufferedFile(f *os.File) *bufferedFile {
+	return &bufferedFile{
+		file:   f,
+		Writer: bufio.NewWriter(f),
+	}
+}
+
+func (b *bufferedFile) Seek(offset int64, whence int) (int64, error) {
+	if err := b.Flush(); err != nil {
+		return 0, err
+	}
+
+	return b.file.Seek(offset, whence)
+}
+
+func (b *bufferedFile) Close() error {
+	if err := b.Flush(); err != nil {
+		_ = b.file.Close()
+		return err
+	}
+
+	return b.file.Close()
+}
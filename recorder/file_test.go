@@ -0,0 +1,219 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// VP8 payload descriptor with the start of partition bit, followed by the first bytes of a keyframe or a delta frame
+var (
+	vp8Keyframe = []byte{0x10, 0x50, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x08, 0x00, 0x08, 0x00}
+	vp8Delta    = []byte{0x10, 0x51, 0x02, 0x00}
+)
+
+func newTestFileRecorder(t *testing.T, mimeType string, format VideoFormat) (TrackRecorder, string) {
+	t.Helper()
+
+	tr, err := NewFileTrackRecorder(&TrackConfig{
+		TrackID:  "track",
+		ClientID: "client",
+		RoomID:   "room",
+		FileName: "test",
+		MimeType: mimeType,
+		Width:    8,
+		Height:   8,
+	}, FileConfig{
+		Directory:   t.TempDir(),
+		VideoFormat: format,
+	})
+	require.NoError(t, err)
+
+	return tr, tr.(*FileTrack).FilePath
+}
+
+func TestFileRecorderOgg(t *testing.T) {
+	t.Parallel()
+
+	tr, filePath := newTestFileRecorder(t, webrtc.MimeTypeOpus, "")
+	require.Equal(t, "test_client_track.ogg", filepath.Base(filePath))
+
+	for _, ts := range []uint32{0, 960, 960 * 10, 960 * 5} {
+		_, err := tr.WritePacket(&rtp.Packet{Header: rtp.Header{Timestamp: ts}, Payload: []byte{0xfc, 0x01, 0x02}})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tr.Close())
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	pages := bytes.Split(data, []byte("OggS"))[1:]
+	// 2 header pages, 3 audio packets and 8 silence frames, the late packet is dropped
+	require.Len(t, pages, 2+3+8)
+
+	lastGranule := binary.LittleEndian.Uint64(pages[len(pages)-1][2:10])
+	require.Equal(t, uint64(1+960*10), lastGranule)
+}
+
+func TestFileRecorderIVF(t *testing.T) {
+	t.Parallel()
+
+	tr, filePath := newTestFileRecorder(t, webrtc.MimeTypeVP8, VideoFormatIVF)
+
+	packets := []*rtp.Packet{
+		// delta frame before the keyframe is dropped
+		{Header: rtp.Header{SequenceNumber: 1, Timestamp: 1000, Marker: true}, Payload: vp8Delta},
+		{Header: rtp.Header{SequenceNumber: 2, Timestamp: 4000, Marker: true}, Payload: vp8Keyframe},
+		{Header: rtp.Header{SequenceNumber: 3, Timestamp: 7000, Marker: true}, Payload: vp8Delta},
+		// paused recording
+		{Header: rtp.Header{SequenceNumber: 4, Timestamp: 97000, Marker: true}, Payload: vp8Delta},
+	}
+
+	for _, p := range packets {
+		_, err := tr.WritePacket(p)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tr.Close())
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	require.Equal(t, "DKIF", string(data[0:4]))
+	require.Equal(t, "VP80", string(data[8:12]))
+	require.Equal(t, uint16(8), binary.LittleEndian.Uint16(data[12:]))
+	require.Equal(t, uint32(90000), binary.LittleEndian.Uint32(data[16:]))
+	require.Equal(t, uint32(3), binary.LittleEndian.Uint32(data[24:]))
+
+	offset := ivfHeaderSize
+	pts := make([]uint64, 0)
+
+	for offset < len(data) {
+		size := int(binary.LittleEndian.Uint32(data[offset:]))
+		pts = append(pts, binary.LittleEndian.Uint64(data[offset+4:]))
+		offset += ivfFrameHeaderSize + size
+	}
+
+	require.Equal(t, []uint64{0, 3000, 93000}, pts)
+}
+
+func TestFileRecorderWebM(t *testing.T) {
+	t.Parallel()
+
+	tr, filePath := newTestFileRecorder(t, webrtc.MimeTypeVP8, VideoFormatWebM)
+
+	_, err := tr.WritePacket(&rtp.Packet{Header: rtp.Header{Timestamp: 0, Marker: true}, Payload: vp8Keyframe})
+	require.NoError(t, err)
+	_, err = tr.WritePacket(&rtp.Packet{Header: rtp.Header{Timestamp: 9000, Marker: true}, Payload: vp8Delta})
+	require.NoError(t, err)
+
+	require.NoError(t, tr.Close())
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	require.True(t, bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}))
+	require.Contains(t, string(data), "V_VP8")
+	require.Equal(t, 1, bytes.Count(data, ebmlIDBytes(webmClusterID)))
+
+	// the second block is 100ms after the cluster timecode
+	blocks := bytes.Split(data, []byte{webmSimpleBlockID})
+	last := blocks[len(blocks)-1]
+	// size, track number, timecode and flags
+	require.Equal(t, byte(0x81), last[1])
+	require.Equal(t, uint16(100), binary.BigEndian.Uint16(last[2:]))
+	require.Equal(t, byte(0), last[4])
+}
+
+func TestVP9Superframe(t *testing.T) {
+	t.Parallel()
+
+	builder := newFrameBuilder(webrtc.MimeTypeVP9)
+
+	// two spatial layers of a keyframe picture, the VP9 descriptor has the B and E flags set and the layer indices
+	layer0 := []byte{0x2C, 0x00, 0x00, 0x82, 0x49}
+	layer1 := []byte{0x2C, 0x02, 0x00, 0x86, 0x00}
+
+	frame, err := builder.Push(&rtp.Packet{Header: rtp.Header{Timestamp: 100}, Payload: layer0})
+	require.NoError(t, err)
+	require.Nil(t, frame)
+
+	frame, err = builder.Push(&rtp.Packet{Header: rtp.Header{Timestamp: 100, Marker: true}, Payload: layer1})
+	require.NoError(t, err)
+	require.NotNil(t, frame)
+	require.True(t, frame.keyframe)
+
+	marker := byte(0xc0 | 3<<3 | 1)
+	expected := []byte{0x82, 0x49, 0x86, 0x00, marker, 2, 0, 0, 0, 2, 0, 0, 0, marker}
+	require.Equal(t, expected, frame.data)
+}
+
+func TestFileRecorderUnsupportedMimeType(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewFileTrackRecorder(&TrackConfig{
+		TrackID:  "track",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypePCMU,
+	}, FileConfig{Directory: t.TempDir()})
+	require.ErrorIs(t, err, ErrUnsupportedMimeType)
+}
+
+func TestFileRecorderRotate(t *testing.T) {
+	t.Parallel()
+
+	tr, filePath := newTestFileRecorder(t, webrtc.MimeTypeOpus, "")
+	file := tr.(*FileTrack)
+
+	_, err := tr.WritePacket(&rtp.Packet{Header: rtp.Header{Timestamp: 0}, Payload: []byte{0xfc, 0x01}})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, file.WriteMarker(Marker{Type: MarkerRotate, Label: "test"}), ErrSameFile)
+	require.NoError(t, file.WriteMarker(Marker{Type: MarkerRotate, Label: "transfer"}))
+	require.Equal(t, "transfer_client_track.ogg", filepath.Base(file.FilePath))
+
+	// the new file starts with the headers
+	_, err = tr.WritePacket(&rtp.Packet{Header: rtp.Header{Timestamp: 960}, Payload: []byte{0xfc, 0x01}})
+	require.NoError(t, err)
+	require.NoError(t, tr.Close())
+
+	for _, path := range []string{filePath, file.FilePath} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Len(t, bytes.Split(data, []byte("OggS"))[1:], 2+1)
+	}
+}
+
+func TestJoinFileName(t *testing.T) {
+	dir := t.TempDir()
+
+	filePath, err := joinFileName(dir, "../call", ".ogg")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, ".._call.ogg"), filePath)
+
+	for _, name := range []string{"", ".", ".."} {
+		_, err := joinFileName(dir, name, "")
+		require.ErrorIs(t, err, ErrInvalidFileName, name)
+	}
+}
+
+func TestBucketDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	bucketPath, err := BucketDirectory(dir, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "bucket"), bucketPath)
+
+	for _, name := range []string{"", ".", "..", "../../etc", "a/b", `a\b`, "/etc", "bucket.."} {
+		_, err := BucketDirectory(dir, name)
+		require.ErrorIs(t, err, ErrInvalidBucketName, name)
+	}
+}
@@ -0,0 +1,170 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// videoFrame is a depacketized VP8 or VP9 frame
+type videoFrame struct {
+	data     []byte
+	keyframe bool
+	// presentation time in 90kHz units since the first frame
+	pts uint64
+}
+
+// frameBuilder depacketizes the VP8 and VP9 RTP packets into frames.
+// The frames are dropped until the first keyframe, the VP9 spatial layers of a picture are combined into a superframe.
+type frameBuilder struct {
+	isVP9         bool
+	frames        [][]byte
+	current       []byte
+	timestamp     uint32
+	keyframe      bool
+	inFrame       bool
+	seenKeyframe  bool
+	started       bool
+	lastTimestamp uint32
+	pts           uint64
+}
+
+func newFrameBuilder(mimeType string) *frameBuilder {
+	return &frameBuilder{
+		isVP9: strings.EqualFold(mimeType, webrtc.MimeTypeVP9),
+	}
+}
+
+// Push adds the packet to the current frame, returns the frame when the packet completes it
+func (b *frameBuilder) Push(packet *rtp.Packet) (*videoFrame, error) {
+	if len(packet.Payload) == 0 {
+		return nil, nil
+	}
+
+	if b.inFrame && packet.Timestamp != b.timestamp {
+		// the marker packet of the previous picture is lost, drop the incomplete picture
+		b.reset()
+	}
+
+	if b.isVP9 {
+		vp9 := codecs.VP9Packet{}
+		if _, err := vp9.Unmarshal(packet.Payload); err != nil {
+			return nil, err
+		}
+
+		if vp9.B {
+			if !b.inFrame {
+				b.keyframe = !vp9.P && vp9.SID == 0
+			}
+
+			b.current = b.current[:0]
+			b.inFrame = true
+			b.timestamp = packet.Timestamp
+		} else if !b.inFrame {
+			return nil, nil
+		}
+
+		b.current = append(b.current, vp9.Payload...)
+
+		if vp9.E {
+			b.frames = append(b.frames, append([]byte{}, b.current...))
+			b.current = b.current[:0]
+		}
+	} else {
+		vp8 := codecs.VP8Packet{}
+		if _, err := vp8.Unmarshal(packet.Payload); err != nil {
+			return nil, err
+		}
+
+		if vp8.S == 1 && vp8.PID == 0 {
+			b.keyframe = len(vp8.Payload) > 0 && vp8.Payload[0]&0x01 == 0
+			b.current = b.current[:0]
+			b.inFrame = true
+			b.timestamp = packet.Timestamp
+		} else if !b.inFrame {
+			return nil, nil
+		}
+
+		b.current = append(b.current, vp8.Payload...)
+
+		if packet.Marker {
+			b.frames = append(b.frames, append([]byte{}, b.current...))
+		}
+	}
+
+	if !packet.Marker {
+		return nil, nil
+	}
+
+	frames := b.frames
+	keyframe := b.keyframe
+	timestamp := b.timestamp
+	b.reset()
+
+	if len(frames) == 0 {
+		return nil, nil
+	}
+
+	if !b.seenKeyframe && !keyframe {
+		return nil, nil
+	}
+
+	b.seenKeyframe = true
+
+	if b.started {
+		diff := timestamp - b.lastTimestamp
+		if diff > 1<<31 {
+			// late picture
+			return nil, nil
+		}
+
+		b.pts += uint64(diff)
+	}
+
+	b.started = true
+	b.lastTimestamp = timestamp
+
+	data := frames[0]
+	if len(frames) > 1 {
+		data = vp9Superframe(frames)
+	}
+
+	return &videoFrame{
+		data:     data,
+		keyframe: keyframe,
+		pts:      b.pts,
+	}, nil
+}
+
+func (b *frameBuilder) reset() {
+	b.frames = nil
+	b.current = b.current[:0]
+	b.inFrame = false
+	b.keyframe = false
+}
+
+// vp9Superframe combines the frames of the spatial layers into a VP9 superframe with the index at the end,
+// see Annex B of the VP9 bitstream specification
+func vp9Superframe(frames [][]byte) []byte {
+	if len(frames) > 8 {
+		frames = frames[:8]
+	}
+
+	// 4 bytes per frame size
+	marker := byte(0xc0) | byte(3)<<3 | byte(len(frames)-1)
+
+	data := make([]byte, 0)
+	for _, frame := range frames {
+		data = append(data, frame...)
+	}
+
+	data = append(data, marker)
+	for _, frame := range frames {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(frame)))
+	}
+
+	return append(data, marker)
+}
@@ -0,0 +1,87 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	ivfHeaderSize      = 32
+	ivfFrameHeaderSize = 12
+	// the frame timestamps are the RTP timestamps of the 90kHz video clock
+	videoClockRate = 90000
+)
+
+// ivfWriter writes VP8 or VP9 frames to an IVF file
+type ivfWriter struct {
+	out     io.WriteCloser
+	builder *frameBuilder
+	count   uint32
+}
+
+func newIVFWriter(out io.WriteCloser, mimeType string, width, height uint32) (*ivfWriter, error) {
+	fourcc := "VP80"
+	if strings.EqualFold(mimeType, webrtc.MimeTypeVP9) {
+		fourcc = "VP90"
+	}
+
+	header := make([]byte, ivfHeaderSize)
+	copy(header[0:], "DKIF")
+	binary.LittleEndian.PutUint16(header[4:], 0)               // version
+	binary.LittleEndian.PutUint16(header[6:], ivfHeaderSize)   // header size
+	copy(header[8:], fourcc)                                   // codec
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))  // width in pixels
+	binary.LittleEndian.PutUint16(header[14:], uint16(height)) // height in pixels
+	binary.LittleEndian.PutUint32(header[16:], videoClockRate) // timebase denominator
+	binary.LittleEndian.PutUint32(header[20:], 1)              // timebase numerator
+	binary.LittleEndian.PutUint32(header[24:], 0)              // frame count, updated on close
+
+	if _, err := out.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &ivfWriter{
+		out:     out,
+		builder: newFrameBuilder(mimeType),
+	}, nil
+}
+
+func (w *ivfWriter) WriteRTP(packet *rtp.Packet) error {
+	frame, err := w.builder.Push(packet)
+	if err != nil || frame == nil {
+		return err
+	}
+
+	header := make([]byte, ivfFrameHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(frame.data)))
+	binary.LittleEndian.PutUint64(header[4:], frame.pts)
+
+	if _, err := w.out.Write(header); err != nil {
+		return err
+	}
+
+	if _, err := w.out.Write(frame.data); err != nil {
+		return err
+	}
+
+	w.count++
+
+	return nil
+}
+
+func (w *ivfWriter) Close() error {
+	if ws, ok := w.out.(io.WriteSeeker); ok {
+		count := make([]byte, 4)
+		binary.LittleEndian.PutUint32(count, w.count)
+
+		if _, err := ws.Seek(24, io.SeekStart); err == nil {
+			_, _ = ws.Write(count)
+		}
+	}
+
+	return w.out.Close()
+}
@@ -0,0 +1,91 @@
+package recorder
+
+import (
+	"io"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+const (
+	opusSampleRate   = 48000
+	opusChannelCount = 2
+	// samples of a 20ms Opus frame
+	opusFrameSamples = 960
+	// the longest gap that filled with silence, a longer gap is treated as a timestamp jump of the publisher
+	maxOpusGap = time.Hour
+)
+
+// Opus silence frame, the same frame that the SFU sends when an audio track is muted
+var opusSilenceFrame = []byte{0xf8, 0xff, 0xfe}
+
+// oggOpusWriter writes Opus packets to an Ogg file.
+// The granule position of the Ogg pages follows the RTP timestamps, a gap caused by DTX, packet loss or a paused recording
+// is filled with silence frames so every player will render the gap with the correct duration.
+type oggOpusWriter struct {
+	writer        *oggwriter.OggWriter
+	started       bool
+	lastTimestamp uint32
+}
+
+func newOggOpusWriter(out io.Writer) (*oggOpusWriter, error) {
+	writer, err := oggwriter.NewWith(out, opusSampleRate, opusChannelCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oggOpusWriter{
+		writer: writer,
+	}, nil
+}
+
+func (w *oggOpusWriter) WriteRTP(packet *rtp.Packet) error {
+	if len(packet.Payload) == 0 {
+		return nil
+	}
+
+	if w.started {
+		diff := packet.Timestamp - w.lastTimestamp
+		if diff == 0 || diff > 1<<31 {
+			// duplicate or late packet, the granule position can't go back
+			return nil
+		}
+
+		if diff > opusFrameSamples && diff <= uint32(maxOpusGap.Seconds()*opusSampleRate) {
+			if err := w.fillGap(packet); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.started = true
+	w.lastTimestamp = packet.Timestamp
+
+	return w.writer.WriteRTP(packet)
+}
+
+// fillGap writes silence frames from the last written packet until the packet
+func (w *oggOpusWriter) fillGap(packet *rtp.Packet) error {
+	for ts := w.lastTimestamp + opusFrameSamples; packet.Timestamp-ts >= opusFrameSamples && packet.Timestamp-ts < 1<<31; ts += opusFrameSamples {
+		silence := &rtp.Packet{
+			Header: rtp.Header{
+				Version:     2,
+				PayloadType: packet.PayloadType,
+				SSRC:        packet.SSRC,
+				Timestamp:   ts,
+			},
+			Payload: opusSilenceFrame,
+		}
+
+		if err := w.writer.WriteRTP(silence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *oggOpusWriter) Close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,304 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+)
+
+const (
+	oggPageHeaderSize      = 27
+	oggHeaderTypeBOS       = 0x02
+	oggHeaderTypeEOS       = 0x04
+	oggOpusVendor          = "samespace-sfu"
+	opusMappingFamilyMono  = 0
+	opusMappingFamilyMulti = 1
+	// the channels without a defined position
+	opusMappingFamilyDiscrete = 255
+)
+
+var errInvalidOpusPacket = errors.New("recorder: invalid opus packet")
+
+var oggCRCTable = func() *[256]uint32 {
+	table := &[256]uint32{}
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggOpusStreamWriter writes Ogg Opus with a custom channel mapping, used to write the multistream mixed recording.
+// The last page is kept in memory until the next page or close, so it can be marked as the end of the stream.
+type oggOpusStreamWriter struct {
+	out      io.WriteCloser
+	serial   uint32
+	pageSeq  uint32
+	granule  uint64
+	lastPage []byte
+}
+
+// newOggOpusStreamWriter writes the Opus headers, the mapping is the stream index of each channel.
+// A single channel is written without the mapping table, and more than 2 channels as discrete channels.
+func newOggOpusStreamWriter(out io.WriteCloser, streams, coupled uint8, mapping []uint8) (*oggOpusStreamWriter, error) {
+	w := &oggOpusStreamWriter{
+		out:    out,
+		serial: rand.Uint32(), //nolint:gosec // not a security random
+	}
+
+	head := make([]byte, 19, 21+len(mapping))
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = uint8(len(mapping))
+	binary.LittleEndian.PutUint16(head[10:], 0) // pre-skip
+	binary.LittleEndian.PutUint32(head[12:], opusSampleRate)
+	binary.LittleEndian.PutUint16(head[16:], 0) // output gain
+
+	switch {
+	case len(mapping) == 1:
+		head[18] = opusMappingFamilyMono
+	case len(mapping) == 2:
+		head[18] = opusMappingFamilyMulti
+		head = append(head, streams, coupled)
+		head = append(head, mapping...)
+	default:
+		head[18] = opusMappingFamilyDiscrete
+		head = append(head, streams, coupled)
+		head = append(head, mapping...)
+	}
+
+	tags := make([]byte, 8, 16+len(oggOpusVendor))
+	copy(tags, "OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(oggOpusVendor)))
+	tags = append(tags, oggOpusVendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0) // comment count
+
+	if _, err := out.Write(w.page(head, oggHeaderTypeBOS, 0)); err != nil {
+		return nil, err
+	}
+
+	if _, err := out.Write(w.page(tags, 0, 0)); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WritePacket writes an Opus packet with the duration in samples
+func (w *oggOpusStreamWriter) WritePacket(packet []byte, samples uint64) error {
+	if w.lastPage != nil {
+		if _, err := w.out.Write(w.lastPage); err != nil {
+			return err
+		}
+	}
+
+	w.granule += samples
+	w.lastPage = w.page(packet, 0, w.granule)
+
+	return nil
+}
+
+func (w *oggOpusStreamWriter) Close() error {
+	if w.lastPage != nil {
+		// rewrite the last page as the end of the stream
+		w.pageSeq--
+		page := w.page(w.lastPage[oggPageHeaderSize+int(w.lastPage[26]):], oggHeaderTypeEOS, w.granule)
+		if _, err := w.out.Write(page); err != nil {
+			_ = w.out.Close()
+			return err
+		}
+	}
+
+	return w.out.Close()
+}
+
+func (w *oggOpusStreamWriter) page(payload []byte, headerType uint8, granule uint64) []byte {
+	segments := len(payload)/255 + 1
+
+	page := make([]byte, oggPageHeaderSize+segments, oggPageHeaderSize+segments+len(payload))
+	copy(page, "OggS")
+	page[4] = 0 // version
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], w.serial)
+	binary.LittleEndian.PutUint32(page[18:], w.pageSeq)
+	page[26] = uint8(segments)
+
+	for i := 0; i < segments-1; i++ {
+		page[oggPageHeaderSize+i] = 255
+	}
+	page[oggPageHeaderSize+segments-1] = uint8(len(payload) % 255)
+
+	page = append(page, payload...)
+
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:], crc)
+
+	w.pageSeq++
+
+	return page
+}
+
+// OpusPacketSamples returns the duration of the Opus packet in 48kHz samples, see RFC 6716 section 3.1
+func OpusPacketSamples(packet []byte) (uint64, error) {
+	if len(packet) < 1 {
+		return 0, errInvalidOpusPacket
+	}
+
+	config := packet[0] >> 3
+
+	var frameSamples uint64
+	switch {
+	case config < 12:
+		// SILK 10, 20, 40, 60 ms
+		frameSamples = []uint64{480, 960, 1920, 2880}[config%4]
+	case config < 16:
+		// Hybrid 10, 20 ms
+		frameSamples = []uint64{480, 960}[config%2]
+	default:
+		// CELT 2.5, 5, 10, 20 ms
+		frameSamples = []uint64{120, 240, 480, 960}[config%4]
+	}
+
+	switch packet[0] & 0x03 {
+	case 0:
+		return frameSamples, nil
+	case 1, 2:
+		return 2 * frameSamples, nil
+	default:
+		if len(packet) < 2 {
+			return 0, errInvalidOpusPacket
+		}
+		return uint64(packet[1]&0x3f) * frameSamples, nil
+	}
+}
+
+// opusSelfDelimited converts an Opus packet to the self-delimiting framing that used by all streams
+// except the last one in a multistream packet, see RFC 6716 appendix B
+func opusSelfDelimited(packet []byte) ([]byte, error) {
+	if len(packet) < 1 {
+		return nil, errInvalidOpusPacket
+	}
+
+	// the position where the length of the last frame is inserted, and the length
+	var pos, length int
+
+	switch packet[0] & 0x03 {
+	case 0:
+		pos, length = 1, len(packet)-1
+	case 1:
+		if (len(packet)-1)%2 != 0 {
+			return nil, errInvalidOpusPacket
+		}
+		pos, length = 1, (len(packet)-1)/2
+	case 2:
+		n1, k, err := opusReadLength(packet[1:])
+		if err != nil {
+			return nil, err
+		}
+		pos = 1 + k
+		length = len(packet) - pos - n1
+	default:
+		if len(packet) < 2 {
+			return nil, errInvalidOpusPacket
+		}
+
+		count := int(packet[1] & 0x3f)
+		vbr := packet[1]&0x80 != 0
+		padding := 0
+		pos = 2
+
+		if packet[1]&0x40 != 0 {
+			for {
+				if pos >= len(packet) {
+					return nil, errInvalidOpusPacket
+				}
+
+				b := int(packet[pos])
+				pos++
+
+				if b == 255 {
+					padding += 254
+					continue
+				}
+
+				padding += b
+				break
+			}
+		}
+
+		sum := 0
+		if vbr {
+			for i := 0; i < count-1; i++ {
+				if pos >= len(packet) {
+					return nil, errInvalidOpusPacket
+				}
+
+				n, k, err := opusReadLength(packet[pos:])
+				if err != nil {
+					return nil, err
+				}
+
+				pos += k
+				sum += n
+			}
+		}
+
+		data := len(packet) - pos - padding
+		if count == 0 || data < sum {
+			return nil, errInvalidOpusPacket
+		}
+
+		if vbr {
+			length = data - sum
+		} else {
+			length = data / count
+		}
+	}
+
+	if length < 0 || pos > len(packet) {
+		return nil, errInvalidOpusPacket
+	}
+
+	result := make([]byte, 0, len(packet)+2)
+	result = append(result, packet[:pos]...)
+	result = append(result, opusLength(length)...)
+
+	return append(result, packet[pos:]...), nil
+}
+
+func opusLength(n int) []byte {
+	if n < 252 {
+		return []byte{byte(n)}
+	}
+
+	first := 252 + (n-252)&0x03
+	return []byte{byte(first), byte((n - first) / 4)}
+}
+
+func opusReadLength(data []byte) (int, int, error) {
+	if len(data) < 1 {
+		return 0, 0, errInvalidOpusPacket
+	}
+
+	if data[0] < 252 {
+		return int(data[0]), 1, nil
+	}
+
+	if len(data) < 2 {
+		return 0, 0, errInvalidOpusPacket
+	}
+
+	return int(data[1])*4 + int(data[0]), 2, nil
+}
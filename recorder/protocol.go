@@ -0,0 +1,387 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// The protocol version is negotiated with the ALPN of the QUIC connection, the client offers all the versions
+// and the recorder picks the latest version it supports.
+//
+// Version 1 frames are a type byte and a big endian uint16 length followed by the data, the track config is JSON
+// and the track end is a data frame with a single TrackEndPacket byte.
+//
+// Version 2 frames are followed by a big endian CRC32 (IEEE) of the type, length and data. The track config is
+// binary and starts with the version, and the tracks send the RTCP sender reports and the start, pause and resume
+// markers, so the recorder can place all tracks on the room timeline that starts at ClientConfig.TimelineStart.
+// The label and rotate markers carry a label after the fixed fields, a rotate marker starts a new file of the track
+// named with the label.
+const (
+	ProtocolVersion1 uint8 = 1
+	ProtocolVersion2 uint8 = 2
+	// the latest version
+	ProtocolVersion = ProtocolVersion2
+
+	recorderALPN   = "samespace-recorder"
+	recorderALPNV2 = "samespace-recorder/2"
+
+	frameHeaderSize   = 3
+	frameChecksumSize = 4
+)
+
+var (
+	closeDatagramPrefix = []byte("close")
+
+	ErrInvalidFrame    = errors.New("recorder: invalid frame")
+	ErrInvalidChecksum = errors.New("recorder: invalid frame checksum")
+)
+
+// recorderProtocols is the ALPN list in the order of preference
+var recorderProtocols = []string{recorderALPNV2, recorderALPN}
+
+// NegotiatedVersion returns the protocol version of the connection
+func NegotiatedVersion(conn quic.Connection) uint8 {
+	if conn.ConnectionState().TLS.NegotiatedProtocol == recorderALPNV2 {
+		return ProtocolVersion2
+	}
+
+	return ProtocolVersion1
+}
+
+type MarkerType uint8
+
+const (
+	MarkerStart  MarkerType = 1
+	MarkerPause  MarkerType = 2
+	MarkerResume MarkerType = 3
+	// an event of the recording, for example a compliance event
+	MarkerLabel MarkerType = 4
+	// the following packets are written to a new file, the label is the file name
+	MarkerRotate MarkerType = 5
+)
+
+// the size of the marker frame without the label
+const markerSize = 13
+
+func (m MarkerType) String() string {
+	switch m {
+	case MarkerStart:
+		return "start"
+	case MarkerPause:
+		return "pause"
+	case MarkerResume:
+		return "resume"
+	case MarkerLabel:
+		return "label"
+	case MarkerRotate:
+		return "rotate"
+	default:
+		return "unknown"
+	}
+}
+
+// Marker is a state change of a track recording, the RTP time is the timestamp of the packet at the time of the marker.
+type Marker struct {
+	Type    MarkerType
+	Time    time.Time
+	RTPTime uint32
+	// the label of a label marker or the file name of a rotate marker
+	Label string
+}
+
+// SenderReport is the NTP and RTP timestamp mapping from the RTCP sender report of the track
+type SenderReport struct {
+	NTPTime uint64
+	RTPTime uint32
+}
+
+// Time returns the wall clock time of the NTP timestamp
+func (s SenderReport) Time() time.Time {
+	// the NTP epoch is 1900-01-01, 70 years and 17 leap days before the unix epoch
+	const ntpEpochOffset = 2208988800
+
+	seconds := int64(s.NTPTime>>32) - ntpEpochOffset
+	fraction := int64(s.NTPTime&0xffffffff) * int64(time.Second) >> 32
+
+	return time.Unix(seconds, fraction)
+}
+
+// TimelineRecorder is implemented by the track recorders that record the clock mapping and the markers of the track
+type TimelineRecorder interface {
+	WriteSenderReport(report SenderReport) error
+	WriteMarker(marker Marker) error
+}
+
+// closeMessage is the payload of the close datagram. The streams is the number of streams opened on the connection,
+// the recorder waits until it accepts them because the datagram can arrive before the last opened streams.
+type closeMessage struct {
+	StopConfig
+	Streams int `json:",omitempty"`
+}
+
+// CloseDatagram returns the datagram that sent by the client to stop the recording session
+func CloseDatagram(cfg StopConfig) []byte {
+	return closeDatagram(cfg, 0)
+}
+
+func closeDatagram(cfg StopConfig, streams int) []byte {
+	var buf bytes.Buffer
+	buf.Write(closeDatagramPrefix)
+	j, err := json.Marshal(closeMessage{StopConfig: cfg, Streams: streams})
+	if err != nil {
+		return nil
+	}
+	buf.Write(j)
+	return buf.Bytes()
+}
+
+// ParseCloseDatagram returns the stop config and true if the datagram is a close datagram
+func ParseCloseDatagram(data []byte) (StopConfig, bool) {
+	cfg, _, ok := parseCloseDatagram(data)
+	return cfg, ok
+}
+
+func parseCloseDatagram(data []byte) (StopConfig, int, bool) {
+	msg := closeMessage{}
+
+	if !bytes.HasPrefix(data, closeDatagramPrefix) {
+		return msg.StopConfig, 0, false
+	}
+
+	if err := json.Unmarshal(data[len(closeDatagramPrefix):], &msg); err != nil {
+		return msg.StopConfig, 0, false
+	}
+
+	return msg.StopConfig, msg.Streams, true
+}
+
+// encodeFrame returns a frame of the track stream, or nil if the packet type is not supported by the version
+func encodeFrame(version uint8, packetType PacketType, data []byte) []byte {
+	if version < ProtocolVersion2 {
+		switch packetType {
+		case ConfigPacket, DataPacket:
+		case TrackEndPacket:
+			packetType, data = DataPacket, []byte{byte(TrackEndPacket)}
+		default:
+			return nil
+		}
+	}
+
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(data)+frameChecksumSize)
+	frame[0] = byte(packetType)
+	binary.BigEndian.PutUint16(frame[1:], uint16(len(data)))
+	frame = append(frame, data...)
+
+	if version >= ProtocolVersion2 {
+		frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+	}
+
+	return frame
+}
+
+// readFrame reads a frame of the version from a track stream
+func readFrame(r io.Reader, version uint8) (PacketType, []byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(header[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+
+	packetType := PacketType(header[0])
+
+	if version >= ProtocolVersion2 {
+		checksum := make([]byte, frameChecksumSize)
+		if _, err := io.ReadFull(r, checksum); err != nil {
+			return 0, nil, err
+		}
+
+		crc := crc32.Update(crc32.ChecksumIEEE(header), crc32.IEEETable, data)
+		if crc != binary.BigEndian.Uint32(checksum) {
+			return packetType, nil, ErrInvalidChecksum
+		}
+
+		switch packetType {
+		case ConfigPacket, DataPacket, TrackEndPacket, SenderReportPacket, MarkerPacket:
+			return packetType, data, nil
+		default:
+			return 0, nil, ErrInvalidFrame
+		}
+	}
+
+	// the track end is sent as a data frame with a single byte, a RTP packet is never that short
+	if packetType == DataPacket && len(data) == 1 && PacketType(data[0]) == TrackEndPacket {
+		return TrackEndPacket, nil, nil
+	}
+
+	if packetType != ConfigPacket && packetType != DataPacket {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	return packetType, data, nil
+}
+
+// the fields of the version 2 track config, the unknown fields are skipped by the decoder
+const (
+	configFieldTrackID     uint8 = 1
+	configFieldClientID    uint8 = 2
+	configFieldRoomID      uint8 = 3
+	configFieldFileName    uint8 = 4
+	configFieldMimeType    uint8 = 5
+	configFieldChannel     uint8 = 6
+	configFieldWidth       uint8 = 7
+	configFieldHeight      uint8 = 8
+	configFieldResume      uint8 = 9
+	configFieldResumeIndex uint8 = 10
+)
+
+// encodeTrackConfig returns the payload of the config frame of the version
+func encodeTrackConfig(version uint8, conf *TrackConfig) ([]byte, error) {
+	if version < ProtocolVersion2 {
+		return json.Marshal(conf)
+	}
+
+	data := []byte{version}
+
+	field := func(id uint8, value []byte) {
+		data = append(data, id)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(value)))
+		data = append(data, value...)
+	}
+
+	field(configFieldTrackID, []byte(conf.TrackID))
+	field(configFieldClientID, []byte(conf.ClientID))
+	field(configFieldRoomID, []byte(conf.RoomID))
+	field(configFieldFileName, []byte(conf.FileName))
+	field(configFieldMimeType, []byte(conf.MimeType))
+	field(configFieldChannel, binary.BigEndian.AppendUint32(nil, uint32(conf.Channel)))
+	field(configFieldWidth, binary.BigEndian.AppendUint32(nil, conf.Width))
+	field(configFieldHeight, binary.BigEndian.AppendUint32(nil, conf.Height))
+
+	if conf.Resume {
+		field(configFieldResume, []byte{1})
+		field(configFieldResumeIndex, binary.BigEndian.AppendUint64(nil, conf.ResumeIndex))
+	}
+
+	return data, nil
+}
+
+// decodeTrackConfig parses the payload of the config frame of the version
+func decodeTrackConfig(version uint8, data []byte) (*TrackConfig, error) {
+	conf := &TrackConfig{}
+
+	if version < ProtocolVersion2 {
+		if err := json.Unmarshal(data, conf); err != nil {
+			return nil, err
+		}
+
+		return conf, nil
+	}
+
+	if len(data) < 1 || data[0] < ProtocolVersion2 {
+		return nil, ErrInvalidFrame
+	}
+
+	data = data[1:]
+
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, ErrInvalidFrame
+		}
+
+		id := data[0]
+		length := int(binary.BigEndian.Uint16(data[1:]))
+		data = data[3:]
+
+		if len(data) < length {
+			return nil, ErrInvalidFrame
+		}
+
+		value := data[:length]
+		data = data[length:]
+
+		switch id {
+		case configFieldTrackID:
+			conf.TrackID = string(value)
+		case configFieldClientID:
+			conf.ClientID = string(value)
+		case configFieldRoomID:
+			conf.RoomID = string(value)
+		case configFieldFileName:
+			conf.FileName = string(value)
+		case configFieldMimeType:
+			conf.MimeType = string(value)
+		case configFieldChannel, configFieldWidth, configFieldHeight:
+			if len(value) != 4 {
+				return nil, ErrInvalidFrame
+			}
+
+			v := binary.BigEndian.Uint32(value)
+
+			switch id {
+			case configFieldChannel:
+				conf.Channel = int(int32(v))
+			case configFieldWidth:
+				conf.Width = v
+			default:
+				conf.Height = v
+			}
+		case configFieldResume:
+			conf.Resume = len(value) == 1 && value[0] == 1
+		case configFieldResumeIndex:
+			if len(value) != 8 {
+				return nil, ErrInvalidFrame
+			}
+
+			conf.ResumeIndex = binary.BigEndian.Uint64(value)
+		}
+	}
+
+	return conf, nil
+}
+
+func encodeSenderReport(report SenderReport) []byte {
+	data := binary.BigEndian.AppendUint64(nil, report.NTPTime)
+	return binary.BigEndian.AppendUint32(data, report.RTPTime)
+}
+
+func decodeSenderReport(data []byte) (SenderReport, error) {
+	if len(data) < 12 {
+		return SenderReport{}, ErrInvalidFrame
+	}
+
+	return SenderReport{
+		NTPTime: binary.BigEndian.Uint64(data),
+		RTPTime: binary.BigEndian.Uint32(data[8:]),
+	}, nil
+}
+
+func encodeMarker(marker Marker) []byte {
+	data := []byte{byte(marker.Type)}
+	data = binary.BigEndian.AppendUint64(data, uint64(marker.Time.UnixNano()))
+	data = binary.BigEndian.AppendUint32(data, marker.RTPTime)
+	return append(data, marker.Label...)
+}
+
+func decodeMarker(data []byte) (Marker, error) {
+	if len(data) < markerSize {
+		return Marker{}, ErrInvalidFrame
+	}
+
+	return Marker{
+		Type:    MarkerType(data[0]),
+		Time:    time.Unix(0, int64(binary.BigEndian.Uint64(data[1:]))),
+		RTPTime: binary.BigEndian.Uint32(data[9:]),
+		Label:   string(data[markerSize:]),
+	}, nil
+}
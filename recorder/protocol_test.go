@@ -0,0 +1,114 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackConfigEncoding(t *testing.T) {
+	t.Parallel()
+
+	conf := &TrackConfig{
+		TrackID:     "track",
+		ClientID:    "client",
+		RoomID:      "room",
+		FileName:    "file",
+		MimeType:    webrtc.MimeTypeVP8,
+		Channel:     int(RightChannel),
+		Width:       1280,
+		Height:      720,
+		Resume:      true,
+		ResumeIndex: 42,
+	}
+
+	for _, version := range []uint8{ProtocolVersion1, ProtocolVersion2} {
+		data, err := encodeTrackConfig(version, conf)
+		require.NoError(t, err)
+
+		decoded, err := decodeTrackConfig(version, data)
+		require.NoError(t, err)
+		require.Equal(t, conf, decoded)
+	}
+
+	// the unknown fields of a later version are skipped
+	data, err := encodeTrackConfig(ProtocolVersion2, conf)
+	require.NoError(t, err)
+	data = append(data, 200, 0, 2, 0xff, 0xff)
+
+	decoded, err := decodeTrackConfig(ProtocolVersion2, data)
+	require.NoError(t, err)
+	require.Equal(t, conf, decoded)
+
+	_, err = decodeTrackConfig(ProtocolVersion2, data[:len(data)-1])
+	require.ErrorIs(t, err, ErrInvalidFrame)
+}
+
+func TestFrameEncoding(t *testing.T) {
+	t.Parallel()
+
+	marker := Marker{Type: MarkerLabel, Time: time.Unix(1700000000, 123), RTPTime: 4000, Label: "consent given"}
+	report := SenderReport{NTPTime: 0xe8fe6f81_80000000, RTPTime: 960}
+
+	var stream bytes.Buffer
+	stream.Write(encodeFrame(ProtocolVersion2, DataPacket, []byte{1, 2, 3}))
+	stream.Write(encodeFrame(ProtocolVersion2, MarkerPacket, encodeMarker(marker)))
+	stream.Write(encodeFrame(ProtocolVersion2, SenderReportPacket, encodeSenderReport(report)))
+	stream.Write(encodeFrame(ProtocolVersion2, TrackEndPacket, nil))
+
+	packetType, data, err := readFrame(&stream, ProtocolVersion2)
+	require.NoError(t, err)
+	require.Equal(t, DataPacket, packetType)
+	require.Equal(t, []byte{1, 2, 3}, data)
+
+	packetType, data, err = readFrame(&stream, ProtocolVersion2)
+	require.NoError(t, err)
+	require.Equal(t, MarkerPacket, packetType)
+	decodedMarker, err := decodeMarker(data)
+	require.NoError(t, err)
+	require.Equal(t, marker.Type, decodedMarker.Type)
+	require.True(t, marker.Time.Equal(decodedMarker.Time))
+	require.Equal(t, marker.RTPTime, decodedMarker.RTPTime)
+	require.Equal(t, marker.Label, decodedMarker.Label)
+
+	packetType, data, err = readFrame(&stream, ProtocolVersion2)
+	require.NoError(t, err)
+	require.Equal(t, SenderReportPacket, packetType)
+	decodedReport, err := decodeSenderReport(data)
+	require.NoError(t, err)
+	require.Equal(t, report, decodedReport)
+	// 0xe8fe6f81 seconds after 1900 is 1700000001 seconds after 1970, plus half a second
+	require.Equal(t, time.Unix(1700000001, int64(time.Second/2)), decodedReport.Time())
+
+	packetType, _, err = readFrame(&stream, ProtocolVersion2)
+	require.NoError(t, err)
+	require.Equal(t, TrackEndPacket, packetType)
+
+	// a corrupted frame is read completely so the next frame can be read
+	corrupted := encodeFrame(ProtocolVersion2, DataPacket, []byte{1, 2, 3})
+	corrupted[4]++
+	stream.Write(corrupted)
+	stream.Write(encodeFrame(ProtocolVersion2, DataPacket, []byte{4}))
+
+	_, _, err = readFrame(&stream, ProtocolVersion2)
+	require.ErrorIs(t, err, ErrInvalidChecksum)
+
+	_, data, err = readFrame(&stream, ProtocolVersion2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{4}, data)
+
+	// version 1 doesn't have the timeline frames, and the track end is a data frame
+	require.Nil(t, encodeFrame(ProtocolVersion1, MarkerPacket, encodeMarker(marker)))
+
+	end := encodeFrame(ProtocolVersion1, TrackEndPacket, nil)
+	require.Equal(t, []byte{byte(DataPacket), 0, 1, byte(TrackEndPacket)}, end)
+	require.Equal(t, uint16(1), binary.BigEndian.Uint16(end[1:]))
+
+	packetType, _, err = readFrame(bytes.NewReader(end), ProtocolVersion1)
+	require.NoError(t, err)
+	require.Equal(t, TrackEndPacket, packetType)
+}
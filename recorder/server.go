@@ -0,0 +1,1324 @@
+package recorder
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// 20ms Opus frame, the slot of the mixed recording
+	mixSlot = 20 * time.Millisecond
+	// the record types of the track log
+	logRecordData         = 1
+	logRecordSenderReport = 2
+	logRecordMarker       = 3
+	logRecordHeaderSize   = 11
+)
+
+var (
+	ErrServerClosed = errors.New("recorder: server is closed")
+	ErrMissingCert  = errors.New("recorder: cert file and key file are required")
+)
+
+// ServerConfig configures the reference recorder server
+type ServerConfig struct {
+	// The UDP address to listen, for example 0.0.0.0:9000
+	Address  string
+	CertFile string
+	KeyFile  string
+	// The recording files of a session are written to {Directory}/{bucket name}
+	Directory   string
+	VideoFormat VideoFormat
+	// The duration to wait for the track streams to end after the close datagram is received, default is 5 seconds
+	CloseTimeout time.Duration
+	// The duration to wait for a lost connection to be resumed before the session is ended, default is 30 seconds.
+	// Only the sessions of recorder.Session are resumed, they're identified by the session ID of the client config.
+	ResumeTimeout time.Duration
+	Log           logging.LeveledLogger
+}
+
+// SessionResult is the result of a recording session, reported when the session is ended
+type SessionResult struct {
+	Config ClientConfig
+	// nil if the connection is closed without the close datagram
+	Stop  *StopConfig
+	Files []string
+	Err   error
+}
+
+// Server is a reference implementation of the recorder service.
+// It accepts the QUIC connections of the SFU, writes each track to a file with the local disk recorder,
+// and on the close datagram it writes the splits and the mixed recording of the tracks in the channel config.
+type Server struct {
+	config         ServerConfig
+	listener       *quic.Listener
+	mu             sync.Mutex
+	wg             sync.WaitGroup
+	cancel         context.CancelFunc
+	sessions       map[string]*serverSession
+	onSessionEnded func(SessionResult)
+	log            logging.LeveledLogger
+}
+
+func NewServer(config ServerConfig) (*Server, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, ErrMissingCert
+	}
+
+	if config.CloseTimeout == 0 {
+		config.CloseTimeout = 5 * time.Second
+	}
+
+	if config.ResumeTimeout == 0 {
+		config.ResumeTimeout = 30 * time.Second
+	}
+
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("recorder")
+	}
+
+	return &Server{
+		config:   config,
+		mu:       sync.Mutex{},
+		sessions: make(map[string]*serverSession),
+		log:      config.Log,
+	}, nil
+}
+
+// OnSessionEnded is called when all the files of a session are written
+func (s *Server) OnSessionEnded(callback func(SessionResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onSessionEnded = callback
+}
+
+// Listen starts listening on the address of the config, call Serve to accept the connections
+func (s *Server) Listen() error {
+	cert, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	listener, err := quic.ListenAddr(s.config.Address, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   recorderProtocols,
+	}, &quic.Config{
+		EnableDatagrams: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Addr returns the listening address, nil if the server is not listening
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
+// Serve accepts the connections until the context is done or the server is closed
+func (s *Server) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	listener := s.listener
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	if listener == nil {
+		return ErrServerClosed
+	}
+
+	for {
+		conn, err := listener.Accept(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, quic.ErrServerClosed) {
+				return ErrServerClosed
+			}
+
+			return err
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(ctx, conn)
+		}()
+	}
+}
+
+// ListenAndServe listens on the address of the config and accepts the connections until the context is done
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	return s.Serve(ctx)
+}
+
+// Close stops accepting connections, ends the running sessions and waits until their files are written
+func (s *Server) Close() error {
+	s.mu.Lock()
+	listener := s.listener
+	cancel := s.cancel
+	s.listener = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	var err error
+	if listener != nil {
+		err = listener.Close()
+	}
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) handleConn(ctx context.Context, conn quic.Connection) {
+	c := newServerConn(conn)
+
+	config := c.clientConfig()
+
+	// the bucket is a directory in the recordings directory, a bucket name that escapes it is rejected
+	if _, err := BucketDirectory(s.config.Directory, config.BucketName); err != nil {
+		s.log.Errorf("recorder: session %s is rejected, invalid bucket name %q", config.ClientId, config.BucketName)
+		_ = c.conn.CloseWithError(0, err.Error())
+		return
+	}
+
+	sess := s.resumeSession(config, c)
+	if sess == nil {
+		// the connection is handed to the running session
+		return
+	}
+
+	result := sess.run(ctx, c)
+
+	if result.Err != nil {
+		s.log.Errorf("recorder: session %s ended with error: %s", result.Config.ClientId, result.Err.Error())
+	} else {
+		s.log.Infof("recorder: session %s ended, %d files written", result.Config.ClientId, len(result.Files))
+	}
+
+	s.mu.Lock()
+	callback := s.onSessionEnded
+	s.mu.Unlock()
+
+	if callback != nil {
+		callback(result)
+	}
+}
+
+// resumeSession hands the connection to the running session with the same session ID and returns nil,
+// or returns a new session for the connection
+func (s *Server) resumeSession(config ClientConfig, c *serverConn) *serverSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if config.SessionID != "" {
+		if sess, ok := s.sessions[config.SessionID]; ok {
+			s.log.Infof("recorder: session %s is resumed from %s", config.SessionID, c.conn.RemoteAddr())
+
+			// replace the connection that is not taken yet, only the latest connection is used
+			select {
+			case old := <-sess.resumeCh:
+				_ = old.conn.CloseWithError(0, "replaced")
+			default:
+			}
+
+			sess.resumeCh <- c
+
+			return nil
+		}
+	}
+
+	sess := newServerSession(s, config)
+
+	if config.SessionID != "" {
+		s.sessions[config.SessionID] = sess
+	}
+
+	return sess
+}
+
+// endSession removes the session, the connections that arrive after this start a new session
+func (s *Server) endSession(sess *serverSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions[sess.config.SessionID] == sess {
+		delete(s.sessions, sess.config.SessionID)
+	}
+
+	select {
+	case c := <-sess.resumeCh:
+		_ = c.conn.CloseWithError(0, "session ended")
+	default:
+	}
+}
+
+// serverConn is a connection of a session, the datagrams are read in the background
+type serverConn struct {
+	conn      quic.Connection
+	version   uint8
+	datagrams chan []byte
+	// the close datagram that received before the config datagram
+	closeDatagram []byte
+	// the number of accepted streams, signaled on each accepted stream
+	mu       sync.Mutex
+	accepted int
+	acceptCh chan struct{}
+}
+
+func newServerConn(conn quic.Connection) *serverConn {
+	c := &serverConn{
+		conn:      conn,
+		version:   NegotiatedVersion(conn),
+		datagrams: make(chan []byte, 16),
+		acceptCh:  make(chan struct{}, 1),
+	}
+
+	go func() {
+		defer close(c.datagrams)
+
+		for {
+			data, err := conn.ReceiveDatagram(conn.Context())
+			if err != nil {
+				return
+			}
+
+			c.datagrams <- data
+		}
+	}()
+
+	return c
+}
+
+// clientConfig reads the config datagram, the datagram is not reliable so the connection continues without it after a while
+func (c *serverConn) clientConfig() ClientConfig {
+	config := ClientConfig{}
+	timeout := time.After(2 * time.Second)
+
+	for {
+		select {
+		case data, ok := <-c.datagrams:
+			if !ok {
+				return config
+			}
+
+			if _, isClose := ParseCloseDatagram(data); isClose {
+				// keep the close datagram for the session
+				c.closeDatagram = data
+				return config
+			}
+
+			if err := json.Unmarshal(data, &config); err != nil {
+				continue
+			}
+
+			return config
+		case <-timeout:
+			return config
+		}
+	}
+}
+
+func (c *serverConn) onAccepted() {
+	c.mu.Lock()
+	c.accepted++
+	c.mu.Unlock()
+
+	select {
+	case c.acceptCh <- struct{}{}:
+	default:
+	}
+}
+
+// waitStreams waits until the number of streams are accepted, or the timeout
+func (c *serverConn) waitStreams(streams int, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		accepted := c.accepted
+		c.mu.Unlock()
+
+		if accepted >= streams {
+			return
+		}
+
+		select {
+		case <-c.acceptCh:
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// serverSession is a recording of a room or a client, it continues on a new connection when the session ID is resumed
+type serverSession struct {
+	server   *Server
+	config   ClientConfig
+	start    time.Time
+	resumeCh chan *serverConn
+	mu       sync.Mutex
+	current  *serverConn
+	tracks   []*serverTrack
+	// the data channel messages of the session, nil if the client doesn't send them
+	transcript *serverTranscript
+	wg         sync.WaitGroup
+	log        logging.LeveledLogger
+}
+
+func newServerSession(server *Server, config ClientConfig) *serverSession {
+	return &serverSession{
+		server:   server,
+		config:   config,
+		start:    time.Now(),
+		resumeCh: make(chan *serverConn, 1),
+		tracks:   make([]*serverTrack, 0),
+		log:      server.log,
+	}
+}
+
+func (s *serverSession) run(ctx context.Context, c *serverConn) SessionResult {
+	var stop *StopConfig
+
+	for c != nil {
+		var next *serverConn
+
+		stop, next = s.serve(ctx, c)
+		if stop != nil || ctx.Err() != nil {
+			break
+		}
+
+		if next == nil && s.config.SessionID != "" {
+			select {
+			case next = <-s.resumeCh:
+			case <-time.After(s.server.config.ResumeTimeout):
+				s.log.Warnf("recorder: session %s is not resumed after %s", s.config.SessionID, s.server.config.ResumeTimeout)
+			case <-ctx.Done():
+			}
+		}
+
+		c = next
+	}
+
+	s.server.endSession(s)
+
+	files, err := s.finalize(stop)
+
+	return SessionResult{
+		Config: s.config,
+		Stop:   stop,
+		Files:  files,
+		Err:    err,
+	}
+}
+
+// serve receives the tracks of the connection until the close datagram is received, the connection is ended,
+// or a new connection resumes the session
+func (s *serverSession) serve(ctx context.Context, c *serverConn) (*StopConfig, *serverConn) {
+	s.mu.Lock()
+	s.current = c
+	s.mu.Unlock()
+
+	go s.acceptStreams(c)
+
+	datagrams := c.datagrams
+
+	if c.closeDatagram != nil {
+		cfg, streams, _ := parseCloseDatagram(c.closeDatagram)
+
+		c.waitStreams(streams, s.server.config.CloseTimeout)
+		s.waitTracks(s.server.config.CloseTimeout)
+		_ = c.conn.CloseWithError(0, "recording stopped")
+
+		return &cfg, nil
+	}
+
+	for {
+		select {
+		case data, ok := <-datagrams:
+			if !ok {
+				datagrams = nil
+				continue
+			}
+
+			cfg, streams, isClose := parseCloseDatagram(data)
+			if !isClose {
+				continue
+			}
+
+			c.waitStreams(streams, s.server.config.CloseTimeout)
+			s.waitTracks(s.server.config.CloseTimeout)
+			_ = c.conn.CloseWithError(0, "recording stopped")
+
+			return &cfg, nil
+		case next := <-s.resumeCh:
+			_ = c.conn.CloseWithError(0, "replaced")
+			s.waitTracks(s.server.config.CloseTimeout)
+
+			return nil, next
+		case <-c.conn.Context().Done():
+			s.waitTracks(s.server.config.CloseTimeout)
+
+			return nil, nil
+		case <-ctx.Done():
+			_ = c.conn.CloseWithError(0, "server closed")
+			s.waitTracks(s.server.config.CloseTimeout)
+
+			return nil, nil
+		}
+	}
+}
+
+func (s *serverSession) acceptStreams(c *serverConn) {
+	for {
+		stream, err := c.conn.AcceptUniStream(c.conn.Context())
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		c.onAccepted()
+
+		go func() {
+			defer s.wg.Done()
+			s.handleStream(stream, c.version)
+		}()
+	}
+}
+
+// timelineStart returns the start of the room timeline, or the start of the session when the client doesn't send it
+func (s *serverSession) timelineStart() time.Time {
+	if s.config.TimelineStart.IsZero() {
+		return s.start
+	}
+
+	return s.config.TimelineStart
+}
+
+// directory returns the bucket directory of the session, the bucket name is validated when the session starts
+func (s *serverSession) directory() string {
+	return filepath.Join(s.server.config.Directory, sanitizeFileName(s.config.BucketName))
+}
+
+// baseName returns the file name of the session without the extension
+func (s *serverSession) baseName() string {
+	if s.config.FileName == "" {
+		return s.config.ClientId
+	}
+
+	return trimExt(s.config.FileName)
+}
+
+// segmentName returns the file name of the first segment
+func (s *serverSession) segmentName() string {
+	if s.config.FileName == "" {
+		return s.config.ClientId
+	}
+
+	return s.config.FileName
+}
+
+func trimExt(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
+
+func (s *serverSession) fileConfig() FileConfig {
+	return FileConfig{
+		Directory:   s.directory(),
+		VideoFormat: s.server.config.VideoFormat,
+	}
+}
+
+// track returns the track with the ID to continue after a reconnection, or creates it
+func (s *serverSession) track(conf *TrackConfig) (*serverTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, track := range s.tracks {
+		if track.config.TrackID == conf.TrackID {
+			return track, nil
+		}
+	}
+
+	if conf.Resume {
+		s.log.Warnf("recorder: resumed track %s is unknown, recording it as a new track", conf.TrackID)
+	}
+
+	// the tracks that start after a rotation have the file name of the current segment
+	if conf.FileName == "" {
+		conf.FileName = s.baseName()
+	} else {
+		conf.FileName = trimExt(conf.FileName)
+	}
+
+	track, err := newServerTrack(conf, s.fileConfig(), s.timelineStart())
+	if err != nil {
+		return nil, err
+	}
+
+	s.tracks = append(s.tracks, track)
+
+	return track, nil
+}
+
+// transcriptTrack returns the transcript of the session, the transcript stream continues the same file after a reconnection
+func (s *serverSession) transcriptTrack() (*serverTranscript, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.transcript != nil {
+		return s.transcript, nil
+	}
+
+	file, err := NewFileTranscriptRecorder(s.fileConfig(), s.baseName())
+	if err != nil {
+		return nil, err
+	}
+
+	s.transcript = &serverTranscript{
+		mu:   sync.Mutex{},
+		file: file,
+	}
+
+	return s.transcript, nil
+}
+
+// serverStream is the recording of a stream, a media track or the transcript
+type serverStream interface {
+	// Resume returns the number of packets to skip on a stream that starts with the packet index
+	Resume(index uint64) uint64
+	// Skip counts a data packet that is not written
+	Skip()
+	Write(offset time.Duration, data []byte) error
+	WriteSenderReport(offset time.Duration, report SenderReport) error
+	WriteMarker(offset time.Duration, marker Marker) error
+	Close()
+}
+
+func (s *serverSession) handleStream(stream quic.ReceiveStream, version uint8) {
+	packetType, data, err := readFrame(stream, version)
+	if err != nil || packetType != ConfigPacket {
+		s.log.Errorf("recorder: track stream without config packet")
+		stream.CancelRead(0)
+		return
+	}
+
+	conf, err := decodeTrackConfig(version, data)
+	if err != nil {
+		s.log.Errorf("recorder: invalid track config: %s", err.Error())
+		stream.CancelRead(0)
+		return
+	}
+
+	var track serverStream
+
+	if conf.MimeType == MimeTypeTranscript {
+		track, err = s.transcriptTrack()
+	} else {
+		track, err = s.track(conf)
+	}
+
+	if err != nil {
+		s.log.Errorf("recorder: failed to record track %s: %s", conf.TrackID, err.Error())
+		stream.CancelRead(0)
+		return
+	}
+
+	// the packets that sent again after a reconnection but already received
+	skip := track.Resume(conf.ResumeIndex)
+
+	for {
+		packetType, data, err := readFrame(stream, version)
+		if errors.Is(err, ErrInvalidChecksum) {
+			// the frame is read completely, the stream continues with the next frame
+			s.log.Warnf("recorder: dropped a corrupted frame of track %s", conf.TrackID)
+			if packetType == DataPacket {
+				if skip > 0 {
+					skip--
+				} else {
+					track.Skip()
+				}
+			}
+			continue
+		}
+
+		if err != nil {
+			// the connection is lost, the track continues when it's resumed
+			return
+		}
+
+		offset := time.Since(s.start)
+
+		switch packetType {
+		case TrackEndPacket:
+			track.Close()
+			return
+		case SenderReportPacket:
+			report, err := decodeSenderReport(data)
+			if err == nil {
+				err = track.WriteSenderReport(offset, report)
+			}
+
+			if err != nil {
+				s.log.Warnf("recorder: failed to write sender report of track %s: %s", conf.TrackID, err.Error())
+			}
+		case MarkerPacket:
+			marker, err := decodeMarker(data)
+			if err == nil {
+				err = track.WriteMarker(offset, marker)
+			}
+
+			if err != nil {
+				s.log.Warnf("recorder: failed to write marker of track %s: %s", conf.TrackID, err.Error())
+			}
+		case DataPacket:
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			if err := track.Write(offset, data); err != nil {
+				s.log.Warnf("recorder: failed to write packet of track %s: %s", conf.TrackID, err.Error())
+			}
+		}
+	}
+}
+
+func (s *serverSession) waitTracks(timeout time.Duration) {
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.log.Warnf("recorder: track streams are not ended after %s", timeout)
+	}
+}
+
+// finalize closes the track files, then writes the splits and the mixed recording from the packet logs of the tracks
+func (s *serverSession) finalize(stop *StopConfig) ([]string, error) {
+	s.mu.Lock()
+	tracks := s.tracks
+	transcript := s.transcript
+	s.mu.Unlock()
+
+	files := make([]string, 0)
+	errs := make([]error, 0)
+
+	for _, track := range tracks {
+		track.Close()
+		files = append(files, track.Files()...)
+	}
+
+	if transcript != nil {
+		transcript.Close()
+		files = append(files, transcript.file.FilePath)
+	}
+
+	defer func() {
+		for _, track := range tracks {
+			track.RemoveLog()
+		}
+	}()
+
+	timeline := Timeline{
+		Start:    s.timelineStart(),
+		Markers:  make([]TimelineMarker, 0),
+		Segments: []TimelineSegment{{FileName: s.segmentName()}},
+		Tracks:   make([]TimelineTrack, 0, len(tracks)),
+	}
+
+	hasMarkers := false
+	for _, track := range tracks {
+		timelineTrack := track.Timeline()
+		hasMarkers = hasMarkers || len(timelineTrack.Markers) > 0
+		timeline.Tracks = append(timeline.Tracks, timelineTrack)
+	}
+
+	timeline.addRoomMarkers()
+
+	if transcript != nil {
+		timeline.Transcript = transcript.file.FilePath
+	}
+
+	// only the protocol version 2 tracks have a timeline
+	if hasMarkers {
+		filePath, err := joinFileName(s.directory(), s.baseName(), ".timeline.json")
+		if err == nil {
+			err = writeTimeline(filePath, timeline)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			files = append(files, filePath)
+		}
+	}
+
+	if stop == nil {
+		return files, errors.Join(errs...)
+	}
+
+	for _, split := range stop.Splits {
+		splitName := strings.TrimSuffix(split.FileName, filepath.Ext(split.FileName))
+
+		for _, track := range tracks {
+			filePath, err := track.WriteSplit(splitName, split.Start, split.End, s.fileConfig())
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			files = append(files, filePath)
+		}
+	}
+
+	if len(stop.ChannelConfig) > 0 {
+		channels := stop.channelCount()
+
+		filePath, err := joinFileName(s.directory(), s.baseName(), ".ogg")
+		if err == nil {
+			filePath, err = writeMix(filePath, tracks, stop.ChannelConfig, channels, 0, 0)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			files = append(files, filePath)
+		}
+
+		for _, split := range stop.Splits {
+			splitName := strings.TrimSuffix(split.FileName, filepath.Ext(split.FileName))
+
+			filePath, err := joinFileName(s.directory(), splitName, ".ogg")
+			if err == nil {
+				filePath, err = writeMix(filePath, tracks, stop.ChannelConfig, channels, split.Start, split.End)
+			}
+
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			files = append(files, filePath)
+		}
+	}
+
+	return files, errors.Join(errs...)
+}
+
+// serverTrack writes a track to its file and logs the packets with the arrival time for the splits and the mixed recording
+type serverTrack struct {
+	mu     sync.Mutex
+	config TrackConfig
+	file   *FileTrack
+	// the files of the previous segments
+	segments      []string
+	log           *os.File
+	closed        bool
+	timelineStart time.Time
+	markers       []Marker
+	senderReport  *TimelineSenderReport
+	senderReports int
+	// the index of the next data packet
+	next uint64
+}
+
+func newServerTrack(conf *TrackConfig, fileConf FileConfig, timelineStart time.Time) (*serverTrack, error) {
+	tr, err := NewFileTrackRecorder(conf, fileConf)
+	if err != nil {
+		return nil, err
+	}
+
+	file := tr.(*FileTrack)
+
+	log, err := os.CreateTemp(fileConf.Directory, "."+filepath.Base(file.FilePath)+".*.rtplog")
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &serverTrack{
+		mu:            sync.Mutex{},
+		config:        *conf,
+		file:          file,
+		log:           log,
+		timelineStart: timelineStart,
+	}, nil
+}
+
+// Skip counts a data packet that is not written
+func (t *serverTrack) Skip() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next++
+}
+
+// Resume returns the number of packets to skip on a stream that starts with the packet index
+func (t *serverTrack) Resume(index uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.next >= index {
+		return t.next - index
+	}
+
+	// the packets between are dropped by the client
+	t.next = index
+
+	return 0
+}
+
+func (t *serverTrack) Write(offset time.Duration, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrRecorderClosed
+	}
+
+	t.next++
+
+	if err := t.writeLog(offset, logRecordData, data); err != nil {
+		return err
+	}
+
+	_, err := t.file.Write(data)
+
+	return err
+}
+
+// WriteSenderReport logs the NTP and RTP timestamp mapping for the timeline
+func (t *serverTrack) WriteSenderReport(offset time.Duration, report SenderReport) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.senderReport == nil {
+		t.senderReport = &TimelineSenderReport{
+			Offset:  report.Time().Sub(t.timelineStart),
+			NTPTime: report.NTPTime,
+			RTPTime: report.RTPTime,
+		}
+	}
+
+	t.senderReports++
+
+	return t.writeLog(offset, logRecordSenderReport, encodeSenderReport(report))
+}
+
+// WriteMarker logs the marker, the markers that sent again after a reconnection are skipped
+func (t *serverTrack) WriteMarker(offset time.Duration, marker Marker) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, m := range t.markers {
+		if m.Type == marker.Type && m.Time.Equal(marker.Time) && m.RTPTime == marker.RTPTime {
+			return nil
+		}
+	}
+
+	t.markers = append(t.markers, marker)
+
+	if err := t.writeLog(offset, logRecordMarker, encodeMarker(marker)); err != nil {
+		return err
+	}
+
+	if marker.Type != MarkerRotate || t.closed {
+		return nil
+	}
+
+	filePath := t.file.FilePath
+	if err := t.file.Rotate(trimExt(marker.Label)); err != nil {
+		return err
+	}
+
+	t.segments = append(t.segments, filePath)
+
+	return nil
+}
+
+// Files returns the files of the segments of the track
+func (t *serverTrack) Files() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append(append([]string{}, t.segments...), t.file.FilePath)
+}
+
+func (t *serverTrack) writeLog(offset time.Duration, recordType uint8, data []byte) error {
+	record := make([]byte, logRecordHeaderSize, logRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint64(record, uint64(offset))
+	record[8] = recordType
+	binary.BigEndian.PutUint16(record[9:], uint16(len(data)))
+
+	_, err := t.log.Write(append(record, data...))
+
+	return err
+}
+
+// Timeline returns the markers and the sender report of the track on the timeline
+func (t *serverTrack) Timeline() TimelineTrack {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	markers := make([]TimelineMarker, 0, len(t.markers))
+	for _, marker := range t.markers {
+		markers = append(markers, TimelineMarker{
+			Type:    marker.Type.String(),
+			Offset:  marker.Time.Sub(t.timelineStart),
+			RTPTime: marker.RTPTime,
+			Label:   marker.Label,
+		})
+	}
+
+	return TimelineTrack{
+		TrackID:       t.config.TrackID,
+		ClientID:      t.config.ClientID,
+		MimeType:      t.config.MimeType,
+		FilePath:      t.file.FilePath,
+		Files:         append(append([]string{}, t.segments...), t.file.FilePath),
+		Markers:       markers,
+		SenderReport:  t.senderReport,
+		SenderReports: t.senderReports,
+	}
+}
+
+func (t *serverTrack) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+
+	t.closed = true
+	_ = t.file.Close()
+}
+
+func (t *serverTrack) RemoveLog() {
+	_ = t.log.Close()
+	_ = os.Remove(t.log.Name())
+}
+
+// packets calls f with the packets in the log and their media time on the timeline. The media time is the time of the
+// last start or resume marker, or the arrival time of the first packet without markers, plus the RTP timestamp difference,
+// so it's not affected by the network jitter, the timestamp wraps, and the timestamp gaps of a paused recording.
+func (t *serverTrack) packets(f func(mediaTime time.Duration, packet *rtp.Packet) error) error {
+	if _, err := t.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	clockRate := int64(videoClockRate)
+	if t.config.MimeType == webrtc.MimeTypeOpus {
+		clockRate = opusSampleRate
+	}
+
+	var (
+		started      bool
+		anchorOffset time.Duration
+		lastTS       uint32
+		elapsed      int64
+	)
+
+	header := make([]byte, logRecordHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(t.log, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		data := make([]byte, binary.BigEndian.Uint16(header[9:]))
+		if _, err := io.ReadFull(t.log, data); err != nil {
+			return err
+		}
+
+		switch header[8] {
+		case logRecordMarker:
+			marker, err := decodeMarker(data)
+			if err != nil || (marker.Type != MarkerStart && marker.Type != MarkerResume) {
+				continue
+			}
+
+			// the following packets are placed from the marker time
+			started = true
+			anchorOffset = marker.Time.Sub(t.timelineStart)
+			lastTS = marker.RTPTime
+			elapsed = 0
+
+			continue
+		case logRecordData:
+		default:
+			continue
+		}
+
+		packet := &rtp.Packet{}
+		if err := packet.Unmarshal(data); err != nil {
+			continue
+		}
+
+		if !started {
+			started = true
+			anchorOffset = time.Duration(binary.BigEndian.Uint64(header))
+			lastTS = packet.Timestamp
+		}
+
+		// unwrap the timestamp, a late packet has a negative difference
+		elapsed += int64(int32(packet.Timestamp - lastTS))
+		lastTS = packet.Timestamp
+
+		mediaTime := anchorOffset + time.Duration(elapsed*int64(time.Second)/clockRate)
+
+		if err := f(mediaTime, packet); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteSplit writes the packets between start and end to a new file named with the split name
+func (t *serverTrack) WriteSplit(splitName string, start, end time.Duration, fileConf FileConfig) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conf := t.config
+	conf.FileName = splitName
+
+	tr, err := NewFileTrackRecorder(&conf, fileConf)
+	if err != nil {
+		return "", err
+	}
+
+	err = t.packets(func(mediaTime time.Duration, packet *rtp.Packet) error {
+		if mediaTime < start || (end > 0 && mediaTime >= end) {
+			return nil
+		}
+
+		_, err := tr.WritePacket(packet)
+		return err
+	})
+
+	if closeErr := tr.Close(); err == nil {
+		err = closeErr
+	}
+
+	return tr.(*FileTrack).FilePath, err
+}
+
+// serverTranscript writes the data channel messages of the session to a JSON lines file
+type serverTranscript struct {
+	mu     sync.Mutex
+	file   *FileTranscript
+	closed bool
+	// the index of the next data packet
+	next uint64
+}
+
+func (t *serverTranscript) Skip() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next++
+}
+
+func (t *serverTranscript) Resume(index uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.next >= index {
+		return t.next - index
+	}
+
+	t.next = index
+
+	return 0
+}
+
+func (t *serverTranscript) Write(_ time.Duration, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrRecorderClosed
+	}
+
+	t.next++
+
+	// an invalid message would break the JSON lines
+	if !json.Valid(data) {
+		return ErrInvalidFrame
+	}
+
+	return t.file.writeLine(data)
+}
+
+func (t *serverTranscript) WriteSenderReport(time.Duration, SenderReport) error {
+	return nil
+}
+
+func (t *serverTranscript) WriteMarker(time.Duration, Marker) error {
+	return nil
+}
+
+func (t *serverTranscript) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	_ = t.file.Close()
+}
+
+// writeMix writes the Opus tracks of the channel config to an Ogg Opus file with a mono stream per channel.
+// The packets are aligned to 20ms slots of the session time, when multiple tracks are in the same channel the packet
+// with the largest payload is used because it's the one with the voice activity, the packets are not decoded to mix
+// them. Only 20ms packets are supported, the other packets are replaced with silence.
+func writeMix(filePath string, tracks []*serverTrack, channelConfig ChannelConfig, channels int, start, end time.Duration) (string, error) {
+	if channels < 1 || channels > 255 {
+		return "", fmt.Errorf("recorder: invalid number of channels %d for the recording %s", channels, filepath.Base(filePath))
+	}
+
+	slots := make([]map[int64][]byte, channels)
+	for i := range slots {
+		slots[i] = make(map[int64][]byte)
+	}
+
+	minSlot, maxSlot := int64(-1), int64(-1)
+
+	for _, track := range tracks {
+		channel, ok := channelConfig[track.config.TrackID]
+		if !ok || channel < 1 || channel > channels || track.config.MimeType != webrtc.MimeTypeOpus {
+			continue
+		}
+
+		channelSlots := slots[channel-1]
+
+		track.mu.Lock()
+		err := track.packets(func(mediaTime time.Duration, packet *rtp.Packet) error {
+			if mediaTime < start || (end > 0 && mediaTime >= end) {
+				return nil
+			}
+
+			if samples, err := OpusPacketSamples(packet.Payload); err != nil || samples != opusFrameSamples {
+				return nil
+			}
+
+			slot := int64((mediaTime + mixSlot/2) / mixSlot)
+			if current, ok := channelSlots[slot]; !ok || len(packet.Payload) > len(current) {
+				channelSlots[slot] = packet.Payload
+			}
+
+			if minSlot == -1 || slot < minSlot {
+				minSlot = slot
+			}
+
+			if slot > maxSlot {
+				maxSlot = slot
+			}
+
+			return nil
+		})
+		track.mu.Unlock()
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if minSlot == -1 {
+		return "", fmt.Errorf("recorder: no audio packets for the recording %s", filepath.Base(filePath))
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	mapping := make([]uint8, channels)
+	for i := range mapping {
+		mapping[i] = uint8(i)
+	}
+
+	writer, err := newOggOpusStreamWriter(newBufferedFile(f), uint8(channels), 0, mapping)
+	if err != nil {
+		_ = f.Close()
+		return "", err
+	}
+
+	silence, _ := opusSelfDelimited(opusSilenceFrame)
+
+	for slot := minSlot; slot <= maxSlot; slot++ {
+		packet := make([]byte, 0)
+
+		// all streams except the last are self-delimited
+		for i, channelSlots := range slots {
+			payload, ok := channelSlots[slot]
+			if !ok {
+				payload = opusSilenceFrame
+			}
+
+			if i == len(slots)-1 {
+				packet = append(packet, payload...)
+				continue
+			}
+
+			delimited, err := opusSelfDelimited(payload)
+			if err != nil {
+				delimited = silence
+			}
+
+			packet = append(packet, delimited...)
+		}
+
+		if err := writer.WritePacket(packet, opusFrameSamples); err != nil {
+			_ = writer.Close()
+			return "", err
+		}
+	}
+
+	return filePath, writer.Close()
+}
@@ -0,0 +1,531 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.cert")
+	keyFile := filepath.Join(dir, "server.key")
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	return certFile, keyFile
+}
+
+// startTestServer starts a recorder server that writes to a temp directory, the results of the sessions are sent to the channel
+func startTestServer(t *testing.T, ctx context.Context) (*Server, *RecorderConfig, string, chan SessionResult) {
+	t.Helper()
+
+	certFile, keyFile := writeTestCert(t)
+	dir := t.TempDir()
+
+	server, err := NewServer(ServerConfig{
+		Address:   "127.0.0.1:0",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		Directory: dir,
+	})
+	require.NoError(t, err)
+
+	results := make(chan SessionResult, 1)
+	server.OnSessionEnded(func(result SessionResult) {
+		results <- result
+	})
+
+	require.NoError(t, server.Listen())
+
+	go func() {
+		_ = server.Serve(ctx)
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return server, &RecorderConfig{
+		Host:     "127.0.0.1",
+		Port:     uint16(server.Addr().(*net.UDPAddr).Port),
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}, dir, results
+}
+
+func waitSessionResult(t *testing.T, ctx context.Context, results chan SessionResult) SessionResult {
+	t.Helper()
+
+	select {
+	case result := <-results:
+		return result
+	case <-ctx.Done():
+		require.Fail(t, "session is not ended")
+	}
+
+	return SessionResult{}
+}
+
+func TestServerRecording(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, config, dir, results := startTestServer(t, ctx)
+
+	conn, err := NewQuicClient(ctx, ClientConfig{
+		ClientId:   "client",
+		BucketName: "bucket",
+		FileName:   "call.ogg",
+	}, config)
+	require.NoError(t, err)
+	require.Equal(t, ProtocolVersion2, NegotiatedVersion(conn))
+
+	newRecorder := QuicTrackRecorder(conn)
+
+	for _, trackID := range []string{"left", "right"} {
+		tr, err := newRecorder(&TrackConfig{
+			TrackID:  trackID,
+			ClientID: "client",
+			RoomID:   "room",
+			MimeType: webrtc.MimeTypeOpus,
+		})
+		require.NoError(t, err)
+
+		// 1 second of 20ms CELT packets
+		for i := 0; i < 50; i++ {
+			_, err := tr.WritePacket(&rtp.Packet{
+				Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * opusFrameSamples)},
+				Payload: []byte{0xfc, byte(i), 0x01},
+			})
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, tr.Close())
+	}
+
+	// the datagram is not ordered with the streams
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, conn.SendDatagram(CloseDatagram(StopConfig{
+		Splits: []SplitConfig{{Start: 0, End: 500 * time.Millisecond, FileName: "part.ogg"}},
+		ChannelConfig: ChannelConfig{
+			"left":  int(LeftChannel),
+			"right": int(RightChannel),
+		},
+	})))
+
+	result := waitSessionResult(t, ctx, results)
+
+	require.NoError(t, result.Err)
+	require.Equal(t, "client", result.Config.ClientId)
+	require.NotNil(t, result.Stop)
+
+	bucket := filepath.Join(dir, "bucket")
+	require.ElementsMatch(t, []string{
+		filepath.Join(bucket, "call_client_left.ogg"),
+		filepath.Join(bucket, "call_client_right.ogg"),
+		filepath.Join(bucket, "part_client_left.ogg"),
+		filepath.Join(bucket, "part_client_right.ogg"),
+		filepath.Join(bucket, "call.ogg"),
+		filepath.Join(bucket, "part.ogg"),
+	}, result.Files)
+
+	// the packet logs are removed
+	entries, err := os.ReadDir(bucket)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+
+	countPages := func(name string) int {
+		data, err := os.ReadFile(filepath.Join(bucket, name))
+		require.NoError(t, err)
+		return len(bytes.Split(data, []byte("OggS"))) - 1
+	}
+
+	// 2 header pages and a page for each packet
+	require.Equal(t, 2+50, countPages("call_client_left.ogg"))
+	require.Equal(t, 2+25, countPages("part_client_left.ogg"))
+	require.Equal(t, 2+50, countPages("call.ogg"))
+
+	data, err := os.ReadFile(filepath.Join(bucket, "call.ogg"))
+	require.NoError(t, err)
+
+	head := data[bytes.Index(data, []byte("OpusHead")):]
+	require.Equal(t, uint8(2), head[9], "channel count")
+	require.Equal(t, uint32(opusSampleRate), binary.LittleEndian.Uint32(head[12:]))
+	require.Equal(t, uint8(opusMappingFamilyMulti), head[18])
+	require.Equal(t, []byte{2, 0, 0, 1}, head[19:23], "2 mono streams, left then right")
+}
+
+func TestServerInvalidBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, config, dir, results := startTestServer(t, ctx)
+
+	conn, err := NewQuicClient(ctx, ClientConfig{
+		ClientId:   "client",
+		BucketName: "..",
+		FileName:   "call.ogg",
+	}, config)
+	require.NoError(t, err)
+
+	// the session is rejected before a track is recorded
+	select {
+	case <-conn.Context().Done():
+	case <-ctx.Done():
+		require.Fail(t, "session is not rejected")
+	}
+
+	select {
+	case result := <-results:
+		require.Fail(t, "rejected session has a result", result.Config.BucketName)
+	default:
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	require.NoError(t, err)
+
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), "call")
+	}
+}
+
+func TestServerChannelLayout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, config, dir, results := startTestServer(t, ctx)
+
+	conn, err := NewQuicClient(ctx, ClientConfig{
+		ClientId:   "room",
+		BucketName: "bucket",
+		FileName:   "conference.ogg",
+	}, config)
+	require.NoError(t, err)
+
+	newRecorder := QuicTrackRecorder(conn)
+
+	for i, clientID := range []string{"agent", "customer", "supervisor"} {
+		tr, err := newRecorder(&TrackConfig{
+			TrackID:  clientID + "-audio",
+			ClientID: clientID,
+			RoomID:   "room",
+			MimeType: webrtc.MimeTypeOpus,
+		})
+		require.NoError(t, err)
+
+		for j := 0; j < 10; j++ {
+			_, err := tr.WritePacket(&rtp.Packet{
+				Header:  rtp.Header{SequenceNumber: uint16(j), Timestamp: uint32(j * opusFrameSamples)},
+				Payload: []byte{0xfc, byte(i)},
+			})
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, tr.Close())
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, conn.SendDatagram(CloseDatagram(StopConfig{
+		ChannelConfig: ChannelConfig{
+			"agent-audio":      1,
+			"customer-audio":   2,
+			"supervisor-audio": 3,
+		},
+		ChannelLayout: ChannelLayoutParticipant,
+		Clients: []ChannelClient{
+			{ClientID: "agent", Channel: 1, TrackIDs: []string{"agent-audio"}},
+			{ClientID: "customer", Channel: 2, TrackIDs: []string{"customer-audio"}},
+			{ClientID: "supervisor", Channel: 3, TrackIDs: []string{"supervisor-audio"}},
+		},
+	})))
+
+	result := waitSessionResult(t, ctx, results)
+	require.NoError(t, result.Err)
+	require.Len(t, result.Stop.Clients, 3)
+
+	data, err := os.ReadFile(filepath.Join(dir, "bucket", "conference.ogg"))
+	require.NoError(t, err)
+
+	pages := bytes.Split(data, []byte("OggS"))[1:]
+	require.Len(t, pages, 2+10)
+
+	head := data[bytes.Index(data, []byte("OpusHead")):]
+	require.Equal(t, uint8(3), head[9], "channel count")
+	require.Equal(t, uint8(opusMappingFamilyDiscrete), head[18])
+	require.Equal(t, []byte{3, 0, 0, 1, 2}, head[19:24], "3 mono streams")
+
+	// the first 2 streams are self-delimited, the page payload follows the header and a single segment
+	audio := pages[2][oggPageHeaderSize-4+1:]
+	require.Equal(t, []byte{0xfc, 0x01, 0x00, 0xfc, 0x01, 0x01, 0xfc, 0x02}, audio)
+}
+
+func TestOpusSelfDelimited(t *testing.T) {
+	t.Parallel()
+
+	packet, err := opusSelfDelimited([]byte{0xfc, 0x01, 0x02})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xfc, 0x02, 0x01, 0x02}, packet)
+
+	// code 1, two frames with the same size
+	packet, err = opusSelfDelimited([]byte{0xfd, 0x01, 0x02})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xfd, 0x01, 0x01, 0x02}, packet)
+
+	long := append([]byte{0xfc}, make([]byte, 300)...)
+	packet, err = opusSelfDelimited(long)
+	require.NoError(t, err)
+	n, k, err := opusReadLength(packet[1:])
+	require.NoError(t, err)
+	require.Equal(t, 300, n)
+	require.Equal(t, 2, k)
+
+	_, err = opusSelfDelimited(nil)
+	require.Error(t, err)
+}
+
+func TestServerTimeline(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, config, dir, results := startTestServer(t, ctx)
+
+	timelineStart := time.Now()
+
+	conn, err := NewQuicClient(ctx, ClientConfig{
+		ClientId:      "client",
+		BucketName:    "bucket",
+		FileName:      "call.ogg",
+		TimelineStart: timelineStart,
+	}, config)
+	require.NoError(t, err)
+
+	tr, err := QuicTrackRecorder(conn)(&TrackConfig{
+		TrackID:  "audio",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypeOpus,
+	})
+	require.NoError(t, err)
+
+	timeline := tr.(TimelineRecorder)
+
+	// the track starts 1 second after the timeline with 500ms of audio, then it's paused and resumed at 3 seconds
+	// with an unrelated timestamp
+	require.NoError(t, timeline.WriteMarker(Marker{Type: MarkerStart, Time: timelineStart.Add(time.Second), RTPTime: 0}))
+	for i := 0; i < 25; i++ {
+		_, err := tr.WritePacket(&rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * opusFrameSamples)},
+			Payload: []byte{0xfc, byte(i)},
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, timeline.WriteMarker(Marker{Type: MarkerPause, Time: timelineStart.Add(1500 * time.Millisecond), RTPTime: 24 * opusFrameSamples}))
+	require.NoError(t, timeline.WriteSenderReport(SenderReport{NTPTime: 0xe8fe6f81_80000000, RTPTime: 960}))
+	require.NoError(t, timeline.WriteMarker(Marker{Type: MarkerResume, Time: timelineStart.Add(3 * time.Second), RTPTime: 4294950000}))
+
+	for i := 0; i < 25; i++ {
+		_, err := tr.WritePacket(&rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: uint16(25 + i), Timestamp: uint32(4294950000 + i*opusFrameSamples)},
+			Payload: []byte{0xfc, byte(i)},
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tr.Close())
+
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, conn.SendDatagram(CloseDatagram(StopConfig{
+		Splits: []SplitConfig{{Start: 2 * time.Second, End: 4 * time.Second, FileName: "resumed.ogg"}},
+	})))
+
+	result := waitSessionResult(t, ctx, results)
+	require.NoError(t, result.Err)
+
+	bucket := filepath.Join(dir, "bucket")
+	require.Contains(t, result.Files, filepath.Join(bucket, "call.timeline.json"))
+
+	// only the packets after the resume are in the split, the timestamp wrap after the resume is unwrapped
+	data, err := os.ReadFile(filepath.Join(bucket, "resumed_client_audio.ogg"))
+	require.NoError(t, err)
+	require.Len(t, bytes.Split(data, []byte("OggS"))[1:], 2+25)
+
+	data, err = os.ReadFile(filepath.Join(bucket, "call.timeline.json"))
+	require.NoError(t, err)
+
+	recorded := Timeline{}
+	require.NoError(t, json.Unmarshal(data, &recorded))
+	require.True(t, timelineStart.Equal(recorded.Start))
+	require.Len(t, recorded.Tracks, 1)
+
+	track := recorded.Tracks[0]
+	require.Equal(t, "audio", track.TrackID)
+	require.Equal(t, []TimelineMarker{
+		{Type: "start", Offset: time.Second, RTPTime: 0},
+		{Type: "pause", Offset: 1500 * time.Millisecond, RTPTime: 24 * opusFrameSamples},
+		{Type: "resume", Offset: 3 * time.Second, RTPTime: 4294950000},
+	}, track.Markers)
+	require.Equal(t, 1, track.SenderReports)
+	require.Equal(t, uint32(960), track.SenderReport.RTPTime)
+}
+
+func TestServerRotation(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, config, dir, results := startTestServer(t, ctx)
+
+	timelineStart := time.Now()
+
+	conn, err := NewQuicClient(ctx, ClientConfig{
+		ClientId:      "room",
+		BucketName:    "bucket",
+		FileName:      "call.ogg",
+		TimelineStart: timelineStart,
+	}, config)
+	require.NoError(t, err)
+
+	newTrack := func(trackID, fileName string) TrackRecorder {
+		tr, err := QuicTrackRecorder(conn)(&TrackConfig{
+			TrackID:  trackID,
+			ClientID: "client",
+			RoomID:   "room",
+			FileName: fileName,
+			MimeType: webrtc.MimeTypeOpus,
+		})
+		require.NoError(t, err)
+
+		return tr
+	}
+
+	writePackets := func(tr TrackRecorder, count int) {
+		for i := 0; i < count; i++ {
+			_, err := tr.WritePacket(&rtp.Packet{
+				Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * opusFrameSamples)},
+				Payload: []byte{0xfc, byte(i)},
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	tracks := []TrackRecorder{newTrack("agent1", ""), newTrack("customer", "")}
+
+	for _, tr := range tracks {
+		require.NoError(t, tr.(TimelineRecorder).WriteMarker(Marker{Type: MarkerStart, Time: timelineStart}))
+		writePackets(tr, 10)
+	}
+
+	// the room markers are sent by every track at the same time
+	for _, tr := range tracks {
+		require.NoError(t, tr.(TimelineRecorder).WriteMarker(Marker{Type: MarkerLabel, Time: timelineStart.Add(time.Second), Label: "consent"}))
+		require.NoError(t, tr.(TimelineRecorder).WriteMarker(Marker{Type: MarkerRotate, Time: timelineStart.Add(2 * time.Second), Label: "transfer.ogg"}))
+		writePackets(tr, 5)
+	}
+
+	// a track that starts after the rotation is named with the current segment
+	tracks = append(tracks, newTrack("agent2", "transfer.ogg"))
+	writePackets(tracks[2], 3)
+
+	for _, tr := range tracks {
+		require.NoError(t, tr.Close())
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, conn.SendDatagram(CloseDatagram(StopConfig{})))
+
+	result := waitSessionResult(t, ctx, results)
+	require.NoError(t, result.Err)
+
+	bucket := filepath.Join(dir, "bucket")
+
+	pages := map[string]int{
+		"call_client_agent1.ogg":       10,
+		"call_client_customer.ogg":     10,
+		"transfer_client_agent1.ogg":   5,
+		"transfer_client_customer.ogg": 5,
+		"transfer_client_agent2.ogg":   3,
+	}
+
+	for name, count := range pages {
+		require.Contains(t, result.Files, filepath.Join(bucket, name))
+
+		data, err := os.ReadFile(filepath.Join(bucket, name))
+		require.NoError(t, err)
+		require.Len(t, bytes.Split(data, []byte("OggS"))[1:], 2+count, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(bucket, "call.timeline.json"))
+	require.NoError(t, err)
+
+	recorded := Timeline{}
+	require.NoError(t, json.Unmarshal(data, &recorded))
+	require.Equal(t, []TimelineMarker{
+		{Type: "label", Offset: time.Second, Label: "consent"},
+		{Type: "rotate", Offset: 2 * time.Second, Label: "transfer.ogg"},
+	}, recorded.Markers)
+	require.Equal(t, []TimelineSegment{
+		{FileName: "call.ogg"},
+		{FileName: "transfer.ogg", Offset: 2 * time.Second},
+	}, recorded.Segments)
+
+	for _, track := range recorded.Tracks {
+		if track.TrackID == "agent1" {
+			require.Equal(t, []string{
+				filepath.Join(bucket, "call_client_agent1.ogg"),
+				filepath.Join(bucket, "transfer_client_agent1.ogg"),
+			}, track.Files)
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package recorder
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/quic-go/quic-go"
+)
+
+type SessionState string
+
+const (
+	SessionStateConnecting   SessionState = "connecting"
+	SessionStateConnected    SessionState = "connected"
+	SessionStateReconnecting SessionState = "reconnecting"
+	SessionStateClosed       SessionState = "closed"
+)
+
+var ErrSessionClosed = errors.New("recorder: session is closed")
+
+// SessionHealth is the state of the connection to the recorder service
+type SessionHealth struct {
+	State     SessionState
+	Connected bool
+	// The number of reconnections after the first connection
+	Reconnects  uint32
+	BytesSent   uint64
+	PacketsSent uint64
+	// The packets dropped because the spill queue is full or the session is closed before they're sent
+	PacketsDropped uint64
+	// The packets and bytes waiting in the spill queue
+	QueuedPackets int
+	QueuedBytes   int
+	LastError     string
+}
+
+type SessionOptions struct {
+	// The maximum bytes of the packets buffered while the connection is down, the oldest packets are dropped when it's full.
+	// Default is 8MB
+	MaxQueueBytes int
+	// The delay before reconnecting, doubled on each failed attempt until MaxBackoff. Default is 500ms and 10s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// The timeout of a connection attempt, default is 5 seconds
+	DialTimeout time.Duration
+	// The time to send the queued packets and wait for the recorder to end the session after Close, default is 10 seconds
+	CloseTimeout time.Duration
+	Log          logging.LeveledLogger
+}
+
+func DefaultSessionOptions() SessionOptions {
+	return SessionOptions{
+		MaxQueueBytes: 8 * 1024 * 1024,
+		MinBackoff:    500 * time.Millisecond,
+		MaxBackoff:    10 * time.Second,
+		DialTimeout:   5 * time.Second,
+		CloseTimeout:  10 * time.Second,
+	}
+}
+
+// sessionFrame is a frame waiting in the spill queue
+type sessionFrame struct {
+	track      *sessionTrack
+	packetType PacketType
+	data       []byte
+	// the index of the data packet in the track, assigned when it's sent for the first time
+	index   uint64
+	indexed bool
+}
+
+// Session is a supervised connection to the recorder service.
+// The connection is made and restored in the background, the tracks are queued while the connection is down
+// and their streams are opened again on the new connection with the resume flag in the track config.
+// A stream write doesn't mean the recorder received the data, so the last sent frames are kept and sent again
+// after a reconnection, the recorder skips the packets it already has with the resume index of the track config.
+type Session struct {
+	context         context.Context
+	cancel          context.CancelFunc
+	clientConfig    ClientConfig
+	address         string
+	tlsConfig       *tls.Config
+	options         SessionOptions
+	mu              sync.Mutex
+	queue           []*sessionFrame
+	queueBytes      int
+	inflight        []*sessionFrame
+	inflightBytes   int
+	notify          chan struct{}
+	health          SessionHealth
+	closing         bool
+	stopConfig      StopConfig
+	done            chan struct{}
+	onHealthChanged []func(SessionHealth)
+	log             logging.LeveledLogger
+}
+
+// NewSession starts a recording session with the recorder service, the connection is made in the background.
+// The tracks can be recorded right away with the NewTrackRecorder method.
+func NewSession(clientConfig ClientConfig, config *RecorderConfig, options SessionOptions) (*Session, error) {
+	if config == nil {
+		return nil, errors.New("recorder: recorder config is required")
+	}
+
+	tlsConfig, err := loadTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := DefaultSessionOptions()
+
+	if options.MaxQueueBytes == 0 {
+		options.MaxQueueBytes = defaults.MaxQueueBytes
+	}
+
+	if options.MinBackoff == 0 {
+		options.MinBackoff = defaults.MinBackoff
+	}
+
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = defaults.MaxBackoff
+	}
+
+	if options.DialTimeout == 0 {
+		options.DialTimeout = defaults.DialTimeout
+	}
+
+	if options.CloseTimeout == 0 {
+		options.CloseTimeout = defaults.CloseTimeout
+	}
+
+	if options.Log == nil {
+		options.Log = logging.NewDefaultLoggerFactory().NewLogger("recorder")
+	}
+
+	if clientConfig.SessionID == "" {
+		clientConfig.SessionID = newSessionID()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Session{
+		context:      ctx,
+		cancel:       cancel,
+		clientConfig: clientConfig,
+		address:      fmt.Sprintf("%s:%d", config.Host, config.Port),
+		tlsConfig:    tlsConfig,
+		options:      options,
+		mu:           sync.Mutex{},
+		queue:        make([]*sessionFrame, 0),
+		notify:       make(chan struct{}, 1),
+		health: SessionHealth{
+			State: SessionStateConnecting,
+		},
+		done: make(chan struct{}),
+		log:  options.Log,
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// ID returns the session ID that the recorder service uses to resume the session after a reconnection
+func (s *Session) ID() string {
+	return s.clientConfig.SessionID
+}
+
+// OnHealthChanged is called when the connection state is changed
+func (s *Session) OnHealthChanged(callback func(SessionHealth)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onHealthChanged = append(s.onHealthChanged, callback)
+}
+
+// Health returns the current state of the session
+func (s *Session) Health() SessionHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.healthLocked()
+}
+
+func (s *Session) healthLocked() SessionHealth {
+	health := s.health
+	health.QueuedPackets = len(s.queue)
+	health.QueuedBytes = s.queueBytes
+
+	return health
+}
+
+// Done is closed when the session is ended
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// NewTrackRecorder records a track in the session, it can be used as a NewTrackRecorderFunc
+func (s *Session) NewTrackRecorder(conf *TrackConfig) (TrackRecorder, error) {
+	if err := validateTrackConfig(conf); err != nil {
+		return nil, err
+	}
+
+	track := &sessionTrack{
+		session: s,
+		config:  *conf,
+	}
+
+	// the config is encoded with the protocol version of the connection when it's sent
+	if err := s.enqueue(&sessionFrame{track: track, packetType: ConfigPacket}); err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
+
+// Close sends the queued packets and the stop config to end the recording, it doesn't wait for the session to end.
+func (s *Session) Close(stopConfig StopConfig) {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return
+	}
+
+	s.closing = true
+	s.stopConfig = stopConfig
+	s.mu.Unlock()
+
+	s.signal()
+
+	time.AfterFunc(s.options.CloseTimeout, s.cancel)
+}
+
+func (s *Session) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) enqueue(frame *sessionFrame) error {
+	s.mu.Lock()
+
+	if s.closing {
+		s.mu.Unlock()
+		return ErrSessionClosed
+	}
+
+	s.queue = append(s.queue, frame)
+	s.queueBytes += len(frame.data)
+
+	// drop the oldest data packets, the config and the track end must be sent
+	for i := 0; s.queueBytes > s.options.MaxQueueBytes && i < len(s.queue); {
+		if s.queue[i].packetType != DataPacket {
+			i++
+			continue
+		}
+
+		s.queueBytes -= len(s.queue[i].data)
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		s.health.PacketsDropped++
+	}
+
+	s.mu.Unlock()
+
+	s.signal()
+
+	return nil
+}
+
+func (s *Session) setHealth(update func(health *SessionHealth)) {
+	s.mu.Lock()
+	update(&s.health)
+	health := s.healthLocked()
+	callbacks := s.onHealthChanged
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(health)
+	}
+}
+
+func (s *Session) run() {
+	defer close(s.done)
+	defer s.cancel()
+
+	backoff := s.options.MinBackoff
+	connected := false
+
+	for {
+		conn, err := s.dial(connected)
+		if err != nil {
+			if s.context.Err() != nil {
+				s.end(nil)
+				return
+			}
+
+			s.log.Warnf("recorder: failed to connect to %s, retry in %s: %s", s.address, backoff, err.Error())
+			s.setHealth(func(health *SessionHealth) {
+				health.LastError = err.Error()
+			})
+
+			select {
+			case <-time.After(backoff):
+			case <-s.context.Done():
+				s.end(nil)
+				return
+			}
+
+			backoff = min(backoff*2, s.options.MaxBackoff)
+
+			continue
+		}
+
+		backoff = s.options.MinBackoff
+
+		s.setHealth(func(health *SessionHealth) {
+			if connected {
+				health.Reconnects++
+			}
+
+			health.State = SessionStateConnected
+			health.Connected = true
+		})
+
+		connected = true
+
+		failed, err := s.send(conn)
+		if err == nil {
+			s.end(conn)
+			return
+		}
+
+		_ = conn.CloseWithError(0, "")
+
+		s.requeue(failed)
+
+		if s.context.Err() != nil {
+			s.end(nil)
+			return
+		}
+
+		s.log.Warnf("recorder: connection to %s is lost: %s", s.address, err.Error())
+		s.setHealth(func(health *SessionHealth) {
+			health.State = SessionStateReconnecting
+			health.Connected = false
+			health.LastError = err.Error()
+		})
+	}
+}
+
+func (s *Session) dial(resume bool) (quic.Connection, error) {
+	ctx, cancel := context.WithTimeout(s.context, s.options.DialTimeout)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, s.address, s.tlsConfig, &quic.Config{
+		EnableDatagrams: true,
+		KeepAlivePeriod: 2 * time.Second,
+		MaxIdleTimeout:  10 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config := s.clientConfig
+	config.Resume = resume
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	if err := conn.SendDatagram(data); err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// send writes the queued frames to the connection, it returns nil when the session is closed
+// and the stop config is sent, or the error and the frame that failed when the connection is ended
+func (s *Session) send(conn quic.Connection) (*sessionFrame, error) {
+	// the number of streams opened on the connection
+	streams := 0
+
+	for {
+		frame, closing := s.next(conn)
+		if frame == nil {
+			if !closing {
+				if s.context.Err() != nil {
+					return nil, s.context.Err()
+				}
+
+				return nil, context.Cause(conn.Context())
+			}
+
+			s.mu.Lock()
+			stopConfig := s.stopConfig
+			s.mu.Unlock()
+
+			return nil, conn.SendDatagram(closeDatagram(stopConfig, streams))
+		}
+
+		first := !frame.indexed
+		opened := frame.track.conn != conn
+
+		n, err := frame.track.writeFrame(s.context, conn, frame)
+		if err != nil {
+			return frame, err
+		}
+
+		if opened && frame.track.conn == conn {
+			streams++
+		}
+
+		s.mu.Lock()
+		s.health.BytesSent += uint64(n)
+		if frame.packetType == DataPacket && first {
+			s.health.PacketsSent++
+		}
+
+		if frame.packetType != ConfigPacket {
+			s.inflight = append(s.inflight, frame)
+			s.inflightBytes += len(frame.data)
+
+			for s.inflightBytes > s.options.MaxQueueBytes && len(s.inflight) > 0 {
+				s.inflightBytes -= len(s.inflight[0].data)
+				s.inflight[0] = nil
+				s.inflight = s.inflight[1:]
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// requeue puts the frames that sent on the lost connection and the failed frame back to the front of the queue
+func (s *Session) requeue(failed *sessionFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := s.inflight
+	if failed != nil {
+		frames = append(frames, failed)
+	}
+
+	for _, frame := range frames {
+		s.queueBytes += len(frame.data)
+	}
+
+	s.queue = append(frames, s.queue...)
+	s.inflight = nil
+	s.inflightBytes = 0
+}
+
+// next returns the first frame of the queue, or nil if the connection is ended, or the session is closing and the queue is empty
+func (s *Session) next(conn quic.Connection) (*sessionFrame, bool) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			frame := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.queueBytes -= len(frame.data)
+			s.mu.Unlock()
+
+			return frame, false
+		}
+
+		closing := s.closing
+		s.mu.Unlock()
+
+		if closing {
+			return nil, true
+		}
+
+		select {
+		case <-s.notify:
+		case <-conn.Context().Done():
+			return nil, false
+		case <-s.context.Done():
+			return nil, false
+		}
+	}
+}
+
+// end waits for the recorder to close the connection after the stop config is sent, then marks the session as closed
+func (s *Session) end(conn quic.Connection) {
+	if conn != nil {
+		select {
+		case <-conn.Context().Done():
+		case <-s.context.Done():
+		}
+
+		_ = conn.CloseWithError(0, "")
+	}
+
+	s.setHealth(func(health *SessionHealth) {
+		health.State = SessionStateClosed
+		health.Connected = false
+	})
+
+	s.mu.Lock()
+	s.closing = true
+	for _, frame := range s.queue {
+		if frame.packetType == DataPacket {
+			s.health.PacketsDropped++
+		}
+	}
+	s.queue = nil
+	s.queueBytes = 0
+	s.inflight = nil
+	s.inflightBytes = 0
+	s.mu.Unlock()
+}
+
+// sessionTrack is a track recorded in a session, the frames are queued in the session and written by the session goroutine
+type sessionTrack struct {
+	session *Session
+	config  TrackConfig
+	closed  atomic.Bool
+	// the connection, the stream and the index are only used by the session goroutine
+	conn      quic.Connection
+	stream    quic.SendStream
+	version   uint8
+	nextIndex uint64
+}
+
+func (t *sessionTrack) Write(data []byte) (int, error) {
+	if t.closed.Load() {
+		return 0, ErrRecorderClosed
+	}
+
+	frame := &sessionFrame{
+		track:      t,
+		packetType: DataPacket,
+		data:       append([]byte(nil), data...),
+	}
+
+	if err := t.session.enqueue(frame); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (t *sessionTrack) WritePacket(packet *rtp.Packet) (int, error) {
+	if t.closed.Load() {
+		return 0, ErrRecorderClosed
+	}
+
+	data, err := packet.Marshal()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := t.session.enqueue(&sessionFrame{track: t, packetType: DataPacket, data: data}); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (t *sessionTrack) Close() error {
+	if !t.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	return t.session.enqueue(&sessionFrame{track: t, packetType: TrackEndPacket})
+}
+
+// WriteSenderReport queues the NTP and RTP timestamp mapping of the track, it's not sent on a protocol version 1 connection
+func (t *sessionTrack) WriteSenderReport(report SenderReport) error {
+	if t.closed.Load() {
+		return ErrRecorderClosed
+	}
+
+	return t.session.enqueue(&sessionFrame{track: t, packetType: SenderReportPacket, data: encodeSenderReport(report)})
+}
+
+// WriteMarker queues the state change of the track, it's not sent on a protocol version 1 connection
+func (t *sessionTrack) WriteMarker(marker Marker) error {
+	if t.closed.Load() {
+		return ErrRecorderClosed
+	}
+
+	return t.session.enqueue(&sessionFrame{track: t, packetType: MarkerPacket, data: encodeMarker(marker)})
+}
+
+// writeFrame writes the frame to the track stream on the connection, the stream is opened on the first frame
+// of each connection, and when it's not the first stream of the track the config is sent again with the resume flag.
+func (t *sessionTrack) writeFrame(ctx context.Context, conn quic.Connection, frame *sessionFrame) (int, error) {
+	written := 0
+
+	if t.config.MimeType == MimeTypeTranscript && NegotiatedVersion(conn) < ProtocolVersion2 {
+		// the recorder of the protocol version 1 doesn't support the transcript stream
+		return 0, nil
+	}
+
+	if frame.packetType == DataPacket && !frame.indexed {
+		frame.index = t.nextIndex
+		frame.indexed = true
+		t.nextIndex++
+	}
+
+	if t.conn != conn {
+		stream, err := conn.OpenUniStreamSync(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		resume := t.conn != nil
+		t.conn = conn
+		t.stream = stream
+		t.version = NegotiatedVersion(conn)
+
+		if resume && frame.packetType != ConfigPacket {
+			conf := t.config
+			conf.Resume = true
+			conf.ResumeIndex = t.nextIndex
+
+			if frame.packetType == DataPacket {
+				conf.ResumeIndex = frame.index
+			}
+
+			data, err := encodeTrackConfig(t.version, &conf)
+			if err != nil {
+				return 0, err
+			}
+
+			n, err := stream.Write(encodeFrame(t.version, ConfigPacket, data))
+			if err != nil {
+				return 0, err
+			}
+
+			written += n
+		}
+	}
+
+	data := frame.data
+	if frame.packetType == ConfigPacket {
+		var err error
+		if data, err = encodeTrackConfig(t.version, &t.config); err != nil {
+			return written, err
+		}
+	}
+
+	encoded := encodeFrame(t.version, frame.packetType, data)
+	if encoded == nil {
+		// not supported by the protocol version of the connection
+		return written, nil
+	}
+
+	n, err := t.stream.Write(encoded)
+	written += n
+
+	if err != nil {
+		return written, err
+	}
+
+	if frame.packetType == TrackEndPacket {
+		return written, t.stream.Close()
+	}
+
+	return written, nil
+}
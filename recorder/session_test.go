@@ -0,0 +1,253 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func writeOpusPackets(t *testing.T, tr TrackRecorder, from, to int) {
+	t.Helper()
+
+	for i := from; i < to; i++ {
+		_, err := tr.WritePacket(&rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * opusFrameSamples)},
+			Payload: []byte{0xfc, byte(i), 0x01},
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestSessionReconnect(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	server, config, dir, results := startTestServer(t, ctx)
+
+	session, err := NewSession(ClientConfig{
+		ClientId:   "client",
+		BucketName: "bucket",
+		FileName:   "call.ogg",
+	}, config, SessionOptions{
+		MinBackoff: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	tr, err := session.NewTrackRecorder(&TrackConfig{
+		TrackID:  "audio",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypeOpus,
+	})
+	require.NoError(t, err)
+
+	writeOpusPackets(t, tr, 0, 10)
+
+	require.Eventually(t, func() bool {
+		return session.Health().PacketsSent == 10
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// drop the connection from the server, the session reconnects and resumes the track
+	var sess *serverSession
+	require.Eventually(t, func() bool {
+		server.mu.Lock()
+		sess = server.sessions[session.ID()]
+		server.mu.Unlock()
+
+		if sess == nil {
+			return false
+		}
+
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+
+		return sess.current != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sess.mu.Lock()
+	conn := sess.current.conn
+	sess.mu.Unlock()
+	require.NoError(t, conn.CloseWithError(1, "outage"))
+
+	writeOpusPackets(t, tr, 10, 20)
+
+	require.Eventually(t, func() bool {
+		health := session.Health()
+		return health.Connected && health.Reconnects == 1 && health.PacketsSent == 20
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, tr.Close())
+	session.Close(StopConfig{})
+
+	result := waitSessionResult(t, ctx, results)
+
+	require.NoError(t, result.Err)
+	require.Equal(t, []string{filepath.Join(dir, "bucket", "call_client_audio.ogg")}, result.Files)
+
+	data, err := os.ReadFile(result.Files[0])
+	require.NoError(t, err)
+	// 2 header pages and the 20 packets in a single file
+	require.Len(t, bytes.Split(data, []byte("OggS"))[1:], 2+20)
+
+	select {
+	case <-session.Done():
+	case <-ctx.Done():
+		require.Fail(t, "session is not closed")
+	}
+
+	health := session.Health()
+	require.Equal(t, SessionStateClosed, health.State)
+	require.Zero(t, health.PacketsDropped)
+}
+
+func TestSessionSpillQueue(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile := writeTestCert(t)
+
+	// a port without a listener, the session keeps reconnecting
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, conn.Close())
+
+	session, err := NewSession(ClientConfig{ClientId: "client"}, &RecorderConfig{
+		Host:     "127.0.0.1",
+		Port:     uint16(port),
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}, SessionOptions{
+		MaxQueueBytes: 200,
+		MinBackoff:    10 * time.Millisecond,
+		DialTimeout:   50 * time.Millisecond,
+		CloseTimeout:  100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	healthCh := make(chan SessionHealth, 100)
+	session.OnHealthChanged(func(health SessionHealth) {
+		select {
+		case healthCh <- health:
+		default:
+		}
+	})
+
+	tr, err := session.NewTrackRecorder(&TrackConfig{
+		TrackID:  "audio",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypeOpus,
+	})
+	require.NoError(t, err)
+
+	// each packet is 15 bytes
+	writeOpusPackets(t, tr, 0, 100)
+
+	health := session.Health()
+	require.False(t, health.Connected)
+	require.Greater(t, health.PacketsDropped, uint64(80))
+	// the config is never dropped
+	require.LessOrEqual(t, health.QueuedBytes, 200+15)
+
+	select {
+	case health := <-healthCh:
+		require.NotEmpty(t, health.LastError)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no health event")
+	}
+
+	session.Close(StopConfig{})
+
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "session is not closed")
+	}
+
+	require.Equal(t, SessionStateClosed, session.Health().State)
+
+	_, err = tr.WritePacket(&rtp.Packet{Payload: []byte{0xfc}})
+	require.ErrorIs(t, err, ErrSessionClosed)
+}
+
+func TestSessionInvalidCert(t *testing.T) {
+	t.Parallel()
+
+	config := &RecorderConfig{
+		Host:     "127.0.0.1",
+		Port:     9000,
+		CertFile: "missing.cert",
+		KeyFile:  "missing.key",
+	}
+
+	_, err := NewSession(ClientConfig{ClientId: "client"}, config, SessionOptions{})
+	require.Error(t, err)
+
+	_, err = NewQuicClient(context.Background(), ClientConfig{ClientId: "client"}, config)
+	require.Error(t, err)
+}
+
+func TestSessionTranscript(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, config, dir, results := startTestServer(t, ctx)
+
+	session, err := NewSession(ClientConfig{
+		ClientId:   "room",
+		BucketName: "bucket",
+		FileName:   "call.ogg",
+	}, config, SessionOptions{})
+	require.NoError(t, err)
+
+	transcript, err := session.NewTranscriptRecorder()
+	require.NoError(t, err)
+
+	start := time.Now()
+	messages := []TranscriptMessage{
+		{Time: start, Offset: time.Second, ClientID: "agent", Label: "chat", Text: "hello"},
+		{Time: start, Offset: 2 * time.Second, ClientID: "customer", Label: "captions", Data: []byte{1, 2, 3}},
+	}
+
+	for _, message := range messages {
+		require.NoError(t, transcript.WriteMessage(message))
+	}
+
+	require.ErrorIs(t, transcript.WriteMessage(TranscriptMessage{Text: string(make([]byte, 70000))}), ErrMessageTooLarge)
+	require.NoError(t, transcript.Close())
+
+	session.Close(StopConfig{})
+
+	result := waitSessionResult(t, ctx, results)
+	require.NoError(t, result.Err)
+
+	filePath := filepath.Join(dir, "bucket", "call.transcript.jsonl")
+	require.Contains(t, result.Files, filePath)
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	for i, line := range lines {
+		message := TranscriptMessage{}
+		require.NoError(t, json.Unmarshal(line, &message))
+		require.True(t, messages[i].Time.Equal(message.Time))
+		message.Time = messages[i].Time
+		require.Equal(t, messages[i], message)
+	}
+}
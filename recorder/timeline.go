@@ -0,0 +1,91 @@
+package recorder
+
+import (
+	"cmp"
+	"encoding/json"
+	"os"
+	"slices"
+	"time"
+)
+
+// Timeline is the room-level timeline of a recording session, written by the recorder server next to the recording files
+// as {file name}.timeline.json. The offsets are relative to the start of the timeline.
+type Timeline struct {
+	Start time.Time
+	// The label and rotate markers of the room, the markers are sent by every track so they're listed once here
+	Markers []TimelineMarker
+	// The segments started by the rotate markers, the first segment is the file name of the session
+	Segments []TimelineSegment
+	Tracks   []TimelineTrack
+	// The file of the data channel transcript, empty if the session doesn't have a transcript
+	Transcript string `json:",omitempty"`
+}
+
+type TimelineTrack struct {
+	TrackID  string
+	ClientID string
+	MimeType string
+	// The file of the last segment
+	FilePath string
+	// The files of all segments in order
+	Files   []string
+	Markers []TimelineMarker
+	// The first sender report of the track, nil if the publisher doesn't send sender reports
+	SenderReport *TimelineSenderReport
+	// The number of sender reports received
+	SenderReports int
+}
+
+type TimelineMarker struct {
+	Type    string
+	Offset  time.Duration
+	RTPTime uint32
+	Label   string `json:",omitempty"`
+}
+
+type TimelineSegment struct {
+	FileName string
+	Offset   time.Duration
+}
+
+type TimelineSenderReport struct {
+	Offset  time.Duration
+	NTPTime uint64
+	RTPTime uint32
+}
+
+// addRoomMarkers adds the label and rotate markers of the tracks to the room markers and segments
+func (t *Timeline) addRoomMarkers() {
+	for _, track := range t.Tracks {
+		for _, marker := range track.Markers {
+			if marker.Type != MarkerLabel.String() && marker.Type != MarkerRotate.String() {
+				continue
+			}
+
+			if slices.ContainsFunc(t.Markers, func(m TimelineMarker) bool {
+				return m.Type == marker.Type && m.Label == marker.Label && m.Offset == marker.Offset
+			}) {
+				continue
+			}
+
+			// the RTP time is different on each track
+			t.Markers = append(t.Markers, TimelineMarker{Type: marker.Type, Offset: marker.Offset, Label: marker.Label})
+
+			if marker.Type == MarkerRotate.String() {
+				t.Segments = append(t.Segments, TimelineSegment{FileName: marker.Label, Offset: marker.Offset})
+			}
+		}
+	}
+
+	slices.SortStableFunc(t.Markers, func(a, b TimelineMarker) int { return cmp.Compare(a.Offset, b.Offset) })
+	slices.SortStableFunc(t.Segments, func(a, b TimelineSegment) int { return cmp.Compare(a.Offset, b.Offset) })
+}
+
+func writeTimeline(filePath string, timeline Timeline) error {
+	data, err := json.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, data, 0o644)
+}
@@ -1,12 +1,9 @@
 package recorder
 
 import (
-	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"io"
 	"sync"
-	"sync/atomic"
 
 	"github.com/pion/rtp"
 	"github.com/quic-go/quic-go"
@@ -19,6 +16,9 @@ const (
 	DataPacket     PacketType = 0x02
 	RoomEndPacket  PacketType = 0x03
 	TrackEndPacket PacketType = 0x04
+	// the RTCP sender report and the markers of the protocol version 2
+	SenderReportPacket PacketType = 0x05
+	MarkerPacket       PacketType = 0x06
 )
 
 type TrackConfig struct {
@@ -28,6 +28,13 @@ type TrackConfig struct {
 	FileName string
 	MimeType string
 	Channel  int
+	// the resolution of the first video keyframe, zero for audio tracks
+	Width  uint32
+	Height uint32
+	// set when the track stream is opened again after a reconnection, the recorder continues the same track
+	Resume bool
+	// the index of the first data packet of the resumed stream, the packets before it are already sent
+	ResumeIndex uint64
 }
 
 type TrackRecorder interface {
@@ -36,17 +43,37 @@ type TrackRecorder interface {
 	Close() error
 }
 
+// NewTrackRecorderFunc creates the recorder of a track when the track recording is started
+type NewTrackRecorderFunc func(conf *TrackConfig) (TrackRecorder, error)
+
+// QuicTrackRecorder returns a NewTrackRecorderFunc that sends each track to the recorder service on a new stream of the connection
+func QuicTrackRecorder(conn quic.Connection) NewTrackRecorderFunc {
+	return func(conf *TrackConfig) (TrackRecorder, error) {
+		stream, err := conn.OpenUniStream()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewVersionTrackRecorder(conf, stream, NegotiatedVersion(conn))
+	}
+}
+
 type Track struct {
-	TrackID        string
-	ClientID       string
-	RoomID         string
-	stream         quic.SendStream
-	mu             sync.Mutex
-	isConfigPacket atomic.Bool
+	TrackID  string
+	ClientID string
+	RoomID   string
+	version  uint8
+	stream   quic.SendStream
+	mu       sync.Mutex
 }
 
+// NewTrackRecorder records the track on the stream with the protocol version 1
 func NewTrackRecorder(conf *TrackConfig, stream quic.SendStream) (TrackRecorder, error) {
+	return NewVersionTrackRecorder(conf, stream, ProtocolVersion1)
+}
 
+// NewVersionTrackRecorder records the track on the stream with the protocol version that negotiated by the connection
+func NewVersionTrackRecorder(conf *TrackConfig, stream quic.SendStream, version uint8) (TrackRecorder, error) {
 	if err := validateTrackConfig(conf); err != nil {
 		return nil, err
 	}
@@ -55,12 +82,11 @@ func NewTrackRecorder(conf *TrackConfig, stream quic.SendStream) (TrackRecorder,
 		TrackID:  conf.TrackID,
 		ClientID: conf.ClientID,
 		RoomID:   conf.RoomID,
+		version:  version,
 		stream:   stream,
 		mu:       sync.Mutex{},
 	}
 
-	track.isConfigPacket.Store(true)
-
 	err := track.sendNewTrackPacket(conf)
 	if err != nil {
 		return nil, err
@@ -69,35 +95,37 @@ func NewTrackRecorder(conf *TrackConfig, stream quic.SendStream) (TrackRecorder,
 	return track, nil
 }
 
-func (q *Track) Write(p []byte) (int, error) {
+// Version returns the protocol version of the track stream
+func (q *Track) Version() uint8 {
+	return q.version
+}
+
+func (q *Track) writeFrame(packetType PacketType, p []byte) (int, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	var packetType PacketType
-	if q.isConfigPacket.Load() {
-		packetType = ConfigPacket
-		q.isConfigPacket.Store(false)
-	} else {
-		packetType = DataPacket
+	packet := encodeFrame(q.version, packetType, p)
+	if packet == nil {
+		// not supported by the protocol version
+		return 0, nil
 	}
 
-	header := make([]byte, 3)
-	header[0] = byte(packetType)
-	binary.BigEndian.PutUint16(header[1:], uint16(len(p)))
-
-	packet := append(header, p...)
 	n, err := q.stream.Write(packet)
 	if err != nil {
 		return 0, err
 	}
 
 	if n != len(packet) {
-		return n - len(header), io.ErrShortWrite
+		return max(0, n-frameHeaderSize), io.ErrShortWrite
 	}
 
 	return len(p), nil
 }
 
+func (q *Track) Write(p []byte) (int, error) {
+	return q.writeFrame(DataPacket, p)
+}
+
 func (q *Track) WritePacket(packet *rtp.Packet) (int, error) {
 	p, err := packet.Marshal()
 	if err != nil {
@@ -106,20 +134,33 @@ func (q *Track) WritePacket(packet *rtp.Packet) (int, error) {
 	return q.Write(p)
 }
 
+// WriteSenderReport sends the NTP and RTP timestamp mapping of the track, only sent with the protocol version 2
+func (q *Track) WriteSenderReport(report SenderReport) error {
+	_, err := q.writeFrame(SenderReportPacket, encodeSenderReport(report))
+	return err
+}
+
+// WriteMarker sends the state change of the track, only sent with the protocol version 2
+func (q *Track) WriteMarker(marker Marker) error {
+	_, err := q.writeFrame(MarkerPacket, encodeMarker(marker))
+	return err
+}
+
 func (q *Track) sendNewTrackPacket(conf *TrackConfig) error {
-	data, err := json.Marshal(conf)
+	data, err := encodeTrackConfig(q.version, conf)
 	if err != nil {
 		return err
 	}
 
-	_, err = q.Write(data)
+	_, err = q.writeFrame(ConfigPacket, data)
 	return err
 }
 
 func (q *Track) sendTrackEndPacket() error {
-	_, err := q.Write([]byte{byte(TrackEndPacket)})
+	_, err := q.writeFrame(TrackEndPacket, nil)
 	return err
 }
+
 func (q *Track) Close() error {
 	err := q.sendTrackEndPacket()
 	if err != nil {
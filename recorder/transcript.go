@@ -0,0 +1,144 @@
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MimeTypeTranscript is the mime type of the transcript stream of a session, its data packets are JSON TranscriptMessage.
+	// The transcript stream requires the protocol version 2.
+	MimeTypeTranscript = "application/x-sfu-transcript+json"
+
+	transcriptTrackID = "transcript"
+	transcriptExt     = ".transcript.jsonl"
+)
+
+var ErrMessageTooLarge = errors.New("recorder: message is too large")
+
+// TranscriptMessage is a data channel message of a recorded room, the offset is relative to the start of the timeline
+type TranscriptMessage struct {
+	Time     time.Time     `json:"time"`
+	Offset   time.Duration `json:"offset_ns"`
+	ClientID string        `json:"client_id"`
+	Label    string        `json:"label"`
+	// The text of a string message
+	Text string `json:"text,omitempty"`
+	// The data of a binary message
+	Data []byte `json:"data,omitempty"`
+}
+
+// TranscriptRecorder records the data channel messages of a recording as JSON lines
+type TranscriptRecorder interface {
+	WriteMessage(message TranscriptMessage) error
+	Close() error
+}
+
+// FileTranscript is a TranscriptRecorder that writes the messages to {Directory}/{file name}.transcript.jsonl
+type FileTranscript struct {
+	FilePath string
+	mu       sync.Mutex
+	file     *os.File
+	closed   bool
+}
+
+func NewFileTranscriptRecorder(fileConf FileConfig, fileName string) (*FileTranscript, error) {
+	filePath, err := joinFileName(fileConf.Directory, fileName, transcriptExt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(fileConf.Directory, 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTranscript{
+		FilePath: filePath,
+		mu:       sync.Mutex{},
+		file:     f,
+	}, nil
+}
+
+func (f *FileTranscript) WriteMessage(message TranscriptMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return f.writeLine(data)
+}
+
+// writeLine writes a JSON line, the file is not buffered because the messages are rare compared to the media packets
+func (f *FileTranscript) writeLine(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrRecorderClosed
+	}
+
+	_, err := f.file.Write(append(data, '\n'))
+
+	return err
+}
+
+func (f *FileTranscript) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	return f.file.Close()
+}
+
+// NewTranscriptRecorder records the transcript of the session on its own stream, it's not sent on a protocol version 1
+// connection. The messages are queued with the media packets and dropped the same way when the queue is full.
+func (s *Session) NewTranscriptRecorder() (TranscriptRecorder, error) {
+	tr, err := s.NewTrackRecorder(&TrackConfig{
+		TrackID:  transcriptTrackID,
+		ClientID: s.clientConfig.ClientId,
+		RoomID:   s.clientConfig.ClientId,
+		MimeType: MimeTypeTranscript,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionTranscript{track: tr.(*sessionTrack)}, nil
+}
+
+type sessionTranscript struct {
+	track *sessionTrack
+}
+
+func (t *sessionTranscript) WriteMessage(message TranscriptMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > math.MaxUint16 {
+		return ErrMessageTooLarge
+	}
+
+	_, err = t.track.Write(data)
+
+	return err
+}
+
+func (t *sessionTranscript) Close() error {
+	return t.track.Close()
+}
@@ -0,0 +1,204 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// Matroska element IDs, see https://www.matroska.org/technical/elements.html
+const (
+	ebmlID               = 0x1A45DFA3
+	ebmlVersionID        = 0x4286
+	ebmlReadVersionID    = 0x42F7
+	ebmlMaxIDLengthID    = 0x42F2
+	ebmlMaxSizeLengthID  = 0x42F3
+	ebmlDocTypeID        = 0x4282
+	ebmlDocTypeVersionID = 0x4287
+	ebmlDocTypeReadID    = 0x4285
+	webmSegmentID        = 0x18538067
+	webmInfoID           = 0x1549A966
+	webmTimecodeScaleID  = 0x2AD7B1
+	webmMuxingAppID      = 0x4D80
+	webmWritingAppID     = 0x5741
+	webmTracksID         = 0x1654AE6B
+	webmTrackEntryID     = 0xAE
+	webmTrackNumberID    = 0xD7
+	webmTrackUIDID       = 0x73C5
+	webmTrackTypeID      = 0x83
+	webmCodecID          = 0x86
+	webmVideoID          = 0xE0
+	webmPixelWidthID     = 0xB0
+	webmPixelHeightID    = 0xBA
+	webmClusterID        = 0x1F43B675
+	webmTimecodeID       = 0xE7
+	webmSimpleBlockID    = 0xA3
+
+	// the size of an element that is written while streaming, the segment and clusters are never seeked back
+	ebmlUnknownSize = 0x01FFFFFFFFFFFFFF
+	webmMuxingApp   = "samespace-sfu"
+	// new cluster is started on a keyframe after this duration in milliseconds, or when the block timecode overflows
+	webmClusterDuration = 5000
+)
+
+// webmWriter writes VP8 or VP9 frames to a WebM file with a single video track.
+// The file is written in the live WebM layout with unknown size segment and clusters, so it's playable even if the recording is not closed.
+type webmWriter struct {
+	out            io.WriteCloser
+	builder        *frameBuilder
+	clusterStarted bool
+	clusterTime    uint64
+}
+
+func newWebMWriter(out io.WriteCloser, mimeType string, width, height uint32) (*webmWriter, error) {
+	codecID := "V_VP8"
+	if strings.EqualFold(mimeType, webrtc.MimeTypeVP9) {
+		codecID = "V_VP9"
+	}
+
+	header := ebmlElement(ebmlID, concatBytes(
+		ebmlUint(ebmlVersionID, 1),
+		ebmlUint(ebmlReadVersionID, 1),
+		ebmlUint(ebmlMaxIDLengthID, 4),
+		ebmlUint(ebmlMaxSizeLengthID, 8),
+		ebmlString(ebmlDocTypeID, "webm"),
+		ebmlUint(ebmlDocTypeVersionID, 4),
+		ebmlUint(ebmlDocTypeReadID, 2),
+	))
+
+	header = append(header, ebmlUnknownSizeElement(webmSegmentID)...)
+
+	header = append(header, ebmlElement(webmInfoID, concatBytes(
+		// timecodes in milliseconds
+		ebmlUint(webmTimecodeScaleID, 1000000),
+		ebmlString(webmMuxingAppID, webmMuxingApp),
+		ebmlString(webmWritingAppID, webmMuxingApp),
+	))...)
+
+	header = append(header, ebmlElement(webmTracksID, ebmlElement(webmTrackEntryID, concatBytes(
+		ebmlUint(webmTrackNumberID, 1),
+		ebmlUint(webmTrackUIDID, 1),
+		ebmlUint(webmTrackTypeID, 1),
+		ebmlString(webmCodecID, codecID),
+		ebmlElement(webmVideoID, concatBytes(
+			ebmlUint(webmPixelWidthID, uint64(width)),
+			ebmlUint(webmPixelHeightID, uint64(height)),
+		)),
+	)))...)
+
+	if _, err := out.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &webmWriter{
+		out:     out,
+		builder: newFrameBuilder(mimeType),
+	}, nil
+}
+
+func (w *webmWriter) WriteRTP(packet *rtp.Packet) error {
+	frame, err := w.builder.Push(packet)
+	if err != nil || frame == nil {
+		return err
+	}
+
+	timecode := frame.pts * 1000 / videoClockRate
+
+	if !w.clusterStarted ||
+		(frame.keyframe && timecode-w.clusterTime >= webmClusterDuration) ||
+		timecode-w.clusterTime > math.MaxInt16 {
+		cluster := ebmlUnknownSizeElement(webmClusterID)
+		cluster = append(cluster, ebmlUint(webmTimecodeID, timecode)...)
+
+		if _, err := w.out.Write(cluster); err != nil {
+			return err
+		}
+
+		w.clusterStarted = true
+		w.clusterTime = timecode
+	}
+
+	flags := byte(0)
+	if frame.keyframe {
+		flags = 0x80
+	}
+
+	block := make([]byte, 4, 4+len(frame.data))
+	block[0] = 0x81 // track number 1
+	binary.BigEndian.PutUint16(block[1:], uint16(timecode-w.clusterTime))
+	block[3] = flags
+	block = append(block, frame.data...)
+
+	_, err = w.out.Write(ebmlElement(webmSimpleBlockID, block))
+
+	return err
+}
+
+func (w *webmWriter) Close() error {
+	return w.out.Close()
+}
+
+func ebmlElement(id uint32, data []byte) []byte {
+	element := ebmlIDBytes(id)
+	element = append(element, ebmlSize(uint64(len(data)))...)
+	return append(element, data...)
+}
+
+func ebmlUnknownSizeElement(id uint32) []byte {
+	return binary.BigEndian.AppendUint64(ebmlIDBytes(id), ebmlUnknownSize)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	data := binary.BigEndian.AppendUint64(nil, v)
+	for len(data) > 1 && data[0] == 0 {
+		data = data[1:]
+	}
+
+	return ebmlElement(id, data)
+}
+
+func ebmlString(id uint32, s string) []byte {
+	return ebmlElement(id, []byte(s))
+}
+
+// ebmlIDBytes returns the ID without the leading zero bytes, the length marker is already part of the ID
+func ebmlIDBytes(id uint32) []byte {
+	data := binary.BigEndian.AppendUint32(nil, id)
+	for len(data) > 1 && data[0] == 0 {
+		data = data[1:]
+	}
+
+	return data
+}
+
+// ebmlSize encodes the size as a variable length integer with the shortest length
+func ebmlSize(size uint64) []byte {
+	length := 1
+	// all ones value is reserved for the unknown size
+	for length < 8 && size >= (1<<(7*length))-1 {
+		length++
+	}
+
+	data := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		data[i] = byte(size)
+		size >>= 8
+	}
+
+	data[0] |= 1 << (8 - length)
+
+	return data
+}
+
+func concatBytes(parts ...[]byte) []byte {
+	data := make([]byte, 0)
+	for _, part := range parts {
+		data = append(data, part...)
+	}
+
+	return data
+}
@@ -0,0 +1,140 @@
+package sfu
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/samespace/sfu/recorder"
+)
+
+// recordingChannels collects the recorded clients of a room recording with their tracks, the channels of the mixed
+// recording are assigned with the layout when the recording is stopped, so the layout and the channels can be changed
+// while the clients join and leave the recording.
+type recordingChannels struct {
+	mu        sync.Mutex
+	layout    recorder.ChannelLayoutConfig
+	clients   []*recordingClient
+	overrides map[string]int
+}
+
+type recordingClient struct {
+	id       string
+	name     string
+	role     string
+	channel  recorder.Channel
+	trackIDs []string
+}
+
+func newRecordingChannels(layout recorder.ChannelLayoutConfig) *recordingChannels {
+	return &recordingChannels{
+		mu:        sync.Mutex{},
+		layout:    layout,
+		clients:   make([]*recordingClient, 0),
+		overrides: make(map[string]int),
+	}
+}
+
+func (c *recordingChannels) SetLayout(layout recorder.ChannelLayoutConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.layout = layout
+}
+
+// SetChannel places the client in the channel regardless of the layout
+func (c *recordingChannels) SetChannel(clientID string, channel int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.overrides[clientID] = channel
+}
+
+// AddTrack adds the recorded track of the client, the client metadata is updated with the latest values
+func (c *recordingChannels) AddTrack(client *Client, trackID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idx := slices.IndexFunc(c.clients, func(rc *recordingClient) bool { return rc.id == client.ID() })
+	if idx == -1 {
+		c.clients = append(c.clients, &recordingClient{id: client.ID()})
+		idx = len(c.clients) - 1
+	}
+
+	rc := c.clients[idx]
+	rc.name = client.Name()
+	rc.role = client.options.RecordingRole
+	rc.channel = client.options.Channel
+
+	if !slices.Contains(rc.trackIDs, trackID) {
+		rc.trackIDs = append(rc.trackIDs, trackID)
+	}
+}
+
+// StopConfig sets the channels of the recorded tracks and the client metadata to the stop config
+func (c *recordingChannels) StopConfig(stopConfig recorder.StopConfig) recorder.StopConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	layout := c.layout.Layout
+	if layout == "" {
+		layout = recorder.ChannelLayoutStereo
+	}
+
+	// the roles without a configured channel get the next channels
+	roleChannels := make(map[string]int)
+	nextRoleChannel := 1
+
+	for role, channel := range c.layout.RoleChannels {
+		roleChannels[role] = channel
+		nextRoleChannel = max(nextRoleChannel, channel+1)
+	}
+
+	stopConfig.ChannelConfig = make(recorder.ChannelConfig)
+	stopConfig.ChannelLayout = layout
+	stopConfig.Channels = 0
+	stopConfig.Clients = make([]recorder.ChannelClient, 0, len(c.clients))
+
+	for i, rc := range c.clients {
+		var channel int
+
+		switch layout {
+		case recorder.ChannelLayoutParticipant:
+			channel = i + 1
+		case recorder.ChannelLayoutRole:
+			if _, ok := roleChannels[rc.role]; !ok {
+				roleChannels[rc.role] = nextRoleChannel
+				nextRoleChannel++
+			}
+
+			channel = roleChannels[rc.role]
+		case recorder.ChannelLayoutMono:
+			channel = 1
+		default:
+			channel = int(rc.channel)
+		}
+
+		if override, ok := c.overrides[rc.id]; ok {
+			channel = override
+		}
+
+		for _, trackID := range rc.trackIDs {
+			stopConfig.ChannelConfig[trackID] = channel
+		}
+
+		stopConfig.Channels = max(stopConfig.Channels, channel)
+		stopConfig.Clients = append(stopConfig.Clients, recorder.ChannelClient{
+			ClientID: rc.id,
+			Name:     rc.name,
+			Role:     rc.role,
+			Channel:  channel,
+			TrackIDs: slices.Clone(rc.trackIDs),
+		})
+	}
+
+	if layout == recorder.ChannelLayoutStereo {
+		// the clients without a channel are not in the stereo recording
+		stopConfig.Channels = max(stopConfig.Channels, 2)
+	}
+
+	return stopConfig
+}
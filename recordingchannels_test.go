@@ -0,0 +1,63 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/samespace/sfu/recorder"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingChannels(t *testing.T) {
+	t.Parallel()
+
+	clients := []*Client{
+		{id: "agent1", name: "Agent 1", options: ClientOptions{Channel: recorder.LeftChannel, RecordingRole: "agent"}},
+		{id: "customer", name: "Customer", options: ClientOptions{Channel: recorder.RightChannel, RecordingRole: "customer"}},
+		{id: "agent2", name: "Agent 2", options: ClientOptions{Channel: recorder.LeftChannel, RecordingRole: "agent"}},
+		{id: "supervisor", name: "Supervisor", options: ClientOptions{RecordingRole: "supervisor"}},
+	}
+
+	channels := newRecordingChannels(recorder.ChannelLayoutConfig{})
+	for _, client := range clients {
+		channels.AddTrack(client, client.id+"-audio")
+	}
+
+	channels.AddTrack(clients[0], "agent1-video")
+	channels.AddTrack(clients[0], "agent1-audio")
+
+	channelsOf := func(stopConfig recorder.StopConfig) []int {
+		result := make([]int, 0, len(stopConfig.Clients))
+		for _, client := range stopConfig.Clients {
+			result = append(result, client.Channel)
+		}
+		return result
+	}
+
+	stopConfig := channels.StopConfig(recorder.StopConfig{})
+	require.Equal(t, recorder.ChannelLayoutStereo, stopConfig.ChannelLayout)
+	require.Equal(t, 2, stopConfig.Channels)
+	require.Equal(t, []int{1, 2, 1, 0}, channelsOf(stopConfig))
+	require.Equal(t, []string{"agent1-audio", "agent1-video"}, stopConfig.Clients[0].TrackIDs)
+	require.Equal(t, "Agent 1", stopConfig.Clients[0].Name)
+	require.Equal(t, 1, stopConfig.ChannelConfig["agent1-video"])
+
+	channels.SetLayout(recorder.ChannelLayoutConfig{Layout: recorder.ChannelLayoutParticipant})
+	stopConfig = channels.StopConfig(recorder.StopConfig{})
+	require.Equal(t, 4, stopConfig.Channels)
+	require.Equal(t, []int{1, 2, 3, 4}, channelsOf(stopConfig))
+
+	channels.SetLayout(recorder.ChannelLayoutConfig{
+		Layout:       recorder.ChannelLayoutRole,
+		RoleChannels: map[string]int{"customer": 1},
+	})
+	stopConfig = channels.StopConfig(recorder.StopConfig{})
+	require.Equal(t, 3, stopConfig.Channels)
+	require.Equal(t, []int{2, 1, 2, 3}, channelsOf(stopConfig))
+
+	channels.SetLayout(recorder.ChannelLayoutConfig{Layout: recorder.ChannelLayoutMono})
+	channels.SetChannel("supervisor", 2)
+	stopConfig = channels.StopConfig(recorder.StopConfig{})
+	require.Equal(t, 2, stopConfig.Channels)
+	require.Equal(t, []int{1, 1, 1, 2}, channelsOf(stopConfig))
+	require.Equal(t, 2, stopConfig.ChannelConfig["supervisor-audio"])
+}
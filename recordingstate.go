@@ -0,0 +1,123 @@
+package sfu
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	RecordingTargetRecorder = "recorder"
+	RecordingTargetLocal    = "local"
+)
+
+// RecordingState is the state of the room recording, it's sent to the clients on the internal data channel
+// as a recording message when the recording is started, paused, continued, rotated or stopped,
+// and to the clients that join while the room is recorded.
+type RecordingState struct {
+	Recording bool      `json:"recording"`
+	Paused    bool      `json:"paused"`
+	StartedAt time.Time `json:"started_at"`
+	// The total paused duration until the state is taken, including the current pause
+	PausedDuration time.Duration     `json:"paused_duration_ns"`
+	Pauses         []RecordingPause  `json:"pauses"`
+	Targets        []RecordingTarget `json:"targets"`
+}
+
+// RecordingPause is a paused period of the recording, the end is zero while it's paused
+type RecordingPause struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// RecordingTarget is where the recording is written
+type RecordingTarget struct {
+	// RecordingTargetRecorder or RecordingTargetLocal
+	Type       string `json:"type"`
+	BucketName string `json:"bucket_name"`
+	// The file name of the current segment
+	FileName string `json:"file_name"`
+}
+
+type internalDataRecording struct {
+	Type string         `json:"type"`
+	Data RecordingState `json:"data"`
+}
+
+// snapshot returns a copy of the state with the paused duration at the time
+func (s RecordingState) snapshot(now time.Time) RecordingState {
+	s.Pauses = slices.Clone(s.Pauses)
+	s.Targets = slices.Clone(s.Targets)
+	s.PausedDuration = 0
+
+	for _, pause := range s.Pauses {
+		end := pause.End
+		if end.IsZero() {
+			end = now
+		}
+
+		s.PausedDuration += end.Sub(pause.Start)
+	}
+
+	return s
+}
+
+// RecordingState returns the state of the room recording
+func (r *Room) RecordingState() RecordingState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.recordingState.snapshot(time.Now())
+}
+
+// updateRecordingState changes the recording state and sends it to the clients
+func (r *Room) updateRecordingState(update func(state *RecordingState, now time.Time)) {
+	now := time.Now()
+
+	r.mu.Lock()
+	update(&r.recordingState, now)
+	state := r.recordingState.snapshot(now)
+	r.mu.Unlock()
+
+	for _, client := range r.sfu.clients.GetClients() {
+		client.sendRecordingState(state)
+	}
+}
+
+// sendRecordingState sends the recording state on the internal data channel, or when the data channel is opened
+func (c *Client) sendRecordingState(state RecordingState) {
+	c.mu.Lock()
+	c.recordingState = &state
+	dc := c.internalDataChannel
+	c.mu.Unlock()
+
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	data, err := json.Marshal(internalDataRecording{
+		Type: messageTypeRecording,
+		Data: state,
+	})
+	if err != nil {
+		c.log.Errorf("client: error marshal recording state ", err)
+		return
+	}
+
+	if err := dc.SendText(string(data)); err != nil {
+		c.log.Errorf("client: error send recording state ", err)
+	}
+}
+
+// sendPendingRecordingState sends the latest recording state when the internal data channel is opened
+func (c *Client) sendPendingRecordingState() {
+	c.mu.Lock()
+	state := c.recordingState
+	c.mu.Unlock()
+
+	if state != nil {
+		c.sendRecordingState(*state)
+	}
+}
@@ -0,0 +1,1276 @@
+package sfu
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/quic-go/quic-go"
+)
+
+// The relay connects the rooms with the same ID on different nodes over QUIC. Each relayed track is a bidirectional
+// stream: the origin node sends the track config and the layer configs, and the node that receives the track sends
+// the keyframe requests and the NACKs of the lost packets back. The RTP packets are sent as datagrams with the ID
+// of the stream and the layer, a packet that doesn't fit in a datagram is sent on the stream.
+//
+// The frames of the stream are a type byte and a big endian uint16 length followed by the data.
+const (
+	relayALPN = "samespace-relay"
+
+	relayFrameHeaderSize    = 3
+	relayDatagramHeaderSize = 5
+	// the number of the sent packets of a layer that can be retransmitted
+	relayRetransmitBuffer = 512
+	relaySendBuffer       = 512
+	relayReceiveBuffer    = 512
+	// the maximum number of the packets that are requested with a NACK
+	relayMaxNACK     = 64
+	relayAcceptWait  = 5 * time.Second
+	relayKeepAlive   = 5 * time.Second
+	relayLayerSingle = 0
+)
+
+type relayFrameType uint8
+
+const (
+	// the track config from the origin
+	relayFrameConfig relayFrameType = 1
+	// the answer of the track config, with the error when the track is rejected
+	relayFrameAccept relayFrameType = 2
+	// a new layer of the track from the origin, sent before the first packet of the layer
+	relayFrameLayer relayFrameType = 3
+	// a packet from the origin that doesn't fit in a datagram
+	relayFrameRTP relayFrameType = 4
+	// a keyframe request of a layer
+	relayFramePLI relayFrameType = 5
+	// the sequence numbers of the lost packets of a layer
+	relayFrameNACK relayFrameType = 6
+)
+
+var (
+	ErrRelayMissingCert = errors.New("relay: missing certificate, key or CA file")
+	ErrRelayInsecureTLS = errors.New("relay: the TLS config must verify the certificates of the nodes")
+	ErrRelayClosed      = errors.New("relay: relay is closed")
+	ErrRelayRejected    = errors.New("relay: track is rejected by the node")
+	ErrRelayInvalidData = errors.New("relay: invalid frame")
+)
+
+type RelayConfig struct {
+	// The UDP address of the QUIC listener, like ":4433" or "127.0.0.1:0" for a free port
+	Address string
+	// The certificate of the node, it's used as the server and the client certificate so it must be valid for both
+	CertFile string
+	KeyFile  string
+	// The CA certificate that signs the certificates of the nodes, the nodes verify the certificates of each other with it
+	CAFile string
+	// The TLS config that is used instead of the files, it must require and verify the client certificates
+	TLSConfig *tls.Config
+}
+
+type RelayStats struct {
+	PacketsSent          uint64 `json:"packets_sent"`
+	PacketsReceived      uint64 `json:"packets_received"`
+	PacketsDropped       uint64 `json:"packets_dropped"`
+	PacketsRetransmitted uint64 `json:"packets_retransmitted"`
+	NACKsSent            uint64 `json:"nacks_sent"`
+	NACKsReceived        uint64 `json:"nacks_received"`
+	PLIsSent             uint64 `json:"plis_sent"`
+	PLIsReceived         uint64 `json:"plis_received"`
+}
+
+type relayTrackConfig struct {
+	ID         uint32    `json:"id"`
+	RoomID     string    `json:"room_id"`
+	TrackID    string    `json:"track_id"`
+	StreamID   string    `json:"stream_id"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Kind       string    `json:"kind"`
+	MimeType   string    `json:"mime_type"`
+	SourceType TrackType `json:"source_type"`
+}
+
+type relayLayerConfig struct {
+	Layer uint8  `json:"layer"`
+	RID   string `json:"rid"`
+	SSRC  uint32 `json:"ssrc"`
+}
+
+type relayAccept struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Relay listens for the QUIC connections of the other nodes and connects to them. A room spans the nodes when
+// RelayConnection.RelayRoom is called on both sides of a connection with the ID of a room that exists on both nodes.
+type Relay struct {
+	mu           sync.Mutex
+	manager      *Manager
+	context      context.Context
+	cancel       context.CancelFunc
+	listener     *quic.Listener
+	tlsConfig    *tls.Config
+	connections  map[*RelayConnection]bool
+	onConnection []func(*RelayConnection)
+	wg           sync.WaitGroup
+	log          logging.LeveledLogger
+}
+
+// relayTLSConfig returns a mutual TLS config, a node only accepts the connections of the nodes with a certificate
+// that is signed by the CA
+func relayTLSConfig(config RelayConfig) (*tls.Config, error) {
+	if config.TLSConfig != nil {
+		if config.TLSConfig.InsecureSkipVerify || config.TLSConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+			return nil, ErrRelayInsecureTLS
+		}
+
+		tlsConfig := config.TLSConfig.Clone()
+		tlsConfig.NextProtos = []string{relayALPN}
+
+		return tlsConfig, nil
+	}
+
+	if config.CertFile == "" || config.KeyFile == "" || config.CAFile == "" {
+		return nil, ErrRelayMissingCert
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("relay: failed to load the certificate: %w", err)
+	}
+
+	ca, err := os.ReadFile(config.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("relay: failed to load the CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("relay: failed to load the CA certificate: %s", config.CAFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{relayALPN},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+func relayQuicConfig() *quic.Config {
+	return &quic.Config{
+		EnableDatagrams: true,
+		KeepAlivePeriod: relayKeepAlive,
+	}
+}
+
+// StartRelay listens for the relay connections of the other nodes until the relay or the manager is closed
+func (m *Manager) StartRelay(config RelayConfig) (*Relay, error) {
+	tlsConfig, err := relayTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := quic.ListenAddr(config.Address, tlsConfig, relayQuicConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(m.context)
+
+	relay := &Relay{
+		mu:          sync.Mutex{},
+		manager:     m,
+		context:     ctx,
+		cancel:      cancel,
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+		connections: make(map[*RelayConnection]bool),
+		log:         m.log,
+	}
+
+	relay.wg.Add(1)
+	go relay.accept()
+
+	go func() {
+		<-ctx.Done()
+		_ = relay.Close()
+	}()
+
+	return relay, nil
+}
+
+// Addr returns the listening address of the relay
+func (r *Relay) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// OnConnection is called when a node connects to the relay
+func (r *Relay) OnConnection(callback func(*RelayConnection)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onConnection = append(r.onConnection, callback)
+}
+
+// Connect connects to the relay of another node
+func (r *Relay) Connect(ctx context.Context, address string) (*RelayConnection, error) {
+	if r.context.Err() != nil {
+		return nil, ErrRelayClosed
+	}
+
+	conn, err := quic.DialAddr(ctx, address, r.tlsConfig, relayQuicConfig())
+	if err != nil {
+		return nil, fmt.Errorf("relay: failed to connect to %s: %w", address, err)
+	}
+
+	return r.addConnection(conn), nil
+}
+
+// Connections returns the connections from and to the other nodes
+func (r *Relay) Connections() []*RelayConnection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	connections := make([]*RelayConnection, 0, len(r.connections))
+	for c := range r.connections {
+		connections = append(connections, c)
+	}
+
+	return connections
+}
+
+// Close closes the listener and the connections, the relayed tracks are ended on both nodes
+func (r *Relay) Close() error {
+	r.cancel()
+
+	err := r.listener.Close()
+
+	for _, c := range r.Connections() {
+		_ = c.Close()
+	}
+
+	r.wg.Wait()
+
+	if errors.Is(err, quic.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (r *Relay) accept() {
+	defer r.wg.Done()
+
+	for {
+		conn, err := r.listener.Accept(r.context)
+		if err != nil {
+			return
+		}
+
+		c := r.addConnection(conn)
+
+		r.mu.Lock()
+		callbacks := r.onConnection
+		r.mu.Unlock()
+
+		for _, callback := range callbacks {
+			callback(c)
+		}
+	}
+}
+
+func (r *Relay) addConnection(conn quic.Connection) *RelayConnection {
+	ctx, cancel := context.WithCancel(r.context)
+
+	c := &RelayConnection{
+		mu:         sync.Mutex{},
+		relay:      r,
+		conn:       conn,
+		context:    ctx,
+		cancel:     cancel,
+		senders:    make(map[uint32]*relaySender),
+		receivers:  make(map[uint32]*relayReceiver),
+		publishers: make(map[string]*relayPublisher),
+	}
+
+	r.mu.Lock()
+	r.connections[c] = true
+	r.mu.Unlock()
+
+	c.wg.Add(3)
+	go c.acceptStreams()
+	go c.readDatagrams()
+
+	go func() {
+		defer c.wg.Done()
+
+		select {
+		case <-ctx.Done():
+		case <-conn.Context().Done():
+		}
+
+		c.close()
+	}()
+
+	return c
+}
+
+func (r *Relay) removeConnection(c *RelayConnection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.connections, c)
+}
+
+// RelayConnection is a connection between two nodes, both nodes can relay the tracks of their rooms to the other node
+type RelayConnection struct {
+	mu         sync.Mutex
+	relay      *Relay
+	conn       quic.Connection
+	context    context.Context
+	cancel     context.CancelFunc
+	nextID     atomic.Uint32
+	senders    map[uint32]*relaySender
+	receivers  map[uint32]*relayReceiver
+	publishers map[string]*relayPublisher
+	wg         sync.WaitGroup
+	stats      relayConnectionStats
+	callbacks  []*TrackCallback
+}
+
+type relayConnectionStats struct {
+	packetsSent          atomic.Uint64
+	packetsReceived      atomic.Uint64
+	packetsDropped       atomic.Uint64
+	packetsRetransmitted atomic.Uint64
+	nacksSent            atomic.Uint64
+	nacksReceived        atomic.Uint64
+	plisSent             atomic.Uint64
+	plisReceived         atomic.Uint64
+}
+
+// relayPublisher is the virtual publisher of the relayed tracks of a remote client
+type relayPublisher struct {
+	publisher *VirtualPublisher
+	tracks    int
+}
+
+// RemoteAddr returns the address of the other node
+func (c *RelayConnection) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *RelayConnection) Stats() RelayStats {
+	return RelayStats{
+		PacketsSent:          c.stats.packetsSent.Load(),
+		PacketsReceived:      c.stats.packetsReceived.Load(),
+		PacketsDropped:       c.stats.packetsDropped.Load(),
+		PacketsRetransmitted: c.stats.packetsRetransmitted.Load(),
+		NACKsSent:            c.stats.nacksSent.Load(),
+		NACKsReceived:        c.stats.nacksReceived.Load(),
+		PLIsSent:             c.stats.plisSent.Load(),
+		PLIsReceived:         c.stats.plisReceived.Load(),
+	}
+}
+
+// Close closes the connection, the relayed tracks are ended on both nodes
+func (c *RelayConnection) Close() error {
+	c.cancel()
+	c.wg.Wait()
+
+	return nil
+}
+
+func (c *RelayConnection) close() {
+	c.cancel()
+
+	_ = c.conn.CloseWithError(0, "closed")
+
+	c.mu.Lock()
+	callbacks := c.callbacks
+	c.callbacks = nil
+
+	senders := make([]*relaySender, 0, len(c.senders))
+	for _, sender := range c.senders {
+		senders = append(senders, sender)
+	}
+
+	receivers := make([]*relayReceiver, 0, len(c.receivers))
+	for _, receiver := range c.receivers {
+		receivers = append(receivers, receiver)
+	}
+	c.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback.Remove()
+	}
+
+	for _, sender := range senders {
+		sender.close()
+	}
+
+	for _, receiver := range receivers {
+		receiver.close()
+	}
+
+	c.relay.removeConnection(c)
+}
+
+// RelayRoom relays the tracks of the clients of the room to the room with the same ID on the other node, the current
+// tracks and the tracks that are published later until the connection is closed. The relay tracks, like the tracks
+// that are relayed from the other node, are not relayed again so the tracks don't loop between the nodes.
+func (c *RelayConnection) RelayRoom(roomID string) error {
+	room, err := c.relay.manager.GetRoom(roomID)
+	if err != nil {
+		return err
+	}
+
+	callback := room.sfu.OnTracksAvailable(func(tracks []ITrack) {
+		if c.context.Err() != nil {
+			return
+		}
+
+		// the callback is called while the tracks are published, the track config is sent in the background
+		go c.relayTracks(room, tracks)
+	})
+
+	c.mu.Lock()
+	closed := c.context.Err() != nil
+	if !closed {
+		c.callbacks = append(c.callbacks, callback)
+	}
+	c.mu.Unlock()
+
+	if closed {
+		callback.Remove()
+		return ErrRelayClosed
+	}
+
+	tracks := make([]ITrack, 0)
+	for _, client := range room.sfu.clients.GetClients() {
+		tracks = append(tracks, client.announcedTracks()...)
+	}
+
+	c.relayTracks(room, tracks)
+
+	return nil
+}
+
+func (c *RelayConnection) relayTracks(room *Room, tracks []ITrack) {
+	for _, track := range tracks {
+		if track.IsRelay() {
+			continue
+		}
+
+		if client, err := room.sfu.GetClient(track.ClientID()); err != nil || client.IsHidden() {
+			continue
+		}
+
+		if err := c.PublishTrack(room.ID(), track.ID()); err != nil && !errors.Is(err, ErrTrackExists) {
+			c.relay.log.Errorf("relay: failed to relay track %s of room %s: %s", track.ID(), room.ID(), err.Error())
+		}
+	}
+}
+
+// PublishTrack relays a track of the room to the room with the same ID on the other node until the track is ended,
+// the room is closed on one of the nodes or the connection is closed. The clients of the other node see the track
+// as a relay track of a virtual publisher with the ID and the name of the client of the track.
+func (c *RelayConnection) PublishTrack(roomID, trackID string) error {
+	room, err := c.relay.manager.GetRoom(roomID)
+	if err != nil {
+		return err
+	}
+
+	track, err := room.sfu.getTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	for _, sender := range c.senders {
+		if sender.config.RoomID == roomID && sender.config.TrackID == trackID {
+			c.mu.Unlock()
+			return ErrTrackExists
+		}
+	}
+	c.mu.Unlock()
+
+	config := relayTrackConfig{
+		ID:         c.nextID.Add(1),
+		RoomID:     roomID,
+		TrackID:    track.ID(),
+		StreamID:   track.StreamID(),
+		ClientID:   track.ClientID(),
+		Kind:       track.Kind().String(),
+		MimeType:   track.MimeType(),
+		SourceType: track.SourceType(),
+	}
+
+	if client, err := room.sfu.GetClient(track.ClientID()); err == nil {
+		config.ClientName = client.Name()
+	}
+
+	stream, err := c.conn.OpenStreamSync(c.context)
+	if err != nil {
+		return err
+	}
+
+	if err := writeRelayJSON(stream, relayFrameConfig, config); err != nil {
+		stream.CancelRead(0)
+		stream.CancelWrite(0)
+
+		return err
+	}
+
+	accept := relayAccept{}
+
+	_ = stream.SetReadDeadline(time.Now().Add(relayAcceptWait))
+
+	frameType, data, err := readRelayFrame(stream)
+	if err == nil && frameType != relayFrameAccept {
+		err = ErrRelayInvalidData
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &accept)
+	}
+
+	if err == nil && accept.Error != "" {
+		err = fmt.Errorf("%w: %s", ErrRelayRejected, accept.Error)
+	}
+
+	if err != nil {
+		stream.CancelRead(0)
+		stream.CancelWrite(0)
+
+		return err
+	}
+
+	_ = stream.SetReadDeadline(time.Time{})
+
+	sender := newRelaySender(c, config, stream, track)
+
+	c.mu.Lock()
+	c.senders[config.ID] = sender
+	c.mu.Unlock()
+
+	if c.context.Err() != nil {
+		sender.close()
+		return ErrRelayClosed
+	}
+
+	if !track.IsSimulcast() {
+		// the track is published on the other node before the first packet
+		sender.mu.Lock()
+		sender.addLayer(relayLayerSingle)
+		sender.mu.Unlock()
+	}
+
+	callbacks := []*TrackCallback{
+		track.OnRead(sender.onRead),
+		track.OnEnded(sender.close),
+	}
+
+	sender.mu.Lock()
+	closed := sender.closed
+	if !closed {
+		sender.callbacks = callbacks
+	}
+	sender.mu.Unlock()
+
+	// the sender is closed with the connection or the stream while the callbacks are added
+	if closed {
+		for _, callback := range callbacks {
+			callback.Remove()
+		}
+
+		return ErrRelayClosed
+	}
+
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		sender.requestKeyframe(relayLayerSingle)
+	}
+
+	return nil
+}
+
+func (c *RelayConnection) removeSender(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.senders, id)
+}
+
+func (c *RelayConnection) removeReceiver(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.receivers, id)
+}
+
+func (c *RelayConnection) acceptStreams() {
+	defer c.wg.Done()
+
+	for {
+		stream, err := c.conn.AcceptStream(c.context)
+		if err != nil {
+			return
+		}
+
+		go c.receiveTrack(stream)
+	}
+}
+
+func (c *RelayConnection) readDatagrams() {
+	defer c.wg.Done()
+
+	for {
+		data, err := c.conn.ReceiveDatagram(c.context)
+		if err != nil {
+			return
+		}
+
+		if len(data) <= relayDatagramHeaderSize {
+			continue
+		}
+
+		c.mu.Lock()
+		receiver := c.receivers[binary.BigEndian.Uint32(data)]
+		c.mu.Unlock()
+
+		if receiver != nil {
+			receiver.onPacket(data[4], data[relayDatagramHeaderSize:])
+		}
+	}
+}
+
+// receiveTrack publishes the track of the stream in the room until the stream is closed by the origin
+func (c *RelayConnection) receiveTrack(stream quic.Stream) {
+	_ = stream.SetReadDeadline(time.Now().Add(relayAcceptWait))
+
+	frameType, data, err := readRelayFrame(stream)
+	if err == nil && frameType != relayFrameConfig {
+		err = ErrRelayInvalidData
+	}
+
+	config := relayTrackConfig{}
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+	}
+
+	if err != nil {
+		stream.CancelRead(0)
+		stream.CancelWrite(0)
+
+		return
+	}
+
+	_ = stream.SetReadDeadline(time.Time{})
+
+	receiver, err := c.newReceiver(config, stream)
+	if err != nil {
+		_ = writeRelayJSON(stream, relayFrameAccept, relayAccept{Error: err.Error()})
+		_ = stream.Close()
+		stream.CancelRead(0)
+
+		return
+	}
+
+	if err := writeRelayJSON(stream, relayFrameAccept, relayAccept{}); err != nil {
+		receiver.close()
+		return
+	}
+
+	receiver.readFrames()
+}
+
+func (c *RelayConnection) newReceiver(config relayTrackConfig, stream quic.Stream) (*relayReceiver, error) {
+	room, err := c.relay.manager.GetRoom(config.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := room.sfu.getTrack(config.TrackID); err == nil {
+		return nil, ErrTrackExists
+	}
+
+	publisher, err := c.addPublisher(room, config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(publisher.Client().Context())
+
+	receiver := &relayReceiver{
+		mu:         sync.Mutex{},
+		connection: c,
+		context:    ctx,
+		cancel:     cancel,
+		config:     config,
+		stream:     stream,
+		room:       room,
+		publisher:  publisher,
+		kind:       webrtc.NewRTPCodecType(config.Kind),
+		layers:     make(map[uint8]*relayReceiverLayer),
+	}
+
+	c.mu.Lock()
+	c.receivers[config.ID] = receiver
+	c.mu.Unlock()
+
+	// the track is ended when the room or the connection is closed
+	go func() {
+		<-ctx.Done()
+		receiver.close()
+	}()
+
+	return receiver, nil
+}
+
+// addPublisher returns the virtual publisher of the client of the track, the publisher is closed with its last track
+func (c *RelayConnection) addPublisher(room *Room, config relayTrackConfig) (*VirtualPublisher, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := room.ID() + "/" + config.ClientID
+
+	if p, ok := c.publishers[key]; ok {
+		p.tracks++
+		return p.publisher, nil
+	}
+
+	publisher, err := room.AddVirtualPublisher(config.ClientID, VirtualPublisherOptions{Name: config.ClientName})
+	if err != nil {
+		return nil, err
+	}
+
+	c.publishers[key] = &relayPublisher{publisher: publisher, tracks: 1}
+
+	return publisher, nil
+}
+
+func (c *RelayConnection) removePublisher(room *Room, clientID string) {
+	c.mu.Lock()
+
+	key := room.ID() + "/" + clientID
+
+	p, ok := c.publishers[key]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+
+	p.tracks--
+	if p.tracks > 0 {
+		c.mu.Unlock()
+		return
+	}
+
+	delete(c.publishers, key)
+	c.mu.Unlock()
+
+	_ = p.publisher.Close()
+}
+
+type relayOutgoing struct {
+	frameType relayFrameType
+	data      []byte
+}
+
+// relaySender sends the packets of a track to the other node and keeps the last packets of each layer for the NACKs
+type relaySender struct {
+	mu         sync.Mutex
+	connection *RelayConnection
+	config     relayTrackConfig
+	context    context.Context
+	cancel     context.CancelFunc
+	stream     quic.Stream
+	track      ITrack
+	queue      chan relayOutgoing
+	layers     map[uint8]*relaySenderLayer
+	closed     bool
+	callbacks  []*TrackCallback
+}
+
+type relaySenderLayer struct {
+	packets [relayRetransmitBuffer][]byte
+}
+
+func newRelaySender(c *RelayConnection, config relayTrackConfig, stream quic.Stream, track ITrack) *relaySender {
+	ctx, cancel := context.WithCancel(c.context)
+
+	sender := &relaySender{
+		mu:         sync.Mutex{},
+		connection: c,
+		config:     config,
+		context:    ctx,
+		cancel:     cancel,
+		stream:     stream,
+		track:      track,
+		queue:      make(chan relayOutgoing, relaySendBuffer),
+		layers:     make(map[uint8]*relaySenderLayer),
+	}
+
+	go sender.write()
+	go sender.readFeedback()
+
+	return sender
+}
+
+func (s *relaySender) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	s.closed = true
+	callbacks := s.callbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback.Remove()
+	}
+
+	// the stream is closed by the writer
+	s.cancel()
+	s.stream.CancelRead(0)
+
+	s.connection.removeSender(s.config.ID)
+}
+
+func (s *relaySender) onRead(p *rtp.Packet, quality QualityLevel) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed {
+		return
+	}
+
+	layer := uint8(relayLayerSingle)
+	if s.track.IsSimulcast() {
+		layer = uint8(quality)
+	}
+
+	header := p.Header
+	// the header extensions are negotiated with the publisher, the subscribers of the other node don't know them
+	header.Extension = false
+	header.Extensions = nil
+
+	packet := &rtp.Packet{Header: header, Payload: p.Payload}
+
+	data, err := packet.Marshal()
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	l := s.addLayer(layer)
+	if l == nil {
+		s.mu.Unlock()
+		return
+	}
+
+	l.packets[p.SequenceNumber%relayRetransmitBuffer] = data
+	s.mu.Unlock()
+
+	if s.send(relayOutgoing{data: relayDatagram(s.config.ID, layer, data)}) {
+		s.connection.stats.packetsSent.Add(1)
+	}
+}
+
+// addLayer returns the layer and sends the layer config before the first packet of the layer, it's called with the lock
+func (s *relaySender) addLayer(layer uint8) *relaySenderLayer {
+	if s.closed {
+		return nil
+	}
+
+	if l, ok := s.layers[layer]; ok {
+		return l
+	}
+
+	layerConfig, err := json.Marshal(s.layerConfig(layer))
+	if err != nil {
+		return nil
+	}
+
+	// the layer is added again with the next packet when the queue is full
+	if !s.send(relayOutgoing{frameType: relayFrameLayer, data: layerConfig}) {
+		return nil
+	}
+
+	l := &relaySenderLayer{}
+	s.layers[layer] = l
+
+	return l
+}
+
+// send queues the frame or the datagram to the writer, the packets are dropped when the connection is too slow
+func (s *relaySender) send(outgoing relayOutgoing) bool {
+	select {
+	case s.queue <- outgoing:
+		return true
+	default:
+		s.connection.stats.packetsDropped.Add(1)
+		return false
+	}
+}
+
+func (s *relaySender) layerConfig(layer uint8) relayLayerConfig {
+	config := relayLayerConfig{Layer: layer}
+
+	switch track := s.track.(type) {
+	case *Track:
+		config.SSRC = uint32(track.SSRC())
+	case *SimulcastTrack:
+		switch QualityLevel(layer) {
+		case QualityHigh:
+			config.RID, config.SSRC = track.RIDHigh(), uint32(track.SSRCHigh())
+		case QualityMid:
+			config.RID, config.SSRC = track.RIDMid(), uint32(track.SSRCMid())
+		case QualityLow:
+			config.RID, config.SSRC = track.RIDLow(), uint32(track.SSRCLow())
+		}
+	}
+
+	return config
+}
+
+// write sends the datagrams and the frames in the order they're queued, and closes the stream when the sender is closed
+func (s *relaySender) write() {
+	defer func() {
+		_ = s.stream.Close()
+	}()
+
+	for {
+		select {
+		case <-s.context.Done():
+			return
+		case outgoing := <-s.queue:
+			if outgoing.frameType != 0 {
+				if err := writeRelayFrame(s.stream, outgoing.frameType, outgoing.data); err != nil {
+					go s.close()
+					return
+				}
+
+				continue
+			}
+
+			err := s.connection.conn.SendDatagram(outgoing.data)
+
+			var tooLarge *quic.DatagramTooLargeError
+			if errors.As(err, &tooLarge) {
+				// the datagram header is replaced with the layer
+				frame := outgoing.data[relayDatagramHeaderSize-1:]
+				err = writeRelayFrame(s.stream, relayFrameRTP, frame)
+			}
+
+			if err != nil {
+				go s.close()
+				return
+			}
+		}
+	}
+}
+
+// readFeedback reads the keyframe requests and the NACKs of the other node until the stream is closed
+func (s *relaySender) readFeedback() {
+	defer s.close()
+
+	for {
+		frameType, data, err := readRelayFrame(s.stream)
+		if err != nil || len(data) == 0 {
+			return
+		}
+
+		switch frameType {
+		case relayFramePLI:
+			s.connection.stats.plisReceived.Add(1)
+			s.requestKeyframe(data[0])
+		case relayFrameNACK:
+			s.connection.stats.nacksReceived.Add(1)
+			s.retransmit(data[0], data[1:])
+		}
+	}
+}
+
+func (s *relaySender) requestKeyframe(layer uint8) {
+	switch track := s.track.(type) {
+	case *Track:
+		track.remoteTrack.sendPLI()
+	case *SimulcastTrack:
+		quality := QualityLevel(layer)
+		if layer == relayLayerSingle {
+			quality = QualityHigh
+		}
+
+		if remoteTrack := track.getRemoteTrack(quality); remoteTrack != nil {
+			remoteTrack.sendPLI()
+		}
+	}
+}
+
+// retransmit sends the requested packets of the layer again if they're still kept
+func (s *relaySender) retransmit(layer uint8, sequences []byte) {
+	for i := 0; i+1 < len(sequences); i += 2 {
+		sequence := binary.BigEndian.Uint16(sequences[i:])
+
+		s.mu.Lock()
+		var data []byte
+		if l, ok := s.layers[layer]; ok {
+			data = l.packets[sequence%relayRetransmitBuffer]
+		}
+		s.mu.Unlock()
+
+		// the slot can be taken by a newer packet
+		if len(data) < 4 || binary.BigEndian.Uint16(data[2:]) != sequence {
+			continue
+		}
+
+		if s.send(relayOutgoing{data: relayDatagram(s.config.ID, layer, data)}) {
+			s.connection.stats.packetsRetransmitted.Add(1)
+		}
+	}
+}
+
+// relayReceiver publishes the layers of a relayed track as relay tracks and requests the lost packets
+type relayReceiver struct {
+	mu         sync.Mutex
+	writeMu    sync.Mutex
+	connection *RelayConnection
+	context    context.Context
+	cancel     context.CancelFunc
+	config     relayTrackConfig
+	stream     quic.Stream
+	room       *Room
+	publisher  *VirtualPublisher
+	kind       webrtc.RTPCodecType
+	layers     map[uint8]*relayReceiverLayer
+	closed     bool
+}
+
+type relayReceiverLayer struct {
+	rtpChan      chan *rtp.Packet
+	started      bool
+	lastSequence uint16
+}
+
+func (r *relayReceiver) readFrames() {
+	defer r.close()
+
+	for {
+		frameType, data, err := readRelayFrame(r.stream)
+		if err != nil {
+			return
+		}
+
+		switch frameType {
+		case relayFrameLayer:
+			config := relayLayerConfig{}
+			if err := json.Unmarshal(data, &config); err != nil {
+				return
+			}
+
+			if err := r.addLayer(config); err != nil {
+				r.connection.relay.log.Errorf("relay: failed to add layer of track %s: %s", r.config.TrackID, err.Error())
+				return
+			}
+		case relayFrameRTP:
+			if len(data) > 1 {
+				r.onPacket(data[0], data[1:])
+			}
+		}
+	}
+}
+
+func (r *relayReceiver) addLayer(config relayLayerConfig) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRelayClosed
+	}
+
+	if _, ok := r.layers[config.Layer]; ok {
+		r.mu.Unlock()
+		return nil
+	}
+
+	layer := &relayReceiverLayer{rtpChan: make(chan *rtp.Packet, relayReceiveBuffer)}
+	r.layers[config.Layer] = layer
+	r.mu.Unlock()
+
+	onPLI := func() {
+		r.sendFeedback(relayFramePLI, []byte{config.Layer})
+		r.connection.stats.plisSent.Add(1)
+	}
+
+	track, err := r.room.sfu.addRelayTrack(r.context, r.config.TrackID, r.config.StreamID, config.RID, r.publisher.Client(), r.kind, webrtc.SSRC(config.SSRC), r.config.MimeType, layer.rtpChan, onPLI)
+	if err != nil {
+		return err
+	}
+
+	if track != nil && r.config.SourceType != "" {
+		track.SetSourceType(r.config.SourceType)
+	}
+
+	return nil
+}
+
+func (r *relayReceiver) onPacket(layerID uint8, data []byte) {
+	p := &rtp.Packet{}
+	if err := p.Unmarshal(data); err != nil {
+		return
+	}
+
+	// the packets are written with the payload type of the codec in the SFU
+	p.PayloadType = uint8(getPayloadType(r.config.MimeType))
+
+	r.mu.Lock()
+	layer, ok := r.layers[layerID]
+	if !ok || r.closed {
+		r.mu.Unlock()
+		return
+	}
+
+	missing := layer.missingSequences(p.SequenceNumber)
+
+	select {
+	case layer.rtpChan <- p:
+		r.connection.stats.packetsReceived.Add(1)
+	default:
+		r.connection.stats.packetsDropped.Add(1)
+	}
+	r.mu.Unlock()
+
+	if len(missing) > 0 {
+		nack := make([]byte, 1, 1+len(missing)*2)
+		nack[0] = layerID
+
+		for _, sequence := range missing {
+			nack = binary.BigEndian.AppendUint16(nack, sequence)
+		}
+
+		r.sendFeedback(relayFrameNACK, nack)
+		r.connection.stats.nacksSent.Add(1)
+	}
+}
+
+// missingSequences returns the sequence numbers between the last packet and the packet, a late packet is not a gap
+func (l *relayReceiverLayer) missingSequences(sequence uint16) []uint16 {
+	if !l.started {
+		l.started = true
+		l.lastSequence = sequence
+
+		return nil
+	}
+
+	diff := sequence - l.lastSequence
+	if diff == 0 || diff >= 0x8000 {
+		return nil
+	}
+
+	missing := make([]uint16, 0)
+	for s := l.lastSequence + 1; s != sequence && len(missing) < relayMaxNACK; s++ {
+		missing = append(missing, s)
+	}
+
+	l.lastSequence = sequence
+
+	return missing
+}
+
+func (r *relayReceiver) sendFeedback(frameType relayFrameType, data []byte) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	_ = writeRelayFrame(r.stream, frameType, data)
+}
+
+// close ends the relay tracks and tells the origin to stop sending the track
+func (r *relayReceiver) close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+
+	r.closed = true
+
+	// the relay tracks are ended when the channels are closed
+	for _, layer := range r.layers {
+		close(layer.rtpChan)
+	}
+	r.mu.Unlock()
+
+	r.cancel()
+
+	r.writeMu.Lock()
+	_ = r.stream.Close()
+	r.writeMu.Unlock()
+
+	r.stream.CancelRead(0)
+
+	r.connection.removeReceiver(r.config.ID)
+	r.connection.removePublisher(r.room, r.config.ClientID)
+}
+
+func relayDatagram(id uint32, layer uint8, data []byte) []byte {
+	datagram := make([]byte, relayDatagramHeaderSize, relayDatagramHeaderSize+len(data))
+	binary.BigEndian.PutUint32(datagram, id)
+	datagram[4] = layer
+
+	return append(datagram, data...)
+}
+
+func writeRelayFrame(w io.Writer, frameType relayFrameType, data []byte) error {
+	if len(data) > 0xffff {
+		return ErrRelayInvalidData
+	}
+
+	frame := make([]byte, relayFrameHeaderSize, relayFrameHeaderSize+len(data))
+	frame[0] = byte(frameType)
+	binary.BigEndian.PutUint16(frame[1:], uint16(len(data)))
+
+	_, err := w.Write(append(frame, data...))
+
+	return err
+}
+
+func writeRelayJSON(w io.Writer, frameType relayFrameType, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return writeRelayFrame(w, frameType, data)
+}
+
+func readRelayFrame(r io.Reader) (relayFrameType, []byte, error) {
+	header := make([]byte, relayFrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(header[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+
+	return relayFrameType(header[0]), data, nil
+}
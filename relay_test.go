@@ -0,0 +1,251 @@
+package sfu
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRelayTestCerts writes a CA and a node certificate that is signed by the CA for the client and the server auth
+func writeRelayTestCerts(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "relay ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(caDer)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "relay.cert")
+	keyFile := filepath.Join(dir, "relay.key")
+	caFile := filepath.Join(dir, "ca.cert")
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0o600))
+
+	return certFile, keyFile, caFile
+}
+
+func TestRelayRoom(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	certFile, keyFile, caFile := writeRelayTestCerts(t)
+
+	// two nodes in one process with the same room
+	managerA := NewManager(ctx, "node-a", sfuOpts)
+	defer managerA.Close()
+
+	_, err := managerA.StartRelay(RelayConfig{Address: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile})
+	require.ErrorIs(t, err, ErrRelayMissingCert)
+
+	// the nodes must verify the certificates of each other
+	_, err = managerA.StartRelay(RelayConfig{Address: "127.0.0.1:0", TLSConfig: &tls.Config{InsecureSkipVerify: true}})
+	require.ErrorIs(t, err, ErrRelayInsecureTLS)
+
+	managerB := NewManager(ctx, "node-b", sfuOpts)
+	defer managerB.Close()
+
+	roomID := managerA.CreateRoomID()
+
+	roomA, err := managerA.NewRoom(roomID, "relay", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	roomB, err := managerB.NewRoom(roomID, "relay", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	relayA, err := managerA.StartRelay(RelayConfig{Address: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile, CAFile: caFile})
+	require.NoError(t, err)
+	defer relayA.Close()
+
+	relayB, err := managerB.StartRelay(RelayConfig{Address: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile, CAFile: caFile})
+	require.NoError(t, err)
+	defer relayB.Close()
+
+	connectedB := make(chan *RelayConnection, 1)
+	relayB.OnConnection(func(conn *RelayConnection) {
+		// node B relays the room back, the relayed tracks of node A must not loop back
+		if conn.RelayRoom(roomID) == nil {
+			connectedB <- conn
+		}
+	})
+
+	speaker, err := roomA.AddVirtualPublisher("speaker", VirtualPublisherOptions{Name: "keynote"})
+	require.NoError(t, err)
+
+	audio, err := speaker.NewTrack("speaker-audio", "speaker", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	pc, listener, _, _ := CreatePeerPair(ctx, TestLogger, roomB, DefaultTestIceServers(), "listener", true, false)
+	defer pc.PeerConnection.Close()
+
+	require.Eventually(t, func() bool {
+		return listener.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	// a node with a certificate of another CA can't connect
+	otherCert, otherKey, otherCA := writeRelayTestCerts(t)
+
+	managerC := NewManager(ctx, "node-c", sfuOpts)
+	defer managerC.Close()
+
+	relayC, err := managerC.StartRelay(RelayConfig{Address: "127.0.0.1:0", CertFile: otherCert, KeyFile: otherKey, CAFile: otherCA})
+	require.NoError(t, err)
+	defer relayC.Close()
+
+	_, err = relayC.Connect(ctx, relayB.Addr().String())
+	require.Error(t, err)
+
+	connA, err := relayA.Connect(ctx, relayB.Addr().String())
+	require.NoError(t, err)
+
+	sourceTrack, err := roomA.SFU().getTrack("speaker-audio")
+	require.NoError(t, err)
+
+	trackCallbacksBefore := trackCallbacks(sourceTrack)
+	roomCallbacksBefore := sfuTracksAvailableCallbacks(roomA.SFU())
+
+	require.NoError(t, connA.RelayRoom(roomID))
+	require.ErrorIs(t, connA.PublishTrack(roomID, "speaker-audio"), ErrTrackExists)
+
+	connB := <-connectedB
+
+	// the track is published by a virtual publisher with the id and the name of the client on node A
+	require.Eventually(t, func() bool {
+		_, ok := listener.ClientTracks()["speaker-audio"]
+		return ok
+	}, 10*time.Second, 50*time.Millisecond)
+
+	publisher, err := roomB.SFU().GetClient("speaker")
+	require.NoError(t, err)
+	require.Equal(t, "keynote", publisher.Name())
+
+	relayTrack, err := roomB.SFU().getTrack("speaker-audio")
+	require.NoError(t, err)
+	require.True(t, relayTrack.IsRelay())
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			data := []byte{0xf8, 0xff, 0xfe}
+			if i%10 == 0 {
+				// larger than a datagram, it's sent on the stream of the track
+				data = make([]byte, 1400)
+			}
+
+			if audio.WriteSample(media.Sample{Data: data, Duration: 20 * time.Millisecond}) != nil {
+				return
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		return connA.Stats().PacketsSent >= 50 && connB.Stats().PacketsReceived >= 50
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// the relay track of node A on node B is not relayed back, only the tracks of the listener are relayed to node A
+	connB.mu.Lock()
+	relayedClients := make([]string, 0)
+	for _, sender := range connB.senders {
+		relayedClients = append(relayedClients, sender.config.ClientID)
+	}
+	connB.mu.Unlock()
+
+	require.NotEmpty(t, relayedClients)
+
+	for _, clientID := range relayedClients {
+		require.Equal(t, listener.ID(), clientID)
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := roomA.SFU().GetClient(listener.ID())
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// the relayed track ends with the track on node A
+	require.NoError(t, speaker.Close())
+
+	require.Eventually(t, func() bool {
+		_, subscribed := listener.ClientTracks()["speaker-audio"]
+		_, err := roomB.SFU().GetClient("speaker")
+
+		return !subscribed && err == ErrClientNotFound
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// the callbacks of the sender and the room are removed when the track ends and the connection is closed
+	require.Equal(t, trackCallbacksBefore, trackCallbacks(sourceTrack))
+
+	require.NoError(t, connA.Close())
+	require.Equal(t, roomCallbacksBefore, sfuTracksAvailableCallbacks(roomA.SFU()))
+}
+
+// sfuTracksAvailableCallbacks returns the number of the OnTracksAvailable callbacks of the SFU
+func sfuTracksAvailableCallbacks(s *SFU) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.onTrackAvailableCallbacks)
+}
+
+func TestRelayReceiverLayerNACK(t *testing.T) {
+	layer := &relayReceiverLayer{}
+
+	require.Empty(t, layer.missingSequences(65534))
+	require.Empty(t, layer.missingSequences(65535))
+	// the gap wraps around the sequence numbers
+	require.Equal(t, []uint16{0, 1}, layer.missingSequences(2))
+	// a late packet is not a gap
+	require.Empty(t, layer.missingSequences(1))
+	require.Empty(t, layer.missingSequences(3))
+	require.Len(t, layer.missingSequences(1000), relayMaxNACK)
+}
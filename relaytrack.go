@@ -1,7 +1,7 @@
 package sfu
 
 import (
-	"errors"
+	"io"
 	"sync"
 	"time"
 
@@ -37,6 +37,7 @@ type RelayTrack struct {
 	mimeType    string
 	rid         string
 	rtpChan     chan *rtp.Packet
+	deadline    time.Time
 }
 
 func NewTrackRelay(id, streamid, rid string, kind webrtc.RTPCodecType, ssrc webrtc.SSRC, mimeType string, rtpChan chan *rtp.Packet) IRemoteTrack {
@@ -48,6 +49,8 @@ func NewTrackRelay(id, streamid, rid string, kind webrtc.RTPCodecType, ssrc webr
 		ssrc:     ssrc,
 		rid:      rid,
 		rtpChan:  rtpChan,
+		// the packets are written with the payload type of the codec in the SFU
+		payloadType: getPayloadType(mimeType),
 	}
 }
 
@@ -110,20 +113,51 @@ func (t *RelayTrack) Codec() webrtc.RTPCodecParameters {
 	return getRTPParameters(t.mimeType)
 }
 
-// Read reads data from the track.
+// Read reads the next packet of the RTP channel, it returns io.EOF when the channel is closed
+// and zero bytes when the read deadline is reached.
 func (t *RelayTrack) Read(b []byte) (n int, attributes interceptor.Attributes, err error) {
-	return 0, nil, errors.New("relaytrack: not implemented, use ReadRTP instead")
+	t.mu.RLock()
+	deadline := t.deadline
+	t.mu.RUnlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p, ok := <-t.rtpChan:
+		if !ok {
+			return 0, nil, io.EOF
+		}
+
+		n, err = p.MarshalTo(b)
+		return n, nil, err
+	case <-timeout:
+		return 0, nil, nil
+	}
 }
 
 // ReadRTP is a convenience method that wraps Read and unmarshals for you.
 func (t *RelayTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
-	p := <-t.rtpChan
+	p, ok := <-t.rtpChan
+	if !ok {
+		return nil, nil, io.EOF
+	}
+
 	return p, nil, nil
 }
 
 // SetReadDeadline sets the max amount of time the RTP stream will block before returning. 0 is forever.
 func (t *RelayTrack) SetReadDeadline(deadline time.Time) error {
-	return errors.New("relaytrack: not implemented")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.deadline = deadline
+
+	return nil
 }
 
 // IsRelay returns true if this track is a relay track
@@ -13,7 +13,6 @@ import (
 	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/logging"
 	"github.com/pion/rtp"
-	"github.com/pion/webrtc/v4"
 	"github.com/samespace/sfu/pkg/networkmonitor"
 	"github.com/samespace/sfu/pkg/rtppool"
 )
@@ -62,7 +61,7 @@ func newRemoteTrack(ctx context.Context, log logging.LeveledLogger, useBuffer bo
 		rtppool:               pool,
 	}
 
-	if useBuffer && track.Kind() == webrtc.RTPCodecTypeVideo {
+	if useBuffer {
 		rt.packetBuffers = newPacketBuffers(localctx, minWait, maxWait, true, log)
 	}
 
@@ -74,7 +73,7 @@ func newRemoteTrack(ctx context.Context, log logging.LeveledLogger, useBuffer bo
 
 	go rt.readRTP()
 
-	if useBuffer && track.Kind() == webrtc.RTPCodecTypeVideo {
+	if useBuffer {
 		go rt.loop()
 	}
 
@@ -161,11 +160,11 @@ func (t *remoteTrack) readRTP() {
 				continue
 			}
 
-			if !t.IsRelay() {
+			if !t.IsRelay() && t.statsGetter != nil {
 				go t.updateStats()
 			}
 
-			if t.Buffered() && t.Track().Kind() == webrtc.RTPCodecTypeVideo {
+			if t.Buffered() {
 				retainablePacket := t.rtppool.NewPacket(&p.Header, p.Payload)
 				_ = t.packetBuffers.Add(retainablePacket)
 
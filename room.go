@@ -3,20 +3,21 @@ package sfu
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pion/webrtc/v4"
-	"github.com/quic-go/quic-go"
 	"github.com/samespace/sfu/recorder"
 )
 
 const (
-	StateRoomOpen       = "open"
-	StateRoomClosed     = "closed"
-	EventRoomClosed     = "room_closed"
-	EventRoomClientLeft = "room_client_left"
+	StateRoomOpen            = "open"
+	StateRoomClosed          = "closed"
+	EventRoomClosed          = "room_closed"
+	EventRoomClientLeft      = "room_client_left"
+	EventRoomRecordingHealth = "room_recording_health"
 )
 
 type Options struct {
@@ -55,27 +56,36 @@ type Event struct {
 }
 
 type Room struct {
-	onRoomClosedCallbacks   []func(id string)
-	onClientJoinedCallbacks []func(*Client)
-	onClientLeftCallbacks   []func(*Client)
-	context                 context.Context
-	cancel                  context.CancelFunc
-	id                      string
-	token                   string
-	RenegotiationChan       map[string]chan bool
-	name                    string
-	mu                      *sync.RWMutex
-	meta                    *Metadata
-	sfu                     *SFU
-	state                   string
-	stats                   map[string]*TrackStats
-	kind                    string
-	extensions              []IExtension
-	OnEvent                 func(event Event)
-	quicClient              quic.Connection
-	isRecording             atomic.Bool
-	isRecordingPaused       atomic.Bool
-	options                 RoomOptions
+	onRoomClosedCallbacks    []func(id string)
+	onClientJoinedCallbacks  []func(*Client)
+	onClientLeftCallbacks    []func(*Client)
+	context                  context.Context
+	cancel                   context.CancelFunc
+	id                       string
+	token                    string
+	RenegotiationChan        map[string]chan bool
+	name                     string
+	mu                       *sync.RWMutex
+	meta                     *Metadata
+	sfu                      *SFU
+	state                    string
+	stats                    map[string]*TrackStats
+	kind                     string
+	extensions               []IExtension
+	OnEvent                  func(event Event)
+	recordingSession         *recorder.Session
+	onRecordingHealthChanged []func(recorder.SessionHealth)
+	newTrackRecorder         recorder.NewTrackRecorderFunc
+	recordingFileName        string
+	recordingChannels        *recordingChannels
+	recordingState           RecordingState
+	recordingTranscript      recorder.TranscriptRecorder
+	recordingStart           time.Time
+	isRecording              atomic.Bool
+	isRecordingPaused        atomic.Bool
+	options                  RoomOptions
+	supervisors              map[string]*supervision
+	trackForwards            map[string]*TrackForward
 }
 
 type RoomOptions struct {
@@ -94,6 +104,25 @@ type RoomOptions struct {
 	EmptyRoomTimeout *time.Duration `json:"empty_room_timeout_ns,omitempty" example:"300000000000" default:"300000000000"`
 	// Configure the quic configuration for recording
 	RecorderConfig *recorder.RecorderConfig `json:"recorder_config,omitempty"`
+	// Configure the recording to the local disk, the recording doesn't need a recorder service when this is set.
+	// The tracks are written to {directory}/{bucket name}/{file name}_{client id}_{track id} when the recording is started.
+	LocalRecorderConfig *recorder.FileConfig `json:"local_recorder_config,omitempty"`
+	// Configure the channel layout of the mixed recording of the recorder service, default is the stereo layout
+	// with the channel of the client options. The layout can be changed while recording with SetRecordingChannelLayout.
+	RecordingChannelLayout *recorder.ChannelLayoutConfig `json:"recording_channel_layout,omitempty"`
+	// Configure the labels of the data channels that are recorded as the transcript of the room recording, for example chat
+	// and captions. The messages are written to {file name}.transcript.jsonl by the local recorder or the recorder service.
+	RecordingDataChannels []string `json:"recording_data_channels,omitempty"`
+	// Configure the max number of packets to cache from the latest keyframe of each video track.
+	// The cached keyframe is replayed to a new subscriber so the video is rendered immediately without requesting a keyframe from the publisher.
+	// Default is 0 means the cache is disabled.
+	GOPCacheSize int `json:"gop_cache_size,omitempty" example:"0"`
+	// Configure the default minimum playout delay in milliseconds of the clients in the room, it overrides the playout delay of the client options.
+	// Default is nil means the playout delay of the client options is used. See ClientOptions.MinPlayoutDelay for the recommended values.
+	MinPlayoutDelay *uint16 `json:"min_playout_delay,omitempty" example:"100"`
+	// Configure the default maximum playout delay in milliseconds of the clients in the room, it overrides the playout delay of the client options.
+	// Default is nil means the playout delay of the client options is used.
+	MaxPlayoutDelay *uint16 `json:"max_playout_delay,omitempty" example:"200"`
 }
 
 func DefaultRoomOptions() RoomOptions {
@@ -130,6 +159,10 @@ func newRoom(id, name string, sfu *SFU, kind string, opts RoomOptions) *Room {
 		room.onClientLeft(client)
 	})
 
+	sfu.OnDataChannelMessage(room.recordDataMessage)
+
+	sfu.OnTracksAvailable(room.onSupervisorTracksAvailable)
+
 	go room.loopRecordStats()
 
 	return room
@@ -207,16 +240,26 @@ func (r *Room) AddClient(id, name string, opts ClientOptions) (*Client, error) {
 		return nil, ErrClientExists
 	}
 
-	if r.quicClient != nil {
-		opts.QuicConnection = r.quicClient
-	}
-
 	if r.options.RecorderConfig != nil {
 		opts.RecorderConfig = r.options.RecorderConfig
 	}
 
+	if r.options.LocalRecorderConfig != nil {
+		opts.LocalRecorderConfig = r.options.LocalRecorderConfig
+	}
+
+	r.mu.RLock()
+	if r.options.MinPlayoutDelay != nil {
+		opts.MinPlayoutDelay = *r.options.MinPlayoutDelay
+	}
+
+	if r.options.MaxPlayoutDelay != nil {
+		opts.MaxPlayoutDelay = *r.options.MaxPlayoutDelay
+	}
+	r.mu.RUnlock()
+
 	client = r.sfu.NewClient(id, name, opts)
-	client.roomId = r.id
+	client.roomId.Store(r.id)
 
 	// stop client if not connecting for a specific time
 	initConnection := true
@@ -265,48 +308,358 @@ func (r *Room) StartRecording(bucketName, filename string) error {
 	if !swp {
 		return fmt.Errorf("recording is already started")
 	}
-	var quicClient quic.Connection = r.quicClient
-	var err error
-	if quicClient == nil {
-		quicClient, err = recorder.NewQuicClient(
-			context.Background(),
-			recorder.ClientConfig{
-				ClientId:   r.id,
-				BucketName: bucketName,
-				FileName:   filename,
-			},
-			r.options.RecorderConfig,
-		)
+
+	layout := recorder.ChannelLayoutConfig{}
+	if r.options.RecordingChannelLayout != nil {
+		layout = *r.options.RecordingChannelLayout
+	}
+
+	start := time.Now()
+
+	r.mu.Lock()
+	r.recordingFileName = filename
+	r.recordingChannels = newRecordingChannels(layout)
+	r.recordingStart = start
+	r.mu.Unlock()
+
+	if r.options.LocalRecorderConfig != nil {
+		trackRecorder, err := localTrackRecorder(*r.options.LocalRecorderConfig, bucketName, filename)
 		if err != nil {
+			r.isRecording.Store(false)
 			return err
 		}
-		r.quicClient = quicClient
+
+		if len(r.options.RecordingDataChannels) > 0 {
+			fileConf := *r.options.LocalRecorderConfig
+			// the bucket name is already validated by localTrackRecorder
+			fileConf.Directory, _ = recorder.BucketDirectory(fileConf.Directory, bucketName)
+
+			transcript, err := recorder.NewFileTranscriptRecorder(fileConf, filename)
+			if err != nil {
+				r.isRecording.Store(false)
+				return err
+			}
+
+			r.mu.Lock()
+			r.recordingTranscript = transcript
+			r.mu.Unlock()
+		}
+
+		newRecorder := r.segmentTrackRecorder(trackRecorder)
+
+		r.mu.Lock()
+		r.newTrackRecorder = newRecorder
+		r.mu.Unlock()
+
+		for _, client := range r.sfu.clients.GetClients() {
+			client.startRoomRecording(newRecorder)
+		}
+
+		r.startRecordingState(RecordingTarget{Type: RecordingTargetLocal, BucketName: bucketName, FileName: filename}, start)
+
+		return nil
+	}
+
+	session, err := recorder.NewSession(
+		recorder.ClientConfig{
+			ClientId:      r.id,
+			BucketName:    bucketName,
+			FileName:      filename,
+			TimelineStart: start,
+		},
+		r.options.RecorderConfig,
+		recorder.SessionOptions{
+			Log: r.sfu.log,
+		},
+	)
+	if err != nil {
+		r.isRecording.Store(false)
+		return err
 	}
+
+	session.OnHealthChanged(r.onRecordingHealth)
+
+	var transcript recorder.TranscriptRecorder
+	if len(r.options.RecordingDataChannels) > 0 {
+		if transcript, err = session.NewTranscriptRecorder(); err != nil {
+			r.sfu.log.Errorf("room: failed to record the data channels: %s", err.Error())
+		}
+	}
+
+	newRecorder := r.segmentTrackRecorder(session.NewTrackRecorder)
+
+	r.mu.Lock()
+	r.recordingSession = session
+	r.recordingTranscript = transcript
+	r.newTrackRecorder = newRecorder
+	r.mu.Unlock()
+
 	for _, client := range r.sfu.clients.GetClients() {
-		client.startRoomRecording(quicClient)
+		client.startRoomRecording(newRecorder)
 	}
+
+	r.startRecordingState(RecordingTarget{Type: RecordingTargetRecorder, BucketName: bucketName, FileName: filename}, start)
+
 	return nil
 }
 
+// trackRecorder returns the track recorder of the room recording, or nil when the room is not recording
+func (r *Room) trackRecorder() recorder.NewTrackRecorderFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.isRecording.Load() {
+		return nil
+	}
+
+	return r.newTrackRecorder
+}
+
+func (r *Room) startRecordingState(target RecordingTarget, start time.Time) {
+	r.updateRecordingState(func(state *RecordingState, now time.Time) {
+		*state = RecordingState{
+			Recording: true,
+			// the tracks start paused when the recording is paused before it's started
+			Paused:    r.isRecordingPaused.Load(),
+			StartedAt: start,
+			Pauses:    make([]RecordingPause, 0),
+			Targets:   []RecordingTarget{target},
+		}
+
+		if state.Paused {
+			state.Pauses = append(state.Pauses, RecordingPause{Start: now})
+		}
+	})
+}
+
 func (r *Room) StopRecording(stopConfig recorder.StopConfig) {
-	fmt.Println("sending stop recording")
 	swp := r.isRecording.CompareAndSwap(true, false)
 	if !swp {
 		return
 	}
-	chanConfig := make(map[string]int)
 
 	for _, client := range r.sfu.clients.GetClients() {
-		clienTracks := client.Tracks()
-		for _, track := range clienTracks {
-			chanConfig[track.ID()] = int(client.options.Channel)
-		}
 		client.stopRoomRecording()
 	}
-	stopConfig.ChannelConfig = chanConfig
-	if r.quicClient != nil {
-		fmt.Println("sending datagram L: ", r.quicClient.SendDatagram(serializeCloseDatagram(stopConfig)))
-		r.quicClient = nil
+	r.isRecordingPaused.Store(false)
+
+	r.mu.Lock()
+	r.newTrackRecorder = nil
+	session := r.recordingSession
+	channels := r.recordingChannels
+	transcript := r.recordingTranscript
+	r.recordingSession = nil
+	r.recordingChannels = nil
+	r.recordingTranscript = nil
+	r.mu.Unlock()
+
+	if transcript != nil {
+		if err := transcript.Close(); err != nil {
+			r.sfu.log.Errorf("room: failed to close the transcript: %s", err.Error())
+		}
+	}
+
+	// the channels of all tracks that are recorded, including the tracks of the clients that left
+	stopConfig = channels.StopConfig(stopConfig)
+
+	r.updateRecordingState(func(state *RecordingState, now time.Time) {
+		state.Recording = false
+		state.Paused = false
+
+		if len(state.Pauses) > 0 && state.Pauses[len(state.Pauses)-1].End.IsZero() {
+			state.Pauses[len(state.Pauses)-1].End = now
+		}
+	})
+
+	if session != nil {
+		// the stop config is sent after the queued packets
+		session.Close(stopConfig)
+	}
+}
+
+// segmentTrackRecorder names the tracks that start recording after a rotation with the file name of the current segment,
+// and adds the tracks to the channels of the mixed recording
+func (r *Room) segmentTrackRecorder(newRecorder recorder.NewTrackRecorderFunc) recorder.NewTrackRecorderFunc {
+	return func(conf *recorder.TrackConfig) (recorder.TrackRecorder, error) {
+		r.mu.RLock()
+		conf.FileName = r.recordingFileName
+		channels := r.recordingChannels
+		r.mu.RUnlock()
+
+		tr, err := newRecorder(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		if client, err := r.sfu.clients.GetClient(conf.ClientID); err == nil && channels != nil {
+			channels.AddTrack(client, conf.TrackID)
+		}
+
+		return tr, nil
+	}
+}
+
+// recordDataMessage writes the message of a recorded data channel to the transcript, the messages are not recorded
+// while the recording is paused
+func (r *Room) recordDataMessage(clientID string, label string, msg webrtc.DataChannelMessage) {
+	if !r.isRecording.Load() || r.isRecordingPaused.Load() || !slices.Contains(r.options.RecordingDataChannels, label) {
+		return
+	}
+
+	r.mu.RLock()
+	transcript := r.recordingTranscript
+	start := r.recordingStart
+	r.mu.RUnlock()
+
+	if transcript == nil {
+		return
+	}
+
+	now := time.Now()
+	message := recorder.TranscriptMessage{
+		Time:     now,
+		Offset:   now.Sub(start),
+		ClientID: clientID,
+		Label:    label,
+	}
+
+	if msg.IsString {
+		message.Text = string(msg.Data)
+	} else {
+		message.Data = msg.Data
+	}
+
+	if err := transcript.WriteMessage(message); err != nil {
+		r.sfu.log.Errorf("room: failed to record the message of data channel %s: %s", label, err.Error())
+	}
+}
+
+// SetRecordingChannelLayout changes the channel layout of the mixed recording of the current room recording,
+// the layout is applied to all tracks of the recording when it's stopped.
+func (r *Room) SetRecordingChannelLayout(layout recorder.ChannelLayoutConfig) error {
+	r.mu.RLock()
+	channels := r.recordingChannels
+	r.mu.RUnlock()
+
+	if channels == nil {
+		return ErrRecordingNotStarted
+	}
+
+	channels.SetLayout(layout)
+
+	return nil
+}
+
+// SetRecordingChannel places the client in the channel of the mixed recording regardless of the layout,
+// the channel starts from 1. It can be set before the client is recorded.
+func (r *Room) SetRecordingChannel(clientID string, channel int) error {
+	r.mu.RLock()
+	channels := r.recordingChannels
+	r.mu.RUnlock()
+
+	if channels == nil {
+		return ErrRecordingNotStarted
+	}
+
+	channels.SetChannel(clientID, channel)
+
+	return nil
+}
+
+// MarkRecording adds a label marker at the current time to the recording timeline of all recorded tracks,
+// for example to tag a compliance event. The markers are written to the timeline of the recorder service,
+// the local disk recording doesn't have a timeline.
+func (r *Room) MarkRecording(label string) error {
+	if !r.isRecording.Load() {
+		return ErrRecordingNotStarted
+	}
+
+	at := time.Now()
+
+	for _, client := range r.sfu.clients.GetClients() {
+		for _, track := range client.Tracks() {
+			track.MarkRecording(label, at)
+		}
+	}
+
+	return nil
+}
+
+// RotateRecording continues the recording of the room in new files named with the file name, without stopping
+// the track recordings, for example to cut a segment per agent on a call transfer. The audio tracks are rotated
+// on their next packet and the video tracks on their next keyframe. Reusing the file name of a previous segment
+// overwrites its files. The rotation requires the protocol version 2 with the recorder service.
+func (r *Room) RotateRecording(newFilename string) error {
+	if !r.isRecording.Load() {
+		return ErrRecordingNotStarted
+	}
+
+	r.mu.Lock()
+	r.recordingFileName = newFilename
+	r.mu.Unlock()
+
+	r.updateRecordingState(func(state *RecordingState, now time.Time) {
+		for i := range state.Targets {
+			state.Targets[i].FileName = newFilename
+		}
+	})
+
+	at := time.Now()
+
+	for _, client := range r.sfu.clients.GetClients() {
+		for _, track := range client.Tracks() {
+			track.RotateRecording(newFilename, at)
+		}
+	}
+
+	return nil
+}
+
+// RecordingHealth returns the state of the connection to the recorder service,
+// false if the room is not recorded with the recorder service.
+func (r *Room) RecordingHealth() (recorder.SessionHealth, bool) {
+	r.mu.RLock()
+	session := r.recordingSession
+	r.mu.RUnlock()
+
+	if session == nil {
+		return recorder.SessionHealth{}, false
+	}
+
+	return session.Health(), true
+}
+
+// OnRecordingHealthChanged is called when the connection to the recorder service is connected, lost or closed.
+// The health is also sent as EventRoomRecordingHealth to the OnEvent callback.
+func (r *Room) OnRecordingHealthChanged(callback func(recorder.SessionHealth)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onRecordingHealthChanged = append(r.onRecordingHealthChanged, callback)
+}
+
+func (r *Room) onRecordingHealth(health recorder.SessionHealth) {
+	if !health.Connected && health.State != recorder.SessionStateClosed {
+		r.sfu.log.Warnf("room: recording connection is %s: %s", health.State, health.LastError)
+	}
+
+	r.mu.RLock()
+	callbacks := r.onRecordingHealthChanged
+	onEvent := r.OnEvent
+	r.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(health)
+	}
+
+	if onEvent != nil {
+		onEvent(Event{
+			Type: EventRoomRecordingHealth,
+			Time: time.Now(),
+			Data: map[string]interface{}{
+				"health": health,
+			},
+		})
 	}
 }
 
@@ -319,6 +672,12 @@ func (r *Room) PauseRecording() {
 		client.pauseRoomRecording()
 	}
 
+	if r.isRecording.Load() {
+		r.updateRecordingState(func(state *RecordingState, now time.Time) {
+			state.Paused = true
+			state.Pauses = append(state.Pauses, RecordingPause{Start: now})
+		})
+	}
 }
 
 func (r *Room) ContinueRecording() {
@@ -329,6 +688,46 @@ func (r *Room) ContinueRecording() {
 	for _, client := range r.sfu.clients.GetClients() {
 		client.continueRoomRecording()
 	}
+
+	if r.isRecording.Load() {
+		r.updateRecordingState(func(state *RecordingState, now time.Time) {
+			state.Paused = false
+
+			if len(state.Pauses) > 0 && state.Pauses[len(state.Pauses)-1].End.IsZero() {
+				state.Pauses[len(state.Pauses)-1].End = now
+			}
+		})
+	}
+}
+
+// SetPlayoutDelay sets the default playout delay in milliseconds of the clients in the room.
+// The delay is applied to the connected clients on their next packets and used by the clients that join later.
+// The tracks with their own playout delay set with Client.SetPlayoutDelay are not affected.
+// The delay is saved for the clients that join later before it's applied, the connected clients are updated
+// on a best effort basis and the clients that failed are returned in the error without rolling back the others.
+func (r *Room) SetPlayoutDelay(min, max uint16) error {
+	if min > max {
+		return ErrPlayoutDelayInvalid
+	}
+
+	r.mu.Lock()
+	r.options.MinPlayoutDelay = &min
+	r.options.MaxPlayoutDelay = &max
+	r.mu.Unlock()
+
+	errs := make([]error, 0)
+
+	for _, client := range r.sfu.clients.GetClients() {
+		if err := client.SetDefaultPlayoutDelay(min, max); err != nil && err != ErrPlayoutDelayDisabled {
+			errs = append(errs, fmt.Errorf("client %s: %w", client.ID(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return FlattenErrors(errs)
+	}
+
+	return nil
 }
 
 // Generate a unique client ID for this room
@@ -347,6 +746,8 @@ func (r *Room) OnClientLeft(callback func(client *Client)) {
 }
 
 func (r *Room) onClientLeft(client *Client) {
+	r.onSupervisorLeft(client)
+
 	r.mu.RLock()
 	callbacks := r.onClientLeftCallbacks
 	exts := r.extensions
@@ -371,13 +772,16 @@ func (r *Room) onClientJoined(client *Client) {
 		callback(client)
 	}
 
-	if r.isRecording.Load() {
-		client.startRoomRecording(r.quicClient)
+	if newRecorder := r.trackRecorder(); newRecorder != nil {
+		client.startRoomRecording(newRecorder)
+		client.sendRecordingState(r.RecordingState())
 	}
 
 	for _, ext := range r.extensions {
 		ext.OnClientAdded(r, client)
 	}
+
+	r.onSupervisedClientJoined(client)
 }
 
 func (r *Room) OnClientJoined(callback func(client *Client)) {
@@ -436,10 +840,16 @@ func (r *Room) Stats() RoomStats {
 		ClientStats:    clientStats,
 	}
 
+	for _, forward := range r.trackForwards {
+		roomStats.ForwardedTracks = append(roomStats.ForwardedTracks, forward.Stats())
+	}
+
 	for id, c := range r.sfu.clients.GetClients() {
 		roomStats.ClientStats[id] = c.Stats()
 
-		roomStats.ClientsCount++
+		if !c.IsHidden() {
+			roomStats.ClientsCount++
+		}
 
 		for _, track := range roomStats.ClientStats[id].Receives {
 			if track.Kind == webrtc.RTPCodecTypeAudio {
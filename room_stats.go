@@ -35,6 +35,11 @@ type TrackReceivedStats struct {
 	PacketsLost     int64               `json:"packets_lost"`
 	PacketsReceived uint64              `json:"packets_received"`
 	BytesReceived   int64               `json:"bytes_received"`
+	// jitter buffer stats, only available when ReorderPackets client option is enabled
+	JitterBufferLatency uint32 `json:"jitter_buffer_latency"` // in milliseconds
+	PacketsReordered    uint64 `json:"packets_reordered"`
+	PacketsLate         uint64 `json:"packets_late"`
+	PacketsDuplicate    uint64 `json:"packets_duplicate"`
 }
 
 type ClientTrackStats struct {
@@ -61,4 +66,6 @@ type RoomStats struct {
 	SentTracks      StatTracks                  `json:"sent_tracks"`
 	Timestamp       time.Time                   `json:"timestamp"`
 	ClientStats     map[string]ClientTrackStats `json:"client_stats"`
+	// The tracks that are forwarded from or to the room with Manager.ForwardTrack
+	ForwardedTracks []TrackForwardStats `json:"forwarded_tracks"`
 }
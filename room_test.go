@@ -1,11 +1,16 @@
 package sfu
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/pion/webrtc/v4"
+	"github.com/samespace/sfu/recorder"
 	"github.com/stretchr/testify/require"
 )
 
@@ -353,3 +358,205 @@ func TestRoomAddClientTimeout(t *testing.T) {
 		require.Equal(t, c.ID(), client.ID())
 	}
 }
+
+func TestRoomRecordingState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	roomOpts := DefaultRoomOptions()
+	roomOpts.LocalRecorderConfig = &recorder.FileConfig{Directory: t.TempDir()}
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, roomOpts)
+	require.NoError(t, err)
+
+	require.False(t, testRoom.RecordingState().Recording)
+
+	require.NoError(t, testRoom.StartRecording("bucket", "call"))
+
+	state := testRoom.RecordingState()
+	require.True(t, state.Recording)
+	require.False(t, state.Paused)
+	require.False(t, state.StartedAt.IsZero())
+	require.Equal(t, []RecordingTarget{{Type: RecordingTargetLocal, BucketName: "bucket", FileName: "call"}}, state.Targets)
+
+	testRoom.PauseRecording()
+	time.Sleep(10 * time.Millisecond)
+
+	state = testRoom.RecordingState()
+	require.True(t, state.Paused)
+	require.Len(t, state.Pauses, 1)
+	require.True(t, state.Pauses[0].End.IsZero())
+	require.GreaterOrEqual(t, state.PausedDuration, 10*time.Millisecond)
+
+	testRoom.ContinueRecording()
+	require.NoError(t, testRoom.RotateRecording("transfer"))
+
+	state = testRoom.RecordingState()
+	require.False(t, state.Paused)
+	require.False(t, state.Pauses[0].End.IsZero())
+	require.Equal(t, state.Pauses[0].End.Sub(state.Pauses[0].Start), state.PausedDuration)
+	require.Equal(t, "transfer", state.Targets[0].FileName)
+
+	testRoom.StopRecording(recorder.StopConfig{})
+
+	state = testRoom.RecordingState()
+	require.False(t, state.Recording)
+	require.Equal(t, state.Pauses[0].End.Sub(state.Pauses[0].Start), state.PausedDuration)
+
+	require.ErrorIs(t, testRoom.MarkRecording("consent"), ErrRecordingNotStarted)
+}
+
+func TestRecordingPauseIsResetOnStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	roomOpts := DefaultRoomOptions()
+	roomOpts.LocalRecorderConfig = &recorder.FileConfig{Directory: t.TempDir()}
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, roomOpts)
+	require.NoError(t, err)
+
+	publisher, err := testRoom.AddVirtualPublisher("bot", VirtualPublisherOptions{Name: "bot"})
+	require.NoError(t, err)
+
+	_, err = publisher.NewTrack("audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	track, err := testRoom.SFU().getTrack("audio")
+	require.NoError(t, err)
+
+	client := publisher.Client()
+
+	require.NoError(t, testRoom.StartRecording("bucket", "call"))
+	testRoom.PauseRecording()
+	require.True(t, track.(*Track).IsPaused())
+
+	// a stopped recording is started again without the pause
+	testRoom.StopRecording(recorder.StopConfig{})
+	require.False(t, track.(*Track).IsPaused())
+	require.False(t, client.isRecordingPaused.Load())
+
+	require.NoError(t, testRoom.StartRecording("bucket", "call-2"))
+	require.False(t, testRoom.RecordingState().Paused)
+	require.True(t, track.(*Track).IsRecording())
+	require.False(t, track.(*Track).IsPaused())
+
+	testRoom.StopRecording(recorder.StopConfig{})
+
+	// the same for the client recording, the virtual publisher doesn't have the recorder config of the room
+	client.options.LocalRecorderConfig = roomOpts.LocalRecorderConfig
+
+	require.ErrorIs(t, client.StartClientRecording("../../etc", "client"), recorder.ErrInvalidBucketName)
+	require.NoError(t, client.StartClientRecording("bucket", "client"))
+	client.PauseClientRecording()
+	require.True(t, track.(*Track).IsPaused())
+
+	client.StopClientRecording(recorder.StopConfig{})
+	require.False(t, track.(*Track).IsPaused())
+	require.False(t, client.isRecordingPaused.Load())
+}
+
+func TestRoomRecordingTranscript(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	dir := t.TempDir()
+
+	roomOpts := DefaultRoomOptions()
+	roomOpts.LocalRecorderConfig = &recorder.FileConfig{Directory: dir}
+	roomOpts.RecordingDataChannels = []string{"chat"}
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, roomOpts)
+	require.NoError(t, err)
+
+	// not recorded before the recording is started
+	testRoom.recordDataMessage("agent", "chat", webrtc.DataChannelMessage{IsString: true, Data: []byte("before")})
+
+	// a bucket name can't escape the recordings directory
+	require.ErrorIs(t, testRoom.StartRecording("../../etc", "call"), recorder.ErrInvalidBucketName)
+	require.False(t, testRoom.isRecording.Load())
+
+	require.NoError(t, testRoom.StartRecording("bucket", "call"))
+
+	testRoom.recordDataMessage("agent", "chat", webrtc.DataChannelMessage{IsString: true, Data: []byte("hello")})
+	testRoom.recordDataMessage("agent", "cursor", webrtc.DataChannelMessage{IsString: true, Data: []byte("ignored")})
+	testRoom.recordDataMessage("customer", "chat", webrtc.DataChannelMessage{Data: []byte{1, 2}})
+
+	testRoom.PauseRecording()
+	testRoom.recordDataMessage("agent", "chat", webrtc.DataChannelMessage{IsString: true, Data: []byte("paused")})
+	testRoom.ContinueRecording()
+
+	testRoom.StopRecording(recorder.StopConfig{})
+
+	data, err := os.ReadFile(filepath.Join(dir, "bucket", "call.transcript.jsonl"))
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	messages := make([]recorder.TranscriptMessage, len(lines))
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal(line, &messages[i]))
+		require.Equal(t, "chat", messages[i].Label)
+		require.GreaterOrEqual(t, messages[i].Offset, time.Duration(0))
+	}
+
+	require.Equal(t, "agent", messages[0].ClientID)
+	require.Equal(t, "hello", messages[0].Text)
+	require.Equal(t, "customer", messages[1].ClientID)
+	require.Equal(t, []byte{1, 2}, messages[1].Data)
+}
+
+func TestRoomHiddenClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	roomOpts := DefaultRoomOptions()
+	emptyRoomTimeout := 500 * time.Millisecond
+	roomOpts.EmptyRoomTimeout = &emptyRoomTimeout
+
+	roomID := roomManager.CreateRoomID()
+	testRoom, err := roomManager.NewRoom(roomID, "test-room", RoomTypeLocal, roomOpts)
+	require.NoError(t, err)
+
+	visible, err := testRoom.AddVirtualPublisher("visible", VirtualPublisherOptions{Name: "visible"})
+	require.NoError(t, err)
+
+	announced := make(chan []ITrack, 10)
+	visible.Client().OnTracksAvailable(func(tracks []ITrack) {
+		announced <- tracks
+	})
+
+	hidden, err := testRoom.AddVirtualPublisher("recorder", VirtualPublisherOptions{Name: "recorder", Hidden: true})
+	require.NoError(t, err)
+	require.True(t, hidden.Client().IsHidden())
+
+	_, err = hidden.NewTrack("recorder-audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	select {
+	case tracks := <-announced:
+		t.Fatalf("tracks of the hidden client are announced: %v", tracks)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	require.Equal(t, 1, testRoom.Stats().ClientsCount)
+	require.Equal(t, 1, testRoom.SFU().clients.VisibleLength())
+
+	// the room is closed when only the hidden client is left
+	require.NoError(t, visible.Close())
+
+	require.Eventually(t, func() bool {
+		_, err := roomManager.GetRoom(roomID)
+		return err == ErrRoomNotFound
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,402 @@
+package sfu
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	defaultSenderReportInterval = time.Second
+	// seconds between the NTP epoch 1900 and the Unix epoch 1970
+	ntpEpochOffset = 2208988800
+)
+
+type RTPForwardOptions struct {
+	// The local address of the socket that sends the packets, a free port is used when it's empty
+	LocalAddress string
+	// The simulcast layer that is forwarded when the track is a simulcast track, default is QualityHigh
+	Quality QualityLevel
+	// The payload type of the forwarded packets, the payload type of the codec in the SFU is used when it's zero
+	PayloadType uint8
+	// The SSRC of the forwarded packets, a random SSRC is used when it's zero
+	SSRC uint32
+	// Send RTCP sender reports to the next port of the destination, or to the destination when RTCPMux is true
+	SenderReports bool
+	RTCPMux       bool
+	// The interval of the RTCP sender reports, default is 1 second
+	SenderReportInterval time.Duration
+}
+
+type RTPForwardStats struct {
+	PacketsSent uint64
+	OctetsSent  uint64
+}
+
+// RTPForward sends the packets of a track as plain RTP to a UDP destination, like a transcription service or a media server.
+// The receiver can use the SDP of the forward to decode the stream. The keyframe requests of the receiver on the RTCP port
+// are passed to the publisher of a video track.
+type RTPForward struct {
+	mu          sync.Mutex
+	context     context.Context
+	cancel      context.CancelFunc
+	track       ITrack
+	codec       webrtc.RTPCodecParameters
+	quality     QualityLevel
+	conn        *net.UDPConn
+	remote      *net.UDPAddr
+	rtcpRemote  *net.UDPAddr
+	payloadType uint8
+	ssrc        uint32
+	packets     atomic.Uint64
+	octets      atomic.Uint64
+	lastRTPTime uint32
+	lastSent    time.Time
+	wg          sync.WaitGroup
+}
+
+// ForwardTrackRTP forwards a track of the room to the UDP address until the forward is closed or the track is ended.
+// The track is a track of a client or a relay track.
+func (r *Room) ForwardTrackRTP(trackID, dstAddr string, opts RTPForwardOptions) (*RTPForward, error) {
+	track, err := r.sfu.getTrack(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := net.ResolveUDPAddr("udp", dstAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var local *net.UDPAddr
+	if opts.LocalAddress != "" {
+		if local, err = net.ResolveUDPAddr("udp", opts.LocalAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, err
+	}
+
+	codec := getRTPParameters(track.MimeType())
+
+	payloadType := opts.PayloadType
+	if payloadType == 0 {
+		payloadType = uint8(codec.PayloadType)
+	}
+
+	ssrc := opts.SSRC
+	if ssrc == 0 {
+		ssrc = rand.Uint32()
+	}
+
+	quality := opts.Quality
+	if quality == QualityNone {
+		quality = QualityHigh
+	}
+
+	ctx, cancel := context.WithCancel(r.context)
+
+	forward := &RTPForward{
+		mu:          sync.Mutex{},
+		context:     ctx,
+		cancel:      cancel,
+		track:       track,
+		codec:       codec,
+		quality:     quality,
+		conn:        conn,
+		remote:      remote,
+		payloadType: payloadType,
+		ssrc:        ssrc,
+	}
+
+	if opts.SenderReports {
+		forward.rtcpRemote = remote
+		if !opts.RTCPMux {
+			forward.rtcpRemote = &net.UDPAddr{IP: remote.IP, Port: remote.Port + 1, Zone: remote.Zone}
+		}
+
+		interval := opts.SenderReportInterval
+		if interval == 0 {
+			interval = defaultSenderReportInterval
+		}
+
+		forward.wg.Add(1)
+		go forward.sendSenderReports(interval)
+	}
+
+	onRead := track.OnRead(forward.onRead)
+
+	onEnded := track.OnEnded(func() {
+		go forward.Close()
+	})
+
+	forward.wg.Add(2)
+	go forward.readRTCP()
+
+	// the forward is closed with the room
+	go func() {
+		defer forward.wg.Done()
+
+		<-ctx.Done()
+
+		onRead.Remove()
+		onEnded.Remove()
+
+		_ = conn.Close()
+	}()
+
+	// the receiver can't decode the video until the next keyframe
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		forward.requestKeyframe()
+	}
+
+	return forward, nil
+}
+
+// getTrack finds a track of the clients or a relay track
+func (s *SFU) getTrack(trackID string) (ITrack, error) {
+	for _, client := range s.clients.GetClients() {
+		if track, err := client.tracks.Get(trackID); err == nil {
+			return track, nil
+		}
+	}
+
+	for _, track := range s.getRelayTracks() {
+		if track.ID() == trackID {
+			return track, nil
+		}
+	}
+
+	return nil, ErrTrackIsNotExists
+}
+
+// Track returns the forwarded track
+func (f *RTPForward) Track() ITrack {
+	return f.track
+}
+
+// LocalAddr returns the address of the sending socket
+func (f *RTPForward) LocalAddr() *net.UDPAddr {
+	return f.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// SSRC returns the SSRC of the forwarded packets
+func (f *RTPForward) SSRC() uint32 {
+	return f.ssrc
+}
+
+func (f *RTPForward) Stats() RTPForwardStats {
+	return RTPForwardStats{
+		PacketsSent: f.packets.Load(),
+		OctetsSent:  f.octets.Load(),
+	}
+}
+
+// SDP returns the session description of the forwarded stream for the receiver, like ffmpeg -protocol_whitelist file,udp,rtp -i forward.sdp
+func (f *RTPForward) SDP() (string, error) {
+	mediaType, codecName, _ := strings.Cut(f.codec.MimeType, "/")
+
+	rtpmap := strconv.Itoa(int(f.payloadType)) + " " + codecName + "/" + strconv.Itoa(int(f.codec.ClockRate))
+	if f.codec.Channels > 1 {
+		rtpmap += "/" + strconv.Itoa(int(f.codec.Channels))
+	}
+
+	media := &sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:   mediaType,
+			Port:    sdp.RangedPort{Value: f.remote.Port},
+			Protos:  []string{"RTP", "AVP"},
+			Formats: []string{strconv.Itoa(int(f.payloadType))},
+		},
+	}
+
+	media.WithValueAttribute("rtpmap", rtpmap)
+
+	if f.codec.SDPFmtpLine != "" {
+		media.WithValueAttribute("fmtp", strconv.Itoa(int(f.payloadType))+" "+f.codec.SDPFmtpLine)
+	}
+
+	if f.rtcpRemote != nil && f.rtcpRemote.Port == f.remote.Port {
+		media.WithPropertyAttribute("rtcp-mux")
+	}
+
+	media.WithValueAttribute("ssrc", strconv.FormatUint(uint64(f.ssrc), 10)+" cname:"+f.track.StreamID())
+	media.WithPropertyAttribute(webrtc.RTPTransceiverDirectionRecvonly.String())
+
+	addressType := "IP4"
+	if f.remote.IP.To4() == nil {
+		addressType = "IP6"
+	}
+
+	desc := &sdp.SessionDescription{
+		Origin: sdp.Origin{
+			Username:       "-",
+			SessionID:      uint64(f.ssrc),
+			SessionVersion: 0,
+			NetworkType:    "IN",
+			AddressType:    addressType,
+			UnicastAddress: f.LocalAddr().IP.String(),
+		},
+		SessionName: sdp.SessionName(f.track.ID()),
+		ConnectionInformation: &sdp.ConnectionInformation{
+			NetworkType: "IN",
+			AddressType: addressType,
+			Address:     &sdp.Address{Address: f.remote.IP.String()},
+		},
+		TimeDescriptions:  []sdp.TimeDescription{{Timing: sdp.Timing{}}},
+		MediaDescriptions: []*sdp.MediaDescription{media},
+	}
+
+	data, err := desc.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Close stops the forward, the track is not changed
+func (f *RTPForward) Close() error {
+	f.cancel()
+	f.wg.Wait()
+
+	return nil
+}
+
+func (f *RTPForward) onRead(p *rtp.Packet, quality QualityLevel) {
+	if f.context.Err() != nil {
+		return
+	}
+
+	if f.track.IsSimulcast() && quality != f.quality {
+		return
+	}
+
+	header := p.Header
+	header.SSRC = f.ssrc
+	header.PayloadType = f.payloadType
+	// the header extensions are negotiated with the publisher, the receiver doesn't know them
+	header.Extension = false
+	header.Extensions = nil
+
+	packet := &rtp.Packet{Header: header, Payload: p.Payload}
+
+	data, err := packet.Marshal()
+	if err != nil {
+		return
+	}
+
+	if _, err := f.conn.WriteToUDP(data, f.remote); err != nil {
+		return
+	}
+
+	f.packets.Add(1)
+	f.octets.Add(uint64(len(p.Payload)))
+
+	f.mu.Lock()
+	f.lastRTPTime = p.Timestamp
+	f.lastSent = time.Now()
+	f.mu.Unlock()
+}
+
+func (f *RTPForward) requestKeyframe() {
+	switch track := f.track.(type) {
+	case *Track:
+		track.remoteTrack.sendPLI()
+	case *SimulcastTrack:
+		if remoteTrack := track.getRemoteTrack(f.quality); remoteTrack != nil {
+			remoteTrack.sendPLI()
+		}
+	}
+}
+
+// readRTCP passes the keyframe requests of the receiver to the publisher
+func (f *RTPForward) readRTCP() {
+	defer f.wg.Done()
+
+	buf := make([]byte, rtpIngestMaxPacketSize)
+
+	for {
+		n, _, err := f.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		packets, err := rtcp.Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				f.requestKeyframe()
+			}
+		}
+	}
+}
+
+func (f *RTPForward) sendSenderReports(interval time.Duration) {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.context.Done():
+			return
+		case <-ticker.C:
+			f.sendSenderReport()
+		}
+	}
+}
+
+func (f *RTPForward) sendSenderReport() {
+	f.mu.Lock()
+	if f.lastSent.IsZero() {
+		f.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	// the RTP time of now is extrapolated from the last sent packet
+	rtpTime := f.lastRTPTime + uint32(now.Sub(f.lastSent).Seconds()*float64(f.codec.ClockRate))
+	f.mu.Unlock()
+
+	sr := &rtcp.SenderReport{
+		SSRC:        f.ssrc,
+		NTPTime:     toNTPTime(now),
+		RTPTime:     rtpTime,
+		PacketCount: uint32(f.packets.Load()),
+		OctetCount:  uint32(f.octets.Load()),
+	}
+
+	data, err := sr.Marshal()
+	if err != nil {
+		return
+	}
+
+	_, _ = f.conn.WriteToUDP(data, f.rtcpRemote)
+}
+
+// toNTPTime converts the time to the 64 bit NTP timestamp of RTCP
+func toNTPTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix()) + ntpEpochOffset
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+
+	return seconds<<32 | fraction
+}
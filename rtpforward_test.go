@@ -0,0 +1,129 @@
+package sfu
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/require"
+)
+
+// trackCallbacks returns the number of the read and ended callbacks of the track
+func trackCallbacks(track ITrack) int {
+	t := track.(*Track)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.onReadCallbacks) + len(t.onEndedCallbacks)
+}
+
+func TestForwardTrackRTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	publisher, err := testRoom.AddVirtualPublisher("bot", VirtualPublisherOptions{Name: "bot"})
+	require.NoError(t, err)
+
+	audio, err := publisher.NewTrack("audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	receiver, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer receiver.Close()
+
+	_, err = testRoom.ForwardTrackRTP("unknown", receiver.LocalAddr().String(), RTPForwardOptions{})
+	require.ErrorIs(t, err, ErrTrackIsNotExists)
+
+	forward, err := testRoom.ForwardTrackRTP("audio", receiver.LocalAddr().String(), RTPForwardOptions{
+		PayloadType:          96,
+		SenderReports:        true,
+		RTCPMux:              true,
+		SenderReportInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	description, err := forward.SDP()
+	require.NoError(t, err)
+	require.Contains(t, description, "m=audio "+strconv.Itoa(receiver.LocalAddr().(*net.UDPAddr).Port)+" RTP/AVP 96")
+	require.Contains(t, description, "a=rtpmap:96 opus/48000/2")
+	require.Contains(t, description, "a=rtcp-mux")
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			if audio.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond}) != nil {
+				return
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var packets int
+	var senderReport *rtcp.SenderReport
+
+	for packets < 5 || senderReport == nil {
+		buf := make([]byte, 1500)
+		n, err := receiver.Read(buf)
+		require.NoError(t, err)
+
+		if buf[1] >= rtcpPacketTypeMin && buf[1] <= rtcpPacketTypeMax {
+			rtcpPackets, err := rtcp.Unmarshal(buf[:n])
+			require.NoError(t, err)
+
+			if sr, ok := rtcpPackets[0].(*rtcp.SenderReport); ok {
+				senderReport = sr
+			}
+
+			continue
+		}
+
+		p := &rtp.Packet{}
+		require.NoError(t, p.Unmarshal(buf[:n]))
+		require.Equal(t, forward.SSRC(), p.SSRC)
+		require.Equal(t, uint8(96), p.PayloadType)
+		require.Equal(t, []byte{0xf8, 0xff, 0xfe}, p.Payload)
+
+		packets++
+	}
+
+	require.Equal(t, forward.SSRC(), senderReport.SSRC)
+	require.NotZero(t, senderReport.PacketCount)
+	require.Greater(t, forward.Stats().PacketsSent, uint64(0))
+
+	// a closed forward doesn't keep its callbacks on the track
+	track, err := testRoom.SFU().getTrack("audio")
+	require.NoError(t, err)
+
+	before := trackCallbacks(track)
+
+	second, err := testRoom.ForwardTrackRTP("audio", receiver.LocalAddr().String(), RTPForwardOptions{})
+	require.NoError(t, err)
+	require.Equal(t, before+2, trackCallbacks(track))
+
+	require.NoError(t, second.Close())
+	require.Equal(t, before, trackCallbacks(track))
+
+	// the forward is closed when the track is ended
+	require.NoError(t, publisher.Close())
+
+	require.Eventually(t, func() bool {
+		return forward.context.Err() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, forward.Close())
+}
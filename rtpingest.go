@@ -0,0 +1,587 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	rtpIngestBuffer        = 512
+	rtpIngestMaxPacketSize = 1500
+	// a new source is latched when the latched source doesn't send for this duration, like a restarted encoder
+	rtpIngestLatchTimeout         = 3 * time.Second
+	defaultReceiverReportInterval = time.Second
+	// the payload types of RTCP packets that are multiplexed with RTP, see RFC 5761
+	rtcpPacketTypeMin = 192
+	rtcpPacketTypeMax = 223
+)
+
+var (
+	ErrRTPIngestCodec = errors.New("rtpingest: codec is not supported")
+	ErrRTPIngestSDP   = errors.New("rtpingest: sdp doesn't have a supported media")
+)
+
+type RTPIngestOptions struct {
+	// The local address of the RTP socket like "0.0.0.0:5004", a free port is used when the port is 0.
+	// The port of the SDP media is used when the address is empty.
+	Address string
+	// Receive RTCP on a separate socket on the next port, RTCP is multiplexed on the RTP socket when it's false
+	SeparateRTCP bool
+	// The SDP that describes the stream like the SDP file of ffmpeg, the first media with a codec of the SFU is ingested
+	SDP string
+	// The codec of the stream when there is no SDP, like webrtc.MimeTypeOpus
+	MimeType string
+	// The payload type of the sender when there is no SDP, the payload type of the codec in the SFU is used when it's zero.
+	// The packets with other payload types are dropped.
+	PayloadType uint8
+	// The ID of the published track, the ID of the ingest publisher is used when it's empty
+	TrackID string
+	// The name of the ingest publisher that is seen by the other clients
+	Name string
+	// The interval of the RTCP receiver reports that are sent back to the sender, default is 1 second
+	ReceiverReportInterval time.Duration
+}
+
+type RTPIngestStats struct {
+	PacketsReceived uint64
+	// The packets from another source or with another payload type
+	PacketsDropped uint64
+	PacketsLost    uint32
+	// The interarrival jitter in the clock rate of the codec
+	Jitter uint32
+	// The latched source
+	SSRC       uint32
+	RemoteAddr *net.UDPAddr
+}
+
+// RTPIngest receives plain RTP from an encoder that can't do WebRTC, like ffmpeg, GStreamer or a hardware encoder,
+// and publishes it as a relay track of a virtual publisher. The first source that sends the expected payload type is
+// latched, the packets of other sources are dropped until the latched source stops sending.
+type RTPIngest struct {
+	mu             sync.Mutex
+	context        context.Context
+	cancel         context.CancelFunc
+	publisher      *VirtualPublisher
+	track          ITrack
+	conn           *net.UDPConn
+	rtcpConn       *net.UDPConn
+	rtpChan        chan *rtp.Packet
+	payloadType    uint8
+	sfuPayloadType uint8
+	ssrc           uint32
+	latchedSSRC    uint32
+	remote         *net.UDPAddr
+	rtcpRemote     *net.UDPAddr
+	lastReceived   time.Time
+	stats          *rtpReceiverStats
+	dropped        uint64
+	wg             sync.WaitGroup
+}
+
+type ingestCodec struct {
+	codec       webrtc.RTPCodecParameters
+	payloadType uint8
+	port        int
+}
+
+// AddRTPIngest opens the UDP sockets and publishes the ingested track to the room through SFU.AddRelayTrack,
+// the track is available to the clients once it's created and ends when the ingest is closed.
+func (r *Room) AddRTPIngest(opts RTPIngestOptions) (*RTPIngest, error) {
+	codec, err := rtpIngestCodec(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	address := opts.Address
+	if address == "" {
+		address = ":" + strconv.Itoa(codec.port)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var rtcpConn *net.UDPConn
+
+	if opts.SeparateRTCP {
+		localAddr := conn.LocalAddr().(*net.UDPAddr)
+		if rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.IP, Port: localAddr.Port + 1}); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	closeConns := func() {
+		_ = conn.Close()
+		if rtcpConn != nil {
+			_ = rtcpConn.Close()
+		}
+	}
+
+	id := "ingest-" + GenerateID(16)
+
+	publisher, err := r.AddVirtualPublisher(id, VirtualPublisherOptions{Name: opts.Name})
+	if err != nil {
+		closeConns()
+		return nil, err
+	}
+
+	trackID := opts.TrackID
+	if trackID == "" {
+		trackID = id
+	}
+
+	kind := webrtc.RTPCodecTypeVideo
+	if strings.HasPrefix(strings.ToLower(codec.codec.MimeType), "audio/") {
+		kind = webrtc.RTPCodecTypeAudio
+	}
+
+	ctx, cancel := context.WithCancel(publisher.Client().Context())
+
+	ingest := &RTPIngest{
+		mu:             sync.Mutex{},
+		context:        ctx,
+		cancel:         cancel,
+		publisher:      publisher,
+		conn:           conn,
+		rtcpConn:       rtcpConn,
+		rtpChan:        make(chan *rtp.Packet, rtpIngestBuffer),
+		payloadType:    codec.payloadType,
+		sfuPayloadType: uint8(codec.codec.PayloadType),
+		ssrc:           rand.Uint32(),
+		stats:          newRTPReceiverStats(codec.codec.ClockRate),
+	}
+
+	if err := r.sfu.AddRelayTrack(ctx, trackID, id, "", publisher.Client(), kind, webrtc.SSRC(ingest.ssrc), codec.codec.MimeType, ingest.rtpChan); err != nil {
+		cancel()
+		closeConns()
+		_ = publisher.Close()
+		return nil, err
+	}
+
+	for _, track := range r.sfu.getRelayTracks() {
+		if track.ID() == trackID && track.ClientID() == id {
+			ingest.track = track
+		}
+	}
+
+	interval := opts.ReceiverReportInterval
+	if interval == 0 {
+		interval = defaultReceiverReportInterval
+	}
+
+	ingest.wg.Add(3)
+
+	go func() {
+		defer ingest.wg.Done()
+
+		// the sockets are closed when the ingest, the publisher or the room is closed
+		<-ctx.Done()
+		closeConns()
+	}()
+
+	go ingest.readRTP()
+	go ingest.sendReceiverReports(interval)
+
+	if rtcpConn != nil {
+		ingest.wg.Add(1)
+		go ingest.readRTCP(rtcpConn)
+	}
+
+	return ingest, nil
+}
+
+// rtpIngestCodec finds the codec of the stream in the SDP or in the options
+func rtpIngestCodec(opts RTPIngestOptions) (ingestCodec, error) {
+	if opts.SDP == "" {
+		codec := getRTPParameters(opts.MimeType)
+		if codec.MimeType == "" {
+			return ingestCodec{}, ErrRTPIngestCodec
+		}
+
+		payloadType := opts.PayloadType
+		if payloadType == 0 {
+			payloadType = uint8(codec.PayloadType)
+		}
+
+		return ingestCodec{codec: codec, payloadType: payloadType}, nil
+	}
+
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(opts.SDP)); err != nil {
+		return ingestCodec{}, err
+	}
+
+	for _, media := range desc.MediaDescriptions {
+		for _, format := range media.MediaName.Formats {
+			payloadType, err := strconv.ParseUint(format, 10, 8)
+			if err != nil {
+				continue
+			}
+
+			sdpCodec, err := desc.GetCodecForPayloadType(uint8(payloadType))
+			if err != nil {
+				continue
+			}
+
+			mimeType := media.MediaName.Media + "/" + sdpCodec.Name
+
+			for _, codecs := range [][]webrtc.RTPCodecParameters{audioCodecs, videoCodecs} {
+				for _, codec := range codecs {
+					if strings.EqualFold(codec.MimeType, mimeType) && codec.ClockRate == sdpCodec.ClockRate {
+						return ingestCodec{codec: codec, payloadType: uint8(payloadType), port: media.MediaName.Port.Value}, nil
+					}
+				}
+			}
+		}
+	}
+
+	return ingestCodec{}, ErrRTPIngestSDP
+}
+
+// LocalAddr returns the address of the RTP socket
+func (i *RTPIngest) LocalAddr() *net.UDPAddr {
+	return i.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// RTCPAddr returns the address of the RTCP socket, it's the RTP address when RTCP is multiplexed
+func (i *RTPIngest) RTCPAddr() *net.UDPAddr {
+	if i.rtcpConn != nil {
+		return i.rtcpConn.LocalAddr().(*net.UDPAddr)
+	}
+
+	return i.LocalAddr()
+}
+
+// Track returns the published relay track
+func (i *RTPIngest) Track() ITrack {
+	return i.track
+}
+
+// Publisher returns the virtual publisher that owns the track
+func (i *RTPIngest) Publisher() *VirtualPublisher {
+	return i.publisher
+}
+
+func (i *RTPIngest) Stats() RTPIngestStats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	report := i.stats.report(i.latchedSSRC, time.Now(), false)
+
+	return RTPIngestStats{
+		PacketsReceived: uint64(i.stats.received),
+		PacketsDropped:  i.dropped,
+		PacketsLost:     report.TotalLost,
+		Jitter:          report.Jitter,
+		SSRC:            i.latchedSSRC,
+		RemoteAddr:      i.remote,
+	}
+}
+
+// Close closes the sockets, ends the track and removes the publisher from the room
+func (i *RTPIngest) Close() error {
+	i.cancel()
+	i.wg.Wait()
+
+	return i.publisher.Close()
+}
+
+func (i *RTPIngest) readRTP() {
+	defer i.wg.Done()
+
+	// the relay track is ended when the channel is closed
+	defer close(i.rtpChan)
+
+	buf := make([]byte, rtpIngestMaxPacketSize)
+
+	for {
+		n, addr, err := i.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		if n < 2 {
+			continue
+		}
+
+		// the RTCP packets of a multiplexed stream
+		if i.rtcpConn == nil && buf[1] >= rtcpPacketTypeMin && buf[1] <= rtcpPacketTypeMax {
+			i.onRTCP(buf[:n], addr)
+			continue
+		}
+
+		p := &rtp.Packet{}
+		if err := p.Unmarshal(append([]byte(nil), buf[:n]...)); err != nil {
+			continue
+		}
+
+		if !i.latch(p, addr) {
+			continue
+		}
+
+		p.SSRC = i.ssrc
+		p.PayloadType = i.sfuPayloadType
+
+		select {
+		case i.rtpChan <- p:
+		default:
+			// the track is not read fast enough, the packet is dropped like a lost UDP packet
+		}
+	}
+}
+
+// latch accepts the packets of the latched source, a new source is latched when the latched source stopped sending
+func (i *RTPIngest) latch(p *rtp.Packet, addr *net.UDPAddr) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+
+	if p.PayloadType != i.payloadType {
+		i.dropped++
+		return false
+	}
+
+	if i.remote == nil || (p.SSRC != i.latchedSSRC && now.Sub(i.lastReceived) > rtpIngestLatchTimeout) {
+		if i.remote != nil {
+			i.publisher.Client().log.Infof("rtpingest: source changed from %d to %d", i.latchedSSRC, p.SSRC)
+		}
+
+		i.remote = addr
+		i.latchedSSRC = p.SSRC
+		i.stats = newRTPReceiverStats(i.stats.clockRate)
+	}
+
+	if p.SSRC != i.latchedSSRC {
+		i.dropped++
+		return false
+	}
+
+	i.lastReceived = now
+	i.stats.update(p, now)
+
+	return true
+}
+
+func (i *RTPIngest) readRTCP(conn *net.UDPConn) {
+	defer i.wg.Done()
+
+	buf := make([]byte, rtpIngestMaxPacketSize)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		i.onRTCP(buf[:n], addr)
+	}
+}
+
+// onRTCP passes the sender reports of the latched source to the track, the address of the report is used
+// to send the receiver reports
+func (i *RTPIngest) onRTCP(buf []byte, addr *net.UDPAddr) {
+	packets, err := rtcp.Unmarshal(buf)
+	if err != nil {
+		return
+	}
+
+	for _, packet := range packets {
+		sr, ok := packet.(*rtcp.SenderReport)
+		if !ok {
+			continue
+		}
+
+		i.mu.Lock()
+		if i.remote == nil || sr.SSRC != i.latchedSSRC {
+			i.mu.Unlock()
+			continue
+		}
+
+		i.rtcpRemote = addr
+		i.stats.senderReport(sr, time.Now())
+		i.mu.Unlock()
+
+		if track, ok := i.track.(*Track); ok {
+			track.onSenderReport(sr)
+		}
+	}
+}
+
+func (i *RTPIngest) sendReceiverReports(interval time.Duration) {
+	defer i.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.context.Done():
+			return
+		case <-ticker.C:
+			i.sendReceiverReport()
+		}
+	}
+}
+
+func (i *RTPIngest) sendReceiverReport() {
+	i.mu.Lock()
+	if i.remote == nil || i.stats.received == 0 {
+		i.mu.Unlock()
+		return
+	}
+
+	remote := i.rtcpRemote
+	if remote == nil {
+		// the RTCP port of the sender is the next port unless it's multiplexed
+		remote = i.remote
+		if i.rtcpConn != nil {
+			remote = &net.UDPAddr{IP: i.remote.IP, Port: i.remote.Port + 1, Zone: i.remote.Zone}
+		}
+	}
+
+	rr := &rtcp.ReceiverReport{
+		SSRC:    i.ssrc,
+		Reports: []rtcp.ReceptionReport{i.stats.report(i.latchedSSRC, time.Now(), true)},
+	}
+	i.mu.Unlock()
+
+	data, err := rr.Marshal()
+	if err != nil {
+		return
+	}
+
+	conn := i.conn
+	if i.rtcpConn != nil {
+		conn = i.rtcpConn
+	}
+
+	if _, err := conn.WriteToUDP(data, remote); err != nil {
+		i.publisher.Client().log.Warnf("rtpingest: failed to send receiver report: %s", err.Error())
+	}
+}
+
+// rtpReceiverStats calculates the reception report of a source, see RFC 3550 appendix A.3 and A.8
+type rtpReceiverStats struct {
+	clockRate     uint32
+	start         time.Time
+	started       bool
+	baseSeq       uint32
+	maxSeq        uint16
+	cycles        uint32
+	received      uint32
+	expectedPrior uint32
+	receivedPrior uint32
+	transit       int64
+	jitter        float64
+	lastSR        uint32
+	lastSRTime    time.Time
+}
+
+func newRTPReceiverStats(clockRate uint32) *rtpReceiverStats {
+	return &rtpReceiverStats{
+		clockRate: clockRate,
+		start:     time.Now(),
+	}
+}
+
+func (s *rtpReceiverStats) update(p *rtp.Packet, arrival time.Time) {
+	// the arrival time in the clock rate of the codec
+	arrivalTS := int64(arrival.Sub(s.start).Seconds() * float64(s.clockRate))
+	transit := arrivalTS - int64(p.Timestamp)
+
+	if !s.started {
+		s.started = true
+		s.baseSeq = uint32(p.SequenceNumber)
+		s.maxSeq = p.SequenceNumber
+		s.transit = transit
+		s.received++
+
+		return
+	}
+
+	if delta := p.SequenceNumber - s.maxSeq; delta != 0 && delta < 1<<15 {
+		if p.SequenceNumber < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+
+		s.maxSeq = p.SequenceNumber
+	}
+
+	s.received++
+
+	d := transit - s.transit
+	if d < 0 {
+		d = -d
+	}
+
+	s.transit = transit
+	s.jitter += (float64(d) - s.jitter) / 16
+}
+
+func (s *rtpReceiverStats) senderReport(sr *rtcp.SenderReport, now time.Time) {
+	// the middle 32 bits of the NTP timestamp
+	s.lastSR = uint32(sr.NTPTime >> 16)
+	s.lastSRTime = now
+}
+
+// report returns the reception report, the interval of the fraction lost starts at the previous sent report
+func (s *rtpReceiverStats) report(ssrc uint32, now time.Time, sent bool) rtcp.ReceptionReport {
+	extendedMax := s.cycles + uint32(s.maxSeq)
+	expected := extendedMax - s.baseSeq + 1
+
+	lost := int64(expected) - int64(s.received)
+	if lost < 0 || !s.started {
+		lost = 0
+	}
+
+	if lost > 0x7fffff {
+		lost = 0x7fffff
+	}
+
+	expectedInterval := expected - s.expectedPrior
+	receivedInterval := s.received - s.receivedPrior
+
+	var fractionLost uint8
+	if expectedInterval > 0 && expectedInterval > receivedInterval {
+		fractionLost = uint8(((expectedInterval - receivedInterval) << 8) / expectedInterval)
+	}
+
+	if sent {
+		s.expectedPrior = expected
+		s.receivedPrior = s.received
+	}
+
+	var delay uint32
+	if s.lastSR != 0 {
+		delay = uint32(now.Sub(s.lastSRTime).Seconds() * 65536)
+	}
+
+	return rtcp.ReceptionReport{
+		SSRC:               ssrc,
+		FractionLost:       fractionLost,
+		TotalLost:          uint32(lost),
+		LastSequenceNumber: extendedMax,
+		Jitter:             uint32(s.jitter),
+		LastSenderReport:   s.lastSR,
+		Delay:              delay,
+	}
+}
@@ -0,0 +1,169 @@
+package sfu
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const ingestSDP = `v=0
+o=- 0 0 IN IP4 127.0.0.1
+s=ingest
+c=IN IP4 127.0.0.1
+t=0 0
+m=audio 5004 RTP/AVP 100
+a=rtpmap:100 opus/48000/2
+`
+
+func TestRTPIngest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	_, err = testRoom.AddRTPIngest(RTPIngestOptions{Address: "127.0.0.1:0", MimeType: "audio/unknown"})
+	require.ErrorIs(t, err, ErrRTPIngestCodec)
+
+	ingest, err := testRoom.AddRTPIngest(RTPIngestOptions{
+		Address:                "127.0.0.1:0",
+		SDP:                    ingestSDP,
+		TrackID:                "encoder",
+		ReceiverReportInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	track := ingest.Track()
+	require.NotNil(t, track)
+	require.Equal(t, webrtc.MimeTypeOpus, track.MimeType())
+	require.True(t, track.IsRelay())
+
+	var read atomic.Int32
+	var lastSSRC, lastPT atomic.Uint32
+
+	track.(*Track).OnRead(func(p *rtp.Packet, _ QualityLevel) {
+		read.Add(1)
+		lastSSRC.Store(p.SSRC)
+		lastPT.Store(uint32(p.PayloadType))
+	})
+
+	sender, err := net.DialUDP("udp", nil, ingest.LocalAddr())
+	require.NoError(t, err)
+	defer sender.Close()
+
+	send := func(ssrc uint32, payloadType uint8, seq uint16) {
+		p := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    payloadType,
+				SequenceNumber: seq,
+				Timestamp:      uint32(seq) * 960,
+				SSRC:           ssrc,
+			},
+			Payload: []byte{0xf8, 0xff, 0xfe},
+		}
+
+		data, err := p.Marshal()
+		require.NoError(t, err)
+
+		_, err = sender.Write(data)
+		require.NoError(t, err)
+	}
+
+	// the packets of the second source and with another payload type are dropped, one packet is lost
+	for seq := uint16(1); seq <= 10; seq++ {
+		if seq != 5 {
+			send(1234, 100, seq)
+		}
+
+		send(5678, 100, seq)
+		send(1234, 101, seq)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	require.Eventually(t, func() bool {
+		return read.Load() == 9
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, uint32(track.(*Track).SSRC()), lastSSRC.Load())
+	require.Equal(t, uint32(getPayloadType(webrtc.MimeTypeOpus)), lastPT.Load())
+
+	stats := ingest.Stats()
+	require.Equal(t, uint64(9), stats.PacketsReceived)
+	require.Equal(t, uint64(20), stats.PacketsDropped)
+	require.Equal(t, uint32(1), stats.PacketsLost)
+	require.Equal(t, uint32(1234), stats.SSRC)
+
+	// the sender report is answered with a receiver report on the multiplexed socket
+	sr := &rtcp.SenderReport{SSRC: 1234, NTPTime: 0x0123456789abcdef, RTPTime: 9600}
+	data, err := sr.Marshal()
+	require.NoError(t, err)
+	_, err = sender.Write(data)
+	require.NoError(t, err)
+
+	require.NoError(t, sender.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var report *rtcp.ReceptionReport
+
+	for report == nil {
+		buf := make([]byte, 1500)
+		n, err := sender.Read(buf)
+		require.NoError(t, err)
+
+		packets, err := rtcp.Unmarshal(buf[:n])
+		require.NoError(t, err)
+
+		rr, ok := packets[0].(*rtcp.ReceiverReport)
+		require.True(t, ok)
+		require.Len(t, rr.Reports, 1)
+
+		if rr.Reports[0].LastSenderReport != 0 {
+			report = &rr.Reports[0]
+		}
+	}
+
+	require.Equal(t, uint32(1234), report.SSRC)
+	require.Equal(t, uint32(1), report.TotalLost)
+	require.Equal(t, uint32(10), report.LastSequenceNumber)
+	require.Equal(t, uint32(0x456789ab), report.LastSenderReport)
+
+	require.NoError(t, ingest.Close())
+
+	require.Eventually(t, func() bool {
+		return len(testRoom.SFU().getRelayTracks()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = testRoom.SFU().GetClient(ingest.Publisher().ID())
+	require.ErrorIs(t, err, ErrClientNotFound)
+
+	// the sockets are closed when the publisher is closed without closing the ingest
+	ingest, err = testRoom.AddRTPIngest(RTPIngestOptions{Address: "127.0.0.1:0", SDP: ingestSDP, SeparateRTCP: true})
+	require.NoError(t, err)
+
+	rtpAddr, rtcpAddr := ingest.LocalAddr(), ingest.RTCPAddr()
+
+	require.NoError(t, ingest.Publisher().Close())
+
+	require.Eventually(t, func() bool {
+		for _, addr := range []*net.UDPAddr{rtpAddr, rtcpAddr} {
+			conn, err := net.ListenUDP("udp", addr)
+			if err != nil {
+				return false
+			}
+
+			_ = conn.Close()
+		}
+
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -78,6 +78,21 @@ func (s *SFUClients) Length() int {
 	return len(s.clients)
 }
 
+// VisibleLength returns the number of the clients that are not hidden
+func (s *SFUClients) VisibleLength() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, client := range s.clients {
+		if !client.IsHidden() {
+			count++
+		}
+	}
+
+	return count
+}
+
 func (s *SFUClients) Add(client *Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -115,10 +130,12 @@ type SFU struct {
 	mu                        sync.Mutex
 	onStop                    func()
 	pliInterval               time.Duration
+	gopCacheSize              int
 	qualityRef                QualityPresets
-	onTrackAvailableCallbacks []func(tracks []ITrack)
+	onTrackAvailableCallbacks []*func(tracks []ITrack)
 	onClientRemovedCallbacks  []func(*Client)
 	onClientAddedCallbacks    []func(*Client)
+	onDataMessageCallbacks    []func(clientID string, label string, msg webrtc.DataChannelMessage)
 	relayTracks               map[string]ITrack
 	clientStats               map[string]*ClientStats
 	log                       logging.LeveledLogger
@@ -138,6 +155,7 @@ type sfuOptions struct {
 	PLIInterval    time.Duration
 	Log            logging.LeveledLogger
 	SettingEngine  *webrtc.SettingEngine
+	GOPCacheSize   int
 }
 
 // @Param muxPort: port for udp mux
@@ -154,9 +172,10 @@ func New(ctx context.Context, opts sfuOptions) *SFU {
 		iceServers:                opts.IceServers,
 		bitrateConfigs:            opts.Bitrates,
 		pliInterval:               opts.PLIInterval,
+		gopCacheSize:              opts.GOPCacheSize,
 		qualityRef:                opts.QualityPresets,
 		relayTracks:               make(map[string]ITrack),
-		onTrackAvailableCallbacks: make([]func(tracks []ITrack), 0),
+		onTrackAvailableCallbacks: make([]*func(tracks []ITrack), 0),
 		onClientRemovedCallbacks:  make([]func(*Client), 0),
 		onClientAddedCallbacks:    make([]func(*Client), 0),
 		log:                       opts.Log,
@@ -200,6 +219,19 @@ func (s *SFU) NewClient(id, name string, opts ClientOptions) *Client {
 	return client
 }
 
+// getRelayTracks returns the relay tracks that are not ended
+func (s *SFU) getRelayTracks() []ITrack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracks := make([]ITrack, 0, len(s.relayTracks))
+	for _, track := range s.relayTracks {
+		tracks = append(tracks, track)
+	}
+
+	return tracks
+}
+
 func (s *SFU) AvailableTracks() []ITrack {
 	tracks := make([]ITrack, 0)
 
@@ -220,6 +252,10 @@ func (s *SFU) syncTrack(client *Client) {
 	subscribes := make([]SubscribeTrackRequest, 0)
 
 	for _, clientPeer := range s.clients.GetClients() {
+		if clientPeer.IsHidden() {
+			continue
+		}
+
 		for _, track := range clientPeer.tracks.GetTracks() {
 			if client.ID() != clientPeer.ID() {
 				if !slices.Contains(publishedTrackIDs, track.ID()) {
@@ -293,16 +329,24 @@ func (s *SFU) onClientRemoved(client *Client) {
 }
 
 func (s *SFU) onTracksAvailable(clientId string, tracks []ITrack) {
+	// the tracks of a hidden client are only seen by the server side callbacks
+	owner, err := s.clients.GetClient(clientId)
+	hidden := err == nil && owner.IsHidden()
+
 	for _, client := range s.clients.GetClients() {
-		if client.ID() != clientId {
+		if client.ID() != clientId && !hidden {
 			client.onTracksAvailable(tracks)
 			s.log.Infof("sfu: client %s have %d tracks available ", client.ID(), len(tracks))
 		}
 	}
 
-	for _, callback := range s.onTrackAvailableCallbacks {
-		if callback != nil {
-			callback(tracks)
+	s.mu.Lock()
+	callbacks := s.onTrackAvailableCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		if *callback != nil {
+			(*callback)(tracks)
 		}
 	}
 }
@@ -355,7 +399,7 @@ func (s *SFU) setupMessageForwarder(clientID string, d *webrtc.DataChannel) {
 	d.OnMessage(func(msg webrtc.DataChannelMessage) {
 		// broadcast to all clients
 		s.mu.Lock()
-		defer s.mu.Unlock()
+		callbacks := s.onDataMessageCallbacks
 
 		for _, client := range s.clients.GetClients() {
 			// skip the sender
@@ -376,9 +420,22 @@ func (s *SFU) setupMessageForwarder(clientID string, d *webrtc.DataChannel) {
 				dc.Send(msg.Data)
 			}
 		}
+		s.mu.Unlock()
+
+		for _, callback := range callbacks {
+			callback(clientID, d.Label(), msg)
+		}
 	})
 }
 
+// OnDataChannelMessage is called with the messages of the data channels that are forwarded to the other clients
+func (s *SFU) OnDataChannelMessage(callback func(clientID string, label string, msg webrtc.DataChannelMessage)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDataMessageCallbacks = append(s.onDataMessageCallbacks, callback)
+}
+
 func (s *SFU) createExistingDataChannels(c *Client) {
 	for _, dc := range s.dataChannels.dataChannels {
 		initOpts := &webrtc.DataChannelInit{
@@ -414,6 +471,13 @@ func (s *SFU) PLIInterval() time.Duration {
 	return s.pliInterval
 }
 
+func (s *SFU) GOPCacheSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.gopCacheSize
+}
+
 func (s *SFU) QualityPresets() QualityPresets {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -421,37 +485,59 @@ func (s *SFU) QualityPresets() QualityPresets {
 	return s.qualityRef
 }
 
-func (s *SFU) OnTracksAvailable(callback func(tracks []ITrack)) {
+func (s *SFU) OnTracksAvailable(callback func(tracks []ITrack)) *TrackCallback {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.onTrackAvailableCallbacks = append(s.onTrackAvailableCallbacks, callback)
+	s.onTrackAvailableCallbacks = append(s.onTrackAvailableCallbacks, &callback)
+
+	return newTrackCallback(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.onTrackAvailableCallbacks = removeTrackCallback(s.onTrackAvailableCallbacks, &callback)
+	})
 }
 
 func (s *SFU) AddRelayTrack(ctx context.Context, id, streamid, rid string, client *Client, kind webrtc.RTPCodecType, ssrc webrtc.SSRC, mimeType string, rtpChan chan *rtp.Packet) error {
+	_, err := s.addRelayTrack(ctx, id, streamid, rid, client, kind, ssrc, mimeType, rtpChan, func() {})
+
+	return err
+}
+
+// addRelayTrack adds the relay track and returns it, onPLI is called when a subscriber requests a keyframe
+func (s *SFU) addRelayTrack(ctx context.Context, id, streamid, rid string, client *Client, kind webrtc.RTPCodecType, ssrc webrtc.SSRC, mimeType string, rtpChan chan *rtp.Packet, onPLI func()) (ITrack, error) {
 	var track ITrack
 
 	relayTrack := NewTrackRelay(id, streamid, rid, kind, ssrc, mimeType, rtpChan)
 
-	onPLI := func() {}
-
 	if rid == "" {
 		// not simulcast
 		var err error
 		track, err = newTrack(ctx, client, relayTrack, 0, 0, s.pliInterval, onPLI, nil, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		s.mu.Lock()
 		s.relayTracks[relayTrack.ID()] = track
 		s.mu.Unlock()
+
+		// the track is ended when the rtp channel is closed
+		track.OnEnded(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			if s.relayTracks[id] == track {
+				delete(s.relayTracks, id)
+			}
+		})
 	} else {
 		// simulcast
 		var simulcast *SimulcastTrack
 		var ok bool
 
 		s.mu.Lock()
-		track, ok := s.relayTracks[relayTrack.ID()]
+		track, ok = s.relayTracks[relayTrack.ID()]
 		if !ok {
 			// if track not found, add it
 			track = newSimulcastTrack(client, relayTrack, 0, 0, s.pliInterval, onPLI, nil, nil)
@@ -469,5 +555,5 @@ func (s *SFU) AddRelayTrack(ctx context.Context, id, streamid, rid string, clien
 	// notify the local clients that a relay track is available
 	s.onTracksAvailable(client.ID(), []ITrack{track})
 
-	return nil
+	return track, nil
 }
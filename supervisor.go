@@ -0,0 +1,187 @@
+package sfu
+
+import (
+	"errors"
+
+	"github.com/pion/webrtc/v4"
+)
+
+type SupervisorMode string
+
+const (
+	// The supervisor hears the call, nobody hears the supervisor
+	SupervisorModeListen SupervisorMode = "listen"
+	// The supervisor hears the call, only the agent hears the supervisor
+	SupervisorModeWhisper SupervisorMode = "whisper"
+	// The supervisor hears the call and everyone hears the supervisor
+	SupervisorModeBarge SupervisorMode = "barge"
+)
+
+var (
+	ErrSupervisorMode          = errors.New("supervisor: mode is not supported")
+	ErrSupervisorNotSupervisor = errors.New("supervisor: client is not a supervisor")
+	ErrSupervisorVisible       = errors.New("supervisor: client has already announced its tracks, add it as a hidden client")
+)
+
+type supervision struct {
+	agentID string
+	mode    SupervisorMode
+}
+
+// Supervise makes the client a hidden supervisor of the agent, or changes the mode of a supervisor. The other clients never
+// see the tracks of the supervisor in OnTracksAvailable, the room subscribes them to the tracks of the supervisor once and
+// the mode only changes who receives the packets, so the mode is switched without renegotiation.
+// The supervisor subscribes the tracks of the call like any client. A client that already announced its tracks to
+// the other clients can't be a supervisor, a supervisor that publishes before Supervise is added with ClientOptions.Hidden.
+func (r *Room) Supervise(supervisorID, agentID string, mode SupervisorMode) error {
+	switch mode {
+	case SupervisorModeListen, SupervisorModeWhisper, SupervisorModeBarge:
+	default:
+		return ErrSupervisorMode
+	}
+
+	supervisor, err := r.sfu.GetClient(supervisorID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.sfu.GetClient(agentID); err != nil {
+		return err
+	}
+
+	// hide the client first so a track that is published now is not announced
+	if !supervisor.hidden.Swap(true) && len(supervisor.announcedTracks()) > 0 {
+		supervisor.hidden.Store(false)
+		return ErrSupervisorVisible
+	}
+
+	r.mu.Lock()
+	if r.supervisors == nil {
+		r.supervisors = make(map[string]*supervision)
+	}
+
+	_, supervising := r.supervisors[supervisorID]
+	r.supervisors[supervisorID] = &supervision{agentID: agentID, mode: mode}
+	r.mu.Unlock()
+
+	tracks := supervisor.tracks.GetTracks()
+	r.applySupervision(supervisorID, tracks)
+
+	if !supervising {
+		for _, client := range r.sfu.clients.GetClients() {
+			r.subscribeSupervisorTracks(client, supervisorID, tracks)
+		}
+	}
+
+	return nil
+}
+
+// SupervisorMode returns the mode of the supervisor
+func (r *Room) SupervisorMode(supervisorID string) (SupervisorMode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.supervisors[supervisorID]
+	if !ok {
+		return "", ErrSupervisorNotSupervisor
+	}
+
+	return s.mode, nil
+}
+
+// applySupervision sets the subscribers of the supervisor tracks of the mode
+func (r *Room) applySupervision(supervisorID string, tracks []ITrack) {
+	r.mu.RLock()
+	s, ok := r.supervisors[supervisorID]
+	r.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	var allowed []string
+
+	switch s.mode {
+	case SupervisorModeListen:
+		allowed = []string{}
+	case SupervisorModeWhisper:
+		allowed = []string{s.agentID}
+	case SupervisorModeBarge:
+		allowed = nil
+	}
+
+	for _, track := range tracks {
+		if track.ClientID() == supervisorID {
+			track.SetAllowedSubscribers(allowed)
+		}
+	}
+}
+
+// subscribeSupervisorTracks subscribes the client to the tracks of the supervisor without announcing them
+func (r *Room) subscribeSupervisorTracks(client *Client, supervisorID string, tracks []ITrack) {
+	if client.ID() == supervisorID || client.Type() == ClientTypeVirtual || client.IsHidden() {
+		return
+	}
+
+	// the client is subscribed when it joins
+	if client.PeerConnection().PC().ConnectionState() != webrtc.PeerConnectionStateConnected {
+		return
+	}
+
+	newTracks := make([]ITrack, 0, len(tracks))
+	for _, track := range tracks {
+		if _, err := client.publishedTracks.Get(track.ID()); err == ErrTrackIsNotExists {
+			newTracks = append(newTracks, track)
+		}
+	}
+
+	if len(newTracks) > 0 {
+		client.subscribeTracks(newTracks)
+	}
+}
+
+// onSupervisorTracksAvailable applies the mode to the new tracks of a supervisor and subscribes the clients to them
+func (r *Room) onSupervisorTracksAvailable(tracks []ITrack) {
+	if len(tracks) == 0 {
+		return
+	}
+
+	supervisorID := tracks[0].ClientID()
+
+	r.mu.RLock()
+	_, ok := r.supervisors[supervisorID]
+	r.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	r.applySupervision(supervisorID, tracks)
+
+	for _, client := range r.sfu.clients.GetClients() {
+		r.subscribeSupervisorTracks(client, supervisorID, tracks)
+	}
+}
+
+// onSupervisedClientJoined subscribes a new client to the tracks of the supervisors
+func (r *Room) onSupervisedClientJoined(client *Client) {
+	r.mu.RLock()
+	supervisorIDs := make([]string, 0, len(r.supervisors))
+	for id := range r.supervisors {
+		supervisorIDs = append(supervisorIDs, id)
+	}
+	r.mu.RUnlock()
+
+	for _, id := range supervisorIDs {
+		if supervisor, err := r.sfu.GetClient(id); err == nil {
+			r.subscribeSupervisorTracks(client, id, supervisor.tracks.GetTracks())
+		}
+	}
+}
+
+func (r *Room) onSupervisorLeft(client *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.supervisors, client.ID())
+}
@@ -0,0 +1,127 @@
+package sfu
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomSupervise(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	defer testRoom.Close()
+
+	pcAgent, agent, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "agent", true, false)
+	defer pcAgent.PeerConnection.Close()
+
+	pcCustomer, customer, _, _ := CreatePeerPair(ctx, TestLogger, testRoom, DefaultTestIceServers(), "customer", true, false)
+	defer pcCustomer.PeerConnection.Close()
+
+	require.Eventually(t, func() bool {
+		return agent.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected &&
+			customer.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	var mu sync.Mutex
+	announced := make([]string, 0)
+
+	for _, client := range []*Client{agent, customer} {
+		client.OnTracksAvailable(func(tracks []ITrack) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, track := range tracks {
+				announced = append(announced, track.ClientID())
+			}
+		})
+	}
+
+	supervisor, err := testRoom.AddVirtualPublisher("supervisor", VirtualPublisherOptions{Name: "supervisor"})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, testRoom.Supervise("supervisor", agent.ID(), "coach"), ErrSupervisorMode)
+	require.ErrorIs(t, testRoom.Supervise("supervisor", "unknown", SupervisorModeWhisper), ErrClientNotFound)
+	require.NoError(t, testRoom.Supervise("supervisor", agent.ID(), SupervisorModeWhisper))
+	require.True(t, supervisor.Client().IsHidden())
+
+	mode, err := testRoom.SupervisorMode("supervisor")
+	require.NoError(t, err)
+	require.Equal(t, SupervisorModeWhisper, mode)
+
+	audio, err := supervisor.NewTrack("supervisor-audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	// the agent and the customer are subscribed without seeing the track
+	require.Eventually(t, func() bool {
+		_, agentSubscribed := agent.ClientTracks()["supervisor-audio"]
+		_, customerSubscribed := customer.ClientTracks()["supervisor-audio"]
+		return agentSubscribed && customerSubscribed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	require.NotContains(t, announced, "supervisor")
+	mu.Unlock()
+
+	err = customer.SubscribeTracks([]SubscribeTrackRequest{{ClientID: "supervisor", TrackID: "supervisor-audio"}})
+	require.ErrorIs(t, err, ErrTrackNotAllowed)
+
+	track := audio.Track()
+	require.True(t, track.IsSubscriberAllowed(agent.ID()))
+	require.False(t, track.IsSubscriberAllowed(customer.ID()))
+
+	// the mode is switched without new subscriptions
+	require.NoError(t, testRoom.Supervise("supervisor", agent.ID(), SupervisorModeBarge))
+	require.True(t, track.IsSubscriberAllowed(customer.ID()))
+	require.Nil(t, track.AllowedSubscribers())
+
+	require.NoError(t, testRoom.Supervise("supervisor", agent.ID(), SupervisorModeListen))
+	require.False(t, track.IsSubscriberAllowed(agent.ID()))
+	require.False(t, track.IsSubscriberAllowed(customer.ID()))
+	require.Empty(t, track.AllowedSubscribers())
+
+	require.NoError(t, supervisor.Close())
+
+	require.Eventually(t, func() bool {
+		_, err := testRoom.SupervisorMode("supervisor")
+		return err == ErrSupervisorNotSupervisor
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a client that already announced its tracks can't be a supervisor
+	visible, err := testRoom.AddVirtualPublisher("visible", VirtualPublisherOptions{Name: "visible"})
+	require.NoError(t, err)
+
+	_, err = visible.NewTrack("visible-audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, testRoom.Supervise("visible", agent.ID(), SupervisorModeListen), ErrSupervisorVisible)
+	require.False(t, visible.Client().IsHidden())
+
+	// a hidden client can publish before it supervises
+	hidden, err := testRoom.AddVirtualPublisher("hidden", VirtualPublisherOptions{Name: "hidden", Hidden: true})
+	require.NoError(t, err)
+
+	_, err = hidden.NewTrack("hidden-audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	require.NoError(t, testRoom.Supervise("hidden", agent.ID(), SupervisorModeWhisper))
+
+	require.Eventually(t, func() bool {
+		_, subscribed := agent.ClientTracks()["hidden-audio"]
+		return subscribed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	require.NotContains(t, announced, "hidden")
+	mu.Unlock()
+}
@@ -3,15 +3,17 @@ package sfu
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/logging"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
-	"github.com/quic-go/quic-go"
 	"github.com/samespace/sfu/pkg/networkmonitor"
 	"github.com/samespace/sfu/pkg/rtppool"
 	"github.com/samespace/sfu/recorder"
@@ -25,6 +27,7 @@ const (
 var (
 	ErrTrackExists      = errors.New("client: error track already exists")
 	ErrTrackIsNotExists = errors.New("client: error track is not exists")
+	ErrTrackNotAllowed  = errors.New("client: error track is not allowed for the client")
 )
 
 type TrackType string
@@ -42,8 +45,45 @@ type baseTrack struct {
 	kind         webrtc.RTPCodecType
 	codec        webrtc.RTPCodecParameters
 	isScreen     *atomic.Bool // source of the track, can be media or screen
+	isMuted      *atomic.Bool // muted by the server, subscribers receive silence or black frames
 	clientTracks *clientTrackList
 	pool         *rtppool.RTPPool
+	// the clients that can subscribe and receive the packets of the track, every client can subscribe when it's nil
+	allowedSubscribers atomic.Pointer[map[string]bool]
+}
+
+func (t *baseTrack) setAllowedSubscribers(clientIDs []string) {
+	if clientIDs == nil {
+		t.allowedSubscribers.Store(nil)
+		return
+	}
+
+	allowed := make(map[string]bool, len(clientIDs))
+	for _, id := range clientIDs {
+		allowed[id] = true
+	}
+
+	t.allowedSubscribers.Store(&allowed)
+}
+
+func (t *baseTrack) getAllowedSubscribers() []string {
+	allowed := t.allowedSubscribers.Load()
+	if allowed == nil {
+		return nil
+	}
+
+	clientIDs := make([]string, 0, len(*allowed))
+	for id := range *allowed {
+		clientIDs = append(clientIDs, id)
+	}
+
+	return clientIDs
+}
+
+func (t *baseTrack) isSubscriberAllowed(clientID string) bool {
+	allowed := t.allowedSubscribers.Load()
+
+	return allowed == nil || (*allowed)[clientID]
 }
 
 type ITrack interface {
@@ -56,7 +96,7 @@ type ITrack interface {
 	SetSourceType(TrackType)
 	SourceType() TrackType
 	SetAsProcessed()
-	OnRead(func(*rtp.Packet, QualityLevel))
+	OnRead(func(*rtp.Packet, QualityLevel)) *TrackCallback
 	IsScreen() bool
 	IsRelay() bool
 	Kind() webrtc.RTPCodecType
@@ -65,13 +105,18 @@ type ITrack interface {
 	Context() context.Context
 	Relay(func(webrtc.SSRC, *rtp.Packet))
 	PayloadType() webrtc.PayloadType
-	OnEnded(func())
-	StartRecording(quic.SendStream) error
+	OnEnded(func()) *TrackCallback
+	StartRecording(recorder.NewTrackRecorderFunc) error
 	StopRecording()
 	PauseRecording()
 	ContinueRecording()
+	MarkRecording(label string, at time.Time)
+	RotateRecording(fileName string, at time.Time)
 	Mute()
 	Unmute()
+	SetAllowedSubscribers(clientIDs []string)
+	AllowedSubscribers() []string
+	IsSubscriberAllowed(clientID string) bool
 }
 
 type Track struct {
@@ -79,12 +124,14 @@ type Track struct {
 	mu               sync.Mutex
 	base             *baseTrack
 	remoteTrack      *remoteTrack
-	onEndedCallbacks []func()
-	onReadCallbacks  []func(*rtp.Packet, QualityLevel)
-	trackRecorder    recorder.TrackRecorder
+	onEndedCallbacks []*func()
+	onReadCallbacks  []*func(*rtp.Packet, QualityLevel)
+	recording        *trackRecording
 	isRecording      atomic.Bool
 	isPaused         atomic.Bool
-	isMuted          atomic.Bool
+	gopCache         *gopCache
+	// the telephone events of an audio track, they're detected as DTMF digits and not forwarded
+	dtmf atomic.Pointer[dtmfReceiver]
 }
 
 func newTrack(ctx context.Context, client *Client, trackRemote IRemoteTrack, minWait, maxWait, pliInterval time.Duration, onPLI func(), stats stats.Getter, onStatsUpdated func(*stats.Stats)) (ITrack, error) {
@@ -93,6 +140,7 @@ func newTrack(ctx context.Context, client *Client, trackRemote IRemoteTrack, min
 	baseTrack := &baseTrack{
 		id:           trackRemote.ID(),
 		isScreen:     &atomic.Bool{},
+		isMuted:      &atomic.Bool{},
 		msid:         trackRemote.Msid(),
 		streamid:     trackRemote.StreamID(),
 		client:       client,
@@ -105,22 +153,38 @@ func newTrack(ctx context.Context, client *Client, trackRemote IRemoteTrack, min
 	t := &Track{
 		mu:               sync.Mutex{},
 		base:             baseTrack,
-		onReadCallbacks:  make([]func(*rtp.Packet, QualityLevel), 0),
-		onEndedCallbacks: make([]func(), 0),
+		onReadCallbacks:  make([]*func(*rtp.Packet, QualityLevel), 0),
+		onEndedCallbacks: make([]*func(), 0),
 		isRecording:      atomic.Bool{},
 		isPaused:         atomic.Bool{},
-		isMuted:          atomic.Bool{},
+	}
+
+	// VP9 is forwarded through the scaleable client track that drops and maps the layer packets, the replay is not supported there
+	if cacheSize := client.SFU().GOPCacheSize(); cacheSize > 0 && trackRemote.Kind() == webrtc.RTPCodecTypeVideo && trackRemote.Codec().MimeType != webrtc.MimeTypeVP9 {
+		t.gopCache = newGOPCache(trackRemote.Codec().MimeType, cacheSize)
 	}
 
 	onRead := func(p *rtp.Packet) {
+		if dtmf := t.dtmf.Load(); dtmf != nil && p.PayloadType == dtmf.payloadType {
+			if digit, duration, ok := dtmf.detect(p); ok {
+				client.onDTMF(digit, duration)
+			}
+
+			return
+		}
+
 		tracks := t.base.clientTracks.GetTracks()
 		if t.MimeType() == webrtc.MimeTypeOpus {
-			if t.isMuted.Load() {
+			if t.base.isMuted.Load() {
 				p = t.getSilencePacket(p)
 			}
 		}
 
 		for _, track := range tracks {
+			if !t.base.isSubscriberAllowed(track.Client().ID()) {
+				continue
+			}
+
 			//nolint:ineffassign,staticcheck // packet is from the pool
 			packet := pool.NewPacket(&p.Header, p.Payload)
 
@@ -135,6 +199,11 @@ func newTrack(ctx context.Context, client *Client, trackRemote IRemoteTrack, min
 			packet.Release()
 		}
 
+		// cache after pushing the packet, so a replay to a client track will contain the packets before the live packet
+		if t.gopCache != nil {
+			t.gopCache.Add(p)
+		}
+
 		//nolint:ineffassign // this is required
 		packet := pool.NewPacket(&p.Header, p.Payload)
 
@@ -142,17 +211,8 @@ func newTrack(ctx context.Context, client *Client, trackRemote IRemoteTrack, min
 		copyPacket.Header = *packet.Header()
 		copyPacket.Payload = packet.Payload()
 
-		if t.MimeType() == webrtc.MimeTypeOpus && t.trackRecorder != nil {
-			if t.isRecording.Load() {
-				var packet *rtp.Packet
-				if t.isPaused.Load() {
-					packet = t.getSilencePacket(copyPacket)
-				} else {
-					packet = copyPacket.Clone()
-				}
-				t.trackRecorder.WritePacket(packet)
-
-			}
+		if t.isRecording.Load() {
+			t.writeRecording(copyPacket)
 		}
 
 		t.onRead(copyPacket, QualityHigh)
@@ -180,56 +240,120 @@ func newTrack(ctx context.Context, client *Client, trackRemote IRemoteTrack, min
 	return t, nil
 }
 
+// Mute will send silence to the subscribers of an audio track, or a short burst of black frames on a video track
 func (t *Track) Mute() {
-	t.isMuted.CompareAndSwap(false, true)
+	t.base.isMuted.CompareAndSwap(false, true)
 }
 
 func (t *Track) Unmute() {
-	t.isMuted.CompareAndSwap(true, false)
+	t.base.isMuted.CompareAndSwap(true, false)
 }
 
-func (t *Track) StartRecording(stream quic.SendStream) error {
+// StartRecording records the track to the recorder, a video recording will request a keyframe and start from it
+func (t *Track) StartRecording(newRecorder recorder.NewTrackRecorderFunc) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.Kind() != webrtc.RTPCodecTypeAudio {
-		return nil
-	}
-
-	if t.trackRecorder != nil {
-		return t.trackRecorder.Close()
+	if t.recording != nil {
+		// replace the previous recording
+		_ = t.recording.Close()
+		t.recording = nil
 	}
 
-	tr, err := recorder.NewTrackRecorder(&recorder.TrackConfig{
+	recording, err := newTrackRecording(recorder.TrackConfig{
 		TrackID:  t.ID(),
 		ClientID: t.base.client.id,
-		RoomID:   t.base.client.roomId,
+		RoomID:   t.base.client.RoomID(),
 		MimeType: t.MimeType(),
-	}, stream)
-
+	}, t.Kind(), newRecorder, t.remoteTrack.sendPLI, t.base.client.log)
 	if err != nil {
 		return err
 	}
 
-	t.trackRecorder = tr
+	if t.isPaused.Load() {
+		recording.Pause()
+	}
+
+	t.recording = recording
 	t.isRecording.CompareAndSwap(false, true)
 	return nil
 }
 
 func (t *Track) StopRecording() {
-	if t.trackRecorder != nil {
-		t.trackRecorder.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		_ = t.recording.Close()
 	}
-	t.trackRecorder = nil
+	t.recording = nil
 	t.isRecording.CompareAndSwap(true, false)
+	// a new recording is not paused by the pause of the stopped recording
+	t.isPaused.Store(false)
 }
 
+// PauseRecording stops writing the packets to the recorder, the paused duration is recorded as a timestamp gap
 func (t *Track) PauseRecording() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.isPaused.CompareAndSwap(false, true)
+
+	if t.recording != nil {
+		t.recording.Pause()
+	}
 }
 
 func (t *Track) ContinueRecording() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.isPaused.CompareAndSwap(true, false)
+
+	if t.recording != nil {
+		t.recording.Resume()
+	}
+}
+
+// MarkRecording sends a label marker to the recorder
+func (t *Track) MarkRecording(label string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		t.recording.Mark(label, at)
+	}
+}
+
+// RotateRecording continues the recording in a new file, a video recording is rotated on the next keyframe
+func (t *Track) RotateRecording(fileName string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		t.recording.Rotate(fileName, at)
+	}
+}
+
+func (t *Track) writeRecording(p *rtp.Packet) {
+	t.mu.Lock()
+	recording := t.recording
+	t.mu.Unlock()
+
+	if recording != nil {
+		recording.Write(p)
+	}
+}
+
+// onSenderReport passes the RTCP sender report of the remote track to the recording
+func (t *Track) onSenderReport(sr *rtcp.SenderReport) {
+	t.mu.Lock()
+	recording := t.recording
+	t.mu.Unlock()
+
+	if recording != nil {
+		recording.SenderReport(sr.NTPTime, sr.RTPTime)
+	}
 }
 
 func (t *Track) IsRecording() bool {
@@ -265,8 +389,22 @@ func (t *Track) Context() context.Context {
 	return t.context
 }
 
+// setDTMFCodec enables the DTMF detection when the telephone events are negotiated with the clock rate of the track
+func (t *Track) setDTMFCodec(codecs []webrtc.RTPCodecParameters) {
+	for _, codec := range codecs {
+		if strings.EqualFold(codec.MimeType, MimeTypeTelephoneEvent) && codec.ClockRate == t.base.codec.ClockRate {
+			t.dtmf.Store(&dtmfReceiver{
+				payloadType: uint8(codec.PayloadType),
+				clockRate:   codec.ClockRate,
+			})
+
+			return
+		}
+	}
+}
+
 func (t *Track) createLocalTrack() *webrtc.TrackLocalStaticRTP {
-	track, newTrackErr := webrtc.NewTrackLocalStaticRTP(t.remoteTrack.track.Codec().RTPCodecCapability, t.base.id, t.base.streamid)
+	track, newTrackErr := webrtc.NewTrackLocalStaticRTP(t.base.codec.RTPCodecCapability, t.base.id, t.base.streamid)
 	if newTrackErr != nil {
 		panic(newTrackErr)
 	}
@@ -275,7 +413,7 @@ func (t *Track) createLocalTrack() *webrtc.TrackLocalStaticRTP {
 }
 
 func (t *Track) createOpusLocalTrack() *webrtc.TrackLocalStaticRTP {
-	c := t.remoteTrack.track.Codec().RTPCodecCapability
+	c := t.base.codec.RTPCodecCapability
 	c.MimeType = webrtc.MimeTypeOpus
 	c.SDPFmtpLine = "minptime=10;useinbandfec=1"
 	track, newTrackErr := webrtc.NewTrackLocalStaticRTP(c, t.base.id, t.base.streamid)
@@ -363,7 +501,10 @@ func (t *Track) subscribe(c *Client) iClientTrack {
 	}
 
 	if t.Kind() == webrtc.RTPCodecTypeVideo {
-		t.remoteTrack.sendPLI()
+		// replay the cached keyframe to the new subscriber if available, instead of requesting a new one from the publisher
+		if singleTrack, ok := ct.(*clientTrack); !ok || !singleTrack.requestGOPReplay() {
+			t.remoteTrack.sendPLI()
+		}
 	}
 
 	t.base.clientTracks.Add(ct)
@@ -390,22 +531,45 @@ func (t *Track) SetAsProcessed() {
 	t.base.isProcessed = true
 }
 
-func (t *Track) OnRead(callback func(*rtp.Packet, QualityLevel)) {
+// SetAllowedSubscribers sets the clients that can subscribe the track, the packets are only forwarded to the allowed clients
+// that are already subscribed so the routing can be changed without renegotiation. Every client is allowed when it's nil.
+func (t *Track) SetAllowedSubscribers(clientIDs []string) {
+	t.base.setAllowedSubscribers(clientIDs)
+}
+
+// AllowedSubscribers returns the clients that can subscribe the track, it's nil when every client is allowed
+func (t *Track) AllowedSubscribers() []string {
+	return t.base.getAllowedSubscribers()
+}
+
+func (t *Track) IsSubscriberAllowed(clientID string) bool {
+	return t.base.isSubscriberAllowed(clientID)
+}
+
+func (t *Track) OnRead(callback func(*rtp.Packet, QualityLevel)) *TrackCallback {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.onReadCallbacks = append(t.onReadCallbacks, callback)
+	t.onReadCallbacks = append(t.onReadCallbacks, &callback)
+
+	return newTrackCallback(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.onReadCallbacks = removeTrackCallback(t.onReadCallbacks, &callback)
+	})
 }
 
 func (t *Track) onRead(p *rtp.Packet, quality QualityLevel) {
 	t.mu.Lock()
-	defer t.mu.Unlock()
+	callbacks := t.onReadCallbacks
+	t.mu.Unlock()
 
-	for _, callback := range t.onReadCallbacks {
+	for _, callback := range callbacks {
 		copyPacket := t.base.pool.GetPacket()
 		copyPacket.Header = p.Header
 		copyPacket.Payload = p.Payload
-		callback(p, quality)
+		(*callback)(p, quality)
 		t.base.pool.PutPacket(copyPacket)
 	}
 }
@@ -424,19 +588,27 @@ func (t *Track) IsRelay() bool {
 	return t.remoteTrack.IsRelay()
 }
 
-func (t *Track) OnEnded(f func()) {
+func (t *Track) OnEnded(f func()) *TrackCallback {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.onEndedCallbacks = append(t.onEndedCallbacks, f)
+	t.onEndedCallbacks = append(t.onEndedCallbacks, &f)
+
+	return newTrackCallback(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.onEndedCallbacks = removeTrackCallback(t.onEndedCallbacks, &f)
+	})
 }
 
 func (t *Track) onEnded() {
 	t.mu.Lock()
-	defer t.mu.Unlock()
+	callbacks := t.onEndedCallbacks
+	t.mu.Unlock()
 
-	for _, f := range t.onEndedCallbacks {
-		f()
+	for _, f := range callbacks {
+		(*f)()
 	}
 }
 
@@ -466,11 +638,17 @@ type SimulcastTrack struct {
 	lastMidKeyframeTS           *atomic.Int64
 	lastLowKeyframeTS           *atomic.Int64
 	onAddedRemoteTrackCallbacks []func(*remoteTrack)
-	onReadCallbacks             []func(*rtp.Packet, QualityLevel)
+	onReadCallbacks             []*func(*rtp.Packet, QualityLevel)
 	pliInterval                 time.Duration
 	onNetworkConditionChanged   func(networkmonitor.NetworkConditionType)
 	reordered                   bool
-	onEndedCallbacks            []func()
+	onEndedCallbacks            []*func()
+	gopCacheHigh                *gopCache
+	gopCacheMid                 *gopCache
+	gopCacheLow                 *gopCache
+	recording                   *trackRecording
+	recordingQuality            QualityLevel
+	isRecordingPaused           bool
 }
 
 func newSimulcastTrack(client *Client, track IRemoteTrack, minWait, maxWait, pliInterval time.Duration, onPLI func(), stats stats.Getter, onStatsUpdated func(*stats.Stats)) ITrack {
@@ -480,6 +658,7 @@ func newSimulcastTrack(client *Client, track IRemoteTrack, minWait, maxWait, pli
 		base: &baseTrack{
 			id:           track.ID(),
 			isScreen:     &atomic.Bool{},
+			isMuted:      &atomic.Bool{},
 			msid:         track.Msid(),
 			streamid:     track.StreamID(),
 			client:       client,
@@ -496,12 +675,18 @@ func newSimulcastTrack(client *Client, track IRemoteTrack, minWait, maxWait, pli
 		lastLowKeyframeTS:           &atomic.Int64{},
 		onTrackCompleteCallbacks:    make([]func(), 0),
 		onAddedRemoteTrackCallbacks: make([]func(*remoteTrack), 0),
-		onReadCallbacks:             make([]func(*rtp.Packet, QualityLevel), 0),
+		onReadCallbacks:             make([]*func(*rtp.Packet, QualityLevel), 0),
 		pliInterval:                 pliInterval,
 		onNetworkConditionChanged: func(condition networkmonitor.NetworkConditionType) {
 			client.onNetworkConditionChanged(condition)
 		},
-		onEndedCallbacks: make([]func(), 0),
+		onEndedCallbacks: make([]*func(), 0),
+	}
+
+	if cacheSize := client.SFU().GOPCacheSize(); cacheSize > 0 {
+		t.gopCacheHigh = newGOPCache(track.Codec().MimeType, cacheSize)
+		t.gopCacheMid = newGOPCache(track.Codec().MimeType, cacheSize)
+		t.gopCacheLow = newGOPCache(track.Codec().MimeType, cacheSize)
 	}
 
 	t.context, t.cancel = context.WithCancel(client.Context())
@@ -516,23 +701,134 @@ func newSimulcastTrack(client *Client, track IRemoteTrack, minWait, maxWait, pli
 	return t
 }
 
-func (t *SimulcastTrack) Mute()   {}
-func (t *SimulcastTrack) Unmute() {}
+// Mute will send a short burst of black frames to the subscribers and drop the video until it's unmuted
+func (t *SimulcastTrack) Mute() {
+	t.base.isMuted.CompareAndSwap(false, true)
+}
+
+func (t *SimulcastTrack) Unmute() {
+	t.base.isMuted.CompareAndSwap(true, false)
+}
+
+// StartRecording records the highest available layer of the simulcast track to the recorder
+func (t *SimulcastTrack) StartRecording(newRecorder recorder.NewTrackRecorderFunc) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		// replace the previous recording
+		_ = t.recording.Close()
+		t.recording = nil
+	}
+
+	var remoteTrack *remoteTrack
+
+	switch {
+	case t.remoteTrackHigh != nil:
+		remoteTrack = t.remoteTrackHigh
+		t.recordingQuality = QualityHigh
+	case t.remoteTrackMid != nil:
+		remoteTrack = t.remoteTrackMid
+		t.recordingQuality = QualityMid
+	case t.remoteTrackLow != nil:
+		remoteTrack = t.remoteTrackLow
+		t.recordingQuality = QualityLow
+	default:
+		return ErrTrackIsNotExists
+	}
+
+	recording, err := newTrackRecording(recorder.TrackConfig{
+		TrackID:  t.ID(),
+		ClientID: t.base.client.id,
+		RoomID:   t.base.client.RoomID(),
+		MimeType: t.MimeType(),
+	}, t.Kind(), newRecorder, remoteTrack.sendPLI, t.base.client.log)
+	if err != nil {
+		return err
+	}
+
+	if t.isRecordingPaused {
+		recording.Pause()
+	}
+
+	t.recording = recording
 
-func (t *SimulcastTrack) StartRecording(stream quic.SendStream) error {
 	return nil
 }
 
 func (t *SimulcastTrack) StopRecording() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		_ = t.recording.Close()
+	}
 
+	t.recording = nil
+	t.isRecordingPaused = false
 }
 
 func (t *SimulcastTrack) PauseRecording() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
+	t.isRecordingPaused = true
+
+	if t.recording != nil {
+		t.recording.Pause()
+	}
 }
 
 func (t *SimulcastTrack) ContinueRecording() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.isRecordingPaused = false
+
+	if t.recording != nil {
+		t.recording.Resume()
+	}
+}
+
+func (t *SimulcastTrack) MarkRecording(label string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		t.recording.Mark(label, at)
+	}
+}
+
+func (t *SimulcastTrack) RotateRecording(fileName string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recording != nil {
+		t.recording.Rotate(fileName, at)
+	}
+}
+
+func (t *SimulcastTrack) writeRecording(p *rtp.Packet, quality QualityLevel) {
+	t.mu.RLock()
+	recording := t.recording
+	recordingQuality := t.recordingQuality
+	t.mu.RUnlock()
 
+	if recording != nil && quality == recordingQuality {
+		recording.Write(p)
+	}
+}
+
+// onSenderReport passes the RTCP sender report of the recorded layer to the recording
+func (t *SimulcastTrack) onSenderReport(sr *rtcp.SenderReport, quality QualityLevel) {
+	t.mu.RLock()
+	recording := t.recording
+	recordingQuality := t.recordingQuality
+	t.mu.RUnlock()
+
+	if recording != nil && quality == recordingQuality {
+		recording.SenderReport(sr.NTPTime, sr.RTPTime)
+	}
 }
 
 func (t *SimulcastTrack) ClientID() string {
@@ -643,6 +939,10 @@ func (t *SimulcastTrack) AddRemoteTrack(track IRemoteTrack, minWait, maxWait tim
 		tracks := t.base.clientTracks.GetTracks()
 
 		for _, track := range tracks {
+			if !t.base.isSubscriberAllowed(track.Client().ID()) {
+				continue
+			}
+
 			//nolint:ineffassign,staticcheck // packet is from the pool
 			packet := t.base.pool.NewPacket(&p.Header, p.Payload)
 
@@ -657,6 +957,10 @@ func (t *SimulcastTrack) AddRemoteTrack(track IRemoteTrack, minWait, maxWait tim
 			packet.Release()
 		}
 
+		if cache := t.getGOPCache(quality); cache != nil {
+			cache.Add(p)
+		}
+
 		//nolint:ineffassign // this is required
 		packet := t.base.pool.NewPacket(&p.Header, p.Payload)
 
@@ -664,6 +968,8 @@ func (t *SimulcastTrack) AddRemoteTrack(track IRemoteTrack, minWait, maxWait tim
 		copyPacket.Header = *packet.Header()
 		copyPacket.Payload = packet.Payload()
 
+		t.writeRecording(copyPacket, quality)
+
 		t.onRead(copyPacket, quality)
 
 		t.base.pool.PutPacket(copyPacket)
@@ -744,6 +1050,20 @@ func (t *SimulcastTrack) getRemoteTrack(q QualityLevel) *remoteTrack {
 	return nil
 }
 
+// getGOPCache returns the keyframe cache of the quality layer, nil if the cache is disabled
+func (t *SimulcastTrack) getGOPCache(q QualityLevel) *gopCache {
+	switch q {
+	case QualityHigh:
+		return t.gopCacheHigh
+	case QualityMid:
+		return t.gopCacheMid
+	case QualityLow:
+		return t.gopCacheLow
+	}
+
+	return nil
+}
+
 func (t *SimulcastTrack) subscribe(client *Client) iClientTrack {
 	// Create a local track, all our SFU clients will be fed via this track
 
@@ -882,16 +1202,40 @@ func (t *SimulcastTrack) MimeType() string {
 	return t.base.codec.MimeType
 }
 
-func (t *SimulcastTrack) OnRead(callback func(*rtp.Packet, QualityLevel)) {
+// SetAllowedSubscribers sets the clients that can subscribe the track, see Track.SetAllowedSubscribers
+func (t *SimulcastTrack) SetAllowedSubscribers(clientIDs []string) {
+	t.base.setAllowedSubscribers(clientIDs)
+}
+
+func (t *SimulcastTrack) AllowedSubscribers() []string {
+	return t.base.getAllowedSubscribers()
+}
+
+func (t *SimulcastTrack) IsSubscriberAllowed(clientID string) bool {
+	return t.base.isSubscriberAllowed(clientID)
+}
+
+func (t *SimulcastTrack) OnRead(callback func(*rtp.Packet, QualityLevel)) *TrackCallback {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.onReadCallbacks = append(t.onReadCallbacks, callback)
+	t.onReadCallbacks = append(t.onReadCallbacks, &callback)
+
+	return newTrackCallback(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.onReadCallbacks = removeTrackCallback(t.onReadCallbacks, &callback)
+	})
 }
 
 func (t *SimulcastTrack) onRead(p *rtp.Packet, quality QualityLevel) {
-	for _, callback := range t.onReadCallbacks {
-		callback(p, quality)
+	t.mu.RLock()
+	callbacks := t.onReadCallbacks
+	t.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		(*callback)(p, quality)
 	}
 }
 
@@ -993,22 +1337,56 @@ func (t *SimulcastTrack) IsRelay() bool {
 	return false
 }
 
-func (t *SimulcastTrack) OnEnded(f func()) {
+func (t *SimulcastTrack) OnEnded(f func()) *TrackCallback {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.onEndedCallbacks = append(t.onEndedCallbacks, f)
+	t.onEndedCallbacks = append(t.onEndedCallbacks, &f)
+
+	return newTrackCallback(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.onEndedCallbacks = removeTrackCallback(t.onEndedCallbacks, &f)
+	})
 }
 
 func (t *SimulcastTrack) onEnded() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+	t.mu.RLock()
+	callbacks := t.onEndedCallbacks
+	t.mu.RUnlock()
 
-	for _, f := range t.onEndedCallbacks {
-		f()
+	for _, f := range callbacks {
+		(*f)()
+	}
+}
+
+// TrackCallback is a callback that is registered with OnRead or OnEnded of a track, or with OnTracksAvailable of the SFU
+type TrackCallback struct {
+	once   sync.Once
+	remove func()
+}
+
+func newTrackCallback(remove func()) *TrackCallback {
+	return &TrackCallback{
+		once:   sync.Once{},
+		remove: remove,
 	}
 }
 
+// Remove unregisters the callback, a callback that is already running is not stopped
+func (c *TrackCallback) Remove() {
+	c.once.Do(c.remove)
+}
+
+// removeTrackCallback returns a copy of the callbacks without the callback, the callbacks are called
+// without holding the lock of the track so the slice is never changed in place
+func removeTrackCallback[T any](callbacks []*T, callback *T) []*T {
+	return slices.DeleteFunc(slices.Clone(callbacks), func(c *T) bool {
+		return c == callback
+	})
+}
+
 type SubscribeTrackRequest struct {
 	ClientID string `json:"client_id"`
 	TrackID  string `json:"track_id"`
@@ -0,0 +1,293 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const trackForwardBuffer = 512
+
+var (
+	ErrTrackForwardSameRoom = errors.New("manager: track can't be forwarded to its own room")
+	ErrTrackForwardCodec    = errors.New("manager: room doesn't support the codec of the track")
+	ErrTrackForwardHidden   = errors.New("manager: track of a hidden client can't be forwarded")
+)
+
+type TrackForwardOptions struct {
+	// The name of the publisher of the forwarded track in the target room, default is the name of the source client
+	Name string
+	// The simulcast layer that is forwarded when the track is a simulcast track, default is QualityHigh
+	Quality QualityLevel
+}
+
+type TrackForwardStats struct {
+	ID               string `json:"id"`
+	TrackID          string `json:"track_id"`
+	FromRoomID       string `json:"from_room_id"`
+	ToRoomID         string `json:"to_room_id"`
+	PacketsForwarded uint64 `json:"packets_forwarded"`
+	BytesForwarded   uint64 `json:"bytes_forwarded"`
+	PacketsDropped   uint64 `json:"packets_dropped"`
+}
+
+// TrackForward publishes a track of a room as a relay track in another room of the manager, like a keynote speaker
+// forwarded into overflow rooms. The clients of the target room see the track in OnTracksAvailable from a virtual
+// publisher and the keyframe requests of the subscribers are passed to the publisher of the source track.
+type TrackForward struct {
+	mu          sync.Mutex
+	id          string
+	context     context.Context
+	cancel      context.CancelFunc
+	track       ITrack
+	relayTrack  ITrack
+	from        *Room
+	to          *Room
+	publisher   *VirtualPublisher
+	quality     QualityLevel
+	rtpChan     chan *rtp.Packet
+	ssrc        uint32
+	payloadType uint8
+	closed      bool
+	packets     atomic.Uint64
+	octets      atomic.Uint64
+	dropped     atomic.Uint64
+	callbacks   []*TrackCallback
+}
+
+// ForwardTrack forwards a track of a room to another room until the forward is closed, the track is ended or one of
+// the rooms is closed. The track is a track of a client or a relay track, so a forwarded track can be forwarded again.
+// A track can be forwarded to many rooms but only once to the same room. The tracks of a hidden client are not
+// forwarded because they would be announced to the clients of the target room.
+func (m *Manager) ForwardTrack(trackID, fromRoomID, toRoomID string, opts TrackForwardOptions) (*TrackForward, error) {
+	if fromRoomID == toRoomID {
+		return nil, ErrTrackForwardSameRoom
+	}
+
+	m.mutex.RLock()
+	from, fromErr := m.getRoom(fromRoomID)
+	to, toErr := m.getRoom(toRoomID)
+	m.mutex.RUnlock()
+
+	if fromErr != nil {
+		return nil, fromErr
+	}
+
+	if toErr != nil {
+		return nil, toErr
+	}
+
+	track, err := from.sfu.getTrack(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner, err := from.sfu.GetClient(track.ClientID()); err == nil && owner.IsHidden() {
+		return nil, ErrTrackForwardHidden
+	}
+
+	if _, err := to.sfu.getTrack(trackID); err == nil {
+		return nil, ErrTrackExists
+	}
+
+	if !to.sfu.supportsCodec(track.MimeType()) {
+		return nil, ErrTrackForwardCodec
+	}
+
+	name := opts.Name
+	if client, err := from.sfu.GetClient(track.ClientID()); name == "" && err == nil {
+		name = client.Name()
+	}
+
+	quality := opts.Quality
+	if quality == QualityNone {
+		quality = QualityHigh
+	}
+
+	id := "forward-" + GenerateID(16)
+
+	publisher, err := to.AddVirtualPublisher(id, VirtualPublisherOptions{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(publisher.Client().Context())
+
+	forward := &TrackForward{
+		mu:          sync.Mutex{},
+		id:          id,
+		context:     ctx,
+		cancel:      cancel,
+		track:       track,
+		from:        from,
+		to:          to,
+		publisher:   publisher,
+		quality:     quality,
+		rtpChan:     make(chan *rtp.Packet, trackForwardBuffer),
+		ssrc:        rand.Uint32(),
+		payloadType: uint8(getPayloadType(track.MimeType())),
+	}
+
+	relayTrack, err := to.sfu.addRelayTrack(ctx, track.ID(), track.StreamID(), "", publisher.Client(), track.Kind(), webrtc.SSRC(forward.ssrc), track.MimeType(), forward.rtpChan, forward.requestKeyframe)
+	if err != nil {
+		cancel()
+		_ = publisher.Close()
+
+		return nil, err
+	}
+
+	forward.relayTrack = relayTrack
+
+	from.addTrackForward(forward)
+	to.addTrackForward(forward)
+
+	forward.mu.Lock()
+	forward.callbacks = []*TrackCallback{
+		track.OnRead(forward.onRead),
+		track.OnEnded(func() {
+			go forward.Close()
+		}),
+	}
+	forward.mu.Unlock()
+
+	// the forward is closed with the target room
+	go func() {
+		<-ctx.Done()
+		_ = forward.Close()
+	}()
+
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		forward.requestKeyframe()
+	}
+
+	return forward, nil
+}
+
+// ID returns the id of the forward, it's also the client id of the publisher of the forwarded track in the target room
+func (f *TrackForward) ID() string {
+	return f.id
+}
+
+// Track returns the source track
+func (f *TrackForward) Track() ITrack {
+	return f.track
+}
+
+// RelayTrack returns the track that is published in the target room
+func (f *TrackForward) RelayTrack() ITrack {
+	return f.relayTrack
+}
+
+func (f *TrackForward) Stats() TrackForwardStats {
+	return TrackForwardStats{
+		ID:               f.id,
+		TrackID:          f.track.ID(),
+		FromRoomID:       f.from.ID(),
+		ToRoomID:         f.to.ID(),
+		PacketsForwarded: f.packets.Load(),
+		BytesForwarded:   f.octets.Load(),
+		PacketsDropped:   f.dropped.Load(),
+	}
+}
+
+// Close stops the forward and ends the track in the target room, the source track is not changed
+func (f *TrackForward) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+
+	f.closed = true
+	// the relay track is ended when the channel is closed
+	close(f.rtpChan)
+	callbacks := f.callbacks
+	f.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback.Remove()
+	}
+
+	f.cancel()
+
+	f.from.removeTrackForward(f.id)
+	f.to.removeTrackForward(f.id)
+
+	return f.publisher.Close()
+}
+
+func (f *TrackForward) onRead(p *rtp.Packet, quality QualityLevel) {
+	if f.track.IsSimulcast() && quality != f.quality {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+
+	packet := p.Clone()
+	packet.SSRC = f.ssrc
+	packet.PayloadType = f.payloadType
+	// the header extensions are negotiated with the publisher, the subscribers of the target room don't know them
+	packet.Extension = false
+	packet.Extensions = nil
+
+	select {
+	case f.rtpChan <- packet:
+		f.packets.Add(1)
+		f.octets.Add(uint64(len(packet.Payload)))
+	default:
+		// the relay track is not read fast enough
+		f.dropped.Add(1)
+	}
+}
+
+func (f *TrackForward) requestKeyframe() {
+	switch track := f.track.(type) {
+	case *Track:
+		track.remoteTrack.sendPLI()
+	case *SimulcastTrack:
+		if remoteTrack := track.getRemoteTrack(f.quality); remoteTrack != nil {
+			remoteTrack.sendPLI()
+		}
+	}
+}
+
+func (r *Room) addTrackForward(forward *TrackForward) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.trackForwards == nil {
+		r.trackForwards = make(map[string]*TrackForward)
+	}
+
+	r.trackForwards[forward.id] = forward
+}
+
+func (r *Room) removeTrackForward(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.trackForwards, id)
+}
+
+// TrackForwards returns the forwards from and to the room
+func (r *Room) TrackForwards() []*TrackForward {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	forwards := make([]*TrackForward, 0, len(r.trackForwards))
+	for _, forward := range r.trackForwards {
+		forwards = append(forwards, forward)
+	}
+
+	return forwards
+}
@@ -0,0 +1,115 @@
+package sfu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerForwardTrack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	stage, err := roomManager.NewRoom(roomManager.CreateRoomID(), "stage", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	overflow, err := roomManager.NewRoom(roomManager.CreateRoomID(), "overflow", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	speaker, err := stage.AddVirtualPublisher("speaker", VirtualPublisherOptions{Name: "keynote"})
+	require.NoError(t, err)
+
+	audio, err := speaker.NewTrack("keynote-audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	pc, listener, _, _ := CreatePeerPair(ctx, TestLogger, overflow, DefaultTestIceServers(), "listener", true, false)
+	defer pc.PeerConnection.Close()
+
+	require.Eventually(t, func() bool {
+		return listener.PeerConnection().PC().ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 30*time.Second, 100*time.Millisecond)
+
+	_, err = roomManager.ForwardTrack("keynote-audio", stage.ID(), stage.ID(), TrackForwardOptions{})
+	require.ErrorIs(t, err, ErrTrackForwardSameRoom)
+
+	_, err = roomManager.ForwardTrack("unknown", stage.ID(), overflow.ID(), TrackForwardOptions{})
+	require.ErrorIs(t, err, ErrTrackIsNotExists)
+
+	// the tracks of a hidden client stay private to its room
+	agent, err := stage.AddVirtualPublisher("agent", VirtualPublisherOptions{Hidden: true})
+	require.NoError(t, err)
+
+	_, err = agent.NewTrack("agent-audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+
+	_, err = roomManager.ForwardTrack("agent-audio", stage.ID(), overflow.ID(), TrackForwardOptions{})
+	require.ErrorIs(t, err, ErrTrackForwardHidden)
+
+	forward, err := roomManager.ForwardTrack("keynote-audio", stage.ID(), overflow.ID(), TrackForwardOptions{})
+	require.NoError(t, err)
+
+	_, err = roomManager.ForwardTrack("keynote-audio", stage.ID(), overflow.ID(), TrackForwardOptions{})
+	require.ErrorIs(t, err, ErrTrackExists)
+
+	publisher, err := overflow.SFU().GetClient(forward.ID())
+	require.NoError(t, err)
+	require.Equal(t, "keynote", publisher.Name())
+
+	// the listener subscribes the forwarded track from OnTracksAvailable
+	require.Eventually(t, func() bool {
+		_, ok := listener.ClientTracks()["keynote-audio"]
+		return ok
+	}, 10*time.Second, 50*time.Millisecond)
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			if audio.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond}) != nil {
+				return
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		return forward.Stats().PacketsForwarded > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	for _, room := range []*Room{stage, overflow} {
+		stats := room.Stats()
+		require.Len(t, stats.ForwardedTracks, 1)
+		require.Equal(t, forward.ID(), stats.ForwardedTracks[0].ID)
+		require.Equal(t, stage.ID(), stats.ForwardedTracks[0].FromRoomID)
+		require.Equal(t, overflow.ID(), stats.ForwardedTracks[0].ToRoomID)
+	}
+
+	// a closed forward doesn't keep its callbacks on the source track
+	lobby, err := roomManager.NewRoom(roomManager.CreateRoomID(), "lobby", RoomTypeLocal, DefaultRoomOptions())
+	require.NoError(t, err)
+
+	before := trackCallbacks(forward.Track())
+
+	lobbyForward, err := roomManager.ForwardTrack("keynote-audio", stage.ID(), lobby.ID(), TrackForwardOptions{})
+	require.NoError(t, err)
+	require.Equal(t, before+2, trackCallbacks(forward.Track()))
+
+	require.NoError(t, lobbyForward.Close())
+	require.Equal(t, before, trackCallbacks(forward.Track()))
+
+	// the forward ends with the source track
+	require.NoError(t, speaker.Close())
+
+	require.Eventually(t, func() bool {
+		_, subscribed := listener.ClientTracks()["keynote-audio"]
+		_, err := overflow.SFU().GetClient(forward.ID())
+
+		return !subscribed && err == ErrClientNotFound && len(overflow.TrackForwards()) == 0 && len(stage.TrackForwards()) == 0
+	}, 10*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,232 @@
+package sfu
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/samespace/sfu/recorder"
+)
+
+// trackRecording writes the packets of a published track to the recorder.
+// A video recording is started and resumed from a keyframe, the recorder is only created on the first keyframe
+// because the resolution is sent in the track config.
+// When the recording is paused the packets are dropped, the sequence numbers are kept continuous after resume
+// but the timestamps are not, so the paused duration is recorded as a timestamp gap.
+// The recorders that implement recorder.TimelineRecorder also receive the start, pause and resume markers
+// and the sender reports of the track, so the recording can be placed on the room timeline.
+// A rotation is sent as a rotate marker before the next packet, or the next keyframe of a video track,
+// so the new file of the recorder starts decodable.
+type trackRecording struct {
+	mu              sync.Mutex
+	config          recorder.TrackConfig
+	kind            webrtc.RTPCodecType
+	newRecorder     recorder.NewTrackRecorderFunc
+	recorder        recorder.TrackRecorder
+	paused          bool
+	waitKeyframe    bool
+	resync          bool
+	started         bool
+	lastSequence    uint16
+	lastTimestamp   uint32
+	sequenceOffset  uint16
+	rotation        *recorder.Marker
+	requestKeyframe func()
+	log             logging.LeveledLogger
+}
+
+func newTrackRecording(config recorder.TrackConfig, kind webrtc.RTPCodecType, newRecorder recorder.NewTrackRecorderFunc, requestKeyframe func(), log logging.LeveledLogger) (*trackRecording, error) {
+	r := &trackRecording{
+		mu:              sync.Mutex{},
+		config:          config,
+		kind:            kind,
+		newRecorder:     newRecorder,
+		requestKeyframe: requestKeyframe,
+		log:             log,
+	}
+
+	if kind == webrtc.RTPCodecTypeAudio {
+		tr, err := r.newRecorder(&r.config)
+		if err != nil {
+			return nil, err
+		}
+
+		r.recorder = tr
+
+		return r, nil
+	}
+
+	r.waitKeyframe = true
+	r.requestKeyframe()
+
+	return r, nil
+}
+
+func (r *trackRecording) Write(p *rtp.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.paused {
+		return
+	}
+
+	if r.waitKeyframe {
+		if !IsKeyframe(r.config.MimeType, p) {
+			return
+		}
+
+		r.waitKeyframe = false
+
+		if r.recorder == nil {
+			r.config.Width, r.config.Height = KeyframeDimensions(r.config.MimeType, p)
+
+			tr, err := r.newRecorder(&r.config)
+			if err != nil {
+				r.log.Errorf("recording: failed to start recording track %s: %s", r.config.TrackID, err.Error())
+				r.paused = true
+				return
+			}
+
+			r.recorder = tr
+		}
+	}
+
+	if !r.started {
+		r.started = true
+		r.sequenceOffset = 0
+		r.writeMarker(recorder.MarkerStart, p.Timestamp)
+	} else if r.resync {
+		r.sequenceOffset = p.SequenceNumber - r.lastSequence - 1
+		r.writeMarker(recorder.MarkerResume, p.Timestamp)
+	}
+
+	r.resync = false
+
+	if r.rotation != nil && (r.kind == webrtc.RTPCodecTypeAudio || IsKeyframe(r.config.MimeType, p)) {
+		r.rotation.RTPTime = p.Timestamp
+		r.writeTimelineMarker(*r.rotation)
+		r.rotation = nil
+	}
+
+	packet := p.Clone()
+	packet.SequenceNumber = p.SequenceNumber - r.sequenceOffset
+	r.lastSequence = packet.SequenceNumber
+	r.lastTimestamp = packet.Timestamp
+
+	if _, err := r.recorder.WritePacket(packet); err != nil {
+		r.log.Errorf("recording: failed to write packet of track %s: %s", r.config.TrackID, err.Error())
+	}
+}
+
+func (r *trackRecording) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.paused && r.started {
+		r.writeMarker(recorder.MarkerPause, r.lastTimestamp)
+	}
+
+	if r.rotation != nil {
+		// the file is rotated while paused
+		r.writeTimelineMarker(*r.rotation)
+		r.rotation = nil
+	}
+
+	r.paused = true
+}
+
+// SenderReport sends the NTP and RTP timestamp mapping of the RTCP sender report to the recorder
+func (r *trackRecording) SenderReport(ntpTime uint64, rtpTime uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	timeline, ok := r.recorder.(recorder.TimelineRecorder)
+	if !ok || !r.started {
+		return
+	}
+
+	if err := timeline.WriteSenderReport(recorder.SenderReport{NTPTime: ntpTime, RTPTime: rtpTime}); err != nil {
+		r.log.Errorf("recording: failed to write sender report of track %s: %s", r.config.TrackID, err.Error())
+	}
+}
+
+// Mark sends a label marker at the time to the recorder
+func (r *trackRecording) Mark(label string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writeTimelineMarker(recorder.Marker{Type: recorder.MarkerLabel, Time: at, RTPTime: r.lastTimestamp, Label: label})
+}
+
+// Rotate continues the recording in a new file named with the file name
+func (r *trackRecording) Rotate(fileName string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.config.FileName = fileName
+
+	if r.recorder == nil {
+		// the recorder is created with the file name on the first keyframe
+		return
+	}
+
+	marker := recorder.Marker{Type: recorder.MarkerRotate, Time: at, RTPTime: r.lastTimestamp, Label: fileName}
+
+	if r.paused || !r.started {
+		// no packets are written until the file is rotated
+		r.writeTimelineMarker(marker)
+		return
+	}
+
+	r.rotation = &marker
+
+	if r.kind == webrtc.RTPCodecTypeVideo {
+		r.requestKeyframe()
+	}
+}
+
+func (r *trackRecording) writeMarker(markerType recorder.MarkerType, rtpTime uint32) {
+	r.writeTimelineMarker(recorder.Marker{Type: markerType, Time: time.Now(), RTPTime: rtpTime})
+}
+
+func (r *trackRecording) writeTimelineMarker(marker recorder.Marker) {
+	timeline, ok := r.recorder.(recorder.TimelineRecorder)
+	if !ok {
+		return
+	}
+
+	if err := timeline.WriteMarker(marker); err != nil {
+		r.log.Errorf("recording: failed to write %s marker of track %s: %s", marker.Type, r.config.TrackID, err.Error())
+	}
+}
+
+func (r *trackRecording) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.paused {
+		return
+	}
+
+	r.paused = false
+	r.resync = true
+
+	if r.kind == webrtc.RTPCodecTypeVideo {
+		r.waitKeyframe = true
+		r.requestKeyframe()
+	}
+}
+
+func (r *trackRecording) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recorder == nil {
+		// the recording never received a keyframe
+		return nil
+	}
+
+	return r.recorder.Close()
+}
@@ -0,0 +1,234 @@
+package sfu
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/quic-go/quic-go"
+	"github.com/samespace/sfu/recorder"
+	"github.com/stretchr/testify/require"
+)
+
+type testSendStream struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (s *testSendStream) StreamID() quic.StreamID { return 0 }
+
+func (s *testSendStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *testSendStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *testSendStream) CancelWrite(quic.StreamErrorCode) {}
+
+func (s *testSendStream) Context() context.Context { return context.Background() }
+
+func (s *testSendStream) SetWriteDeadline(time.Time) error { return nil }
+
+// frames returns the payloads of the recorder packets written to the stream
+func (s *testSendStream) frames() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.buf.Bytes()
+	frames := make([][]byte, 0)
+
+	for len(data) >= 3 {
+		length := int(binary.BigEndian.Uint16(data[1:]))
+		frames = append(frames, data[3:3+length])
+		data = data[3+length:]
+	}
+
+	return frames
+}
+
+func TestTrackRecordingVideo(t *testing.T) {
+	t.Parallel()
+
+	stream := &testSendStream{}
+	keyframeRequests := 0
+
+	recording, err := newTrackRecording(recorder.TrackConfig{
+		TrackID:  "track",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypeVP8,
+	}, webrtc.RTPCodecTypeVideo, func(conf *recorder.TrackConfig) (recorder.TrackRecorder, error) {
+		return recorder.NewTrackRecorder(conf, stream)
+	}, func() { keyframeRequests++ }, logging.NewDefaultLoggerFactory().NewLogger("sfu"))
+	require.NoError(t, err)
+	require.Equal(t, 1, keyframeRequests)
+
+	keyframe := (&codecs.VP8Payloader{}).Payload(blankFrameMTU, VP8KeyFrame8x8)[0]
+	delta := []byte{0x10, 0x01}
+
+	// delta frame before the keyframe is not recorded
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 10, Timestamp: 1000}, Payload: delta})
+	require.Empty(t, stream.frames())
+
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 11, Timestamp: 4000}, Payload: keyframe})
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 12, Timestamp: 7000}, Payload: delta})
+
+	recording.Pause()
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 13, Timestamp: 10000}, Payload: keyframe})
+
+	recording.Resume()
+	require.Equal(t, 2, keyframeRequests)
+
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 20, Timestamp: 40000}, Payload: delta})
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 21, Timestamp: 43000}, Payload: keyframe})
+
+	frames := stream.frames()
+	require.Len(t, frames, 4)
+
+	config := recorder.TrackConfig{}
+	require.NoError(t, json.Unmarshal(frames[0], &config))
+	require.Equal(t, webrtc.MimeTypeVP8, config.MimeType)
+	require.Equal(t, uint32(8), config.Width)
+	require.Equal(t, uint32(8), config.Height)
+
+	expected := []struct {
+		seq uint16
+		ts  uint32
+	}{{11, 4000}, {12, 7000}, {13, 43000}}
+
+	for i, e := range expected {
+		p := &rtp.Packet{}
+		require.NoError(t, p.Unmarshal(frames[i+1]))
+		require.Equal(t, e.seq, p.SequenceNumber)
+		require.Equal(t, e.ts, p.Timestamp)
+	}
+
+	require.NoError(t, recording.Close())
+	require.True(t, stream.closed)
+}
+
+type testTimelineRecorder struct {
+	packets []*rtp.Packet
+	markers []recorder.Marker
+	reports []recorder.SenderReport
+}
+
+func (r *testTimelineRecorder) Write(data []byte) (int, error) { return len(data), nil }
+
+func (r *testTimelineRecorder) WritePacket(packet *rtp.Packet) (int, error) {
+	r.packets = append(r.packets, packet)
+	return 0, nil
+}
+
+func (r *testTimelineRecorder) Close() error { return nil }
+
+func (r *testTimelineRecorder) WriteSenderReport(report recorder.SenderReport) error {
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+func (r *testTimelineRecorder) WriteMarker(marker recorder.Marker) error {
+	r.markers = append(r.markers, marker)
+	return nil
+}
+
+func TestTrackRecordingMarkers(t *testing.T) {
+	t.Parallel()
+
+	tr := &testTimelineRecorder{}
+
+	recording, err := newTrackRecording(recorder.TrackConfig{
+		TrackID:  "track",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypeOpus,
+	}, webrtc.RTPCodecTypeAudio, func(conf *recorder.TrackConfig) (recorder.TrackRecorder, error) {
+		return tr, nil
+	}, func() {}, logging.NewDefaultLoggerFactory().NewLogger("sfu"))
+	require.NoError(t, err)
+
+	// the sender report before the first packet is not sent
+	recording.SenderReport(1, 100)
+
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 1, Timestamp: 960}, Payload: []byte{0xfc}})
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 2, Timestamp: 1920}, Payload: []byte{0xfc}})
+	recording.SenderReport(2, 1920)
+
+	recording.Pause()
+	recording.Pause()
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 3, Timestamp: 2880}, Payload: []byte{0xfc}})
+
+	recording.Resume()
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 10, Timestamp: 9600}, Payload: []byte{0xfc}})
+
+	require.Len(t, tr.packets, 3)
+	require.Equal(t, []recorder.SenderReport{{NTPTime: 2, RTPTime: 1920}}, tr.reports)
+
+	require.Len(t, tr.markers, 3)
+
+	expected := []struct {
+		markerType recorder.MarkerType
+		rtpTime    uint32
+	}{{recorder.MarkerStart, 960}, {recorder.MarkerPause, 1920}, {recorder.MarkerResume, 9600}}
+
+	for i, e := range expected {
+		require.Equal(t, e.markerType, tr.markers[i].Type)
+		require.Equal(t, e.rtpTime, tr.markers[i].RTPTime)
+		require.False(t, tr.markers[i].Time.IsZero())
+	}
+}
+
+func TestTrackRecordingRotate(t *testing.T) {
+	t.Parallel()
+
+	tr := &testTimelineRecorder{}
+	keyframeRequests := 0
+
+	recording, err := newTrackRecording(recorder.TrackConfig{
+		TrackID:  "track",
+		ClientID: "client",
+		RoomID:   "room",
+		MimeType: webrtc.MimeTypeVP8,
+	}, webrtc.RTPCodecTypeVideo, func(conf *recorder.TrackConfig) (recorder.TrackRecorder, error) {
+		return tr, nil
+	}, func() { keyframeRequests++ }, logging.NewDefaultLoggerFactory().NewLogger("sfu"))
+	require.NoError(t, err)
+
+	keyframe := (&codecs.VP8Payloader{}).Payload(blankFrameMTU, VP8KeyFrame8x8)[0]
+	delta := []byte{0x10, 0x01}
+
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 1, Timestamp: 3000}, Payload: keyframe})
+
+	at := time.Now()
+	recording.Mark("consent", at)
+	recording.Rotate("transfer", at)
+	require.Equal(t, 2, keyframeRequests)
+
+	// the file is rotated on the next keyframe, the delta frame is written to the current file
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 2, Timestamp: 6000}, Payload: delta})
+	require.Len(t, tr.markers, 2)
+
+	recording.Write(&rtp.Packet{Header: rtp.Header{SequenceNumber: 3, Timestamp: 9000}, Payload: keyframe})
+	require.Len(t, tr.packets, 3)
+	require.Len(t, tr.markers, 3)
+
+	require.Equal(t, recorder.Marker{Type: recorder.MarkerLabel, Time: at, RTPTime: 3000, Label: "consent"}, tr.markers[1])
+	require.Equal(t, recorder.Marker{Type: recorder.MarkerRotate, Time: at, RTPTime: 9000, Label: "transfer"}, tr.markers[2])
+	require.Equal(t, "transfer", recording.config.FileName)
+}
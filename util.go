@@ -2,9 +2,8 @@ package sfu
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/binary"
 	"errors"
 	"flag"
 	"log"
@@ -21,7 +20,6 @@ import (
 	"github.com/pion/sdp/v4"
 	"github.com/pion/turn/v4"
 	"github.com/pion/webrtc/v4"
-	"github.com/samespace/sfu/recorder"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
@@ -346,11 +344,229 @@ func KeyframeDimensions(codec string, packet *rtp.Packet) (uint32, uint32) {
 			}
 		}
 		return w, h
+	} else if strings.EqualFold(codec, "video/h264") {
+		if packet == nil {
+			return 0, 0
+		}
+
+		sps := h264SPS(packet.Payload)
+		if sps == nil {
+			return 0, 0
+		}
+
+		return h264SPSDimensions(sps)
 	} else {
 		return 0, 0
 	}
 }
 
+// h264SPS returns the SPS NAL unit in the packet payload, or nil if the packet doesn't contain it.
+func h264SPS(payload []byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+
+	nalu := payload[0] & 0x1F
+	switch {
+	case nalu == 7:
+		return payload
+	case nalu == 24:
+		// STAP-A
+		for i := 1; i+2 <= len(payload); {
+			length := int(binary.BigEndian.Uint16(payload[i:]))
+			i += 2
+			if length == 0 || i+length > len(payload) {
+				return nil
+			}
+
+			if payload[i]&0x1F == 7 {
+				return payload[i : i+length]
+			}
+
+			i += length
+		}
+	case nalu == 28:
+		// FU-A, the start fragment is enough to read the picture size
+		if len(payload) < 2 || payload[1]&0x80 == 0 || payload[1]&0x1F != 7 {
+			return nil
+		}
+
+		return append([]byte{payload[0]&0xE0 | 7}, payload[2:]...)
+	}
+
+	return nil
+}
+
+// h264SPSDimensions reads the cropped picture size from a H264 SPS NAL unit, see ITU-T H.264 7.3.2.1.1
+func h264SPSDimensions(sps []byte) (uint32, uint32) {
+	// remove the emulation prevention bytes
+	rbsp := make([]byte, 0, len(sps))
+	for i := 0; i < len(sps); i++ {
+		if i >= 2 && sps[i] == 0x03 && sps[i-1] == 0x00 && sps[i-2] == 0x00 {
+			continue
+		}
+		rbsp = append(rbsp, sps[i])
+	}
+
+	r := &bitReader{data: rbsp, pos: 8} // skip the NAL header
+
+	profileIdc := r.readBits(8)
+	r.readBits(16) // constraint flags and level
+	r.readUE()     // seq_parameter_set_id
+
+	chromaFormatIdc := uint32(1)
+	separateColourPlane := uint32(0)
+
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormatIdc = r.readUE()
+		if chromaFormatIdc == 3 {
+			separateColourPlane = r.readBits(1)
+		}
+
+		r.readUE()    // bit_depth_luma_minus8
+		r.readUE()    // bit_depth_chroma_minus8
+		r.readBits(1) // qpprime_y_zero_transform_bypass_flag
+
+		if r.readBits(1) == 1 {
+			// seq_scaling_matrix_present_flag
+			count := 8
+			if chromaFormatIdc == 3 {
+				count = 12
+			}
+
+			for i := 0; i < count; i++ {
+				if r.readBits(1) == 0 {
+					continue
+				}
+
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+
+				lastScale, nextScale := int32(8), int32(8)
+				for j := 0; j < size; j++ {
+					if nextScale != 0 {
+						nextScale = (lastScale + r.readSE() + 256) % 256
+					}
+
+					if nextScale != 0 {
+						lastScale = nextScale
+					}
+				}
+			}
+		}
+	}
+
+	r.readUE() // log2_max_frame_num_minus4
+
+	switch r.readUE() {
+	// pic_order_cnt_type
+	case 0:
+		r.readUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.readBits(1) // delta_pic_order_always_zero_flag
+		r.readSE()    // offset_for_non_ref_pic
+		r.readSE()    // offset_for_top_to_bottom_field
+		for n := r.readUE(); n > 0 && r.err == nil; n-- {
+			r.readSE() // offset_for_ref_frame
+		}
+	}
+
+	r.readUE()    // max_num_ref_frames
+	r.readBits(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthInMbs := r.readUE() + 1
+	heightInMapUnits := r.readUE() + 1
+	frameMbsOnly := r.readBits(1)
+
+	if frameMbsOnly == 0 {
+		r.readBits(1) // mb_adaptive_frame_field_flag
+	}
+
+	r.readBits(1) // direct_8x8_inference_flag
+
+	width := widthInMbs * 16
+	height := (2 - frameMbsOnly) * heightInMapUnits * 16
+
+	if r.readBits(1) == 1 {
+		// frame_cropping_flag
+		left, right, top, bottom := r.readUE(), r.readUE(), r.readUE(), r.readUE()
+
+		cropUnitX, cropUnitY := uint32(1), 2-frameMbsOnly
+		if separateColourPlane == 0 && chromaFormatIdc != 0 {
+			subWidthC, subHeightC := uint32(2), uint32(2)
+			if chromaFormatIdc == 2 {
+				subHeightC = 1
+			} else if chromaFormatIdc == 3 {
+				subWidthC, subHeightC = 1, 1
+			}
+
+			cropUnitX = subWidthC
+			cropUnitY = subHeightC * (2 - frameMbsOnly)
+		}
+
+		if (left+right)*cropUnitX < width && (top+bottom)*cropUnitY < height {
+			width -= (left + right) * cropUnitX
+			height -= (top + bottom) * cropUnitY
+		}
+	}
+
+	if r.err != nil {
+		return 0, 0
+	}
+
+	return width, height
+}
+
+// bitReader reads the bits and the Exp-Golomb codes of a H264 RBSP
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+var errBitReaderEOF = errors.New("bitreader: not enough data")
+
+func (r *bitReader) readBits(n int) uint32 {
+	var v uint32
+
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errBitReaderEOF
+			return 0
+		}
+
+		v = v<<1 | uint32(r.data[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+
+	return v
+}
+
+func (r *bitReader) readUE() uint32 {
+	leadingZeros := 0
+	for r.readBits(1) == 0 {
+		if r.err != nil || leadingZeros >= 31 {
+			r.err = errBitReaderEOF
+			return 0
+		}
+		leadingZeros++
+	}
+
+	return (1 << leadingZeros) - 1 + r.readBits(leadingZeros)
+}
+
+func (r *bitReader) readSE() int32 {
+	v := r.readUE()
+	if v%2 == 1 {
+		return int32((v + 1) / 2)
+	}
+
+	return -int32(v / 2)
+}
+
 func StartTurnServer(ctx context.Context, publicIP string) *turn.Server {
 	port := 3478
 	users := "user=pass"
@@ -531,14 +747,3 @@ func copyRTPPacket(packet *rtp.Packet) *rtp.Packet {
 	copy(newPacket.Payload, packet.Payload)
 	return newPacket
 }
-
-func serializeCloseDatagram(cfg recorder.StopConfig) []byte {
-	var buf bytes.Buffer
-	buf.Write([]byte("close"))
-	j, err := json.Marshal(cfg)
-	if err != nil {
-		return nil
-	}
-	buf.Write(j)
-	return buf.Bytes()
-}
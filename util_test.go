@@ -0,0 +1,37 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyframeDimensions(t *testing.T) {
+	t.Parallel()
+
+	vp8Payloads := (&codecs.VP8Payloader{}).Payload(blankFrameMTU, VP8KeyFrame8x8)
+	require.NotEmpty(t, vp8Payloads)
+
+	width, height := KeyframeDimensions(webrtc.MimeTypeVP8, &rtp.Packet{Payload: vp8Payloads[0]})
+	require.Equal(t, uint32(8), width)
+	require.Equal(t, uint32(8), height)
+
+	width, height = KeyframeDimensions(webrtc.MimeTypeH264, &rtp.Packet{Payload: getH264BlankFrame()})
+	require.Equal(t, uint32(2), width)
+	require.Equal(t, uint32(2), height)
+
+	// 1280x720 high profile SPS
+	sps := []byte{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60}
+	width, height = KeyframeDimensions(webrtc.MimeTypeH264, &rtp.Packet{Payload: sps})
+	require.Equal(t, uint32(1280), width)
+	require.Equal(t, uint32(720), height)
+
+	// 1920x1080 high profile SPS, coded as 1920x1088 with frame cropping
+	sps = []byte{0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0, 0x44, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc6, 0x58}
+	width, height = KeyframeDimensions(webrtc.MimeTypeH264, &rtp.Packet{Payload: sps})
+	require.Equal(t, uint32(1920), width)
+	require.Equal(t, uint32(1080), height)
+}
@@ -0,0 +1,406 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/samespace/sfu/recorder"
+)
+
+const (
+	virtualTrackMTU    = 1200
+	virtualTrackBuffer = 256
+)
+
+var (
+	ErrVirtualPublisherClosed = errors.New("virtualpublisher: publisher is closed")
+	ErrVirtualTrackClosed     = errors.New("virtualpublisher: track is closed")
+	ErrVirtualTrackCodec      = errors.New("virtualpublisher: codec is not supported")
+)
+
+type VirtualPublisherOptions struct {
+	// The name of the publisher that is seen by the other clients
+	Name string
+	// The channel of the publisher in the stereo layout of the room recording
+	Channel recorder.Channel
+	// The role of the publisher in the role layout of the room recording
+	RecordingRole string
+	// The publisher is not seen by the other clients, see ClientOptions.Hidden
+	Hidden bool
+}
+
+// VirtualPublisher publishes tracks that are written from Go code, like a bot or a server side media source.
+// The publisher is a client of the room without a peer connection, its tracks are seen by the other clients
+// and the room recording the same way as the tracks of a browser client.
+type VirtualPublisher struct {
+	mu     sync.Mutex
+	room   *Room
+	client *Client
+	tracks map[string]*VirtualTrack
+	closed bool
+}
+
+// AddVirtualPublisher adds a publisher to the room that is joined immediately, the tracks created
+// with the publisher are available to the other clients once they're created.
+func (r *Room) AddVirtualPublisher(id string, opts VirtualPublisherOptions) (*VirtualPublisher, error) {
+	if r.state == StateRoomClosed {
+		return nil, ErrRoomIsClosed
+	}
+
+	for _, ext := range r.extensions {
+		if err := ext.OnBeforeClientAdded(r, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if client, _ := r.sfu.GetClient(id); client != nil {
+		return nil, ErrClientExists
+	}
+
+	clientOpts := DefaultClientOptions()
+	clientOpts.Type = ClientTypeVirtual
+	clientOpts.EnableVoiceDetection = false
+	clientOpts.EnablePlayoutDelay = false
+	clientOpts.Channel = opts.Channel
+	clientOpts.RecordingRole = opts.RecordingRole
+	clientOpts.Hidden = opts.Hidden
+
+	client := r.sfu.NewClient(id, opts.Name, clientOpts)
+	client.roomId.Store(r.id)
+
+	client.OnJoined(func() {
+		r.onClientJoined(client)
+	})
+
+	client.state.Store(ClientStateActive)
+	client.onJoined()
+
+	return &VirtualPublisher{
+		mu:     sync.Mutex{},
+		room:   r,
+		client: client,
+		tracks: make(map[string]*VirtualTrack),
+	}, nil
+}
+
+func (p *VirtualPublisher) ID() string {
+	return p.client.ID()
+}
+
+// Client returns the client of the publisher in the room
+func (p *VirtualPublisher) Client() *Client {
+	return p.client
+}
+
+// NewTrack creates a track with one of the codecs of the SFU like webrtc.MimeTypeOpus, webrtc.MimeTypePCMU,
+// webrtc.MimeTypeVP8 or webrtc.MimeTypeH264, the stream ID is the publisher ID when it's empty.
+// The track is published to the other clients and recorded when the room is recorded.
+func (p *VirtualPublisher) NewTrack(trackID, streamID, mimeType string) (*VirtualTrack, error) {
+	return p.newTrack(trackID, streamID, mimeType, true)
+}
+
+// newTrack creates a track that is published like the track of a remote client, an unpublished track is not seen
+// by the other clients and the recording, it's only sent to the clients that are subscribed with Client.subscribeTracks.
+func (p *VirtualPublisher) newTrack(trackID, streamID, mimeType string, publish bool) (*VirtualTrack, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrVirtualPublisherClosed
+	}
+
+	if _, ok := p.tracks[trackID]; ok {
+		return nil, ErrTrackExists
+	}
+
+	if streamID == "" {
+		streamID = p.client.ID()
+	}
+
+	vt, err := newVirtualTrack(p.client.Context(), trackID, streamID, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	track, err := newTrack(p.client.Context(), p.client, vt, 0, 0, p.client.SFU().PLIInterval(), vt.onPLI, nil, nil)
+	if err != nil {
+		vt.Close()
+		return nil, err
+	}
+
+	vt.track = track
+
+	track.OnEnded(func() {
+		p.client.tracks.remove([]string{trackID})
+
+		p.mu.Lock()
+		delete(p.tracks, trackID)
+		p.mu.Unlock()
+	})
+
+	track.SetSourceType(TrackTypeMedia)
+	track.SetAsProcessed()
+
+	p.tracks[trackID] = vt
+
+	if !publish {
+		return vt, nil
+	}
+
+	if err := p.client.tracks.Add(track); err != nil {
+		vt.Close()
+		return nil, err
+	}
+
+	if newRecorder := p.room.trackRecorder(); newRecorder != nil && p.client.isRecording.Load() {
+		if p.client.isRecordingPaused.Load() {
+			track.PauseRecording()
+		}
+
+		if err := track.StartRecording(newRecorder); err != nil {
+			p.client.log.Errorf("virtualpublisher: failed to record track %s: %s", trackID, err.Error())
+		}
+	}
+
+	p.client.SFU().onTracksAvailable(p.client.ID(), []ITrack{track})
+
+	return vt, nil
+}
+
+// Tracks returns the tracks of the publisher that are not closed
+func (p *VirtualPublisher) Tracks() []*VirtualTrack {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tracks := make([]*VirtualTrack, 0, len(p.tracks))
+	for _, track := range p.tracks {
+		tracks = append(tracks, track)
+	}
+
+	return tracks
+}
+
+// Close ends the tracks of the publisher and removes it from the room
+func (p *VirtualPublisher) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+
+	p.closed = true
+	tracks := make([]*VirtualTrack, 0, len(p.tracks))
+	for _, track := range p.tracks {
+		tracks = append(tracks, track)
+	}
+	p.mu.Unlock()
+
+	for _, track := range tracks {
+		track.Close()
+	}
+
+	return p.client.stop()
+}
+
+// VirtualTrack is a track of a VirtualPublisher, the packets are read by the SFU like the packets of a remote track.
+// A track is written either with RTP packets or with media samples, mixing both breaks the sequence numbers.
+type VirtualTrack struct {
+	mu                 sync.Mutex
+	context            context.Context
+	cancel             context.CancelFunc
+	id                 string
+	streamID           string
+	kind               webrtc.RTPCodecType
+	codec              webrtc.RTPCodecParameters
+	ssrc               webrtc.SSRC
+	packets            chan *rtp.Packet
+	packetizer         rtp.Packetizer
+	deadline           time.Time
+	track              ITrack
+	onKeyframeRequests []func()
+}
+
+func newVirtualTrack(ctx context.Context, id, streamID, mimeType string) (*VirtualTrack, error) {
+	codec := getRTPParameters(mimeType)
+	if codec.MimeType == "" {
+		return nil, ErrVirtualTrackCodec
+	}
+
+	payloader, err := payloaderForCodec(codec.RTPCodecCapability)
+	if err != nil {
+		return nil, ErrVirtualTrackCodec
+	}
+
+	kind := webrtc.RTPCodecTypeVideo
+	if strings.HasPrefix(strings.ToLower(mimeType), "audio/") {
+		kind = webrtc.RTPCodecTypeAudio
+	}
+
+	ssrc := webrtc.SSRC(rand.Uint32())
+
+	localCtx, cancel := context.WithCancel(ctx)
+
+	return &VirtualTrack{
+		mu:         sync.Mutex{},
+		context:    localCtx,
+		cancel:     cancel,
+		id:         id,
+		streamID:   streamID,
+		kind:       kind,
+		codec:      codec,
+		ssrc:       ssrc,
+		packets:    make(chan *rtp.Packet, virtualTrackBuffer),
+		packetizer: rtp.NewPacketizer(virtualTrackMTU, uint8(codec.PayloadType), uint32(ssrc), payloader, rtp.NewRandomSequencer(), codec.ClockRate),
+	}, nil
+}
+
+// WriteRTP writes a packet to the track, the SSRC and the payload type are replaced with the track values.
+// It blocks when the subscribers are slower than the writer until the track is closed.
+func (t *VirtualTrack) WriteRTP(p *rtp.Packet) error {
+	if t.context.Err() != nil {
+		return ErrVirtualTrackClosed
+	}
+
+	packet := p.Clone()
+	packet.SSRC = uint32(t.ssrc)
+	packet.PayloadType = uint8(t.codec.PayloadType)
+
+	select {
+	case <-t.context.Done():
+		return ErrVirtualTrackClosed
+	case t.packets <- packet:
+		return nil
+	}
+}
+
+// WriteSample packetizes the sample with the codec of the track, the duration is used for the timestamp of the next sample
+func (t *VirtualTrack) WriteSample(sample media.Sample) error {
+	samples := uint32(sample.Duration.Seconds() * float64(t.codec.ClockRate))
+
+	t.mu.Lock()
+	if sample.PrevDroppedPackets > 0 {
+		t.packetizer.SkipSamples(samples * uint32(sample.PrevDroppedPackets))
+	}
+	packets := t.packetizer.Packetize(sample.Data, samples)
+	t.mu.Unlock()
+
+	for _, p := range packets {
+		if err := t.WriteRTP(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnKeyframeRequest is called when a subscriber or the recording needs a keyframe of a video track
+func (t *VirtualTrack) OnKeyframeRequest(callback func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onKeyframeRequests = append(t.onKeyframeRequests, callback)
+}
+
+func (t *VirtualTrack) onPLI() {
+	t.mu.Lock()
+	callbacks := t.onKeyframeRequests
+	t.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+// Track returns the published track
+func (t *VirtualTrack) Track() ITrack {
+	return t.track
+}
+
+// Close ends the track, the subscribers are removed from the track the same way as when a remote track is ended
+func (t *VirtualTrack) Close() {
+	t.cancel()
+}
+
+func (t *VirtualTrack) ID() string {
+	return t.id
+}
+
+func (t *VirtualTrack) RID() string {
+	return ""
+}
+
+func (t *VirtualTrack) PayloadType() webrtc.PayloadType {
+	return t.codec.PayloadType
+}
+
+func (t *VirtualTrack) Kind() webrtc.RTPCodecType {
+	return t.kind
+}
+
+func (t *VirtualTrack) StreamID() string {
+	return t.streamID
+}
+
+func (t *VirtualTrack) SSRC() webrtc.SSRC {
+	return t.ssrc
+}
+
+func (t *VirtualTrack) Msid() string {
+	return t.streamID + " " + t.id
+}
+
+func (t *VirtualTrack) Codec() webrtc.RTPCodecParameters {
+	return t.codec
+}
+
+// Read reads the next written packet, it returns io.EOF when the track is closed
+// and zero bytes when the read deadline is reached.
+func (t *VirtualTrack) Read(b []byte) (n int, attributes interceptor.Attributes, err error) {
+	t.mu.Lock()
+	deadline := t.deadline
+	t.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-t.context.Done():
+		return 0, nil, io.EOF
+	case <-timeout:
+		return 0, nil, nil
+	case p := <-t.packets:
+		n, err = p.MarshalTo(b)
+		return n, nil, err
+	}
+}
+
+func (t *VirtualTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	select {
+	case <-t.context.Done():
+		return nil, nil, io.EOF
+	case p := <-t.packets:
+		return p, nil, nil
+	}
+}
+
+func (t *VirtualTrack) SetReadDeadline(deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.deadline = deadline
+
+	return nil
+}
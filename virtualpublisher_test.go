@@ -0,0 +1,94 @@
+package sfu
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/samespace/sfu/recorder"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualPublisher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roomManager := NewManager(ctx, "test", sfuOpts)
+	defer roomManager.Close()
+
+	dir := t.TempDir()
+	roomOpts := DefaultRoomOptions()
+	roomOpts.LocalRecorderConfig = &recorder.FileConfig{Directory: dir}
+	testRoom, err := roomManager.NewRoom(roomManager.CreateRoomID(), "test-room", RoomTypeLocal, roomOpts)
+	require.NoError(t, err)
+
+	left := make(chan string, 1)
+	testRoom.OnClientLeft(func(client *Client) {
+		left <- client.ID()
+	})
+
+	require.NoError(t, testRoom.StartRecording("bucket", "call"))
+
+	publisher, err := testRoom.AddVirtualPublisher("bot", VirtualPublisherOptions{Name: "Bot"})
+	require.NoError(t, err)
+
+	_, err = testRoom.AddVirtualPublisher("bot", VirtualPublisherOptions{})
+	require.ErrorIs(t, err, ErrClientExists)
+
+	_, err = publisher.NewTrack("text", "", "text/plain")
+	require.ErrorIs(t, err, ErrVirtualTrackCodec)
+
+	audio, err := publisher.NewTrack("audio", "", webrtc.MimeTypeOpus)
+	require.NoError(t, err)
+	require.Equal(t, webrtc.RTPCodecTypeAudio, audio.Track().Kind())
+	require.Equal(t, "bot", audio.Track().ClientID())
+
+	client, err := testRoom.SFU().GetClient("bot")
+	require.NoError(t, err)
+	require.Equal(t, ClientTypeVirtual, client.Type())
+	require.Len(t, client.Tracks(), 1)
+
+	var read atomic.Int32
+	var lastSSRC atomic.Uint32
+	audio.Track().OnRead(func(p *rtp.Packet, _ QualityLevel) {
+		read.Add(1)
+		lastSSRC.Store(p.SSRC)
+	})
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, audio.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond}))
+	}
+
+	require.NoError(t, audio.WriteRTP(&rtp.Packet{
+		Header:  rtp.Header{Version: 2, SSRC: 1234, PayloadType: 1, SequenceNumber: 1, Timestamp: 1},
+		Payload: []byte{0xf8, 0xff, 0xfe},
+	}))
+
+	require.Eventually(t, func() bool { return read.Load() == 11 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, uint32(audio.SSRC()), lastSSRC.Load())
+
+	testRoom.StopRecording(recorder.StopConfig{})
+
+	stat, err := os.Stat(filepath.Join(dir, "bucket", "call_bot_audio.ogg"))
+	require.NoError(t, err)
+	require.Greater(t, stat.Size(), int64(0))
+
+	require.NoError(t, publisher.Close())
+	require.ErrorIs(t, audio.WriteRTP(&rtp.Packet{}), ErrVirtualTrackClosed)
+
+	_, err = publisher.NewTrack("video", "", webrtc.MimeTypeVP8)
+	require.ErrorIs(t, err, ErrVirtualPublisherClosed)
+
+	select {
+	case id := <-left:
+		require.Equal(t, "bot", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the publisher to leave")
+	}
+}